@@ -5,10 +5,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
+	_ "time/tzdata" // zonas de los providers aunque la imagen no traiga tzdata
 
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
 	"github.com/alvgonz/hvac-saas-api/internal/db"
 	"github.com/alvgonz/hvac-saas-api/internal/httpapi"
+	"github.com/alvgonz/hvac-saas-api/internal/jobs"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
 )
 
 func main() {
@@ -17,18 +24,88 @@ func main() {
 		log.Fatal("DATABASE_URL is required")
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET is required")
+	// JWT: con JWT_KEYS_FILE firmamos con claves asimétricas (RS256/EdDSA) y
+	// publicamos el JWKS; JWT_SECRET (HS256) queda como modo simple para local.
+	jwtIssuer := os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "hvac-saas-api"
+	}
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "hvac-saas-api"
+	}
+
+	var keys *auth.KeySet
+	if keysFile := os.Getenv("JWT_KEYS_FILE"); keysFile != "" {
+		ks, err := auth.LoadKeySet(keysFile, jwtIssuer, jwtAudience)
+		if err != nil {
+			log.Fatalf("jwt keys error: %v", err)
+		}
+		keys = ks
+	} else {
+		jwtSecret := os.Getenv("JWT_SECRET")
+		if jwtSecret == "" {
+			log.Fatal("JWT_KEYS_FILE or JWT_SECRET is required")
+		}
+		log.Println("JWT_KEYS_FILE not set, signing tokens with HS256 (JWT_SECRET)")
+		keys = auth.NewHMACKeySet([]byte(jwtSecret), jwtIssuer, jwtAudience)
+	}
+
+	// FRONTEND_URL arma los links de los mails (reset, invitaciones): en
+	// producción un fallback a localhost mandaría links rotos sin avisar.
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		if strings.ToLower(os.Getenv("ENV")) == "production" {
+			log.Fatal("FRONTEND_URL is required with ENV=production")
+		}
+		frontendURL = "http://localhost:3000" // local fallback
+	}
+
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatalf("mailer config error: %v", err)
+	}
+
+	// Adjuntos: disco local (default) o S3 / compatible (STORAGE_DRIVER=s3)
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("storage config error: %v", err)
+	}
+	publicURL := os.Getenv("PUBLIC_API_URL") // "" => links relativos (/files/...)
+
+	// Links de descarga de adjuntos: firmados con DOWNLOAD_SECRET (o JWT_SECRET).
+	downloadSecret := os.Getenv("DOWNLOAD_SECRET")
+	if downloadSecret == "" {
+		downloadSecret = os.Getenv("JWT_SECRET")
+	}
+	var downloads *auth.DownloadSigner
+	if downloadSecret != "" {
+		downloads = &auth.DownloadSigner{Secret: []byte(downloadSecret)}
+	} else {
+		log.Println("DOWNLOAD_SECRET not set, attachment downloads disabled")
+	}
+
+	// Rol sin privilegios con el que corren las queries (RLS). DB_APP_ROLE="" lo desactiva.
+	appRole, ok := os.LookupEnv("DB_APP_ROLE")
+	if !ok {
+		appRole = "hvac_app"
+	}
+
+	// Rol BYPASSRLS de los procesos sin tenant (db.WithSystem); hvac_app es miembro.
+	systemRole, ok := os.LookupEnv("DB_SYSTEM_ROLE")
+	if !ok {
+		systemRole = "hvac_system"
 	}
-	secret := []byte(jwtSecret)
 
-	database, err := db.New(dsn)
+	database, err := db.New(dsn, appRole, systemRole)
 	if err != nil {
 		log.Fatalf("db connection error: %v", err)
 	}
 	defer database.Pool.Close()
 
+	// Fotos: metadata, miniaturas y duplicados en segundo plano (ver Background jobs)
+	photos := jobs.NewPhotoProcessor(database, store, time.Minute)
+
 	mux := http.NewServeMux()
 
 	// =========================
@@ -49,36 +126,264 @@ func main() {
 	// =========================
 	// Auth
 	// =========================
+	httpapi.TrustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+
+	// Throttling de login: en memoria para una instancia, en Postgres si hay réplicas.
+	var throttleStore throttle.Store = throttle.NewMemoryStore()
+	if os.Getenv("THROTTLE_STORE") == "postgres" {
+		throttleStore = &throttle.PostgresStore{DB: database.Pool}
+	}
+	loginGuard := &httpapi.LoginGuard{
+		DB: database,
+		// por cuenta: 5 fallos libres, luego 30s, 1m, 2m... hasta 15m
+		Account: &throttle.Limiter{Store: throttleStore, Policy: throttle.Policy{
+			FreeAttempts: 5,
+			BaseDelay:    30 * time.Second,
+			MaxDelay:     15 * time.Minute,
+			Window:       time.Hour,
+		}},
+		// por IP: más margen (oficinas/NAT comparten IP)
+		IP: &throttle.Limiter{Store: throttleStore, Policy: throttle.Policy{
+			FreeAttempts: 20,
+			BaseDelay:    10 * time.Second,
+			MaxDelay:     15 * time.Minute,
+			Window:       time.Hour,
+		}},
+	}
+
 	authHandler := &httpapi.AuthHandler{
-		DB:        database.Pool,
-		JWTSecret: secret,
+		DB:    database,
+		Keys:  keys,
+		Guard: loginGuard,
+	}
+	authn := &httpapi.Authenticator{
+		DB:   database,
+		Keys: keys,
 	}
+	// JWKS (público): claves para verificar nuestros JWT
+	mux.Handle("/.well-known/jwks.json", &httpapi.JWKSHandler{Keys: keys})
+
 	mux.HandleFunc("/auth/login", authHandler.Login)
-	mux.Handle("/me", httpapi.AuthMiddleware(secret, http.HandlerFunc(httpapi.Me)))
+	mux.HandleFunc("/auth/refresh", authHandler.Refresh)
+	mux.Handle("/auth/logout", authn.Middleware(http.HandlerFunc(authHandler.Logout)))
+	mux.Handle("/me", authn.Middleware(http.HandlerFunc(httpapi.Me)))
+
+	// MFA (TOTP)
+	mfaIssuer := os.Getenv("MFA_ISSUER")
+	if mfaIssuer == "" {
+		mfaIssuer = "HVAC"
+	}
+	mfaHandler := &httpapi.MFAHandler{
+		DB:     database,
+		Keys:   keys,
+		Issuer: mfaIssuer,
+		Guard:  loginGuard,
+	}
+	// POST /auth/mfa/verify | /auth/mfa/enroll | /auth/mfa/enroll/confirm (con mfa_token)
+	mux.HandleFunc("/auth/mfa/", mfaHandler.Auth)
+	// POST /me/mfa/enroll | confirm | recovery-codes | disable
+	mux.Handle("/me/mfa/", authn.Middleware(http.HandlerFunc(mfaHandler.Me)))
+	// GET/PUT /mfa/policy (admin)
+	mux.Handle("/mfa/policy", authn.Middleware(http.HandlerFunc(mfaHandler.Policy)))
+
+	// Roles propios y permisos: GET/POST /roles, GET/PUT/DELETE /roles/{id}, GET /permissions
+	rolesHandler := &httpapi.RolesHandler{DB: database}
+	mux.Handle("/roles", authn.Middleware(http.HandlerFunc(rolesHandler.Collection)))
+	mux.Handle("/roles/", authn.Middleware(http.HandlerFunc(rolesHandler.Item)))
+	mux.Handle("/permissions", authn.Middleware(http.HandlerFunc(httpapi.Permissions)))
 
-	// Set password (public)
-	pwdHandler := &httpapi.PasswordHandler{DB: database.Pool}
+	// API keys (admin): GET/POST /api-keys, POST /api-keys/{id}/revoke
+	apiKeysHandler := &httpapi.APIKeysHandler{DB: database}
+	mux.Handle("/api-keys", authn.Middleware(http.HandlerFunc(apiKeysHandler.Collection)))
+	mux.Handle("/api-keys/", authn.Middleware(http.HandlerFunc(apiKeysHandler.Item)))
+
+	// Configuración del provider: GET/PATCH /settings, GET/PUT/DELETE /settings/logo
+	settingsHandler := &httpapi.SettingsHandler{DB: database}
+	mux.Handle("/settings", authn.Middleware(http.HandlerFunc(settingsHandler.Settings)))
+	mux.Handle("/settings/logo", authn.Middleware(http.HandlerFunc(settingsHandler.Logo)))
+
+	// GET /login-attempts (admin)
+	attemptsHandler := &httpapi.LoginAttemptsHandler{DB: database}
+	mux.Handle("/login-attempts", authn.Middleware(http.HandlerFunc(attemptsHandler.List)))
+
+	// Set / reset password (public)
+	pwdHandler := &httpapi.PasswordHandler{
+		DB:          database,
+		Mailer:      mail,
+		FrontendURL: frontendURL,
+		// forgot-password, cada pedido cuenta. Por IP: 10 por hora, luego 10m... hasta 1h
+		IPLimiter: &throttle.Limiter{Store: throttleStore, Policy: throttle.Policy{
+			FreeAttempts: 10,
+			BaseDelay:    10 * time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       time.Hour,
+		}},
+		// por email: 3 mails por hora, luego 15m, 30m, 1h
+		EmailLimiter: &throttle.Limiter{Store: throttleStore, Policy: throttle.Policy{
+			FreeAttempts: 3,
+			BaseDelay:    15 * time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       time.Hour,
+		}},
+	}
 	mux.HandleFunc("/auth/set-password", pwdHandler.SetPassword)
+	mux.HandleFunc("/auth/forgot-password", pwdHandler.ForgotPassword)
+	mux.HandleFunc("/auth/reset-password", pwdHandler.ResetPassword)
+
+	// =========================
+	// Providers (signup + plataforma)
+	// =========================
+	providersHandler := &httpapi.ProvidersHandler{
+		DB:           database,
+		Mailer:       mail,
+		FrontendURL:  frontendURL,
+		PublicSignup: os.Getenv("PUBLIC_SIGNUP") == "true",
+		// por IP: 3 altas libres por hora, luego 10m, 20m... hasta 1h
+		SignupLimiter: &throttle.Limiter{Store: throttleStore, Policy: throttle.Policy{
+			FreeAttempts: 3,
+			BaseDelay:    10 * time.Minute,
+			MaxDelay:     time.Hour,
+			Window:       time.Hour,
+		}},
+	}
+
+	// POST /signup (público, solo con PUBLIC_SIGNUP=true)
+	mux.HandleFunc("/signup", providersHandler.Signup)
+	// GET/POST /platform/providers (operadores)
+	mux.Handle("/platform/providers", authn.Middleware(http.HandlerFunc(providersHandler.Collection)))
+	// GET /platform/providers/{id}
+	// POST /platform/providers/{id}/suspend | /platform/providers/{id}/reactivate
+	mux.Handle("/platform/providers/", authn.Middleware(http.HandlerFunc(providersHandler.Item)))
 
 	// =========================
 	// Users
 	// =========================
-	usersHandler := &httpapi.UsersHandler{DB: database.Pool}
+	usersHandler := &httpapi.UsersHandler{
+		DB:          database,
+		Mailer:      mail,
+		FrontendURL: frontendURL,
+	}
 
+	// GET /users  (listar con filtros)
 	// POST /users  (crear dispatcher/technician/client)
-	mux.Handle("/users", httpapi.AuthMiddleware(secret, http.HandlerFunc(usersHandler.Create)))
-	// opcional: soportar /users/ también
-	mux.Handle("/users/", httpapi.AuthMiddleware(secret, http.HandlerFunc(usersHandler.Create)))
+	mux.Handle("/users", authn.Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				usersHandler.Create(w, r)
+			case http.MethodGet:
+				usersHandler.List(w, r)
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+		}),
+	))
+	// GET/PATCH /users/{id}
+	// POST /users/{id}/activate | /users/{id}/deactivate
+	mux.Handle("/users/", authn.Middleware(http.HandlerFunc(usersHandler.Item)))
+
+	// =========================
+	// Customers
+	// =========================
+	customersHandler := &httpapi.CustomersHandler{DB: database}
+
+	// GET /customers?q=&active=  |  POST /customers
+	mux.Handle("/customers", authn.Middleware(http.HandlerFunc(customersHandler.Collection)))
+	// GET/PATCH /customers/{id}
+	// POST /customers/{id}/activate | /customers/{id}/deactivate
+	mux.Handle("/customers/", authn.Middleware(http.HandlerFunc(customersHandler.Item)))
+
+	// =========================
+	// Sites & areas
+	// =========================
+	sitesHandler := &httpapi.SitesHandler{DB: database}
+
+	// GET /sites?customer_id=&q=&active=  |  POST /sites
+	mux.Handle("/sites", authn.Middleware(http.HandlerFunc(sitesHandler.Collection)))
+	// GET/PATCH/DELETE /sites/{id}
+	// POST /sites/{id}/activate | /sites/{id}/deactivate
+	// GET/POST /sites/{id}/areas
+	mux.Handle("/sites/", authn.Middleware(http.HandlerFunc(sitesHandler.Item)))
+	// PATCH/DELETE /areas/{id}
+	mux.Handle("/areas/", authn.Middleware(http.HandlerFunc(sitesHandler.Area)))
+
+	// =========================
+	// Assets
+	// =========================
+	// Etiquetas QR: el código va firmado con LABEL_SECRET (o JWT_SECRET). Sin
+	// ninguno de los dos no hay etiquetas ni /scan.
+	labelSecret := os.Getenv("LABEL_SECRET")
+	if labelSecret == "" {
+		labelSecret = os.Getenv("JWT_SECRET")
+	}
+	var labelSigner *auth.LabelSigner
+	if labelSecret != "" {
+		labelSigner = &auth.LabelSigner{Secret: []byte(labelSecret)}
+	} else {
+		log.Println("LABEL_SECRET not set, asset labels disabled")
+	}
+	assetsHandler := &httpapi.AssetsHandler{
+		DB:          database,
+		LabelSigner: labelSigner,
+		FrontendURL: frontendURL,
+		Storage:     store,
+		Downloads:   downloads,
+		PublicURL:   publicURL,
+	}
+
+	// GET /assets?customer_id=&site_id=&area_id=&type=&status=&refrigerant_type=&tag_code=&q=
+	// POST /assets
+	mux.Handle("/assets", authn.Middleware(http.HandlerFunc(assetsHandler.Collection)))
+	// GET /assets/labels?site_id= | ?ids=a,b,c  (PDF de etiquetas QR)
+	// GET /assets/by-tag/{tag_code}?customer_id=
+	// GET/PATCH/DELETE /assets/{id}
+	// POST /assets/{id}/status  |  GET /assets/{id}/status-history
+	// GET /assets/{id}/history?order=  |  GET /assets/{id}/history.pdf  (hoja de vida)
+	// GET/POST /assets/{id}/readings?kind=
+	mux.Handle("/assets/", authn.Middleware(http.HandlerFunc(assetsHandler.Item)))
+	// GET /scan/{code}: código de la etiqueta => equipo, órdenes abiertas y último servicio
+	mux.Handle("/scan/", authn.Middleware(http.HandlerFunc(assetsHandler.Scan)))
+
+	// =========================
+	// Bulk import (CSV / XLSX)
+	// =========================
+	importsHandler := &httpapi.ImportsHandler{DB: database}
+
+	// GET /imports?kind=&status=  |  POST /imports?kind=customers|sites|areas|assets&filename=
+	mux.Handle("/imports", authn.Middleware(http.HandlerFunc(importsHandler.Collection)))
+	// GET /imports/{id}  |  POST /imports/{id}/commit  |  GET /imports/{id}/errors
+	mux.Handle("/imports/", authn.Middleware(http.HandlerFunc(importsHandler.Item)))
+
+	// =========================
+	// Invitations
+	// =========================
+	invitationsHandler := &httpapi.InvitationsHandler{
+		DB:          database,
+		Mailer:      mail,
+		FrontendURL: frontendURL,
+	}
+
+	// GET /invitations?status=pending,expired
+	mux.Handle("/invitations", authn.Middleware(http.HandlerFunc(invitationsHandler.List)))
+	// POST /invitations/{id}/resend | /invitations/{id}/revoke
+	mux.Handle("/invitations/", authn.Middleware(http.HandlerFunc(invitationsHandler.Action)))
 
 	// =========================
 	// Work Orders
 	// =========================
-	woHandler := &httpapi.WorkOrdersHandler{DB: database.Pool}
+	woHandler := &httpapi.WorkOrdersHandler{
+		DB:          database,
+		Mailer:      mail,
+		FrontendURL: frontendURL,
+		Storage:     store,
+		Downloads:   downloads,
+		PublicURL:   publicURL,
+		Photos:      photos,
+	}
 
 	// GET /work-orders
 	// POST /work-orders
-	mux.Handle("/work-orders", httpapi.AuthMiddleware(
-		secret,
+	mux.Handle("/work-orders", authn.Middleware(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
 			case http.MethodPost:
@@ -91,14 +396,46 @@ func main() {
 		}),
 	))
 
-	// PATCH /work-orders/{id}/complete
-	mux.Handle("/work-orders/", httpapi.AuthMiddleware(secret, http.HandlerFunc(woHandler.Complete)))
+	// GET/PATCH/DELETE /work-orders/{id}  |  GET /work-orders/{id}/events (auditoría)
+	// GET/POST /work-orders/{id}/comments  |  PATCH/DELETE /work-orders/{id}/comments/{commentId}
+	// GET/POST /work-orders/{id}/attachments (multipart)  |  DELETE /work-orders/{id}/attachments/{aid}
+	// POST /work-orders/{id}/uploads (subida reanudable)
+	// POST /work-orders/{id}/{assign|start|pause|complete|cancel|reopen}
+	// PATCH /work-orders/{id}/complete (compatibilidad)
+	mux.Handle("/work-orders/", authn.Middleware(http.HandlerFunc(woHandler.Item)))
+	// HEAD/GET/PATCH/DELETE /uploads/{id}
+	mux.Handle("/uploads/", authn.Middleware(http.HandlerFunc(woHandler.Upload)))
+	// GET /files/{token}?variant=thumb|web (público: el link firmado es la autorización)
+	mux.HandleFunc("/files/", woHandler.Download)
 
 	// =========================
 	// Reports (PDF)
 	// =========================
-	reportsHandler := &httpapi.ReportsHandler{DB: database.Pool}
-	mux.Handle("/reports/monthly", httpapi.AuthMiddleware(secret, http.HandlerFunc(reportsHandler.Monthly)))
+	reportsHandler := &httpapi.ReportsHandler{DB: database, Storage: store}
+	mux.Handle("/reports/monthly", authn.Middleware(http.HandlerFunc(reportsHandler.Monthly)))
+
+	// =========================
+	// Background jobs
+	// =========================
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	sweeper := &jobs.InvitationSweeper{
+		DB:       database,
+		Interval: time.Hour,
+		Grace:    7 * 24 * time.Hour,
+	}
+	go sweeper.Run(jobsCtx)
+	go loginGuard.PruneLoop(jobsCtx, time.Hour)
+
+	storageSweeper := &jobs.StorageSweeper{
+		DB:       database,
+		Storage:  store,
+		Interval: 10 * time.Minute,
+	}
+	go storageSweeper.Run(jobsCtx)
+	go photos.Run(jobsCtx)
+	go pwdHandler.RunResets(jobsCtx)
 
 	// =========================
 	// Server
@@ -3,6 +3,7 @@ module github.com/alvgonz/hvac-saas-api
 go 1.25.0
 
 require (
+	github.com/boombuler/barcode v1.1.0
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/jackc/pgx/v5 v5.8.0
 	github.com/phpdave11/gofpdf v1.4.3
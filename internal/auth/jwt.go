@@ -1,42 +1,66 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenTTL es corto a propósito: para seguir operando el cliente usa el
+// refresh token, y el logout/revocación se apoya en la sesión.
+const AccessTokenTTL = 15 * time.Minute
+
 type Claims struct {
 	UserID          string  `json:"uid"`
 	ServiceProvider string  `json:"spid"`
 	CustomerID      *string `json:"cid,omitempty"`
 	Role            string  `json:"role"`
+	SessionID       string  `json:"sid"`
+
+	// Solo API keys (nunca van en un JWT): UserID es quien creó la key.
+	APIKeyID string   `json:"akid,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+
 	jwt.RegisteredClaims
 }
 
-func SignToken(secret []byte, c Claims) (string, error) {
+// SignToken firma el access token con la clave activa del KeySet (iss/aud del KeySet).
+func SignToken(ks *KeySet, c Claims) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := ks.now()
 	c.RegisteredClaims = jwt.RegisteredClaims{
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		ID:        jti,
+		Issuer:    ks.Issuer,
+		Audience:  jwt.ClaimStrings{ks.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
 	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
-	return t.SignedString(secret)
+	return ks.sign(c)
 }
 
-func ParseToken(secret []byte, tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (any, error) {
-		if t.Method != jwt.SigningMethodHS256 {
-			return nil, errors.New("unexpected signing method")
-		}
-		return secret, nil
-	})
+func ParseToken(ks *KeySet, tokenString string) (*Claims, error) {
+	token, err := ks.parse(tokenString, &Claims{}, ks.Audience)
 	if err != nil {
 		return nil, err
 	}
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || isMFAChallenge(claims) {
 		return nil, errors.New("invalid token")
 	}
 	return claims, nil
 }
+
+// newTokenID genera el jti (16 bytes aleatorios en hex).
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
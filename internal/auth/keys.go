@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// hmacKeyID identifica la clave simétrica (JWT_SECRET) cuando no hay keys asimétricas.
+const hmacKeyID = "hs256"
+
+// KeySet firma y verifica los JWT. Puede tener varias claves (identificadas por
+// kid): firma con la activa según el calendario y verifica con cualquiera que no
+// haya expirado, así rotar no desloguea a nadie.
+type KeySet struct {
+	Issuer   string
+	Audience string
+
+	keys []*signingKey // ordenadas: la de activación más reciente primero
+	now  func() time.Time
+}
+
+type signingKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	Private    any // nil => solo verifica (clave retirada)
+	Public     any
+	ActivateAt time.Time // desde cuándo firma (zero = ya)
+	ExpireAt   time.Time // desde cuándo deja de verificar (zero = nunca)
+}
+
+// NewHMACKeySet: modo compatible con JWT_SECRET (HS256). No publica nada en el
+// JWKS, así que otros servicios no pueden verificar sin el secreto.
+func NewHMACKeySet(secret []byte, issuer, audience string) *KeySet {
+	return &KeySet{
+		Issuer:   issuer,
+		Audience: audience,
+		keys: []*signingKey{{
+			ID:      hmacKeyID,
+			Method:  jwt.SigningMethodHS256,
+			Private: secret,
+			Public:  secret,
+		}},
+		now: time.Now,
+	}
+}
+
+// keyManifest es el archivo JWT_KEYS_FILE. Ejemplo de rotación:
+//
+//	{"keys": [
+//	  {"kid": "2026-10", "file": "2026-10.pem", "activate_at": "2026-10-15T00:00:00Z"},
+//	  {"kid": "2026-04", "file": "2026-04.pem", "expire_at": "2026-10-16T00:00:00Z"}
+//	]}
+//
+// La nueva se publica en el JWKS antes de activarse (los verificadores alcanzan a
+// cachearla) y la vieja sigue verificando hasta expire_at. Las rutas de "file" son
+// relativas al manifiesto; un PEM "PUBLIC KEY" sirve solo para verificar.
+type keyManifest struct {
+	Keys []struct {
+		ID         string     `json:"kid"`
+		File       string     `json:"file"`
+		ActivateAt *time.Time `json:"activate_at,omitempty"`
+		ExpireAt   *time.Time `json:"expire_at,omitempty"`
+	} `json:"keys"`
+}
+
+// LoadKeySet lee el manifiesto y los PEM (RSA => RS256, Ed25519 => EdDSA).
+func LoadKeySet(path, issuer, audience string) (*KeySet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m keyManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("jwt keys: %w", err)
+	}
+
+	ks := &KeySet{Issuer: issuer, Audience: audience, now: time.Now}
+	seen := map[string]bool{}
+	for _, e := range m.Keys {
+		if e.ID == "" || e.ID == hmacKeyID || seen[e.ID] {
+			return nil, fmt.Errorf("jwt keys: invalid or duplicated kid %q", e.ID)
+		}
+		seen[e.ID] = true
+
+		file := e.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		k, err := loadPEMKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("jwt keys: kid %s: %w", e.ID, err)
+		}
+		k.ID = e.ID
+		if e.ActivateAt != nil {
+			k.ActivateAt = *e.ActivateAt
+		}
+		if e.ExpireAt != nil {
+			k.ExpireAt = *e.ExpireAt
+		}
+		ks.keys = append(ks.keys, k)
+	}
+
+	sort.SliceStable(ks.keys, func(i, j int) bool {
+		return ks.keys[i].ActivateAt.After(ks.keys[j].ActivateAt)
+	})
+
+	if _, err := ks.activeKey(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func loadPEMKey(file string) (*signingKey, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &signingKey{}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.Method, k.Private, k.Public = jwt.SigningMethodRS256, key, &key.PublicKey
+	case *rsa.PublicKey:
+		k.Method, k.Public = jwt.SigningMethodRS256, key
+	case ed25519.PrivateKey:
+		k.Method, k.Private, k.Public = jwt.SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey:
+		k.Method, k.Public = jwt.SigningMethodEdDSA, key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	if pub, ok := k.Public.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, errors.New("rsa key must be at least 2048 bits")
+	}
+	return k, nil
+}
+
+func (k *signingKey) expired(now time.Time) bool {
+	return !k.ExpireAt.IsZero() && !now.Before(k.ExpireAt)
+}
+
+// activeKey: la clave privada de activación más reciente que ya esté vigente.
+func (ks *KeySet) activeKey() (*signingKey, error) {
+	now := ks.now()
+	for _, k := range ks.keys {
+		if k.Private != nil && !k.ActivateAt.After(now) && !k.expired(now) {
+			return k, nil
+		}
+	}
+	return nil, errors.New("jwt keys: no active signing key")
+}
+
+func (ks *KeySet) sign(c jwt.Claims) (string, error) {
+	k, err := ks.activeKey()
+	if err != nil {
+		return "", err
+	}
+	t := jwt.NewWithClaims(k.Method, c)
+	t.Header["kid"] = k.ID
+	return t.SignedString(k.Private)
+}
+
+// parse verifica firma, exp, iss y aud. La clave se elige por kid y el alg del
+// header tiene que coincidir con el de la clave (evita la confusión HS256/RS256).
+func (ks *KeySet) parse(tokenString string, c jwt.Claims, audience string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, c, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		now := ks.now()
+		for _, k := range ks.keys {
+			if k.ID != kid {
+				continue
+			}
+			if k.expired(now) {
+				return nil, errors.New("signing key expired")
+			}
+			if t.Method.Alg() != k.Method.Alg() {
+				return nil, errors.New("unexpected signing method")
+			}
+			return k.Public, nil
+		}
+		return nil, errors.New("unknown signing key")
+	},
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+}
+
+// =========================
+// JWKS (RFC 7517)
+// =========================
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS devuelve las claves públicas que aún verifican, incluidas las que todavía
+// no firman (para que los verificadores las tengan antes de la rotación).
+func (ks *KeySet) JWKS() JWKS {
+	now := ks.now()
+	out := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if k.expired(now) {
+			continue
+		}
+		switch pub := k.Public.(type) {
+		case *rsa.PublicKey:
+			out.Keys = append(out.Keys, JWK{
+				Kty: "RSA",
+				Kid: k.ID,
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			out.Keys = append(out.Keys, JWK{
+				Kty: "OKP",
+				Kid: k.ID,
+				Use: "sig",
+				Alg: k.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+		// HS256 nunca se publica.
+	}
+	return out
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, dir, name string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rotatingKeySet: "old" (RSA) firma hasta que se activa "new" (Ed25519) en
+// base+5m y verifica hasta base+10m. El reloj del KeySet se mueve con *now;
+// exp lo valida jwt contra la hora real, así que base es ahora.
+func rotatingKeySet(t *testing.T, now *time.Time) (*KeySet, *rsa.PrivateKey, ed25519.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "old.pem", rsaKey)
+	writePEM(t, dir, "new.pem", edKey)
+
+	manifest := `{"keys": [
+		{"kid": "new", "file": "new.pem", "activate_at": "` + now.Add(5*time.Minute).Format(time.RFC3339) + `"},
+		{"kid": "old", "file": "old.pem", "expire_at": "` + now.Add(10*time.Minute).Format(time.RFC3339) + `"}
+	]}`
+	path := filepath.Join(dir, "keys.json")
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := LoadKeySet(path, "hvac-test", "hvac-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.now = func() time.Time { return *now }
+	return ks, rsaKey, edKey
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	tok, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := tok.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	ks, _, _ := rotatingKeySet(t, &now)
+	claims := Claims{UserID: "u1", ServiceProvider: "sp1", Role: "admin", SessionID: "s1"}
+
+	before, err := SignToken(ks, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKid(t, before); kid != "old" {
+		t.Fatalf("before activation signed with %q, want old", kid)
+	}
+
+	// Activada la nueva, la vieja queda retirada: no firma pero verifica.
+	now = now.Add(6 * time.Minute)
+	after, err := SignToken(ks, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenKid(t, after); kid != "new" {
+		t.Fatalf("after activation signed with %q, want new", kid)
+	}
+	for name, token := range map[string]string{"retired kid": before, "active kid": after} {
+		if c, err := ParseToken(ks, token); err != nil || c.UserID != "u1" {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Pasado expire_at, lo firmado con la vieja deja de valer.
+	now = now.Add(5 * time.Minute)
+	if _, err := ParseToken(ks, before); err == nil {
+		t.Error("token signed with an expired key accepted")
+	}
+	if _, err := ParseToken(ks, after); err != nil {
+		t.Errorf("active kid after expiry of the old one: %v", err)
+	}
+}
+
+func TestUnknownOrForgedKid(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	ks, rsaKey, _ := rotatingKeySet(t, &now)
+	_, stranger, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key any) string {
+		t.Helper()
+		c := Claims{UserID: "u1", ServiceProvider: "sp1", Role: "admin", SessionID: "s1"}
+		c.RegisteredClaims = jwt.RegisteredClaims{
+			ID:        "jti",
+			Issuer:    ks.Issuer,
+			Audience:  jwt.ClaimStrings{ks.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		}
+		tok := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{
+		"unknown kid":          sign(jwt.SigningMethodEdDSA, "stranger", stranger),
+		"missing kid":          sign(jwt.SigningMethodEdDSA, "", stranger),
+		"known kid, other key": sign(jwt.SigningMethodEdDSA, "new", stranger),
+		// HS256 firmado con la clave pública de "old": la confusión de algoritmos clásica.
+		"alg confusion": sign(jwt.SigningMethodHS256, "old", pubDER),
+	} {
+		if _, err := ParseToken(ks, token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	// Control: el mismo armado con la clave correcta sí pasa.
+	if _, err := ParseToken(ks, sign(jwt.SigningMethodRS256, "old", rsaKey)); err != nil {
+		t.Errorf("control token rejected: %v", err)
+	}
+}
+
+// El JWKS lleva solo material público: la nueva antes de activarse, la vieja
+// hasta expire_at, y nunca el secreto HS256.
+func TestJWKSPublishesOnlyPublicKeys(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	ks, rsaKey, edKey := rotatingKeySet(t, &now)
+
+	raw, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Keys) != 2 {
+		t.Fatalf("published %d keys, want 2: %s", len(doc.Keys), raw)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	for _, k := range doc.Keys {
+		for _, private := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+			if _, ok := k[private]; ok {
+				t.Errorf("kid %s publishes private member %q", k["kid"], private)
+			}
+		}
+		switch k["kid"] {
+		case "old":
+			if k["kty"] != "RSA" || k["alg"] != "RS256" || k["n"] != b64(rsaKey.N.Bytes()) || k["e"] != "AQAB" {
+				t.Errorf("old: %v", k)
+			}
+		case "new":
+			if k["kty"] != "OKP" || k["alg"] != "EdDSA" || k["crv"] != "Ed25519" || k["x"] != b64(edKey.Public().(ed25519.PublicKey)) {
+				t.Errorf("new: %v", k)
+			}
+		default:
+			t.Errorf("unexpected kid %q", k["kid"])
+		}
+	}
+
+	now = now.Add(11 * time.Minute)
+	if keys := ks.JWKS().Keys; len(keys) != 1 || keys[0].Kid != "new" {
+		t.Errorf("after expiry published %+v, want only new", keys)
+	}
+
+	secret := "super-secret-value"
+	hmac := NewHMACKeySet([]byte(secret), "hvac-test", "hvac-test")
+	if raw, _ := json.Marshal(hmac.JWKS()); string(raw) != `{"keys":[]}` || strings.Contains(string(raw), secret) {
+		t.Errorf("HMAC key set published %s", raw)
+	}
+}
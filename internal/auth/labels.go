@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// LabelSigner arma y verifica el código que va en el QR de la etiqueta de un
+// equipo: base64url(uuid del equipo || HMAC truncado). El HMAC incluye el
+// provider, así que un código solo resuelve dentro de su tenant y no se puede
+// fabricar uno a partir de un id adivinado.
+type LabelSigner struct {
+	Secret []byte
+}
+
+const labelMACLen = 10 // 80 bits: sobra para esto y el QR queda chico
+
+func (s *LabelSigner) mac(spid string, id []byte) []byte {
+	m := hmac.New(sha256.New, s.Secret)
+	m.Write([]byte("asset-label:v1:" + spid + ":"))
+	m.Write(id)
+	return m.Sum(nil)[:labelMACLen]
+}
+
+// Code devuelve el código del equipo; false si assetID no es un uuid.
+func (s *LabelSigner) Code(spid, assetID string) (string, bool) {
+	id, err := hex.DecodeString(strings.ReplaceAll(assetID, "-", ""))
+	if err != nil || len(id) != 16 {
+		return "", false
+	}
+	return base64.RawURLEncoding.EncodeToString(append(id, s.mac(spid, id)...)), true
+}
+
+// Parse verifica el código para el provider y devuelve el id del equipo.
+func (s *LabelSigner) Parse(spid, code string) (string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(code))
+	if err != nil || len(raw) != 16+labelMACLen {
+		return "", false
+	}
+	id, sig := raw[:16], raw[16:]
+	if !hmac.Equal(sig, s.mac(spid, id)) {
+		return "", false
+	}
+	h := hex.EncodeToString(id)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], true
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+const (
+	labelSPID  = "6f1c2a9e-0b7d-4c3e-9a51-2d8e4f6a7b10"
+	labelOther = "0d3b5e7f-1a2c-4e6f-8b9d-a1c3e5f7b9d2"
+	labelAsset = "3F2504E0-4F89-11D3-9A0C-0305E82C3301"
+)
+
+func TestLabelRoundTrip(t *testing.T) {
+	s := &LabelSigner{Secret: []byte("labels-secret")}
+	code, ok := s.Code(labelSPID, labelAsset)
+	if !ok {
+		t.Fatal("Code rejected a valid uuid")
+	}
+	if len(code) != 35 { // base64url sin padding de 16+10 bytes
+		t.Errorf("code %q has %d chars, want 35", code, len(code))
+	}
+	if id, ok := s.Parse(labelSPID, " "+code+"\n"); !ok || id != "3f2504e0-4f89-11d3-9a0c-0305e82c3301" {
+		t.Errorf("Parse = %q, %v", id, ok)
+	}
+	if again, _ := s.Code(labelSPID, labelAsset); again != code {
+		t.Error("Code is not deterministic: printed labels would stop resolving")
+	}
+
+	for _, bad := range []string{"", "not-a-uuid", "3f2504e0-4f89-11d3-9a0c"} {
+		if _, ok := s.Code(labelSPID, bad); ok {
+			t.Errorf("Code accepted %q", bad)
+		}
+	}
+}
+
+func TestLabelRejectsTamperedCodes(t *testing.T) {
+	s := &LabelSigner{Secret: []byte("labels-secret")}
+	code, _ := s.Code(labelSPID, labelAsset)
+	raw, _ := base64.RawURLEncoding.DecodeString(code)
+
+	flip := func(i int) string {
+		b := append([]byte(nil), raw...)
+		b[i] ^= 0x01
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	other, _ := s.Code(labelSPID, "3f2504e0-4f89-11d3-9a0c-0305e82c3302")
+	otherRaw, _ := base64.RawURLEncoding.DecodeString(other)
+
+	for name, c := range map[string]string{
+		"id bit flipped":    flip(0),
+		"mac bit flipped":   flip(len(raw) - 1),
+		"truncated":         code[:len(code)-2],
+		"extra bytes":       base64.RawURLEncoding.EncodeToString(append(append([]byte(nil), raw...), 0)),
+		"mac from other id": base64.RawURLEncoding.EncodeToString(append(append([]byte(nil), raw[:16]...), otherRaw[16:]...)),
+		"padded base64":     base64.URLEncoding.EncodeToString(raw),
+		"not base64":        "!!!!",
+		"bare uuid":         labelAsset,
+	} {
+		if id, ok := s.Parse(labelSPID, c); ok {
+			t.Errorf("%s: resolved to %s", name, id)
+		}
+	}
+}
+
+// El código de un equipo no resuelve en otro provider, ni con otro secreto.
+func TestLabelScopedToProvider(t *testing.T) {
+	s := &LabelSigner{Secret: []byte("labels-secret")}
+	code, _ := s.Code(labelSPID, labelAsset)
+	if _, ok := s.Parse(labelOther, code); ok {
+		t.Error("code resolved for another provider")
+	}
+	if _, ok := (&LabelSigner{Secret: []byte("other-secret")}).Parse(labelSPID, code); ok {
+		t.Error("code resolved with another secret")
+	}
+	otherCode, _ := s.Code(labelOther, labelAsset)
+	if otherCode == code {
+		t.Error("same asset id gives the same code in two providers")
+	}
+}
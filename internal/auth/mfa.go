@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MFAChallengeTTL: tiempo para meter el código después del password.
+const MFAChallengeTTL = 5 * time.Minute
+
+// mfaAudience distingue el challenge de un access token: ninguno sirve como el otro.
+const mfaAudience = "mfa"
+
+// MFAChallenge es el token intermedio que devuelve Login cuando falta el segundo factor.
+type MFAChallenge struct {
+	UserID          string `json:"uid"`
+	ServiceProvider string `json:"spid"`
+	Enroll          bool   `json:"enroll,omitempty"` // true => el provider exige MFA y el usuario aún no lo tiene
+	jwt.RegisteredClaims
+}
+
+func SignMFAChallenge(ks *KeySet, c MFAChallenge) (string, error) {
+	now := ks.now()
+	c.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    ks.Issuer,
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+	}
+	return ks.sign(c)
+}
+
+func ParseMFAChallenge(ks *KeySet, tokenString string) (*MFAChallenge, error) {
+	token, err := ks.parse(tokenString, &MFAChallenge{}, mfaAudience)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := token.Claims.(*MFAChallenge)
+	if !ok || !token.Valid || c.UserID == "" {
+		return nil, errors.New("invalid mfa token")
+	}
+	return c, nil
+}
+
+func isMFAChallenge(c *Claims) bool {
+	return slices.Contains(c.Audience, mfaAudience)
+}
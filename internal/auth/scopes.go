@@ -0,0 +1,27 @@
+package auth
+
+import "slices"
+
+// RoleIntegration es el rol de las API keys. No tiene permisos propios: los
+// que tenga la key salen de sus scopes (ver authz.ForScopes).
+const RoleIntegration = "integration"
+
+const (
+	ScopeWorkOrdersRead  = "work_orders:read"
+	ScopeWorkOrdersWrite = "work_orders:write"
+)
+
+// Scopes son los que se pueden asignar a una API key.
+var Scopes = []string{
+	ScopeWorkOrdersRead,
+	ScopeWorkOrdersWrite,
+}
+
+func ValidScope(s string) bool {
+	return slices.Contains(Scopes, s)
+}
+
+// IsAPIKey: la request viene de una integración (Authorization: ApiKey ...).
+func (c *Claims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
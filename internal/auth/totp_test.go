@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secreto de los vectores del RFC 6238 (apéndice B, SHA1): "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vectores del RFC 6238 recortados a 6 dígitos (los últimos 6 de los 8 del RFC).
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		at := time.Unix(v.unix, 0).UTC()
+		got, err := TOTPCode(rfcSecret, TOTPStep(at))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d): %v", v.unix, err)
+		}
+		if got != v.code {
+			t.Errorf("TOTPCode at %s = %s, want %s", at.Format(time.RFC3339), got, v.code)
+		}
+		step, ok := ValidateTOTP(rfcSecret, v.code, at, 0)
+		if !ok || step != TOTPStep(at) {
+			t.Errorf("ValidateTOTP at %s = %d, %v; want step %d", at.Format(time.RFC3339), step, ok, TOTPStep(at))
+		}
+	}
+}
+
+func TestTOTPSecretIsCaseAndSpaceInsensitive(t *testing.T) {
+	got, err := TOTPCode("  "+strings.ToLower(rfcSecret)+"\n", TOTPStep(time.Unix(59, 0)))
+	if err != nil || got != "287082" {
+		t.Fatalf("TOTPCode(lowercase secret) = %q, %v", got, err)
+	}
+	if _, err := TOTPCode("not-base32!", 1); err == nil {
+		t.Fatal("TOTPCode accepted an invalid secret")
+	}
+}
+
+// El reloj del teléfono puede ir un paso adelante o atrás; dos pasos ya no.
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	current := TOTPStep(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := TOTPCode(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := ValidateTOTP(rfcSecret, code, now, TOTPSkew)
+		wantOK := offset >= -TOTPSkew && offset <= TOTPSkew
+		if ok != wantOK {
+			t.Errorf("offset %+d: ok = %v, want %v", offset, ok, wantOK)
+			continue
+		}
+		// El step devuelto es el del código, no el actual: es el que se guarda
+		// como last_used_step para el anti-replay.
+		if ok && step != current+offset {
+			t.Errorf("offset %+d: step = %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateTOTPStepBoundaries(t *testing.T) {
+	start := time.Unix(1111111110, 0) // 1111111110 / 30 exacto: primer segundo del paso
+	code, err := TOTPCode(rfcSecret, TOTPStep(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []time.Time{
+		start,
+		start.Add(29 * time.Second), // último segundo del mismo paso
+		start.Add(59 * time.Second), // paso siguiente, dentro del skew
+		start.Add(-time.Second),     // paso anterior, dentro del skew
+	} {
+		if _, ok := ValidateTOTP(rfcSecret, code, at, TOTPSkew); !ok {
+			t.Errorf("code rejected at %d", at.Unix())
+		}
+	}
+	for _, at := range []time.Time{
+		start.Add(60 * time.Second),  // +2 pasos
+		start.Add(-31 * time.Second), // -2 pasos
+	} {
+		if _, ok := ValidateTOTP(rfcSecret, code, at, TOTPSkew); ok {
+			t.Errorf("code accepted at %d", at.Unix())
+		}
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	cases := map[string]bool{
+		"005924":    true,
+		" 005 924 ": true,
+		"5924":      false, // sin los ceros a la izquierda
+		"0059240":   false,
+		"":          false,
+		"00592a":    false,
+		"005925":    false,
+		"００５９２４":    false, // dígitos fullwidth
+	}
+	for code, want := range cases {
+		if _, ok := ValidateTOTP(rfcSecret, code, at, 0); ok != want {
+			t.Errorf("ValidateTOTP(%q) = %v, want %v", code, ok, want)
+		}
+	}
+	if _, ok := ValidateTOTP("not-base32!", "005924", at, TOTPSkew); ok {
+		t.Error("ValidateTOTP accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	a, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateTOTPSecret()
+	if a == b {
+		t.Fatal("two secrets are equal")
+	}
+	key, err := b32.DecodeString(a)
+	if err != nil || len(key) != 20 || strings.Contains(a, "=") {
+		t.Fatalf("secret %q: %d bytes, %v", a, len(key), err)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	raw := TOTPProvisioningURI("Frío Total", "ana@example.com", rfcSecret)
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Frío Total:ana@example.com" {
+		t.Fatalf("uri = %s", raw)
+	}
+	q := u.Query()
+	if q.Get("secret") != rfcSecret || q.Get("issuer") != "Frío Total" ||
+		q.Get("algorithm") != "SHA1" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Fatalf("query = %v", q)
+	}
+}
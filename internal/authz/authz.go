@@ -0,0 +1,250 @@
+// Package authz define los permisos de la API y qué rol tiene cada uno.
+//
+// Los handlers preguntan por un permiso ("work_order.complete"), no por un rol.
+// Los roles base (user_role) traen un set por defecto; cada provider puede
+// crear roles propios (provider_role) que reemplazan ese set para los usuarios
+// que los tengan asignados.
+package authz
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+)
+
+type Permission string
+
+const (
+	// Usuarios. Las acciones (read/update/activate) se combinan con
+	// user.invite.<rol>, que define sobre qué roles se pueden ejercer.
+	UserRead             Permission = "user.read"     // usuarios de los roles que gestiona
+	UserReadAll          Permission = "user.read.all" // todos, incluidos admins
+	UserUpdate           Permission = "user.update"
+	UserActivate         Permission = "user.activate"
+	UserInviteDispatcher Permission = "user.invite.dispatcher"
+	UserInviteTechnician Permission = "user.invite.technician"
+	UserInviteClient     Permission = "user.invite.client"
+
+	// Clientes (customer)
+	CustomerRead    Permission = "customer.read"     // todos los del provider
+	CustomerReadOwn Permission = "customer.read.own" // solo el customer del usuario
+	CustomerManage  Permission = "customer.manage"   // alta, edición, activar/desactivar
+
+	// Sitios y áreas
+	SiteRead    Permission = "site.read"     // todos los del provider
+	SiteReadOwn Permission = "site.read.own" // solo los del customer del usuario
+	SiteManage  Permission = "site.manage"   // sitios y áreas: alta, edición, baja
+
+	// Equipos (asset)
+	AssetRead         Permission = "asset.read"          // todos los del provider
+	AssetReadOwn      Permission = "asset.read.own"      // solo los del customer del usuario
+	AssetManage       Permission = "asset.manage"        // alta, edición, cambio de estado, baja
+	AssetReadingWrite Permission = "asset.reading.write" // registrar lecturas (presiones, temperaturas...)
+
+	// Órdenes de trabajo
+	WorkOrderCreate           Permission = "work_order.create"
+	WorkOrderReadAll          Permission = "work_order.read.all"          // todas las del provider
+	WorkOrderReadAssigned     Permission = "work_order.read.assigned"     // las asignadas a uno
+	WorkOrderReadCustomer     Permission = "work_order.read.customer"     // las del customer del usuario
+	WorkOrderUpdate           Permission = "work_order.update"            // editar, asignar, cancelar, reabrir
+	WorkOrderComplete         Permission = "work_order.complete"          // iniciar, pausar y completar cualquiera
+	WorkOrderCompleteAssigned Permission = "work_order.complete.assigned" // lo mismo, solo las asignadas a uno
+	WorkOrderComment          Permission = "work_order.comment"           // comentar las órdenes que ve
+	WorkOrderCommentInternal  Permission = "work_order.comment.internal"  // ver y escribir comentarios internos
+	WorkOrderAttachmentWrite  Permission = "work_order.attachment.write"  // subir adjuntos a las órdenes que ve
+
+	// Reportes
+	ReportMonthlyRead    Permission = "report.monthly.read"     // cualquier customer
+	ReportMonthlyReadOwn Permission = "report.monthly.read.own" // solo el customer del usuario
+
+	// Administración del provider
+	MFAPolicyManage  Permission = "mfa.policy.manage"
+	LoginAttemptRead Permission = "login_attempt.read"
+	APIKeyManage     Permission = "api_key.manage"
+	RoleManage       Permission = "role.manage"
+	SettingsManage   Permission = "settings.manage"
+
+	// Plataforma (operadores): fuera de All, no se pueden asignar a un rol propio.
+	PlatformTenantRead   Permission = "platform.tenant.read"
+	PlatformTenantManage Permission = "platform.tenant.manage"
+)
+
+// All es el catálogo completo (lo que se puede asignar a un rol propio).
+var All = []Permission{
+	UserRead, UserReadAll, UserUpdate, UserActivate,
+	UserInviteDispatcher, UserInviteTechnician, UserInviteClient,
+	CustomerRead, CustomerReadOwn, CustomerManage,
+	SiteRead, SiteReadOwn, SiteManage,
+	AssetRead, AssetReadOwn, AssetManage, AssetReadingWrite,
+	WorkOrderCreate, WorkOrderReadAll, WorkOrderReadAssigned, WorkOrderReadCustomer,
+	WorkOrderUpdate, WorkOrderComplete, WorkOrderCompleteAssigned,
+	WorkOrderComment, WorkOrderCommentInternal, WorkOrderAttachmentWrite,
+	ReportMonthlyRead, ReportMonthlyReadOwn,
+	MFAPolicyManage, LoginAttemptRead, APIKeyManage, RoleManage, SettingsManage,
+}
+
+func Valid(p Permission) bool {
+	return slices.Contains(All, p)
+}
+
+// Platform: lo que suma "user".is_platform_operator, encima del rol que tenga.
+var Platform = []Permission{PlatformTenantRead, PlatformTenantManage}
+
+// builtin: permisos por defecto de cada user_role.
+var builtin = map[string][]Permission{
+	"admin": All,
+	"dispatcher": {
+		UserRead, UserUpdate, UserActivate, UserInviteTechnician,
+		CustomerRead, CustomerManage,
+		SiteRead, SiteManage,
+		AssetRead, AssetManage, AssetReadingWrite,
+		WorkOrderCreate, WorkOrderReadAll, WorkOrderUpdate, WorkOrderComplete,
+		WorkOrderComment, WorkOrderCommentInternal, WorkOrderAttachmentWrite,
+		ReportMonthlyRead,
+	},
+	"technician": {
+		SiteRead,  // dirección, acceso y contacto del sitio
+		AssetRead, // datos técnicos del equipo a intervenir
+		AssetReadingWrite,
+		WorkOrderReadAssigned, WorkOrderCompleteAssigned,
+		WorkOrderComment, WorkOrderCommentInternal, WorkOrderAttachmentWrite,
+	},
+	"client": {
+		CustomerReadOwn, SiteReadOwn, AssetReadOwn,
+		WorkOrderReadCustomer, WorkOrderComment, ReportMonthlyReadOwn,
+	},
+}
+
+// scopes: permisos que otorga cada scope de API key.
+var scopes = map[string][]Permission{
+	auth.ScopeWorkOrdersRead:  {WorkOrderReadAll},
+	auth.ScopeWorkOrdersWrite: {WorkOrderCreate, WorkOrderUpdate, WorkOrderComplete},
+}
+
+// BuiltinRoles en el orden en que se muestran.
+var BuiltinRoles = []string{"admin", "dispatcher", "technician", "client"}
+
+// Set es el conjunto efectivo de permisos de quien hace la request.
+type Set map[Permission]struct{}
+
+func NewSet(perms ...Permission) Set {
+	s := make(Set, len(perms))
+	for _, p := range perms {
+		s[p] = struct{}{}
+	}
+	return s
+}
+
+func (s Set) Has(p Permission) bool {
+	_, ok := s[p]
+	return ok
+}
+
+func (s Set) HasAny(ps ...Permission) bool {
+	for _, p := range ps {
+		if s.Has(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers: todos los permisos de other están en s (nadie otorga lo que no tiene).
+func (s Set) Covers(other Set) bool {
+	for p := range other {
+		if !s.Has(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// List devuelve los permisos ordenados (para JSON).
+func (s Set) List() []Permission {
+	out := make([]Permission, 0, len(s))
+	for p := range s {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// ForRole: set por defecto del rol base (vacío si no existe).
+func ForRole(role string) Set {
+	return NewSet(builtin[role]...)
+}
+
+// ForUser: set efectivo de un usuario. Un rol propio asignado reemplaza (no
+// suma) el set del rol base; los de plataforma se suman si es operador.
+func ForUser(role string, hasCustom bool, custom []string, operator bool) Set {
+	perms := ForRole(role)
+	if hasCustom {
+		perms = FromStrings(custom)
+	}
+	if operator {
+		perms.Add(Platform...)
+	}
+	return perms
+}
+
+// ForScopes: set de una API key.
+func ForScopes(ss []string) Set {
+	s := Set{}
+	for _, sc := range ss {
+		for _, p := range scopes[sc] {
+			s[p] = struct{}{}
+		}
+	}
+	return s
+}
+
+// Add suma permisos al set (in place) y lo devuelve.
+func (s Set) Add(perms ...Permission) Set {
+	for _, p := range perms {
+		s[p] = struct{}{}
+	}
+	return s
+}
+
+// FromStrings arma el set de un rol propio leído de la DB. Ignora permisos que
+// ya no existen en el catálogo.
+func FromStrings(ps []string) Set {
+	s := Set{}
+	for _, p := range ps {
+		if Valid(Permission(p)) {
+			s[Permission(p)] = struct{}{}
+		}
+	}
+	return s
+}
+
+// InvitePermission: permiso para invitar/gestionar usuarios del rol dado.
+func InvitePermission(role string) (Permission, bool) {
+	switch role {
+	case "dispatcher":
+		return UserInviteDispatcher, true
+	case "technician":
+		return UserInviteTechnician, true
+	case "client":
+		return UserInviteClient, true
+	}
+	return "", false
+}
+
+// CanManageRole: el set permite invitar/gestionar usuarios de ese rol.
+func (s Set) CanManageRole(role string) bool {
+	p, ok := InvitePermission(role)
+	return ok && s.Has(p)
+}
+
+// ManageableRoles: roles base sobre los que el set puede actuar.
+func (s Set) ManageableRoles() []string {
+	var out []string
+	for _, role := range BuiltinRoles {
+		if s.CanManageRole(role) {
+			out = append(out, role)
+		}
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package authz
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+)
+
+// Matriz rol/scope × permiso: cada fila dice qué permisos tiene el actor; todo
+// lo que no está listado tiene que faltar. Un cambio en builtin o scopes que
+// no pase por acá rompe el test a propósito.
+var matrix = []struct {
+	name  string
+	perms Set
+	want  []Permission
+}{
+	{"admin", ForRole("admin"), All},
+	{"dispatcher", ForRole("dispatcher"), []Permission{
+		UserRead, UserUpdate, UserActivate, UserInviteTechnician,
+		CustomerRead, CustomerManage,
+		SiteRead, SiteManage,
+		AssetRead, AssetManage, AssetReadingWrite,
+		WorkOrderCreate, WorkOrderReadAll, WorkOrderUpdate, WorkOrderComplete,
+		WorkOrderComment, WorkOrderCommentInternal, WorkOrderAttachmentWrite,
+		ReportMonthlyRead,
+	}},
+	{"technician", ForRole("technician"), []Permission{
+		SiteRead, AssetRead, AssetReadingWrite,
+		WorkOrderReadAssigned, WorkOrderCompleteAssigned,
+		WorkOrderComment, WorkOrderCommentInternal, WorkOrderAttachmentWrite,
+	}},
+	{"client", ForRole("client"), []Permission{
+		CustomerReadOwn, SiteReadOwn, AssetReadOwn,
+		WorkOrderReadCustomer, WorkOrderComment, ReportMonthlyReadOwn,
+	}},
+	{"unknown role", ForRole("superuser"), nil},
+	{"integration role", ForRole(auth.RoleIntegration), nil},
+	{"operator", ForUser("technician", false, nil, true), []Permission{
+		SiteRead, AssetRead, AssetReadingWrite,
+		WorkOrderReadAssigned, WorkOrderCompleteAssigned,
+		WorkOrderComment, WorkOrderCommentInternal, WorkOrderAttachmentWrite,
+		PlatformTenantRead, PlatformTenantManage,
+	}},
+	{"key work_orders:read", ForScopes([]string{auth.ScopeWorkOrdersRead}), []Permission{WorkOrderReadAll}},
+	{"key work_orders:write", ForScopes([]string{auth.ScopeWorkOrdersWrite}), []Permission{
+		WorkOrderCreate, WorkOrderUpdate, WorkOrderComplete,
+	}},
+	{"key read+write", ForScopes([]string{auth.ScopeWorkOrdersRead, auth.ScopeWorkOrdersWrite}), []Permission{
+		WorkOrderReadAll, WorkOrderCreate, WorkOrderUpdate, WorkOrderComplete,
+	}},
+	{"key unknown scope", ForScopes([]string{"assets:write", "*"}), nil},
+	{"key no scopes", ForScopes(nil), nil},
+}
+
+func TestPermissionMatrix(t *testing.T) {
+	catalog := append(slices.Clone(All), Platform...)
+	for _, row := range matrix {
+		t.Run(row.name, func(t *testing.T) {
+			for _, p := range catalog {
+				want := slices.Contains(row.want, p)
+				if got := row.perms.Has(p); got != want {
+					t.Errorf("Has(%s) = %v, want %v", p, got, want)
+				}
+			}
+			if len(row.perms) != len(row.want) {
+				t.Errorf("set has %d permissions, want %d: %v", len(row.perms), len(row.want), row.perms.List())
+			}
+		})
+	}
+}
+
+func TestBuiltinRolesStayInCatalog(t *testing.T) {
+	for _, role := range BuiltinRoles {
+		for p := range ForRole(role) {
+			if !Valid(p) {
+				t.Errorf("%s has %s, which is not in All", role, p)
+			}
+		}
+	}
+	for _, p := range Platform {
+		if Valid(p) {
+			t.Errorf("%s is assignable to a custom role", p)
+		}
+	}
+}
+
+func TestForUserCustomRoleReplacesBase(t *testing.T) {
+	custom := []string{string(WorkOrderReadAll), string(ReportMonthlyRead)}
+
+	got := ForUser("admin", true, custom, false)
+	if !got.Covers(NewSet(WorkOrderReadAll, ReportMonthlyRead)) || len(got) != 2 {
+		t.Fatalf("admin with custom role = %v, want only the custom permissions", got.List())
+	}
+	if got.Has(RoleManage) || got.Has(UserReadAll) {
+		t.Fatal("custom role kept permissions from the base role")
+	}
+
+	// Un rol propio vacío deja al usuario sin permisos, no con los del base.
+	if got := ForUser("dispatcher", true, nil, false); len(got) != 0 {
+		t.Fatalf("empty custom role = %v, want no permissions", got.List())
+	}
+
+	// Sin rol propio asignado vale el base, aunque venga una lista.
+	if got := ForUser("client", false, custom, false); got.Has(WorkOrderReadAll) || !got.Has(WorkOrderReadCustomer) {
+		t.Fatalf("no custom role = %v, want the client defaults", got.List())
+	}
+
+	// Los de plataforma no salen de un rol propio, solo del flag de operador.
+	withPlatform := append(slices.Clone(custom), string(PlatformTenantManage), "user.delete")
+	if got := ForUser("admin", true, withPlatform, false); got.HasAny(Platform...) || len(got) != 2 {
+		t.Fatalf("custom role granted %v", got.List())
+	}
+	if got := ForUser("client", true, custom, true); !got.Has(PlatformTenantManage) || !got.Has(WorkOrderReadAll) || got.Has(WorkOrderReadCustomer) {
+		t.Fatalf("operator with custom role = %v", got.List())
+	}
+}
+
+func TestForUserDoesNotMutateBuiltin(t *testing.T) {
+	ForUser("technician", false, nil, true).Add(RoleManage)
+	if got := ForRole("technician"); got.HasAny(PlatformTenantRead, RoleManage) {
+		t.Fatalf("builtin technician set was mutated: %v", got.List())
+	}
+	if len(All) != len(ForRole("admin")) {
+		t.Fatal("admin set was mutated")
+	}
+}
+
+func TestFromStrings(t *testing.T) {
+	got := FromStrings([]string{"work_order.create", "work_order.create", "nope", "", "platform.tenant.read"})
+	if len(got) != 1 || !got.Has(WorkOrderCreate) {
+		t.Fatalf("FromStrings = %v", got.List())
+	}
+}
+
+// Covers es la regla anti-escalada: nadie arma ni asigna un rol con permisos
+// que él mismo no tiene.
+func TestCovers(t *testing.T) {
+	cases := []struct {
+		name  string
+		actor Set
+		role  Set
+		want  bool
+	}{
+		{"admin covers every builtin", ForRole("admin"), ForRole("dispatcher"), true},
+		{"admin covers the catalog", ForRole("admin"), NewSet(All...), true},
+		{"admin lacks platform", ForRole("admin"), NewSet(PlatformTenantRead), false},
+		{"dispatcher lacks the .assigned variants", ForRole("dispatcher"), ForRole("technician"), false},
+		{"dispatcher covers a subset", ForRole("dispatcher"), NewSet(WorkOrderReadAll, WorkOrderComment), true},
+		{"dispatcher lacks role.manage", ForRole("dispatcher"), NewSet(WorkOrderReadAll, RoleManage), false},
+		{"dispatcher does not cover client", ForRole("dispatcher"), ForRole("client"), false},
+		{"technician does not cover dispatcher", ForRole("technician"), ForRole("dispatcher"), false},
+		{"empty role is always covered", ForRole("client"), NewSet(), true},
+		{"empty actor covers nothing", NewSet(), NewSet(WorkOrderComment), false},
+		{"key cannot mint a role", ForScopes([]string{auth.ScopeWorkOrdersWrite}), NewSet(WorkOrderReadAll), false},
+		{"same set", ForRole("technician"), ForRole("technician"), true},
+	}
+	for _, tc := range cases {
+		if got := tc.actor.Covers(tc.role); got != tc.want {
+			t.Errorf("%s: Covers = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestManageableRoles(t *testing.T) {
+	cases := []struct {
+		perms Set
+		want  []string
+	}{
+		{ForRole("admin"), []string{"dispatcher", "technician", "client"}},
+		{ForRole("dispatcher"), []string{"technician"}},
+		{ForRole("technician"), nil},
+		{ForRole("client"), nil},
+		{ForScopes(auth.Scopes), nil},
+		{NewSet(UserInviteClient), []string{"client"}},
+	}
+	for _, tc := range cases {
+		if got := tc.perms.ManageableRoles(); !slices.Equal(got, tc.want) {
+			t.Errorf("ManageableRoles(%v) = %v, want %v", tc.perms.List(), got, tc.want)
+		}
+		if tc.perms.CanManageRole("admin") {
+			t.Errorf("%v can manage admins", tc.perms.List())
+		}
+	}
+}
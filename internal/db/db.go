@@ -4,14 +4,23 @@ import (
 	"context"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DB struct {
 	Pool *pgxpool.Pool
+
+	// SystemRole: rol BYPASSRLS al que pasa cada transacción de WithSystem.
+	// Vacío => WithSystem no cambia de rol (y con RLS activo no ve nada).
+	SystemRole string
 }
 
-func New(databaseURL string) (*DB, error) {
+// New abre el pool. Si appRole no es vacío, cada conexión hace SET ROLE a ese
+// rol (sin BYPASSRLS ni ownership) para que las políticas RLS apliquen aunque
+// DATABASE_URL sea el usuario dueño de las tablas. systemRole es el que usa
+// WithSystem (ver DB.SystemRole).
+func New(databaseURL, appRole, systemRole string) (*DB, error) {
 	cfg, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, err
@@ -21,6 +30,13 @@ func New(databaseURL string) (*DB, error) {
 	cfg.MinConns = 2
 	cfg.MaxConnLifetime = time.Hour
 
+	if appRole != "" {
+		cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+			_, err := conn.Exec(ctx, `SET ROLE `+pgx.Identifier{appRole}.Sanitize())
+			return err
+		}
+	}
+
 	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		return nil, err
@@ -34,5 +50,5 @@ func New(databaseURL string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{Pool: pool}, nil
+	return &DB{Pool: pool, SystemRole: systemRole}, nil
 }
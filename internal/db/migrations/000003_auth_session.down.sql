@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS trg_user_deactivate_sessions ON "user";
+DROP FUNCTION IF EXISTS revoke_sessions_on_user_deactivate();
+
+DROP TABLE IF EXISTS revoked_access_token;
+DROP TABLE IF EXISTS refresh_token;
+DROP TABLE IF EXISTS auth_session;
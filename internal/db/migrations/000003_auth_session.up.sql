@@ -0,0 +1,68 @@
+-- =========================
+-- Auth sessions / refresh tokens
+-- =========================
+
+-- Una sesión por login. Los refresh tokens rotan dentro de la sesión;
+-- revocar la sesión invalida todos sus access tokens (AuthMiddleware la consulta).
+CREATE TABLE IF NOT EXISTS auth_session (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  user_id uuid NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+
+  user_agent varchar(255),
+  ip_address varchar(64),
+
+  expires_at timestamptz NOT NULL,
+  last_used_at timestamptz,
+  revoked_at timestamptz,
+  revoked_reason varchar(40),
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_session_user
+  ON auth_session(user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_token (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  session_id uuid NOT NULL REFERENCES auth_session(id) ON DELETE CASCADE,
+
+  token_hash varchar(255) NOT NULL,
+  used_at timestamptz,
+
+  created_at timestamptz NOT NULL DEFAULT now(),
+
+  UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_token_session
+  ON refresh_token(session_id);
+
+-- Access tokens revocados individualmente (logout). Solo hace falta guardarlos
+-- hasta que expiran.
+CREATE TABLE IF NOT EXISTS revoked_access_token (
+  jti varchar(64) PRIMARY KEY,
+  user_id uuid NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+  expires_at timestamptz NOT NULL,
+  revoked_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_access_token_expires
+  ON revoked_access_token(expires_at);
+
+-- Desactivar un usuario mata sus sesiones en el acto, venga el UPDATE de la API o de SQL a mano.
+CREATE OR REPLACE FUNCTION revoke_sessions_on_user_deactivate() RETURNS trigger AS $$
+BEGIN
+  IF OLD.is_active AND NOT NEW.is_active THEN
+    UPDATE auth_session
+    SET revoked_at = now(), revoked_reason = 'user_deactivated'
+    WHERE user_id = NEW.id AND revoked_at IS NULL;
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_user_deactivate_sessions ON "user";
+CREATE TRIGGER trg_user_deactivate_sessions
+  AFTER UPDATE OF is_active ON "user"
+  FOR EACH ROW EXECUTE FUNCTION revoke_sessions_on_user_deactivate();
@@ -0,0 +1,24 @@
+-- =========================
+-- Password reset (self-service)
+-- =========================
+
+CREATE TABLE IF NOT EXISTS password_reset (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  user_id uuid NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+
+  token_hash varchar(255) NOT NULL,
+  expires_at timestamptz NOT NULL,
+  used_at timestamptz,
+
+  requested_ip varchar(64),
+  created_at timestamptz NOT NULL DEFAULT now(),
+
+  UNIQUE (token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_user
+  ON password_reset(user_id);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_expires
+  ON password_reset(expires_at);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_user_invitation_provider;
+
+ALTER TABLE user_invitation
+  DROP COLUMN IF EXISTS swept_at,
+  DROP COLUMN IF EXISTS revoked_by,
+  DROP COLUMN IF EXISTS revoked_at;
@@ -0,0 +1,12 @@
+-- =========================
+-- Invitation management (resend / revoke / sweeper)
+-- =========================
+
+ALTER TABLE user_invitation
+  ADD COLUMN IF NOT EXISTS revoked_at timestamptz,
+  ADD COLUMN IF NOT EXISTS revoked_by uuid REFERENCES "user"(id),
+  -- lo marca el sweeper cuando la invitación lleva tiempo vencida sin usarse
+  ADD COLUMN IF NOT EXISTS swept_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_user_invitation_provider
+  ON user_invitation(service_provider_id, created_at DESC);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS mfa_recovery_code;
+DROP TABLE IF EXISTS user_mfa;
+
+ALTER TABLE service_provider DROP COLUMN IF EXISTS mfa_required;
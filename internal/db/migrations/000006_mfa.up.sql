@@ -0,0 +1,31 @@
+-- =========================
+-- TOTP two-factor authentication
+-- =========================
+
+-- Si está activo, admin y dispatcher del provider no pueden entrar sin MFA.
+ALTER TABLE service_provider
+  ADD COLUMN IF NOT EXISTS mfa_required boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS user_mfa (
+  user_id uuid PRIMARY KEY REFERENCES "user"(id) ON DELETE CASCADE,
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+
+  totp_secret varchar(64) NOT NULL,
+  enabled_at timestamptz,        -- NULL = enrolamiento sin confirmar
+  last_used_step bigint,         -- último paso TOTP aceptado (anti-replay)
+
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_code (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id uuid NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+
+  code_hash varchar(255) NOT NULL,
+  used_at timestamptz,
+
+  created_at timestamptz NOT NULL DEFAULT now(),
+
+  UNIQUE (user_id, code_hash)
+);
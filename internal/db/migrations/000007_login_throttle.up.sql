@@ -0,0 +1,37 @@
+-- =========================
+-- Login brute-force protection
+-- =========================
+
+-- Contadores compartidos entre réplicas (throttle.PostgresStore).
+CREATE TABLE IF NOT EXISTS login_throttle (
+  key varchar(200) PRIMARY KEY,
+  failures int NOT NULL DEFAULT 0,
+  last_failure_at timestamptz NOT NULL,
+  locked_until timestamptz
+);
+
+-- Historial de intentos para que el admin vea actividad sospechosa.
+-- service_provider_id es NULL si el intento no se pudo asociar a un provider.
+CREATE TABLE IF NOT EXISTS login_attempt (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid REFERENCES service_provider(id),
+  user_id uuid REFERENCES "user"(id) ON DELETE SET NULL,
+
+  email varchar(100) NOT NULL,
+  ip_address varchar(64) NOT NULL,
+  user_agent varchar(255),
+
+  success boolean NOT NULL,
+  reason varchar(40) NOT NULL,
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempt_provider
+  ON login_attempt(service_provider_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempt_email
+  ON login_attempt(email, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempt_ip
+  ON login_attempt(ip_address, created_at DESC);
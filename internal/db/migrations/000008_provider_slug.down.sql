@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_email;
+DROP INDEX IF EXISTS uq_service_provider_slug;
+ALTER TABLE service_provider DROP CONSTRAINT IF EXISTS chk_service_provider_slug;
+ALTER TABLE service_provider DROP COLUMN IF EXISTS slug;
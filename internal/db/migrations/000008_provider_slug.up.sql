@@ -0,0 +1,51 @@
+-- =========================
+-- Slug legible del service_provider (login sin UUID)
+-- =========================
+
+ALTER TABLE service_provider
+  ADD COLUMN IF NOT EXISTS slug varchar(63);
+
+-- Backfill desde el nombre: "Frío Norte S.A." -> "frio-norte-s-a".
+-- Si dos providers generan el mismo slug, los siguientes llevan un sufijo del id.
+WITH base AS (
+  SELECT
+    id,
+    created_at,
+    coalesce(
+      nullif(
+        trim(BOTH '-' FROM regexp_replace(
+          translate(lower(name), 'áàäâéèëêíìïîóòöôúùüûñç', 'aaaaeeeeiiiioooouuuunc'),
+          '[^a-z0-9]+', '-', 'g'
+        )),
+        ''
+      ),
+      'provider'
+    ) AS slug
+  FROM service_provider
+  WHERE slug IS NULL
+),
+ranked AS (
+  SELECT
+    id,
+    trim(BOTH '-' FROM left(slug, 50)) AS slug,
+    row_number() OVER (PARTITION BY slug ORDER BY created_at, id) AS rn
+  FROM base
+)
+UPDATE service_provider sp
+SET slug = r.slug || CASE WHEN r.rn > 1 THEN '-' || left(sp.id::text, 8) ELSE '' END
+FROM ranked r
+WHERE sp.id = r.id;
+
+ALTER TABLE service_provider
+  ALTER COLUMN slug SET NOT NULL;
+
+ALTER TABLE service_provider
+  ADD CONSTRAINT chk_service_provider_slug
+  CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$');
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_service_provider_slug
+  ON service_provider(slug);
+
+-- Descubrimiento de tenant: buscar un email en todos los providers.
+CREATE INDEX IF NOT EXISTS idx_user_email
+  ON "user"(email);
@@ -0,0 +1,24 @@
+-- =========================
+-- API keys (integraciones máquina a máquina)
+-- =========================
+
+CREATE TABLE IF NOT EXISTS api_key (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+
+  name varchar(100) NOT NULL,
+  prefix varchar(20) NOT NULL UNIQUE,      -- parte visible, ej. "hvk_1a2b3c4d"
+  key_hash varchar(255) NOT NULL UNIQUE,   -- sha256 de la key completa
+  scopes text[] NOT NULL DEFAULT '{}',
+
+  created_by uuid NOT NULL REFERENCES "user"(id),
+  expires_at timestamptz,                  -- NULL = no expira
+  last_used_at timestamptz,
+  revoked_at timestamptz,
+  revoked_by uuid REFERENCES "user"(id),
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_key_provider
+  ON api_key(service_provider_id, created_at DESC);
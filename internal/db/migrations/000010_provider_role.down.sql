@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_custom_role;
+ALTER TABLE "user" DROP COLUMN IF EXISTS custom_role_id;
+DROP TABLE IF EXISTS provider_role_permission;
+DROP TABLE IF EXISTS provider_role;
@@ -0,0 +1,33 @@
+-- =========================
+-- Roles propios por provider (permisos finos)
+-- =========================
+
+-- Un rol propio extiende un user_role base (que sigue definiendo el alcance de
+-- los datos: el client ve su customer, el technician lo asignado) y reemplaza
+-- sus permisos por los de provider_role_permission.
+CREATE TABLE IF NOT EXISTS provider_role (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+
+  name varchar(60) NOT NULL,
+  description varchar(255),
+  base_role user_role NOT NULL,
+
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+
+  UNIQUE (service_provider_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS provider_role_permission (
+  role_id uuid NOT NULL REFERENCES provider_role(id) ON DELETE CASCADE,
+  permission varchar(64) NOT NULL,
+  PRIMARY KEY (role_id, permission)
+);
+
+-- RESTRICT: no se borra un rol que todavía tiene usuarios.
+ALTER TABLE "user"
+  ADD COLUMN IF NOT EXISTS custom_role_id uuid REFERENCES provider_role(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_user_custom_role
+  ON "user"(custom_role_id) WHERE custom_role_id IS NOT NULL;
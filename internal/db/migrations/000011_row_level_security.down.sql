@@ -0,0 +1,18 @@
+DO $$
+DECLARE
+  t text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY[
+    'customer', 'site', 'area', 'asset',
+    'work_order', 'work_order_attachment', 'work_order_comment',
+    'user_invitation'
+  ] LOOP
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+    EXECUTE format('ALTER TABLE %I NO FORCE ROW LEVEL SECURITY', t);
+    EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t);
+  END LOOP;
+END $$;
+
+DROP FUNCTION IF EXISTS app_tenant_visible(uuid);
+
+-- El rol hvac_app se deja: puede tener conexiones/privilegios en otras bases.
@@ -0,0 +1,52 @@
+-- =========================
+-- Row-level security por tenant
+-- =========================
+
+-- La API no corre como dueño de las tablas (el dueño y los superusers se saltan
+-- RLS): cada conexión hace SET ROLE hvac_app (ver db.New / DB_APP_ROLE).
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'hvac_app') THEN
+    CREATE ROLE hvac_app NOLOGIN;
+  END IF;
+END $$;
+
+GRANT hvac_app TO CURRENT_USER;
+GRANT USAGE ON SCHEMA public TO hvac_app;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO hvac_app;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO hvac_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+  GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO hvac_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+  GRANT USAGE, SELECT ON SEQUENCES TO hvac_app;
+
+-- Visible si es del tenant fijado en la sesión (db.WithTenant) o si la sesión
+-- es de sistema (db.WithSystem). Sin nada fijado no se ve ninguna fila.
+CREATE OR REPLACE FUNCTION app_tenant_visible(sp uuid) RETURNS boolean
+LANGUAGE sql STABLE AS $$
+  SELECT current_setting('app.bypass_rls', true) = 'on'
+      OR sp = nullif(current_setting('app.service_provider_id', true), '')::uuid
+$$;
+
+-- "user" queda fuera a propósito: el login (y el descubrimiento de tenant)
+-- busca por email antes de saber el provider. Sus queries filtran a mano.
+DO $$
+DECLARE
+  t text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY[
+    'customer', 'site', 'area', 'asset',
+    'work_order', 'work_order_attachment', 'work_order_comment',
+    'user_invitation'
+  ] LOOP
+    EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+    EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', t);
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+    EXECUTE format(
+      'CREATE POLICY tenant_isolation ON %I
+         USING (app_tenant_visible(service_provider_id))
+         WITH CHECK (app_tenant_visible(service_provider_id))',
+      t
+    );
+  END LOOP;
+END $$;
@@ -0,0 +1,5 @@
+ALTER TABLE "user" DROP COLUMN IF EXISTS is_platform_operator;
+ALTER TABLE service_provider
+  DROP COLUMN IF EXISTS suspended_by,
+  DROP COLUMN IF EXISTS suspended_reason,
+  DROP COLUMN IF EXISTS suspended_at;
@@ -0,0 +1,15 @@
+-- =========================
+-- Alta de providers y administración de la plataforma
+-- =========================
+
+-- Provider suspendido: nadie de ese provider puede entrar (login, refresh,
+-- tokens ya emitidos y API keys) hasta que se reactive.
+ALTER TABLE service_provider
+  ADD COLUMN IF NOT EXISTS suspended_at timestamptz,
+  ADD COLUMN IF NOT EXISTS suspended_reason varchar(255),
+  ADD COLUMN IF NOT EXISTS suspended_by uuid REFERENCES "user"(id);
+
+-- Operadores de la plataforma (nosotros, no los clientes): ven y administran
+-- todos los providers. Solo se otorga por SQL, nunca desde la API.
+ALTER TABLE "user"
+  ADD COLUMN IF NOT EXISTS is_platform_operator boolean NOT NULL DEFAULT false;
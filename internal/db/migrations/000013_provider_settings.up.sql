@@ -0,0 +1,49 @@
+-- =========================
+-- Configuración por provider (zona horaria, idioma, marca, defaults)
+-- =========================
+
+-- Los defaults tienen que coincidir con defaultProviderSettings (httpapi/settings.go):
+-- un provider sin fila se comporta igual que uno con la fila recién creada.
+CREATE TABLE IF NOT EXISTS provider_settings (
+  service_provider_id uuid PRIMARY KEY REFERENCES service_provider(id),
+
+  timezone varchar(64) NOT NULL DEFAULT 'UTC',           -- IANA, ej. America/Bogota
+  language varchar(5) NOT NULL DEFAULT 'es',
+  currency char(3) NOT NULL DEFAULT 'USD',               -- ISO 4217
+
+  logo bytea,
+  logo_content_type varchar(40),
+  primary_color varchar(7),                              -- #RRGGBB
+  secondary_color varchar(7),
+
+  default_work_order_priority work_order_priority NOT NULL DEFAULT 'medium',
+  default_work_order_type work_order_type NOT NULL DEFAULT 'corrective',
+  invite_ttl_hours int NOT NULL DEFAULT 48,
+
+  updated_by uuid REFERENCES "user"(id),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+
+  CONSTRAINT chk_provider_settings_language CHECK (language IN ('es', 'en')),
+  CONSTRAINT chk_provider_settings_currency CHECK (currency ~ '^[A-Z]{3}$'),
+  CONSTRAINT chk_provider_settings_colors CHECK (
+    (primary_color IS NULL OR primary_color ~ '^#[0-9a-f]{6}$') AND
+    (secondary_color IS NULL OR secondary_color ~ '^#[0-9a-f]{6}$')
+  ),
+  CONSTRAINT chk_provider_settings_logo CHECK (
+    (logo IS NULL) = (logo_content_type IS NULL) AND
+    (logo IS NULL OR octet_length(logo) <= 512 * 1024)
+  ),
+  CONSTRAINT chk_provider_settings_invite_ttl CHECK (invite_ttl_hours BETWEEN 1 AND 720)
+);
+
+INSERT INTO provider_settings (service_provider_id)
+SELECT id FROM service_provider
+ON CONFLICT (service_provider_id) DO NOTHING;
+
+ALTER TABLE provider_settings ENABLE ROW LEVEL SECURITY;
+ALTER TABLE provider_settings FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON provider_settings;
+CREATE POLICY tenant_isolation ON provider_settings
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_area_site;
+DROP INDEX IF EXISTS idx_site_customer;
+
+ALTER TABLE area DROP CONSTRAINT IF EXISTS fk_area_site_provider;
+ALTER TABLE site DROP CONSTRAINT IF EXISTS fk_site_customer_provider;
+
+DROP INDEX IF EXISTS uq_site_id_provider;
+DROP INDEX IF EXISTS uq_customer_id_provider;
+
+ALTER TABLE site DROP CONSTRAINT IF EXISTS chk_site_coordinates;
+ALTER TABLE site
+  DROP COLUMN IF EXISTS opening_hours,
+  DROP COLUMN IF EXISTS contact_phone,
+  DROP COLUMN IF EXISTS contact_name,
+  DROP COLUMN IF EXISTS access_instructions,
+  DROP COLUMN IF EXISTS longitude,
+  DROP COLUMN IF EXISTS latitude;
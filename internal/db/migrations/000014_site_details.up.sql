@@ -0,0 +1,43 @@
+-- =========================
+-- Sitios: ubicación y datos para el técnico
+-- =========================
+
+ALTER TABLE site
+  ADD COLUMN IF NOT EXISTS latitude numeric(9,6),
+  ADD COLUMN IF NOT EXISTS longitude numeric(9,6),
+  ADD COLUMN IF NOT EXISTS access_instructions varchar(1000),
+  ADD COLUMN IF NOT EXISTS contact_name varchar(80),
+  ADD COLUMN IF NOT EXISTS contact_phone varchar(20),
+  -- {"mon": ["08:00-12:00", "14:00-18:00"], "sat": ["09:00-13:00"]}
+  ADD COLUMN IF NOT EXISTS opening_hours jsonb;
+
+ALTER TABLE site
+  ADD CONSTRAINT chk_site_coordinates CHECK (
+    (latitude IS NULL) = (longitude IS NULL) AND
+    (latitude IS NULL OR latitude BETWEEN -90 AND 90) AND
+    (longitude IS NULL OR longitude BETWEEN -180 AND 180)
+  );
+
+-- =========================
+-- Misma jerarquía dentro del provider
+-- =========================
+
+-- FKs compuestas: un site solo puede colgar de un customer de su mismo provider
+-- y un área de un site de su mismo provider, lo haga quien lo haga.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_customer_id_provider
+  ON customer(id, service_provider_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_site_id_provider
+  ON site(id, service_provider_id);
+
+ALTER TABLE site
+  ADD CONSTRAINT fk_site_customer_provider
+  FOREIGN KEY (customer_id, service_provider_id)
+  REFERENCES customer(id, service_provider_id);
+
+ALTER TABLE area
+  ADD CONSTRAINT fk_area_site_provider
+  FOREIGN KEY (site_id, service_provider_id)
+  REFERENCES site(id, service_provider_id);
+
+CREATE INDEX IF NOT EXISTS idx_site_customer ON site(customer_id);
+CREATE INDEX IF NOT EXISTS idx_area_site ON area(site_id);
@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS idx_asset_provider_status;
+DROP INDEX IF EXISTS idx_asset_area;
+DROP INDEX IF EXISTS idx_asset_site;
+
+ALTER TABLE asset DROP CONSTRAINT IF EXISTS fk_asset_area_site;
+ALTER TABLE asset DROP CONSTRAINT IF EXISTS fk_asset_site_customer;
+ALTER TABLE asset DROP CONSTRAINT IF EXISTS fk_asset_customer_provider;
+
+DROP INDEX IF EXISTS uq_area_id_site;
+DROP INDEX IF EXISTS uq_site_id_customer;
+
+DROP TABLE IF EXISTS asset_status_history;
+
+ALTER TABLE asset ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE asset ALTER COLUMN status TYPE varchar(20) USING status::text;
+ALTER TABLE asset ALTER COLUMN status SET DEFAULT 'active';
+
+DROP TYPE IF EXISTS asset_status;
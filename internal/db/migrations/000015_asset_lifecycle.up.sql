@@ -0,0 +1,78 @@
+-- =========================
+-- Estado del equipo: ciclo de vida controlado
+-- =========================
+
+DO $$ BEGIN
+  CREATE TYPE asset_status AS ENUM ('active','out_of_service','decommissioned');
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
+
+-- status era varchar libre: lo conocido se mapea, lo demás queda 'active'.
+ALTER TABLE asset ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE asset
+  ALTER COLUMN status TYPE asset_status USING (
+    CASE lower(trim(status))
+      WHEN 'out_of_service' THEN 'out_of_service'
+      WHEN 'decommissioned' THEN 'decommissioned'
+      ELSE 'active'
+    END
+  )::asset_status;
+ALTER TABLE asset ALTER COLUMN status SET DEFAULT 'active';
+
+-- Historial de cambios de estado (el alta cuenta como from_status NULL).
+CREATE TABLE IF NOT EXISTS asset_status_history (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  asset_id uuid NOT NULL REFERENCES asset(id) ON DELETE CASCADE,
+
+  from_status asset_status,
+  to_status asset_status NOT NULL,
+  reason varchar(500),
+
+  changed_by uuid REFERENCES "user"(id),
+  changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_status_history_asset
+  ON asset_status_history(asset_id, changed_at DESC);
+
+-- Los equipos que ya existían arrancan su historial con el estado actual.
+INSERT INTO asset_status_history (service_provider_id, asset_id, from_status, to_status, changed_at)
+SELECT service_provider_id, id, NULL, status, created_at
+FROM asset;
+
+ALTER TABLE asset_status_history ENABLE ROW LEVEL SECURITY;
+ALTER TABLE asset_status_history FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON asset_status_history;
+CREATE POLICY tenant_isolation ON asset_status_history
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
+
+-- =========================
+-- Jerarquía consistente: customer > site > area > asset, todo del mismo provider
+-- =========================
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_site_id_customer
+  ON site(id, customer_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_area_id_site
+  ON area(id, site_id);
+
+ALTER TABLE asset
+  ADD CONSTRAINT fk_asset_customer_provider
+  FOREIGN KEY (customer_id, service_provider_id)
+  REFERENCES customer(id, service_provider_id);
+
+ALTER TABLE asset
+  ADD CONSTRAINT fk_asset_site_customer
+  FOREIGN KEY (site_id, customer_id)
+  REFERENCES site(id, customer_id);
+
+-- area_id NULL => no aplica (MATCH SIMPLE)
+ALTER TABLE asset
+  ADD CONSTRAINT fk_asset_area_site
+  FOREIGN KEY (area_id, site_id)
+  REFERENCES area(id, site_id);
+
+CREATE INDEX IF NOT EXISTS idx_asset_site ON asset(site_id);
+CREATE INDEX IF NOT EXISTS idx_asset_area ON asset(area_id);
+CREATE INDEX IF NOT EXISTS idx_asset_provider_status ON asset(service_provider_id, status);
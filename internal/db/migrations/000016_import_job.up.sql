@@ -0,0 +1,44 @@
+-- =========================
+-- Importación masiva (CSV / XLSX)
+-- =========================
+
+-- Un job por archivo subido. Se valida al subirlo (dry-run) y se aplica con
+-- /commit en una sola transacción; el archivo queda guardado para eso.
+CREATE TABLE IF NOT EXISTS import_job (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+
+  kind varchar(20) NOT NULL,   -- customers | sites | areas | assets
+  format varchar(10) NOT NULL, -- csv | xlsx
+  filename varchar(255),
+  file bytea NOT NULL,
+
+  -- validated: sin errores, lista para commit | invalid: con errores | committed: aplicada
+  status varchar(20) NOT NULL,
+  total_rows int NOT NULL DEFAULT 0,
+  created_rows int NOT NULL DEFAULT 0,
+  updated_rows int NOT NULL DEFAULT 0,
+  -- [{"row": 3, "column": "type", "message": "invalid type"}, ...]
+  errors jsonb NOT NULL DEFAULT '[]',
+
+  created_by uuid NOT NULL REFERENCES "user"(id),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  validated_at timestamptz NOT NULL DEFAULT now(),
+  committed_by uuid REFERENCES "user"(id),
+  committed_at timestamptz,
+
+  CONSTRAINT chk_import_job_kind CHECK (kind IN ('customers','sites','areas','assets')),
+  CONSTRAINT chk_import_job_format CHECK (format IN ('csv','xlsx')),
+  CONSTRAINT chk_import_job_status CHECK (status IN ('validated','invalid','committed')),
+  CONSTRAINT chk_import_job_file CHECK (octet_length(file) <= 5 * 1024 * 1024)
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_job_provider_created
+  ON import_job(service_provider_id, created_at DESC);
+
+ALTER TABLE import_job ENABLE ROW LEVEL SECURITY;
+ALTER TABLE import_job FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON import_job;
+CREATE POLICY tenant_isolation ON import_job
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_work_order_attachment_wo;
+DROP INDEX IF EXISTS idx_work_order_comment_wo;
+DROP INDEX IF EXISTS idx_work_order_asset;
+
+ALTER TABLE work_order DROP COLUMN IF EXISTS assigned_at;
+
+DROP TABLE IF EXISTS asset_reading;
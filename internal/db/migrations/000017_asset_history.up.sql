@@ -0,0 +1,46 @@
+-- =========================
+-- Lecturas de los equipos (presiones, temperaturas, consumo...)
+-- =========================
+
+CREATE TABLE IF NOT EXISTS asset_reading (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  asset_id uuid NOT NULL REFERENCES asset(id) ON DELETE CASCADE,
+  work_order_id uuid REFERENCES work_order(id),
+
+  kind varchar(40) NOT NULL, -- suction_pressure, supply_air_temp, current...
+  value numeric(12,3) NOT NULL,
+  unit varchar(16),
+  notes varchar(500),
+
+  recorded_by uuid NOT NULL REFERENCES "user"(id),
+  recorded_at timestamptz NOT NULL DEFAULT now(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+
+  CONSTRAINT chk_asset_reading_kind CHECK (kind ~ '^[a-z0-9_]+$')
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_reading_asset
+  ON asset_reading(asset_id, recorded_at DESC);
+
+ALTER TABLE asset_reading ENABLE ROW LEVEL SECURITY;
+ALTER TABLE asset_reading FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON asset_reading;
+CREATE POLICY tenant_isolation ON asset_reading
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
+
+-- =========================
+-- Línea de tiempo: cuándo se asignó cada orden
+-- =========================
+
+ALTER TABLE work_order
+  ADD COLUMN IF NOT EXISTS assigned_at timestamptz;
+
+-- Hasta ahora solo se asignaba al crear.
+UPDATE work_order SET assigned_at = created_at
+WHERE assigned_to IS NOT NULL AND assigned_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_work_order_asset ON work_order(asset_id);
+CREATE INDEX IF NOT EXISTS idx_work_order_comment_wo ON work_order_comment(work_order_id);
+CREATE INDEX IF NOT EXISTS idx_work_order_attachment_wo ON work_order_attachment(work_order_id);
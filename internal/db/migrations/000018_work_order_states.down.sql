@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_work_order_provider_status;
+
+ALTER TABLE work_order
+  DROP COLUMN IF EXISTS cancel_reason,
+  DROP COLUMN IF EXISTS cancelled_at;
@@ -0,0 +1,14 @@
+-- =========================
+-- Máquina de estados de las órdenes: cancelación con motivo
+-- =========================
+
+ALTER TABLE work_order
+  ADD COLUMN IF NOT EXISTS cancelled_at timestamptz,
+  ADD COLUMN IF NOT EXISTS cancel_reason varchar(500);
+
+-- Las creadas con técnico quedaban en 'open'.
+UPDATE work_order SET status = 'assigned'
+WHERE status = 'open' AND assigned_to IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_work_order_provider_status
+  ON work_order(service_provider_id, status);
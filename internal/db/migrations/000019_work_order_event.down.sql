@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trg_work_order_event_immutable ON work_order_event;
+DROP FUNCTION IF EXISTS work_order_event_immutable();
+DROP TABLE IF EXISTS work_order_event;
@@ -0,0 +1,53 @@
+-- =========================
+-- Auditoría de órdenes: log append-only de cada alta, edición y transición
+-- =========================
+
+CREATE TABLE IF NOT EXISTS work_order_event (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  work_order_id uuid NOT NULL REFERENCES work_order(id),
+
+  action varchar(40) NOT NULL, -- created, updated, assign, start, pause, complete, cancel, reopen
+  actor_id uuid REFERENCES "user"(id),
+  api_key_id uuid, -- si vino por API key (actor_id es quien la creó)
+
+  old_status work_order_status,
+  new_status work_order_status,
+  changes jsonb NOT NULL DEFAULT '{}'::jsonb, -- {"campo": {"from": ..., "to": ...}}
+  reason varchar(500),
+
+  ip_address varchar(64),
+  user_agent varchar(255),
+
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_work_order_event_wo
+  ON work_order_event(work_order_id, created_at);
+
+ALTER TABLE work_order_event ENABLE ROW LEVEL SECURITY;
+ALTER TABLE work_order_event FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON work_order_event;
+CREATE POLICY tenant_isolation ON work_order_event
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
+
+-- Inmutable: la API no puede editar ni borrar eventos (ni por permisos ni por trigger).
+REVOKE UPDATE, DELETE, TRUNCATE ON work_order_event FROM hvac_app;
+
+CREATE OR REPLACE FUNCTION work_order_event_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'work_order_event is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_work_order_event_immutable ON work_order_event;
+CREATE TRIGGER trg_work_order_event_immutable
+  BEFORE UPDATE OR DELETE ON work_order_event
+  FOR EACH ROW EXECUTE FUNCTION work_order_event_immutable();
+
+-- Las órdenes existentes arrancan con su alta (sin diff: no sabemos más).
+INSERT INTO work_order_event (service_provider_id, work_order_id, action, actor_id, new_status, created_at)
+SELECT wo.service_provider_id, wo.id, 'created', wo.created_by, 'open', wo.created_at
+FROM work_order wo
+WHERE NOT EXISTS (SELECT 1 FROM work_order_event e WHERE e.work_order_id = wo.id);
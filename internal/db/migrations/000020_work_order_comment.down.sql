@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_work_order_comment_wo_created;
+
+ALTER TABLE work_order_comment
+  DROP COLUMN IF EXISTS edited_at,
+  DROP COLUMN IF EXISTS mentions,
+  DROP COLUMN IF EXISTS is_internal;
@@ -0,0 +1,12 @@
+-- =========================
+-- Comentarios de órdenes: internos vs visibles al cliente, menciones, edición
+-- =========================
+
+-- Los existentes quedan internos: se escribieron sin que el cliente los viera.
+ALTER TABLE work_order_comment
+  ADD COLUMN IF NOT EXISTS is_internal boolean NOT NULL DEFAULT true,
+  ADD COLUMN IF NOT EXISTS mentions uuid[] NOT NULL DEFAULT '{}',
+  ADD COLUMN IF NOT EXISTS edited_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_work_order_comment_wo_created
+  ON work_order_comment(work_order_id, created_at);
@@ -0,0 +1,36 @@
+-- Los eventos de órdenes borradas no tienen a qué apuntar (y se conservan):
+-- el FK vuelve NOT VALID, valida solo las filas nuevas.
+ALTER TABLE work_order_event
+  ADD CONSTRAINT work_order_event_work_order_id_fkey
+  FOREIGN KEY (work_order_id) REFERENCES work_order(id) NOT VALID;
+
+ALTER TABLE asset_reading DROP CONSTRAINT IF EXISTS asset_reading_work_order_id_fkey;
+ALTER TABLE asset_reading
+  ADD CONSTRAINT asset_reading_work_order_id_fkey
+  FOREIGN KEY (work_order_id) REFERENCES work_order(id);
+
+DROP TRIGGER IF EXISTS trg_upload_parts_deletion ON attachment_upload;
+DROP FUNCTION IF EXISTS queue_upload_parts_deletion();
+DROP TRIGGER IF EXISTS trg_attachment_object_deletion ON work_order_attachment;
+DROP FUNCTION IF EXISTS queue_attachment_object_deletion();
+
+DROP TABLE IF EXISTS storage_deletion;
+DROP TABLE IF EXISTS attachment_upload;
+
+ALTER TABLE provider_settings DROP CONSTRAINT IF EXISTS chk_provider_settings_max_upload;
+ALTER TABLE provider_settings DROP COLUMN IF EXISTS max_upload_mb;
+
+-- Los adjuntos guardados en storage no tienen URL: se deja la key como
+-- referencia para que file_url pueda volver a NOT NULL sin perder filas.
+UPDATE work_order_attachment
+SET file_url = 'storage:' || storage_key
+WHERE file_url IS NULL AND storage_key IS NOT NULL;
+
+DROP INDEX IF EXISTS uq_attachment_storage_key;
+ALTER TABLE work_order_attachment DROP CONSTRAINT IF EXISTS chk_attachment_location;
+ALTER TABLE work_order_attachment
+  DROP COLUMN IF EXISTS size_bytes,
+  DROP COLUMN IF EXISTS content_type,
+  DROP COLUMN IF EXISTS filename,
+  DROP COLUMN IF EXISTS storage_key;
+ALTER TABLE work_order_attachment ALTER COLUMN file_url SET NOT NULL;
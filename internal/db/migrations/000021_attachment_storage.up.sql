@@ -0,0 +1,124 @@
+-- =========================
+-- Adjuntos en object storage (disco local o S3)
+-- =========================
+
+-- file_url queda para los adjuntos viejos (URL externa); los nuevos guardan la
+-- key del objeto y se descargan por link firmado.
+ALTER TABLE work_order_attachment
+  ALTER COLUMN file_url DROP NOT NULL,
+  ADD COLUMN IF NOT EXISTS storage_key varchar(300),
+  ADD COLUMN IF NOT EXISTS filename varchar(255),
+  ADD COLUMN IF NOT EXISTS content_type varchar(100),
+  ADD COLUMN IF NOT EXISTS size_bytes bigint;
+
+ALTER TABLE work_order_attachment DROP CONSTRAINT IF EXISTS chk_attachment_location;
+ALTER TABLE work_order_attachment
+  ADD CONSTRAINT chk_attachment_location CHECK (file_url IS NOT NULL OR storage_key IS NOT NULL);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_attachment_storage_key
+  ON work_order_attachment(storage_key) WHERE storage_key IS NOT NULL;
+
+-- Límite de tamaño por archivo, por provider (el tope duro está en la API).
+ALTER TABLE provider_settings
+  ADD COLUMN IF NOT EXISTS max_upload_mb int NOT NULL DEFAULT 25;
+ALTER TABLE provider_settings DROP CONSTRAINT IF EXISTS chk_provider_settings_max_upload;
+ALTER TABLE provider_settings
+  ADD CONSTRAINT chk_provider_settings_max_upload CHECK (max_upload_mb BETWEEN 1 AND 100);
+
+-- =========================
+-- Subidas reanudables: el archivo llega en partes (objetos {sp}/uploads/{id}/{n})
+-- y al completarse se arma el adjunto.
+-- =========================
+
+CREATE TABLE IF NOT EXISTS attachment_upload (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  work_order_id uuid NOT NULL REFERENCES work_order(id) ON DELETE CASCADE,
+
+  filename varchar(255) NOT NULL,
+  size_bytes bigint NOT NULL,
+  received_bytes bigint NOT NULL DEFAULT 0,
+  parts int NOT NULL DEFAULT 0,
+
+  created_by uuid NOT NULL REFERENCES "user"(id),
+  expires_at timestamptz NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+
+  CONSTRAINT chk_attachment_upload_size CHECK (size_bytes > 0 AND received_bytes BETWEEN 0 AND size_bytes)
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_upload_expires ON attachment_upload(expires_at);
+
+ALTER TABLE attachment_upload ENABLE ROW LEVEL SECURITY;
+ALTER TABLE attachment_upload FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON attachment_upload;
+CREATE POLICY tenant_isolation ON attachment_upload
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
+
+-- =========================
+-- Objetos a borrar del storage. Lo llenan triggers (borrar un adjunto, una
+-- subida o, en cascada, una orden) y lo vacía jobs.StorageSweeper: el borrado
+-- en la DB no depende de que el storage responda.
+-- =========================
+
+CREATE TABLE IF NOT EXISTS storage_deletion (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  service_provider_id uuid NOT NULL REFERENCES service_provider(id),
+  storage_key varchar(300) NOT NULL,
+  attempts int NOT NULL DEFAULT 0,
+  last_error varchar(500),
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_storage_deletion_created ON storage_deletion(created_at);
+
+ALTER TABLE storage_deletion ENABLE ROW LEVEL SECURITY;
+ALTER TABLE storage_deletion FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON storage_deletion;
+CREATE POLICY tenant_isolation ON storage_deletion
+  USING (app_tenant_visible(service_provider_id))
+  WITH CHECK (app_tenant_visible(service_provider_id));
+
+CREATE OR REPLACE FUNCTION queue_attachment_object_deletion() RETURNS trigger AS $$
+BEGIN
+  IF OLD.storage_key IS NOT NULL THEN
+    INSERT INTO storage_deletion (service_provider_id, storage_key)
+    VALUES (OLD.service_provider_id, OLD.storage_key);
+  END IF;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_attachment_object_deletion ON work_order_attachment;
+CREATE TRIGGER trg_attachment_object_deletion
+  AFTER DELETE ON work_order_attachment
+  FOR EACH ROW EXECUTE FUNCTION queue_attachment_object_deletion();
+
+CREATE OR REPLACE FUNCTION queue_upload_parts_deletion() RETURNS trigger AS $$
+BEGIN
+  INSERT INTO storage_deletion (service_provider_id, storage_key)
+  SELECT OLD.service_provider_id,
+         OLD.service_provider_id || '/uploads/' || OLD.id || '/' || lpad(n::text, 6, '0')
+  FROM generate_series(0, OLD.parts - 1) AS n;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_upload_parts_deletion ON attachment_upload;
+CREATE TRIGGER trg_upload_parts_deletion
+  AFTER DELETE ON attachment_upload
+  FOR EACH ROW EXECUTE FUNCTION queue_upload_parts_deletion();
+
+-- =========================
+-- Borrar una orden: se lleva comentarios, adjuntos y subidas (cascade); las
+-- lecturas quedan en el equipo y la auditoría (work_order_event) se conserva.
+-- =========================
+
+ALTER TABLE asset_reading DROP CONSTRAINT IF EXISTS asset_reading_work_order_id_fkey;
+ALTER TABLE asset_reading
+  ADD CONSTRAINT asset_reading_work_order_id_fkey
+  FOREIGN KEY (work_order_id) REFERENCES work_order(id) ON DELETE SET NULL;
+
+ALTER TABLE work_order_event DROP CONSTRAINT IF EXISTS work_order_event_work_order_id_fkey;
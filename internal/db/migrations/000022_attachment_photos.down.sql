@@ -0,0 +1,35 @@
+CREATE OR REPLACE FUNCTION queue_attachment_object_deletion() RETURNS trigger AS $$
+BEGIN
+  IF OLD.storage_key IS NOT NULL THEN
+    INSERT INTO storage_deletion (service_provider_id, storage_key)
+    VALUES (OLD.service_provider_id, OLD.storage_key);
+  END IF;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_attachment_phash;
+DROP INDEX IF EXISTS idx_attachment_processing;
+ALTER TABLE work_order_attachment DROP CONSTRAINT IF EXISTS chk_attachment_processing_status;
+
+-- las versiones quedan huérfanas en el storage: se encolan antes de perder las keys
+INSERT INTO storage_deletion (service_provider_id, storage_key)
+SELECT service_provider_id, k
+FROM work_order_attachment, unnest(ARRAY[thumb_key, web_key]) AS k
+WHERE k IS NOT NULL;
+
+ALTER TABLE work_order_attachment
+  DROP COLUMN IF EXISTS duplicate_of,
+  DROP COLUMN IF EXISTS phash,
+  DROP COLUMN IF EXISTS gps_lng,
+  DROP COLUMN IF EXISTS gps_lat,
+  DROP COLUMN IF EXISTS taken_at,
+  DROP COLUMN IF EXISTS height,
+  DROP COLUMN IF EXISTS width,
+  DROP COLUMN IF EXISTS web_key,
+  DROP COLUMN IF EXISTS thumb_key,
+  DROP COLUMN IF EXISTS processed_at,
+  DROP COLUMN IF EXISTS processing_error,
+  DROP COLUMN IF EXISTS processing_started_at,
+  DROP COLUMN IF EXISTS processing_attempts,
+  DROP COLUMN IF EXISTS processing_status;
@@ -0,0 +1,51 @@
+-- =========================
+-- Procesamiento de fotos (jobs.PhotoProcessor): metadata limpia, versiones
+-- reducidas, dimensiones y hash perceptual para detectar repetidas.
+-- =========================
+
+ALTER TABLE work_order_attachment
+  -- pending => processing => done | failed | unsupported; NULL si no es foto
+  ADD COLUMN IF NOT EXISTS processing_status varchar(20),
+  ADD COLUMN IF NOT EXISTS processing_attempts int NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS processing_started_at timestamptz,
+  ADD COLUMN IF NOT EXISTS processing_error varchar(500),
+  ADD COLUMN IF NOT EXISTS processed_at timestamptz,
+
+  ADD COLUMN IF NOT EXISTS thumb_key varchar(300),
+  ADD COLUMN IF NOT EXISTS web_key varchar(300),
+  ADD COLUMN IF NOT EXISTS width int,
+  ADD COLUMN IF NOT EXISTS height int,
+
+  -- lo que traía el EXIF antes de limpiarlo: solo para el equipo, nunca al client
+  ADD COLUMN IF NOT EXISTS taken_at timestamptz,
+  ADD COLUMN IF NOT EXISTS gps_lat double precision,
+  ADD COLUMN IF NOT EXISTS gps_lng double precision,
+
+  ADD COLUMN IF NOT EXISTS phash bigint,
+  ADD COLUMN IF NOT EXISTS duplicate_of uuid REFERENCES work_order_attachment(id) ON DELETE SET NULL;
+
+ALTER TABLE work_order_attachment DROP CONSTRAINT IF EXISTS chk_attachment_processing_status;
+ALTER TABLE work_order_attachment
+  ADD CONSTRAINT chk_attachment_processing_status
+  CHECK (processing_status IN ('pending', 'processing', 'done', 'failed', 'unsupported'));
+
+CREATE INDEX IF NOT EXISTS idx_attachment_processing
+  ON work_order_attachment(created_at) WHERE processing_status IN ('pending', 'processing');
+CREATE INDEX IF NOT EXISTS idx_attachment_phash
+  ON work_order_attachment(service_provider_id) WHERE phash IS NOT NULL;
+
+-- Las fotos ya subidas al storage también pasan por el pipeline.
+UPDATE work_order_attachment
+SET processing_status = 'pending'
+WHERE file_type = 'photo' AND storage_key IS NOT NULL AND processing_status IS NULL;
+
+-- Al borrar el adjunto se van también sus versiones.
+CREATE OR REPLACE FUNCTION queue_attachment_object_deletion() RETURNS trigger AS $$
+BEGIN
+  INSERT INTO storage_deletion (service_provider_id, storage_key)
+  SELECT OLD.service_provider_id, k
+  FROM unnest(ARRAY[OLD.storage_key, OLD.thumb_key, OLD.web_key]) AS k
+  WHERE k IS NOT NULL;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,15 @@
+-- Las subidas en curso no se pueden seguir con keys fijas: se cancelan (el
+-- trigger, todavía el nuevo, encola sus partes).
+DELETE FROM attachment_upload;
+
+CREATE OR REPLACE FUNCTION queue_upload_parts_deletion() RETURNS trigger AS $$
+BEGIN
+  INSERT INTO storage_deletion (service_provider_id, storage_key)
+  SELECT OLD.service_provider_id,
+         OLD.service_provider_id || '/uploads/' || OLD.id || '/' || lpad(n::text, 6, '0')
+  FROM generate_series(0, OLD.parts - 1) AS n;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE attachment_upload DROP COLUMN IF EXISTS part_keys;
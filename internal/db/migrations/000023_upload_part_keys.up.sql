@@ -0,0 +1,27 @@
+-- =========================
+-- Partes de subidas reanudables con key propia por intento
+-- ({sp}/uploads/{id}/{n}-{rand}). La API sube la parte sin transacción abierta
+-- y la anota acá solo si la subida sigue donde estaba: dos intentos de la misma
+-- parte no se pisan y el que pierde borra la suya.
+-- =========================
+
+ALTER TABLE attachment_upload
+  ADD COLUMN IF NOT EXISTS part_keys text[] NOT NULL DEFAULT '{}';
+
+-- Las subidas en curso tenían las partes en keys fijas.
+UPDATE attachment_upload
+SET part_keys = ARRAY(
+  SELECT service_provider_id || '/uploads/' || id || '/' || lpad(n::text, 6, '0')
+  FROM generate_series(0, parts - 1) AS n
+  ORDER BY n
+)
+WHERE parts > 0 AND cardinality(part_keys) = 0;
+
+CREATE OR REPLACE FUNCTION queue_upload_parts_deletion() RETURNS trigger AS $$
+BEGIN
+  INSERT INTO storage_deletion (service_provider_id, storage_key)
+  SELECT OLD.service_provider_id, k
+  FROM unnest(OLD.part_keys) AS k;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,32 @@
+DO $$
+DECLARE
+  t text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY[
+    'api_key', 'provider_role', 'auth_session', 'password_reset',
+    'login_attempt', 'user_mfa', 'mfa_recovery_code'
+  ] LOOP
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+    EXECUTE format('ALTER TABLE %I NO FORCE ROW LEVEL SECURITY', t);
+    EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t);
+  END LOOP;
+END $$;
+
+ALTER TABLE mfa_recovery_code DROP COLUMN IF EXISTS service_provider_id;
+
+CREATE OR REPLACE FUNCTION app_tenant_visible(sp uuid) RETURNS boolean
+LANGUAGE sql STABLE AS $$
+  SELECT current_setting('app.bypass_rls', true) = 'on'
+      OR sp = nullif(current_setting('app.service_provider_id', true), '')::uuid
+$$;
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+  REVOKE USAGE, SELECT ON SEQUENCES FROM hvac_system;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+  REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM hvac_system;
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM hvac_system;
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM hvac_system;
+REVOKE USAGE ON SCHEMA public FROM hvac_system;
+REVOKE hvac_system FROM hvac_app;
+
+-- El rol hvac_system se deja, igual que hvac_app (ver 000011).
@@ -0,0 +1,73 @@
+-- =========================
+-- Modo sistema con un rol BYPASSRLS en vez de una variable
+-- =========================
+
+-- Antes app.bypass_rls = 'on' apagaba RLS, y cualquier sesión de hvac_app podía
+-- ponerlo con set_config() desde una query. Ahora db.WithSystem hace
+-- SET LOCAL ROLE hvac_system (una sentencia aparte, no una función que se
+-- pueda inyectar) y la política solo mira el tenant fijado.
+-- Crear un rol BYPASSRLS requiere superuser.
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'hvac_system') THEN
+    CREATE ROLE hvac_system NOLOGIN BYPASSRLS;
+  END IF;
+END $$;
+
+GRANT hvac_system TO hvac_app;
+GRANT USAGE ON SCHEMA public TO hvac_system;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO hvac_system;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO hvac_system;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+  GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO hvac_system;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+  GRANT USAGE, SELECT ON SEQUENCES TO hvac_system;
+
+-- Append-only también para el sistema (ver 000019).
+REVOKE UPDATE, DELETE, TRUNCATE ON work_order_event FROM hvac_system;
+
+CREATE OR REPLACE FUNCTION app_tenant_visible(sp uuid) RETURNS boolean
+LANGUAGE sql STABLE AS $$
+  SELECT sp = nullif(current_setting('app.service_provider_id', true), '')::uuid
+$$;
+
+-- =========================
+-- Tablas por provider que faltaban
+-- =========================
+
+-- Los recovery codes cuelgan del usuario: se les agrega el provider para que
+-- la política sea la misma que en el resto.
+ALTER TABLE mfa_recovery_code
+  ADD COLUMN IF NOT EXISTS service_provider_id uuid REFERENCES service_provider(id);
+UPDATE mfa_recovery_code c
+SET service_provider_id = u.service_provider_id
+FROM "user" u
+WHERE u.id = c.user_id AND c.service_provider_id IS NULL;
+ALTER TABLE mfa_recovery_code ALTER COLUMN service_provider_id SET NOT NULL;
+
+-- login_attempt admite service_provider_id NULL (intento sin provider
+-- conocido): esas filas solo las ve el sistema.
+-- Quedan afuera las que no tienen provider propio: refresh_token y
+-- provider_role_permission (se llega por su padre, que sí tiene política),
+-- revoked_access_token (por jti) y login_throttle (contadores por clave).
+-- Un UPDATE a mano sobre "user" (trigger de sesiones) tiene que correr como
+-- superuser o con SET ROLE hvac_system, igual que cualquier SQL sobre estas tablas.
+DO $$
+DECLARE
+  t text;
+BEGIN
+  FOREACH t IN ARRAY ARRAY[
+    'api_key', 'provider_role', 'auth_session', 'password_reset',
+    'login_attempt', 'user_mfa', 'mfa_recovery_code'
+  ] LOOP
+    EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t);
+    EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', t);
+    EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t);
+    EXECUTE format(
+      'CREATE POLICY tenant_isolation ON %I
+         USING (app_tenant_visible(service_provider_id))
+         WITH CHECK (app_tenant_visible(service_provider_id))',
+      t
+    );
+  END LOOP;
+END $$;
@@ -0,0 +1,376 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =========================
+// RLS contra Postgres real
+// =========================
+//
+// Necesitan TEST_DATABASE_URL: una base con las migraciones aplicadas y un
+// usuario que pueda hacer SET ROLE hvac_app (el que corrió las migraciones,
+// igual que DATABASE_URL en producción). Sin la variable se saltean.
+
+const (
+	appRole    = "hvac_app"
+	systemRole = "hvac_system"
+)
+
+func testDSN(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	return dsn
+}
+
+// seedOrder: tablas de tenant que siembra seedTenant. Si una migración agrega
+// una tabla con tenant_isolation y no está acá, TestRowLevelSecurity falla
+// pidiendo que se agregue.
+var seedOrder = []string{
+	"customer", "site", "area", "asset", "work_order",
+	"work_order_attachment", "work_order_comment", "user_invitation",
+	"provider_settings", "asset_status_history", "import_job", "asset_reading",
+	"work_order_event", "attachment_upload", "storage_deletion",
+	"api_key", "provider_role", "auth_session", "password_reset",
+	"login_attempt", "user_mfa", "mfa_recovery_code",
+}
+
+// appendOnly: hvac_app no tiene UPDATE ni DELETE (migración 000019).
+var appendOnly = map[string]bool{"work_order_event": true}
+
+// seedTenant crea un provider con una fila en cada tabla de tenant, dentro de
+// tx (que tiene que correr como hvac_system: con FORCE ROW LEVEL SECURITY ni el
+// dueño de las tablas se salta RLS).
+func seedTenant(t *testing.T, ctx context.Context, tx pgx.Tx) string {
+	t.Helper()
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	tag := hex.EncodeToString(b)
+
+	ins := func(sql string, args ...any) string {
+		t.Helper()
+		var id string
+		if err := tx.QueryRow(ctx, sql+` RETURNING id`, args...).Scan(&id); err != nil {
+			t.Fatalf("seed: %v\n%s", err, sql)
+		}
+		return id
+	}
+
+	sp := ins(`INSERT INTO service_provider (name, slug) VALUES ('RLS '||$1, 'rls-'||$1)`, tag)
+	u := ins(`INSERT INTO "user" (service_provider_id, fullname, email, password, role) VALUES ($1, 'RLS', $2||'@example.com', 'x', 'admin')`, sp, tag)
+	c := ins(`INSERT INTO customer (service_provider_id, name) VALUES ($1, 'Cliente')`, sp)
+	s := ins(`INSERT INTO site (service_provider_id, customer_id, name) VALUES ($1, $2, 'Sitio')`, sp, c)
+	a := ins(`INSERT INTO area (service_provider_id, site_id, name) VALUES ($1, $2, 'Área')`, sp, s)
+	as := ins(`INSERT INTO asset (service_provider_id, customer_id, site_id, area_id, tag_code) VALUES ($1, $2, $3, $4, 'T-1')`, sp, c, s, a)
+	wo := ins(`INSERT INTO work_order (service_provider_id, customer_id, site_id, asset_id, title, created_by) VALUES ($1, $2, $3, $4, 'Orden', $5)`, sp, c, s, as, u)
+	ins(`INSERT INTO work_order_attachment (service_provider_id, work_order_id, file_url, uploaded_by) VALUES ($1, $2, 'https://files.test/a.jpg', $3)`, sp, wo, u)
+	ins(`INSERT INTO work_order_comment (service_provider_id, work_order_id, author_id, comment) VALUES ($1, $2, $3, 'hola')`, sp, wo, u)
+	ins(`INSERT INTO user_invitation (service_provider_id, user_id, token_hash, expires_at, created_by) VALUES ($1, $2, $3, now() + interval '1 hour', $2)`, sp, u, "rls-"+tag)
+	if _, err := tx.Exec(ctx, `INSERT INTO provider_settings (service_provider_id) VALUES ($1)`, sp); err != nil {
+		t.Fatalf("seed provider_settings: %v", err)
+	}
+	ins(`INSERT INTO asset_status_history (service_provider_id, asset_id, to_status) VALUES ($1, $2, 'active')`, sp, as)
+	ins(`INSERT INTO import_job (service_provider_id, kind, format, file, status, created_by) VALUES ($1, 'customers', 'csv', '\x00', 'validated', $2)`, sp, u)
+	ins(`INSERT INTO asset_reading (service_provider_id, asset_id, kind, value, recorded_by) VALUES ($1, $2, 'current', 1, $3)`, sp, as, u)
+	ins(`INSERT INTO work_order_event (service_provider_id, work_order_id, action) VALUES ($1, $2, 'created')`, sp, wo)
+	ins(`INSERT INTO attachment_upload (service_provider_id, work_order_id, filename, size_bytes, created_by, expires_at) VALUES ($1, $2, 'a.jpg', 1, $3, now() + interval '1 hour')`, sp, wo, u)
+	ins(`INSERT INTO storage_deletion (service_provider_id, storage_key) VALUES ($1, $2)`, sp, sp+"/x")
+	ins(`INSERT INTO api_key (service_provider_id, name, prefix, key_hash, created_by) VALUES ($1, 'RLS', 'hvk_'||$2, 'rls-'||$2, $3)`, sp, tag, u)
+	ins(`INSERT INTO provider_role (service_provider_id, name, base_role) VALUES ($1, 'Rol', 'technician')`, sp)
+	ins(`INSERT INTO auth_session (service_provider_id, user_id, expires_at) VALUES ($1, $2, now() + interval '1 hour')`, sp, u)
+	ins(`INSERT INTO password_reset (service_provider_id, user_id, token_hash, expires_at) VALUES ($1, $2, $3, now() + interval '1 hour')`, sp, u, "rls-"+tag)
+	ins(`INSERT INTO login_attempt (service_provider_id, user_id, email, ip_address, success, reason) VALUES ($1, $2, 'rls@example.com', '127.0.0.1', true, 'ok')`, sp, u)
+	if _, err := tx.Exec(ctx, `INSERT INTO user_mfa (user_id, service_provider_id, totp_secret) VALUES ($1, $2, 'x')`, u, sp); err != nil {
+		t.Fatalf("seed user_mfa: %v", err)
+	}
+	ins(`INSERT INTO mfa_recovery_code (user_id, service_provider_id, code_hash) VALUES ($1, $2, 'x')`, u, sp)
+	return sp
+}
+
+func pgCode(err error, code, msg string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code && strings.Contains(pgErr.Message, msg)
+}
+
+// isRLSViolation: la fila nueva no pasa el WITH CHECK de la política.
+func isRLSViolation(err error) bool {
+	return pgCode(err, "42501", "row-level security")
+}
+
+func isPermissionDenied(err error) bool {
+	return pgCode(err, "42501", "permission denied")
+}
+
+// Todo corre en una transacción con rollback: work_order_event es append-only,
+// así que lo sembrado no se podría borrar después. Dentro de ella se cambia de
+// rol y de tenant con SET LOCAL ROLE y set_config(..., true), igual que hace DB
+// por transacción, y cada sentencia que se espera que falle va en un savepoint.
+func TestRowLevelSecurity(t *testing.T) {
+	dsn := testDSN(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d, err := New(dsn, appRole, systemRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Pool.Close()
+
+	var role string
+	if err := d.Pool.QueryRow(ctx, `SELECT current_user`).Scan(&role); err != nil || role != appRole {
+		t.Fatalf("current_user = %q (%v), want %s", role, err, appRole)
+	}
+
+	rows, err := d.Pool.Query(ctx, `
+		SELECT tablename FROM pg_policies
+		WHERE schemaname = 'public' AND policyname = 'tenant_isolation'
+		ORDER BY tablename
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeded := map[string]bool{}
+	for _, tbl := range seedOrder {
+		seeded[tbl] = true
+	}
+	for _, tbl := range tables {
+		if !seeded[tbl] {
+			t.Fatalf("table %s has tenant_isolation but no seed; add it to seedTenant", tbl)
+		}
+	}
+	if len(tables) != len(seedOrder) {
+		t.Fatalf("policy tables = %v, seeded = %v", tables, seedOrder)
+	}
+
+	sctx, release, err := d.WithSystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	tx, err := d.Begin(sctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	a := seedTenant(t, ctx, tx)
+	b := seedTenant(t, ctx, tx)
+	// Un intento de login sin provider conocido: solo lo ve el sistema.
+	if _, err := tx.Exec(ctx, `INSERT INTO login_attempt (email, ip_address, success, reason) VALUES ('nadie@example.com', '127.0.0.1', false, 'unknown_user')`); err != nil {
+		t.Fatalf("seed login_attempt: %v", err)
+	}
+
+	// as vuelve a hvac_app y fija el tenant dentro de tx ("" = ninguno);
+	// system pasa a hvac_system.
+	as := func(sp string) {
+		t.Helper()
+		if _, err := tx.Exec(ctx, `SET LOCAL ROLE `+pgx.Identifier{appRole}.Sanitize()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec(ctx, `SELECT set_config('app.service_provider_id', $1, true)`, sp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	system := func() {
+		t.Helper()
+		if _, err := tx.Exec(ctx, `SET LOCAL ROLE `+pgx.Identifier{systemRole}.Sanitize()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// try corre sql en un savepoint que siempre se descarta.
+	try := func(sql string, args ...any) (pgconn.CommandTag, error) {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return pgconn.CommandTag{}, err
+		}
+		defer sp.Rollback(ctx)
+		return sp.Exec(ctx, sql, args...)
+	}
+
+	as(a)
+	for _, tbl := range tables {
+		t.Run(tbl, func(t *testing.T) {
+			ident := pgx.Identifier{tbl}.Sanitize()
+			count := func(where string, args ...any) int {
+				t.Helper()
+				var n int
+				if err := tx.QueryRow(ctx, `SELECT count(*) FROM `+ident+where, args...).Scan(&n); err != nil {
+					t.Fatalf("select: %v", err)
+				}
+				return n
+			}
+
+			// SELECT: sin filtrar por tenant solo aparece la fila de A.
+			if n := count(``); n != 1 {
+				t.Fatalf("tenant A sees %d rows, want only its own", n)
+			}
+			if n := count(` WHERE service_provider_id = $1`, b); n != 0 {
+				t.Fatalf("tenant A sees %d rows of tenant B", n)
+			}
+
+			if appendOnly[tbl] {
+				if _, err := try(`UPDATE ` + ident + ` SET service_provider_id = service_provider_id`); !isPermissionDenied(err) {
+					t.Fatalf("update on append-only table = %v, want permission denied", err)
+				}
+				if _, err := try(`DELETE FROM ` + ident); !isPermissionDenied(err) {
+					t.Fatalf("delete on append-only table = %v, want permission denied", err)
+				}
+				return
+			}
+
+			// UPDATE y DELETE apuntando a B no tocan nada; sin WHERE, solo A.
+			tag, err := try(`UPDATE `+ident+` SET service_provider_id = service_provider_id WHERE service_provider_id = $1`, b)
+			if err != nil || tag.RowsAffected() != 0 {
+				t.Fatalf("update of B's rows: %d rows, %v", tag.RowsAffected(), err)
+			}
+			tag, err = try(`UPDATE ` + ident + ` SET service_provider_id = service_provider_id`)
+			if err != nil || tag.RowsAffected() != 1 {
+				t.Fatalf("unfiltered update: %d rows, %v; want only A's row", tag.RowsAffected(), err)
+			}
+			tag, err = try(`DELETE FROM `+ident+` WHERE service_provider_id = $1`, b)
+			if err != nil || tag.RowsAffected() != 0 {
+				t.Fatalf("delete of B's rows: %d rows, %v", tag.RowsAffected(), err)
+			}
+
+			// WITH CHECK: una fila de A no se puede pasar a B.
+			if _, err := try(`UPDATE `+ident+` SET service_provider_id = $1`, b); !isRLSViolation(err) {
+				t.Fatalf("moving A's row to B = %v, want RLS violation", err)
+			}
+		})
+	}
+
+	// WITH CHECK en INSERT: A no puede crear filas a nombre de B, ni colgadas
+	// de sus propias filas.
+	for _, c := range []struct {
+		table string
+		sql   string
+		args  []any
+	}{
+		{"customer", `INSERT INTO customer (service_provider_id, name) VALUES ($1, 'Intruso')`, []any{b}},
+		{"storage_deletion", `INSERT INTO storage_deletion (service_provider_id, storage_key) VALUES ($1, 'x')`, []any{b}},
+		{"site", `INSERT INTO site (service_provider_id, customer_id, name)
+			SELECT $1, id, 'Intruso' FROM customer WHERE service_provider_id = $2`, []any{b, a}},
+		{"work_order_event", `INSERT INTO work_order_event (service_provider_id, work_order_id, action)
+			SELECT $1, id, 'created' FROM work_order WHERE service_provider_id = $2`, []any{b, a}},
+	} {
+		if _, err := try(c.sql, c.args...); !isRLSViolation(err) {
+			t.Errorf("insert into %s for tenant B = %v, want RLS violation", c.table, err)
+		}
+	}
+
+	// La variable del bypass viejo ya no hace nada: hvac_app la puede poner,
+	// pero la política no la mira.
+	if _, err := tx.Exec(ctx, `SELECT set_config('app.bypass_rls', 'on', true)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range tables {
+		var n int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM `+pgx.Identifier{tbl}.Sanitize()+` WHERE service_provider_id = $1`, b).Scan(&n); err != nil || n != 0 {
+			t.Errorf("%s: app.bypass_rls=on shows %d rows of tenant B (%v), want 0", tbl, n, err)
+		}
+	}
+
+	// B sigue intacto.
+	system()
+	for _, tbl := range tables {
+		var n int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM `+pgx.Identifier{tbl}.Sanitize()+` WHERE service_provider_id = $1`, b).Scan(&n); err != nil || n != 1 {
+			t.Errorf("%s: tenant B has %d rows (%v), want 1", tbl, n, err)
+		}
+	}
+
+	// Sin tenant fijado no se ve nada (falla cerrado).
+	as("")
+	for _, tbl := range tables {
+		var n int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM `+pgx.Identifier{tbl}.Sanitize()).Scan(&n); err != nil || n != 0 {
+			t.Errorf("%s: unbound query sees %d rows (%v), want 0", tbl, n, err)
+		}
+	}
+}
+
+// El tenant se fija con set_config(..., true) y el modo sistema con SET LOCAL
+// ROLE: ambos mueren con la transacción y la conexión vuelve al pool limpia. Con una sola conexión, la query siguiente
+// reusa la misma (y si el ctx la retuviera, esperaría para siempre).
+func TestTenantDoesNotLeakIntoPooledConnection(t *testing.T) {
+	dsn := testDSN(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxConns = 1
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, `SET ROLE `+pgx.Identifier{appRole}.Sanitize())
+		return err
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	d := &DB{Pool: pool, SystemRole: systemRole}
+
+	const sp = "00000000-0000-0000-0000-0000000000a1"
+	setting := func(ctx context.Context, name string) string {
+		t.Helper()
+		var v string
+		if err := d.QueryRow(ctx, `SELECT coalesce(current_setting($1, true), '')`, name).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tctx, release, err := d.WithTenant(ctx, sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if v := setting(tctx, "app.service_provider_id"); v != sp {
+		t.Fatalf("bound query: app.service_provider_id = %q, want %s", v, sp)
+	}
+	// El ctx del tenant sigue vivo y aun así la conexión está libre y limpia.
+	if v := setting(ctx, "app.service_provider_id"); v != "" {
+		t.Fatalf("pooled connection kept app.service_provider_id = %q", v)
+	}
+
+	sysCtx, releaseSys, err := d.WithSystem(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseSys()
+	user := func(ctx context.Context) string {
+		t.Helper()
+		var v string
+		if err := d.QueryRow(ctx, `SELECT current_user`).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := user(sysCtx); v != systemRole {
+		t.Fatalf("system query: current_user = %q, want %s", v, systemRole)
+	}
+	if v := user(ctx); v != appRole {
+		t.Fatalf("pooled connection kept current_user = %q, want %s", v, appRole)
+	}
+}
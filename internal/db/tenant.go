@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// =========================
+// Aislamiento por tenant (RLS)
+// =========================
+//
+// Las tablas de tenant tienen políticas RLS que filtran por la variable
+// app.service_provider_id (ver migraciones 000011 y 000024). WithTenant no toma ninguna
+// conexión: deja el tenant en el contexto, y cada query que pase por DB con ese
+// ctx corre en una transacción que lo fija con set_config(..., true), o sea
+// solo para esa transacción. La conexión vuelve al pool al terminar cada query
+// (una request que recibe un upload no retiene una de las MaxConns) y el valor
+// muere con la transacción, así que no puede quedar pegado a una conexión
+// reusada. Sin tenant fijado las tablas de tenant se ven vacías (falla cerrado).
+
+var ErrConnReleased = errors.New("db: tenant binding already released")
+
+type ctxKey struct{}
+
+type binding struct {
+	mu       sync.Mutex
+	setSQL   string
+	args     []any
+	released bool
+}
+
+func bindingFrom(ctx context.Context) *binding {
+	b, _ := ctx.Value(ctxKey{}).(*binding)
+	return b
+}
+
+// WithTenant devuelve un ctx con el tenant fijado y la función que lo da por
+// terminado (siempre con defer): después de llamarla el ctx ya no sirve para
+// queries.
+func (d *DB) WithTenant(ctx context.Context, serviceProviderID string) (context.Context, func(), error) {
+	return d.bind(ctx, `SELECT set_config('app.service_provider_id', $1, true)`, serviceProviderID)
+}
+
+// WithSystem es para procesos sin tenant (jobs, flujos públicos por token):
+// ve todos los providers, así que cada query tiene que filtrar a mano. Cada
+// transacción hace SET LOCAL ROLE al rol de sistema (BYPASSRLS). No hay una
+// variable que apague RLS: un set_config() inyectado en una query no alcanza,
+// cambiar de rol es una sentencia aparte que solo arma este paquete.
+func (d *DB) WithSystem(ctx context.Context) (context.Context, func(), error) {
+	setSQL := ""
+	if d.SystemRole != "" {
+		setSQL = `SET LOCAL ROLE ` + pgx.Identifier{d.SystemRole}.Sanitize()
+	}
+	return d.bind(ctx, setSQL)
+}
+
+// Detach devuelve un ctx sin el tenant fijado, para abrir otro desde una
+// request ya autenticada (ej. un operador de plataforma que necesita WithSystem).
+// El original sigue valiendo para quien lo fijó.
+func Detach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, (*binding)(nil))
+}
+
+func (d *DB) bind(ctx context.Context, setSQL string, args ...any) (context.Context, func(), error) {
+	if bindingFrom(ctx) != nil {
+		return nil, nil, errors.New("db: context already bound to a tenant")
+	}
+
+	b := &binding{setSQL: setSQL, args: args}
+	release := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.released = true
+	}
+	return context.WithValue(ctx, ctxKey{}, b), release, nil
+}
+
+func (b *binding) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.released {
+		return ErrConnReleased
+	}
+	return nil
+}
+
+// begin abre una transacción con el tenant (o el rol de sistema) fijado solo
+// para ella.
+func (d *DB) begin(ctx context.Context, b *binding) (pgx.Tx, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.setSQL == "" {
+		return tx, nil
+	}
+	if _, err := tx.Exec(ctx, b.setSQL, b.args...); err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// =========================
+// Mismos métodos que *pgxpool.Pool: con tenant en el ctx, cada query suelta es
+// su propia transacción (igual que en autocommit) y Begin devuelve una con el
+// tenant ya fijado.
+// =========================
+
+func (d *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	b := bindingFrom(ctx)
+	if b == nil {
+		return d.Pool.Exec(ctx, sql, args...)
+	}
+	tx, err := d.begin(ctx, b)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return pgconn.CommandTag{}, err
+	}
+	return tag, tx.Commit(ctx)
+}
+
+func (d *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	b := bindingFrom(ctx)
+	if b == nil {
+		return d.Pool.Query(ctx, sql, args...)
+	}
+	tx, err := d.begin(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+	return &txRows{Rows: rows, ctx: ctx, tx: tx}, nil
+}
+
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	b := bindingFrom(ctx)
+	if b == nil {
+		return d.Pool.QueryRow(ctx, sql, args...)
+	}
+	return txRow{d: d, ctx: ctx, b: b, sql: sql, args: args}
+}
+
+func (d *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	if b := bindingFrom(ctx); b != nil {
+		return d.begin(ctx, b)
+	}
+	return d.Pool.Begin(ctx)
+}
+
+// txRow corre la query recién en Scan, como pgx. Sin filas también se hace
+// commit: un UPDATE ... RETURNING puede haber escrito igual (ej. vía CTE).
+type txRow struct {
+	d    *DB
+	ctx  context.Context
+	b    *binding
+	sql  string
+	args []any
+}
+
+func (r txRow) Scan(dest ...any) error {
+	tx, err := r.d.begin(r.ctx, r.b)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRow(r.ctx, r.sql, r.args...).Scan(dest...)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		_ = tx.Rollback(r.ctx)
+		return err
+	}
+	if cerr := tx.Commit(r.ctx); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// txRows cierra la transacción cuando se terminan de leer las filas (Next da
+// false) o cuando el llamador hace Close, lo que pase primero.
+type txRows struct {
+	pgx.Rows
+	ctx  context.Context
+	tx   pgx.Tx
+	done bool
+	err  error
+}
+
+func (r *txRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.finish()
+	return false
+}
+
+func (r *txRows) Close() {
+	r.finish()
+}
+
+func (r *txRows) Err() error {
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+func (r *txRows) finish() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.Rows.Close()
+	if r.Rows.Err() != nil {
+		_ = r.tx.Rollback(r.ctx)
+		return
+	}
+	r.err = r.tx.Commit(r.ctx)
+}
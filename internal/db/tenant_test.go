@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// unreachable: pool que nunca llega a conectar; sirve para ver que fijar el
+// tenant no toma conexiones.
+func unreachable(t *testing.T) *DB {
+	t.Helper()
+	cfg, err := pgxpool.ParseConfig("postgres://hvac@127.0.0.1:1/hvac?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return &DB{Pool: pool}
+}
+
+func TestWithTenantDoesNotHoldAConnection(t *testing.T) {
+	d := unreachable(t)
+
+	ctx, release, err := d.WithTenant(context.Background(), "00000000-0000-0000-0000-000000000001")
+	if err != nil {
+		t.Fatalf("WithTenant: %v", err)
+	}
+	defer release()
+	if n := d.Pool.Stat().TotalConns(); n != 0 {
+		t.Fatalf("WithTenant opened %d connections", n)
+	}
+
+	// La query sí intenta conectar (y acá falla), pero no queda nada tomado.
+	if err := d.QueryRow(ctx, `SELECT 1`).Scan(new(int)); err == nil {
+		t.Fatal("query against an unreachable server succeeded")
+	}
+	if n := d.Pool.Stat().AcquiredConns(); n != 0 {
+		t.Fatalf("%d connections still acquired after the query", n)
+	}
+}
+
+func TestReleasedBindingRejectsQueries(t *testing.T) {
+	d := unreachable(t)
+	ctx, release, err := d.WithSystem(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release() // idempotente
+
+	if _, err := d.Exec(ctx, `SELECT 1`); !errors.Is(err, ErrConnReleased) {
+		t.Errorf("Exec = %v, want ErrConnReleased", err)
+	}
+	if _, err := d.Query(ctx, `SELECT 1`); !errors.Is(err, ErrConnReleased) {
+		t.Errorf("Query = %v, want ErrConnReleased", err)
+	}
+	if err := d.QueryRow(ctx, `SELECT 1`).Scan(new(int)); !errors.Is(err, ErrConnReleased) {
+		t.Errorf("QueryRow = %v, want ErrConnReleased", err)
+	}
+	if _, err := d.Begin(ctx); !errors.Is(err, ErrConnReleased) {
+		t.Errorf("Begin = %v, want ErrConnReleased", err)
+	}
+}
+
+func TestBindTwice(t *testing.T) {
+	d := unreachable(t)
+	ctx, release, err := d.WithTenant(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	if _, _, err := d.WithSystem(ctx); err == nil {
+		t.Fatal("WithSystem on a tenant ctx: want error")
+	}
+	sys, releaseSys, err := d.WithSystem(Detach(ctx))
+	if err != nil {
+		t.Fatalf("WithSystem(Detach(ctx)): %v", err)
+	}
+	releaseSys()
+	if bindingFrom(sys) == bindingFrom(ctx) {
+		t.Fatal("Detach reused the tenant binding")
+	}
+	if err := bindingFrom(ctx).check(); err != nil {
+		t.Fatalf("releasing the system ctx released the tenant one: %v", err)
+	}
+}
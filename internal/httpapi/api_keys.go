@@ -0,0 +1,247 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+)
+
+// apiKeyPrefix marca las keys (fácil de detectar si se filtran en un repo/log).
+const apiKeyPrefix = "hvk_"
+
+type APIKeysHandler struct {
+	DB *db.DB
+}
+
+type apiKeyItem struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Status     string     `json:"status"` // active|expired|revoked
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+const apiKeyStatusSQL = `
+	CASE
+	  WHEN revoked_at IS NOT NULL THEN 'revoked'
+	  WHEN expires_at IS NOT NULL AND expires_at <= now() THEN 'expired'
+	  ELSE 'active'
+	END`
+
+const apiKeyColumns = `
+	id, name, prefix, scopes, ` + apiKeyStatusSQL + `,
+	created_by, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (apiKeyItem, error) {
+	var it apiKeyItem
+	err := row.Scan(
+		&it.ID, &it.Name, &it.Prefix, &it.Scopes, &it.Status,
+		&it.CreatedBy, &it.ExpiresAt, &it.LastUsedAt, &it.RevokedAt, &it.CreatedAt,
+	)
+	return it, err
+}
+
+// newAPIKey: "hvk_<8 hex>_<secreto>". Lo primero es el prefix visible en el
+// listado; en DB guardamos solo el hash de la key completa.
+func newAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 4)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(b)
+
+	secret, _, err := newInviteToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = prefix + "_" + secret
+	return key, prefix, hashInviteToken(key), nil
+}
+
+// =========================
+// GET  /api-keys
+// POST /api-keys
+// =========================
+
+func (h *APIKeysHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *APIKeysHandler) list(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.APIKeyManage)
+	if claims == nil {
+		return
+	}
+
+	limit, offset, err := parsePagination(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM api_key
+		WHERE service_provider_id = $1
+		ORDER BY created_at DESC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not list api keys", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]apiKeyItem, 0, limit)
+	for rows.Next() {
+		it, err := scanAPIKey(rows)
+		if err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "could not list api keys", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type createAPIKeyResponse struct {
+	apiKeyItem
+	Key string `json:"key"` // solo se muestra acá, una vez
+}
+
+func (h *APIKeysHandler) create(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.APIKeyManage)
+	if claims == nil {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		http.Error(w, "name is required (max 100)", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		s = strings.TrimSpace(s)
+		if !auth.ValidScope(s) {
+			http.Error(w, "invalid scope: "+s, http.StatusBadRequest)
+			return
+		}
+		scopes = append(scopes, s)
+	}
+	// Como con los roles: nadie otorga a una key lo que no puede hacer él mismo.
+	if !PermissionsFromContext(r.Context()).Covers(authz.ForScopes(scopes)) {
+		http.Error(w, "cannot grant scopes with permissions you do not have", http.StatusForbidden)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		http.Error(w, "could not generate key", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	it, err := scanAPIKey(h.DB.QueryRow(ctx, `
+		INSERT INTO api_key (service_provider_id, name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		claims.ServiceProvider, req.Name, prefix, hash, scopes, claims.UserID, req.ExpiresAt,
+	))
+	if err != nil {
+		http.Error(w, "could not create api key", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, createAPIKeyResponse{apiKeyItem: it, Key: key})
+}
+
+// =========================
+// POST /api-keys/{id}/revoke
+// =========================
+
+func (h *APIKeysHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) != 3 || parts[0] != "api-keys" || parts[2] != "revoke" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := authorize(w, r, authz.APIKeyManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// COALESCE: revocar dos veces no pisa quién/cuándo la revocó primero.
+	it, err := scanAPIKey(h.DB.QueryRow(ctx, `
+		UPDATE api_key
+		SET revoked_at = COALESCE(revoked_at, now()),
+		    revoked_by = COALESCE(revoked_by, $3)
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+apiKeyColumns,
+		parts[1], claims.ServiceProvider, claims.UserID,
+	))
+	if err != nil {
+		http.Error(w, "api key not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") || !strings.HasPrefix(prefix, apiKeyPrefix) || len(prefix) != len(apiKeyPrefix)+8 {
+		t.Errorf("key %q, prefix %q", key, prefix)
+	}
+	secret := strings.TrimPrefix(key, prefix+"_")
+	if hash != hashInviteToken(key) || strings.Contains(hash, secret) {
+		t.Errorf("hash %q is not sha256(key)", hash)
+	}
+	if again, _, _, _ := newAPIKey(); again == key {
+		t.Error("newAPIKey repeated a key")
+	}
+}
+
+// Una key no puede tener más permisos que quien la crea: el chequeo va antes
+// de la DB, así que alcanza con un pool que no conecta.
+func TestCreateAPIKeyScopesCappedByCreator(t *testing.T) {
+	h := &APIKeysHandler{DB: unreachableDB(t)}
+	// admin con un rol propio que administra keys pero solo lee órdenes
+	readOnly := actor{
+		claims: &auth.Claims{UserID: testUserID, ServiceProvider: testSPID, Role: "admin", SessionID: "s"},
+		perms:  authz.ForUser("admin", true, []string{string(authz.APIKeyManage), string(authz.WorkOrderReadAll)}, false),
+	}
+	for _, c := range []struct {
+		actor     actor
+		scopes    string
+		forbidden bool
+	}{
+		{readOnly, `["work_orders:read"]`, false},
+		{readOnly, `["work_orders:write"]`, true},
+		{readOnly, `["work_orders:read","work_orders:write"]`, true},
+		{actors()["admin"], `["work_orders:read","work_orders:write"]`, false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(`{"name":"erp","scopes":`+c.scopes+`}`))
+		w := httptest.NewRecorder()
+		h.Collection(w, withActor(r, c.actor))
+		if got := w.Code == http.StatusForbidden; got != c.forbidden {
+			t.Errorf("%s with %s: status %d, want forbidden=%v", c.actor.claims.Role, c.scopes, w.Code, c.forbidden)
+		}
+	}
+}
+
+// TestAPIKeysPostgres: la key se guarda solo hasheada, y una revocada o
+// vencida deja de autenticar. Necesita TEST_DATABASE_URL (ver db/rls_test.go).
+func TestAPIKeysPostgres(t *testing.T) {
+	e := newSessionEnv(t)
+	keys := &APIKeysHandler{DB: e.db}
+	e.mux.Handle("/api-keys", e.authn.Middleware(http.HandlerFunc(keys.Collection)))
+	e.mux.Handle("/api-keys/", e.authn.Middleware(http.HandlerFunc(keys.Item)))
+
+	admin := e.login(e.user("admin@apikeys.test", "admin"), "admin").Token
+	create := func(body string) createAPIKeyResponse {
+		t.Helper()
+		w := e.do(http.MethodPost, "/api-keys", admin, body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create: status %d: %s", w.Code, w.Body)
+		}
+		var out createAPIKeyResponse
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	t.Run("stored hashed", func(t *testing.T) {
+		k := create(`{"name":"erp","scopes":["work_orders:read"]}`)
+		secret := strings.TrimPrefix(k.Key, k.Prefix+"_")
+
+		var hash, row string
+		err := e.db.QueryRow(e.sys, `
+			SELECT key_hash, row_to_json(k)::text FROM api_key k WHERE id = $1
+		`, k.ID).Scan(&hash, &row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != hashInviteToken(k.Key) {
+			t.Errorf("key_hash %q, want sha256 of the key", hash)
+		}
+		if strings.Contains(row, secret) {
+			t.Errorf("api_key row contains the secret: %s", row)
+		}
+		if w := e.do(http.MethodGet, "/api-keys", admin, ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), secret) {
+			t.Errorf("list: status %d, leaks secret=%v", w.Code, strings.Contains(w.Body.String(), secret))
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		k := create(`{"name":"erp","scopes":["work_orders:write"]}`)
+		if code := e.aliveAPIKey(k.Key); code != http.StatusNoContent {
+			t.Fatalf("fresh key: status %d", code)
+		}
+		if w := e.do(http.MethodPost, "/api-keys/"+k.ID+"/revoke", admin, ""); w.Code != http.StatusOK {
+			t.Fatalf("revoke: status %d", w.Code)
+		}
+		if code := e.aliveAPIKey(k.Key); code != http.StatusUnauthorized {
+			t.Errorf("revoked key: status %d, want 401", code)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		k := create(`{"name":"erp","scopes":["work_orders:read"],"expires_at":"` + expires + `"}`)
+		if code := e.aliveAPIKey(k.Key); code != http.StatusNoContent {
+			t.Fatalf("key before expiry: status %d", code)
+		}
+		if _, err := e.db.Exec(e.sys, `UPDATE api_key SET expires_at = now() - interval '1 second' WHERE id = $1`, k.ID); err != nil {
+			t.Fatal(err)
+		}
+		if code := e.aliveAPIKey(k.Key); code != http.StatusUnauthorized {
+			t.Errorf("expired key: status %d, want 401", code)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		key, _, _, err := newAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code := e.aliveAPIKey(key); code != http.StatusUnauthorized {
+			t.Errorf("unknown key: status %d, want 401", code)
+		}
+	})
+}
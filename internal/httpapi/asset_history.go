@@ -0,0 +1,713 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/phpdave11/gofpdf"
+)
+
+// =========================
+// Lecturas
+// GET  /assets/{id}/readings?kind=
+// POST /assets/{id}/readings
+// =========================
+
+var readingKindRe = regexp.MustCompile(`^[a-z0-9_]{1,40}$`)
+
+type assetReading struct {
+	ID          string    `json:"id"`
+	AssetID     string    `json:"asset_id"`
+	WorkOrderID *string   `json:"work_order_id,omitempty"`
+	Kind        string    `json:"kind"`
+	Value       float64   `json:"value"`
+	Unit        *string   `json:"unit,omitempty"`
+	Notes       *string   `json:"notes,omitempty"`
+	RecordedBy  string    `json:"recorded_by"`
+	RecordedAt  time.Time `json:"recorded_at"`
+}
+
+const assetReadingColumns = `
+	id, asset_id, work_order_id, kind, value::float8, unit, notes, recorded_by, recorded_at`
+
+type createReadingRequest struct {
+	Kind        string     `json:"kind"` // suction_pressure, supply_air_temp, current...
+	Value       *float64   `json:"value"`
+	Unit        *string    `json:"unit,omitempty"` // psi, °C, A...
+	Notes       *string    `json:"notes,omitempty"`
+	WorkOrderID *string    `json:"work_order_id,omitempty"` // orden en la que se tomó (del mismo equipo)
+	RecordedAt  *time.Time `json:"recorded_at,omitempty"`   // default: ahora
+}
+
+func (h *AssetsHandler) Readings(w http.ResponseWriter, r *http.Request, assetID string) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listReadings(w, r, assetID)
+	case http.MethodPost:
+		h.createReading(w, r, assetID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AssetsHandler) listReadings(w http.ResponseWriter, r *http.Request, assetID string) {
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	asset, status, err := h.loadVisibleAsset(ctx, r, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+assetReadingColumns+`
+		FROM asset_reading
+		WHERE asset_id = $1 AND ($2 = '' OR kind = $2)
+		ORDER BY recorded_at DESC, id DESC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, asset.ID, strings.TrimSpace(q.Get("kind")))
+	if err != nil {
+		http.Error(w, "could not list readings", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]assetReading, 0, limit)
+	for rows.Next() {
+		var it assetReading
+		if err := rows.Scan(
+			&it.ID, &it.AssetID, &it.WorkOrderID, &it.Kind, &it.Value, &it.Unit, &it.Notes,
+			&it.RecordedBy, &it.RecordedAt,
+		); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (h *AssetsHandler) createReading(w http.ResponseWriter, r *http.Request, assetID string) {
+	claims := authorize(w, r, authz.AssetReadingWrite)
+	if claims == nil {
+		return
+	}
+
+	var req createReadingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Kind = strings.ToLower(strings.TrimSpace(req.Kind))
+	req.Unit = trimmedOrNil(req.Unit)
+	req.Notes = trimmedOrNil(req.Notes)
+	req.WorkOrderID = trimmedOrNil(req.WorkOrderID)
+
+	switch {
+	case !readingKindRe.MatchString(req.Kind):
+		http.Error(w, "invalid kind (a-z, 0-9, _; max 40)", http.StatusBadRequest)
+		return
+	case req.Value == nil:
+		http.Error(w, "value is required", http.StatusBadRequest)
+		return
+	case *req.Value >= 1e9 || *req.Value <= -1e9:
+		http.Error(w, "value out of range", http.StatusBadRequest)
+		return
+	case req.Unit != nil && len(*req.Unit) > 16:
+		http.Error(w, "unit too long (max 16)", http.StatusBadRequest)
+		return
+	case req.Notes != nil && len(*req.Notes) > 500:
+		http.Error(w, "notes too long (max 500)", http.StatusBadRequest)
+		return
+	case req.RecordedAt != nil && req.RecordedAt.After(time.Now().Add(5*time.Minute)):
+		http.Error(w, "recorded_at cannot be in the future", http.StatusBadRequest)
+		return
+	}
+	recordedAt := time.Now()
+	if req.RecordedAt != nil {
+		recordedAt = *req.RecordedAt
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var id, assetStatus string
+	var woOK bool
+	err := h.DB.QueryRow(ctx, `
+		SELECT a.id, a.status::text,
+		       $3::text IS NULL OR EXISTS (
+		         SELECT 1 FROM work_order wo WHERE wo.id::text = $3 AND wo.asset_id = a.id
+		       )
+		FROM asset a
+		WHERE a.id::text = $1 AND a.service_provider_id = $2
+	`, assetID, claims.ServiceProvider, req.WorkOrderID).Scan(&id, &assetStatus, &woOK)
+	if err != nil {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if assetStatus == "decommissioned" {
+		http.Error(w, "asset is decommissioned", http.StatusConflict)
+		return
+	}
+	if !woOK {
+		http.Error(w, "work_order_id does not belong to this asset", http.StatusBadRequest)
+		return
+	}
+
+	var it assetReading
+	err = h.DB.QueryRow(ctx, `
+		INSERT INTO asset_reading (
+			service_provider_id, asset_id, work_order_id, kind, value, unit, notes,
+			recorded_by, recorded_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+assetReadingColumns,
+		claims.ServiceProvider, id, req.WorkOrderID, req.Kind, *req.Value, req.Unit, req.Notes,
+		claims.UserID, recordedAt,
+	).Scan(
+		&it.ID, &it.AssetID, &it.WorkOrderID, &it.Kind, &it.Value, &it.Unit, &it.Notes,
+		&it.RecordedBy, &it.RecordedAt,
+	)
+	if err != nil {
+		http.Error(w, "could not save reading", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// Línea de tiempo
+// GET /assets/{id}/history?order=desc|asc
+// GET /assets/{id}/history.pdf   ("hoja de vida")
+// =========================
+
+type timelineEvent struct {
+	At          time.Time      `json:"at"`
+	Kind        string         `json:"kind"`
+	RefID       string         `json:"ref_id"` // id de la fila de origen (orden, comentario, lectura...)
+	WorkOrderID *string        `json:"work_order_id,omitempty"`
+	ActorID     *string        `json:"actor_id,omitempty"`
+	ActorName   *string        `json:"actor_name,omitempty"`
+	Data        map[string]any `json:"data"`
+}
+
+// Cada rama arma un tipo de evento. client_visible: lo que ve un client
+// (la asignación y los comentarios internos del equipo técnico no).
+const timelineSQL = `
+	SELECT e.at, e.kind, e.ref_id, e.work_order_id, e.actor_id, u.fullname, e.data
+	FROM (
+		SELECT wo.created_at AS at, 'work_order_created' AS kind, wo.id AS ref_id, wo.id AS work_order_id,
+		       wo.created_by AS actor_id, true AS client_visible,
+		       jsonb_build_object('title', wo.title, 'type', wo.type, 'priority', wo.priority) AS data
+		FROM work_order wo WHERE wo.asset_id = $1
+		UNION ALL
+		SELECT wo.assigned_at, 'work_order_assigned', wo.id, wo.id, NULL, false,
+		       jsonb_build_object('title', wo.title, 'assigned_to', wo.assigned_to, 'assignee_name', tech.fullname)
+		FROM work_order wo LEFT JOIN "user" tech ON tech.id = wo.assigned_to
+		WHERE wo.asset_id = $1 AND wo.assigned_at IS NOT NULL
+		UNION ALL
+		SELECT wo.started_at, 'work_order_started', wo.id, wo.id, wo.assigned_to, true,
+		       jsonb_build_object('title', wo.title)
+		FROM work_order wo WHERE wo.asset_id = $1 AND wo.started_at IS NOT NULL
+		UNION ALL
+		SELECT wo.completed_at, 'work_order_completed', wo.id, wo.id, wo.assigned_to, true,
+		       jsonb_build_object('title', wo.title, 'type', wo.type)
+		FROM work_order wo WHERE wo.asset_id = $1 AND wo.completed_at IS NOT NULL
+		UNION ALL
+		SELECT c.created_at, 'comment', c.id, c.work_order_id, c.author_id, NOT c.is_internal,
+		       jsonb_build_object('comment', c.comment, 'is_internal', c.is_internal)
+		FROM work_order_comment c JOIN work_order wo ON wo.id = c.work_order_id
+		WHERE wo.asset_id = $1
+		UNION ALL
+		SELECT f.created_at, 'attachment', f.id, f.work_order_id, f.uploaded_by, true,
+		       jsonb_build_object('file_type', f.file_type, 'filename', f.filename,
+		                          'has_thumbnail', f.thumb_key IS NOT NULL)
+		FROM work_order_attachment f JOIN work_order wo ON wo.id = f.work_order_id
+		WHERE wo.asset_id = $1
+		UNION ALL
+		SELECT h.changed_at, 'status_change', h.id, NULL, h.changed_by, true,
+		       jsonb_build_object('from_status', h.from_status, 'to_status', h.to_status, 'reason', h.reason)
+		FROM asset_status_history h WHERE h.asset_id = $1
+		UNION ALL
+		SELECT rd.recorded_at, 'reading', rd.id, rd.work_order_id, rd.recorded_by, true,
+		       jsonb_build_object('kind', rd.kind, 'value', rd.value, 'unit', rd.unit, 'notes', rd.notes)
+		FROM asset_reading rd WHERE rd.asset_id = $1
+	) e
+	LEFT JOIN "user" u ON u.id = e.actor_id
+	WHERE e.client_visible OR NOT $2
+`
+
+func loadAssetTimeline(ctx context.Context, q dbtx, assetID string, clientView, asc bool, limit, offset int) ([]timelineEvent, error) {
+	order := "DESC"
+	if asc {
+		order = "ASC"
+	}
+	rows, err := q.Query(ctx, timelineSQL+`
+		ORDER BY e.at `+order+`, e.kind, e.ref_id
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset),
+		assetID, clientView,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]timelineEvent, 0, limit)
+	for rows.Next() {
+		var ev timelineEvent
+		if err := rows.Scan(&ev.At, &ev.Kind, &ev.RefID, &ev.WorkOrderID, &ev.ActorID, &ev.ActorName, &ev.Data); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+func (h *AssetsHandler) History(w http.ResponseWriter, r *http.Request, assetID string) {
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, _ := assetScope(r)
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	order := strings.TrimSpace(q.Get("order"))
+	if order != "" && order != "asc" && order != "desc" {
+		http.Error(w, "invalid order (asc|desc)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	asset, status, err := h.loadVisibleAsset(ctx, r, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	events, err := loadAssetTimeline(ctx, h.DB, asset.ID, own != "", order == "asc", limit, offset)
+	if err != nil {
+		http.Error(w, "could not load history", http.StatusInternalServerError)
+		return
+	}
+
+	// Las fotos van con su miniatura; el original se pide al adjunto.
+	claims := ClaimsFromContext(r.Context())
+	for _, ev := range events {
+		if has, _ := ev.Data["has_thumbnail"].(bool); has && ev.Kind == "attachment" {
+			if link, _ := fileLink(h.Downloads, h.PublicURL, claims.ServiceProvider, ev.RefID, "thumb"); link != nil {
+				ev.Data["thumbnail_url"] = *link
+			}
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, events)
+}
+
+// maxSheetEvents: la hoja de vida lleva hasta este número de eventos (los más
+// recientes), y miniaturas de hasta maxSheetPhotos fotos.
+const (
+	maxSheetEvents = 1000
+	maxSheetPhotos = 100
+)
+
+// sheetThumbnails: attachment id => miniatura, para las fotos procesadas de la hoja.
+func (h *AssetsHandler) sheetThumbnails(ctx context.Context, events []timelineEvent) map[string][]byte {
+	ids := make([]string, 0, maxSheetPhotos)
+	for _, ev := range events {
+		if has, _ := ev.Data["has_thumbnail"].(bool); has && ev.Kind == "attachment" && len(ids) < maxSheetPhotos {
+			ids = append(ids, ev.RefID)
+		}
+	}
+	out := map[string][]byte{}
+	if len(ids) == 0 || h.Storage == nil {
+		return out
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT id::text, thumb_key FROM work_order_attachment
+		WHERE id::text = ANY($1) AND thumb_key IS NOT NULL
+	`, ids)
+	if err != nil {
+		return out
+	}
+	keyOf := map[string]string{}
+	keys := make([]string, 0, len(ids))
+	for rows.Next() {
+		var id, key string
+		if err := rows.Scan(&id, &key); err != nil {
+			rows.Close()
+			return out
+		}
+		keyOf[id] = key
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	thumbs := loadThumbnails(ctx, h.Storage, keys)
+	for id, key := range keyOf {
+		if b, ok := thumbs[key]; ok {
+			out[id] = b
+		}
+	}
+	return out
+}
+
+// HistoryPDF: hoja de vida del equipo (datos + línea de tiempo), con el mismo
+// formato (logo, color, idioma, zona horaria) que el reporte mensual.
+func (h *AssetsHandler) HistoryPDF(w http.ResponseWriter, r *http.Request, assetID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, _ := assetScope(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	asset, status, err := h.loadVisibleAsset(ctx, r, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	settings, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not load settings", http.StatusInternalServerError)
+		return
+	}
+	loc := settings.Location()
+	text := assetSheetTextFor(settings.Language)
+	report := reportTextFor(settings.Language)
+
+	var customerName, siteName string
+	var areaName *string
+	err = h.DB.QueryRow(ctx, `
+		SELECT c.name, s.name, ar.name
+		FROM customer c
+		JOIN site s ON s.id = $2
+		LEFT JOIN area ar ON ar.id = $3
+		WHERE c.id = $1
+	`, asset.CustomerID, asset.SiteID, asset.AreaID).Scan(&customerName, &siteName, &areaName)
+	if err != nil {
+		http.Error(w, "could not load asset details", http.StatusInternalServerError)
+		return
+	}
+
+	// Los más recientes, pero impresos en orden cronológico.
+	events, err := loadAssetTimeline(ctx, h.DB, asset.ID, own != "", false, maxSheetEvents, 0)
+	if err != nil {
+		http.Error(w, "could not load history", http.StatusInternalServerError)
+		return
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	thumbs := h.sheetThumbnails(ctx, events)
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(text.Title, true)
+	pdf.SetMargins(10, 12, 10)
+	pdf.SetAutoPageBreak(false, 12)
+	pdf.AddUTF8Font("Body", "", "internal/assets/fonts/AndaleMono.ttf")
+	pdf.AddUTF8Font("Body", "B", "internal/assets/fonts/AndaleMono.ttf")
+	addReportFooter(pdf, report)
+	pdf.AliasNbPages("")
+	pdf.AddPage()
+
+	brand, hasBrand := parseHexColor(settings.PrimaryColor)
+	if settings.HasLogo {
+		addReportLogo(ctx, pdf, h.DB, claims.ServiceProvider)
+	}
+
+	pdf.SetFont("Body", "B", 16)
+	if hasBrand {
+		pdf.SetTextColor(brand[0], brand[1], brand[2])
+	}
+	pdf.Cell(0, 10, text.Title)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.Ln(10)
+
+	// Datos del equipo
+	place := siteName
+	if areaName != nil {
+		place += " / " + *areaName
+	}
+	fields := [][2]string{
+		{text.Tag, asset.TagCode},
+		{text.Name, deref(asset.Name)},
+		{text.Type, text.value(asset.Type)},
+		{text.Status, text.value(asset.Status)},
+		{text.Customer, customerName},
+		{text.Location, place},
+		{text.MakeModel, strings.TrimSpace(deref(asset.Manufacturer) + " " + deref(asset.Model))},
+		{text.Serial, deref(asset.SerialNumber)},
+		{text.Capacity, capacityText(asset.CapacityBTU)},
+		{text.Refrigerant, deref(asset.RefrigerantType)},
+		{text.Installed, deref(asset.InstallDate)},
+	}
+	pdf.SetFont("Body", "", 10)
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+		pdf.SetFont("Body", "B", 10)
+		pdf.CellFormat(45, 6, f[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Body", "", 10)
+		pdf.CellFormat(0, 6, truncateToWidth(pdf, f[1], 145), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	// Línea de tiempo
+	colW := []float64{32, 50, 108} // fecha, evento, detalle
+	header := report
+	header.Headers = text.Headers
+	tableHeader := func() { addTableHeader(pdf, colW, header, brand, hasBrand) }
+
+	if len(events) == 0 {
+		pdf.SetFont("Body", "", 10)
+		pdf.Cell(0, 7, text.NoEvents)
+	} else {
+		tableHeader()
+	}
+
+	lineH, padX, padY, thumbH := 5.0, 1.5, 1.5, 20.0
+	for _, ev := range events {
+		detail := text.describe(ev)
+		if ev.ActorName != nil {
+			detail += " (" + *ev.ActorName + ")"
+		}
+		lines := wrap2(pdf, detail, colW[2]-2*padX)
+		rowH := 2*padY + float64(len(lines))*lineH
+		thumb, hasThumb := thumbs[ev.RefID]
+		if hasThumb {
+			rowH += thumbH + padY
+		}
+
+		ensureSpace(pdf, rowH, tableHeader)
+
+		x, y := pdf.GetX(), pdf.GetY()
+		pdf.Rect(x, y, colW[0], rowH, "")
+		pdf.Text(x+padX, y+padY+lineH-1, ev.At.In(loc).Format(text.DateTimeLayout))
+		pdf.Rect(x+colW[0], y, colW[1], rowH, "")
+		pdf.Text(x+colW[0]+padX, y+padY+lineH-1, truncateToWidth(pdf, text.event(ev.Kind), colW[1]))
+		pdf.Rect(x+colW[0]+colW[1], y, colW[2], rowH, "")
+		for i, l := range lines {
+			pdf.Text(x+colW[0]+colW[1]+padX, y+padY+lineH*float64(i+1)-1, l)
+		}
+		if hasThumb {
+			addThumbnail(pdf, "thumb-"+ev.RefID, thumb, x+colW[0]+colW[1]+padX, y+padY+float64(len(lines))*lineH, thumbH)
+		}
+		pdf.SetXY(x, y+rowH)
+	}
+
+	filename := fmt.Sprintf("asset_%s_history.pdf", sanitizeFilename(asset.TagCode))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err := pdf.Output(w); err != nil {
+		http.Error(w, "pdf output error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func capacityText(btu *int) string {
+	if btu == nil {
+		return ""
+	}
+	return strconv.Itoa(*btu) + " BTU/h"
+}
+
+// =========================
+// Textos de la hoja de vida por idioma
+// =========================
+
+type assetSheetText struct {
+	Title, NoEvents                                     string
+	Tag, Name, Type, Status, Customer, Location         string
+	MakeModel, Serial, Capacity, Refrigerant, Installed string
+	Headers                                             []string // fecha, evento, detalle
+	DateTimeLayout                                      string
+	Events                                              map[string]string
+	Values                                              map[string]string // tipos, prioridades, estados
+}
+
+func (t assetSheetText) value(v string) string {
+	if s, ok := t.Values[v]; ok {
+		return s
+	}
+	return v
+}
+
+func (t assetSheetText) event(kind string) string {
+	if s, ok := t.Events[kind]; ok {
+		return s
+	}
+	return kind
+}
+
+// describe: una línea de detalle por evento, a partir de data.
+func (t assetSheetText) describe(ev timelineEvent) string {
+	str := func(k string) string {
+		if v, ok := ev.Data[k].(string); ok {
+			return v
+		}
+		return ""
+	}
+	switch ev.Kind {
+	case "work_order_created":
+		return fmt.Sprintf("%s (%s, %s)", str("title"), t.value(str("type")), t.value(str("priority")))
+	case "work_order_assigned":
+		return str("title") + " → " + str("assignee_name")
+	case "work_order_started", "work_order_completed":
+		return str("title")
+	case "comment":
+		return str("comment")
+	case "attachment":
+		if name := str("filename"); name != "" {
+			return t.value(str("file_type")) + ": " + name
+		}
+		return t.value(str("file_type"))
+	case "status_change":
+		s := t.value(str("to_status"))
+		if from := str("from_status"); from != "" {
+			s = t.value(from) + " → " + s
+		}
+		if reason := str("reason"); reason != "" {
+			s += ": " + reason
+		}
+		return s
+	case "reading":
+		v, _ := ev.Data["value"].(float64)
+		return strings.TrimSpace(fmt.Sprintf("%s: %s %s", str("kind"), strconv.FormatFloat(v, 'f', -1, 64), str("unit")))
+	}
+	return ""
+}
+
+var assetSheetTexts = map[string]assetSheetText{
+	"en": {
+		Title:          "Asset Service History",
+		NoEvents:       "No recorded events.",
+		Tag:            "Tag",
+		Name:           "Name",
+		Type:           "Type",
+		Status:         "Status",
+		Customer:       "Customer",
+		Location:       "Location",
+		MakeModel:      "Make / model",
+		Serial:         "Serial number",
+		Capacity:       "Capacity",
+		Refrigerant:    "Refrigerant",
+		Installed:      "Installed",
+		Headers:        []string{"Date", "Event", "Detail"},
+		DateTimeLayout: "2006-01-02 15:04",
+		Events: map[string]string{
+			"work_order_created":   "Work order created",
+			"work_order_assigned":  "Assigned",
+			"work_order_started":   "Work started",
+			"work_order_completed": "Work completed",
+			"comment":              "Comment",
+			"attachment":           "Attachment",
+			"status_change":        "Status change",
+			"reading":              "Reading",
+		},
+		Values: map[string]string{
+			"mini_split":     "mini split",
+			"package_unit":   "package unit",
+			"out_of_service": "out of service",
+		},
+	},
+	"es": {
+		Title:          "Hoja de vida del equipo",
+		NoEvents:       "Sin eventos registrados.",
+		Tag:            "Código",
+		Name:           "Nombre",
+		Type:           "Tipo",
+		Status:         "Estado",
+		Customer:       "Cliente",
+		Location:       "Ubicación",
+		MakeModel:      "Marca / modelo",
+		Serial:         "N.º de serie",
+		Capacity:       "Capacidad",
+		Refrigerant:    "Refrigerante",
+		Installed:      "Instalación",
+		Headers:        []string{"Fecha", "Evento", "Detalle"},
+		DateTimeLayout: "02/01/2006 15:04",
+		Events: map[string]string{
+			"work_order_created":   "Orden creada",
+			"work_order_assigned":  "Asignada",
+			"work_order_started":   "Trabajo iniciado",
+			"work_order_completed": "Trabajo completado",
+			"comment":              "Comentario",
+			"attachment":           "Adjunto",
+			"status_change":        "Cambio de estado",
+			"reading":              "Lectura",
+		},
+		Values: map[string]string{
+			"split":          "split",
+			"mini_split":     "mini split",
+			"package_unit":   "equipo paquete",
+			"vrf":            "VRF",
+			"chiller":        "chiller",
+			"other":          "otro",
+			"active":         "activo",
+			"out_of_service": "fuera de servicio",
+			"decommissioned": "dado de baja",
+			"preventive":     "preventivo",
+			"corrective":     "correctivo",
+			"inspection":     "inspección",
+			"low":            "baja",
+			"medium":         "media",
+			"high":           "alta",
+			"critical":       "crítica",
+			"photo":          "foto",
+			"pdf":            "pdf",
+		},
+	},
+}
+
+func assetSheetTextFor(lang string) assetSheetText {
+	if t, ok := assetSheetTexts[mailer.NormalizeLang(lang)]; ok {
+		return t
+	}
+	return assetSheetTexts["en"]
+}
@@ -0,0 +1,331 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/boombuler/barcode/qr"
+	"github.com/phpdave11/gofpdf"
+)
+
+// =========================
+// GET /assets/labels?site_id=   |   GET /assets/labels?ids=a,b,c
+// =========================
+
+// Hoja A4 de 3 x 8 etiquetas de 70 x 36 mm (formato estándar de etiquetas adhesivas).
+const (
+	labelCols    = 3
+	labelRows    = 8
+	labelW       = 70.0
+	labelH       = 36.0
+	labelPad     = 3.0
+	labelQR      = 30.0
+	maxLabelsReq = 500
+)
+
+type labelRow struct {
+	ID, TagCode, Type, Customer, Site string
+	Name, Area                        *string
+}
+
+// Labels genera el PDF de etiquetas. Con site_id salen todos los equipos no
+// retirados del sitio; con ids, exactamente esos.
+func (h *AssetsHandler) Labels(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.AssetRead)
+	if claims == nil {
+		return
+	}
+	if h.LabelSigner == nil {
+		http.Error(w, "asset labels are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	siteID := strings.TrimSpace(q.Get("site_id"))
+	var ids []string
+	for _, id := range strings.Split(q.Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if (siteID == "") == (len(ids) == 0) {
+		http.Error(w, "pass either site_id or ids", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxLabelsReq {
+		http.Error(w, "too many ids (max 500)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	where := `a.site_id::text = $2 AND a.status <> 'decommissioned'`
+	var arg any = siteID
+	if len(ids) > 0 {
+		where = `a.id::text = ANY($2)`
+		arg = ids
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT a.id, a.tag_code, a.type::text, c.name, s.name, a.name, ar.name
+		FROM asset a
+		JOIN customer c ON c.id = a.customer_id
+		JOIN site s ON s.id = a.site_id
+		LEFT JOIN area ar ON ar.id = a.area_id
+		WHERE a.service_provider_id = $1 AND `+where+`
+		ORDER BY c.name, s.name, ar.name NULLS FIRST, a.tag_code
+		LIMIT `+itoa(maxLabelsReq)+`
+	`, claims.ServiceProvider, arg)
+	if err != nil {
+		http.Error(w, "could not load assets", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var labels []labelRow
+	for rows.Next() {
+		var l labelRow
+		if err := rows.Scan(&l.ID, &l.TagCode, &l.Type, &l.Customer, &l.Site, &l.Name, &l.Area); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		labels = append(labels, l)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+	if len(labels) == 0 {
+		http.Error(w, "no assets to label", http.StatusNotFound)
+		return
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Asset labels", true)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddUTF8Font("Body", "", "internal/assets/fonts/AndaleMono.ttf")
+	pdf.AddUTF8Font("Body", "B", "internal/assets/fonts/AndaleMono.ttf")
+
+	pageW, pageH := pdf.GetPageSize()
+	left := (pageW - labelCols*labelW) / 2
+	top := (pageH - labelRows*labelH) / 2
+
+	for i, l := range labels {
+		slot := i % (labelCols * labelRows)
+		if slot == 0 {
+			pdf.AddPage()
+		}
+		x := left + float64(slot%labelCols)*labelW
+		y := top + float64(slot/labelCols)*labelH
+
+		code, ok := h.LabelSigner.Code(claims.ServiceProvider, l.ID)
+		if !ok {
+			http.Error(w, "invalid asset id", http.StatusInternalServerError)
+			return
+		}
+		if err := drawQR(pdf, frontendLink(h.FrontendURL, "/scan/"+code, nil), x+labelPad, y+labelPad, labelQR); err != nil {
+			http.Error(w, "could not encode qr", http.StatusInternalServerError)
+			return
+		}
+		drawLabelText(pdf, l, x+labelPad+labelQR+2, y+labelPad, labelW-labelQR-2*labelPad-2)
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="asset_labels_%s.pdf"`, time.Now().Format("20060102")))
+	if err := pdf.Output(w); err != nil {
+		http.Error(w, "pdf output error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// drawQR dibuja el QR como rectángulos (vectorial: se lee bien a cualquier
+// tamaño de impresión). Cada tramo oscuro de una fila va en un solo rect.
+func drawQR(pdf *gofpdf.Fpdf, content string, x, y, size float64) error {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return err
+	}
+	n := code.Bounds().Dx()
+	if n == 0 {
+		return errors.New("empty qr")
+	}
+	m := size / float64(n)
+
+	dark := func(i, j int) bool {
+		r, _, _, _ := code.At(i, j).RGBA()
+		return r < 0x8000
+	}
+
+	pdf.SetFillColor(0, 0, 0)
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; {
+			if !dark(i, j) {
+				i++
+				continue
+			}
+			start := i
+			for i < n && dark(i, j) {
+				i++
+			}
+			pdf.Rect(x+float64(start)*m, y+float64(j)*m, float64(i-start)*m, m, "F")
+		}
+	}
+	return nil
+}
+
+func drawLabelText(pdf *gofpdf.Fpdf, l labelRow, x, y, width float64) {
+	pdf.SetFont("Body", "B", 11)
+	pdf.Text(x, y+4, fitWithEllipsis(pdf, l.TagCode, width))
+
+	pdf.SetFont("Body", "", 7)
+	desc := l.Type
+	if l.Name != nil {
+		desc = *l.Name
+	}
+	lineY := y + 10
+	for _, line := range wrap2(pdf, desc, width) {
+		pdf.Text(x, lineY, line)
+		lineY += 3.5
+	}
+
+	pdf.SetTextColor(90, 90, 90)
+	lineY = y + 20
+	place := l.Site
+	if l.Area != nil {
+		place += " / " + *l.Area
+	}
+	for _, s := range []string{l.Customer, place} {
+		pdf.Text(x, lineY, fitWithEllipsis(pdf, s, width))
+		lineY += 3.5
+	}
+	pdf.SetTextColor(0, 0, 0)
+}
+
+// =========================
+// GET /scan/{code}
+// =========================
+
+type scanResult struct {
+	Asset          assetItem       `json:"asset"`
+	CustomerName   string          `json:"customer_name"`
+	SiteName       string          `json:"site_name"`
+	AreaName       *string         `json:"area_name,omitempty"`
+	OpenWorkOrders []workOrderItem `json:"open_work_orders"`
+	LastServiceAt  *time.Time      `json:"last_service_at,omitempty"` // última orden completada
+}
+
+// Scan resuelve el código de una etiqueta al equipo. Mismo alcance que
+// GET /assets/{id}: un client solo resuelve equipos de su customer, y las
+// órdenes abiertas se filtran como en GET /work-orders.
+func (h *AssetsHandler) Scan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if h.LabelSigner == nil {
+		http.Error(w, "asset labels are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	parts := pathParts(r)
+	if len(parts) != 2 || parts[0] != "scan" {
+		http.NotFound(w, r)
+		return
+	}
+	assetID, ok := h.LabelSigner.Parse(claims.ServiceProvider, parts[1])
+	if !ok {
+		http.Error(w, "unknown code", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	asset, status, err := h.loadVisibleAsset(ctx, r, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	out := scanResult{Asset: asset, OpenWorkOrders: []workOrderItem{}}
+
+	err = h.DB.QueryRow(ctx, `
+		SELECT c.name, s.name, ar.name,
+		       (SELECT max(wo.completed_at) FROM work_order wo
+		        WHERE wo.asset_id = $1 AND wo.status = 'completed')
+		FROM customer c
+		JOIN site s ON s.id = $2
+		LEFT JOIN area ar ON ar.id = $3
+		WHERE c.id = $4
+	`, asset.ID, asset.SiteID, asset.AreaID, asset.CustomerID).Scan(
+		&out.CustomerName, &out.SiteName, &out.AreaName, &out.LastServiceAt,
+	)
+	if err != nil {
+		http.Error(w, "could not load asset details", http.StatusInternalServerError)
+		return
+	}
+
+	// Órdenes abiertas, con el mismo alcance que GET /work-orders.
+	perms := PermissionsFromContext(r.Context())
+	args := []any{claims.ServiceProvider, asset.ID}
+	where := `WHERE service_provider_id = $1 AND asset_id = $2 AND status NOT IN ('completed', 'cancelled')`
+	switch {
+	case perms.Has(authz.WorkOrderReadAll):
+	case perms.Has(authz.WorkOrderReadCustomer) && claims.CustomerID != nil:
+		where += ` AND customer_id = $3`
+		args = append(args, *claims.CustomerID)
+	case perms.Has(authz.WorkOrderReadAssigned):
+		where += ` AND assigned_to = $3`
+		args = append(args, claims.UserID)
+	default:
+		WriteJSON(w, http.StatusOK, out)
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT
+		  id, customer_id, site_id, asset_id,
+		  type, priority, status, title,
+		  assigned_to, created_by,
+		  completed_at, created_at
+		FROM work_order
+		`+where+`
+		ORDER BY created_at DESC
+		LIMIT 50
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list work orders", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var it workOrderItem
+		if err := rows.Scan(
+			&it.ID, &it.CustomerID, &it.SiteID, &it.AssetID,
+			&it.Type, &it.Priority, &it.Status, &it.Title,
+			&it.AssignedTo, &it.CreatedBy,
+			&it.CompletedAt, &it.CreatedAt,
+		); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out.OpenWorkOrders = append(out.OpenWorkOrders, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
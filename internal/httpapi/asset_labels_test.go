@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+)
+
+// Scan descarta los códigos ajenos o adulterados antes de ir a la DB, con el
+// mismo 404 que un equipo inexistente.
+func TestScanRejectsForeignAndTamperedCodes(t *testing.T) {
+	labels := &auth.LabelSigner{Secret: []byte("labels-secret")}
+	h := &AssetsHandler{DB: unreachableDB(t), LabelSigner: labels}
+	admin := actors()["admin"]
+
+	own, _ := labels.Code(testSPID, testID)
+	foreign, _ := labels.Code("00000000-0000-0000-0000-0000000000a2", testID)
+	raw, _ := base64.RawURLEncoding.DecodeString(own)
+	raw[0] ^= 0x01 // otro equipo con la firma del original
+	tampered := base64.RawURLEncoding.EncodeToString(raw)
+
+	scan := func(code string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/scan/"+code, nil)
+		w := httptest.NewRecorder()
+		h.Scan(w, withActor(r, admin))
+		return w
+	}
+	for name, code := range map[string]string{"other provider": foreign, "tampered": tampered, "asset id": testID} {
+		if w := scan(code); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "unknown code") {
+			t.Errorf("%s: status %d %q, want 404 unknown code", name, w.Code, w.Body)
+		}
+	}
+	// El propio pasa la firma y recién falla al buscar el equipo.
+	if w := scan(own); strings.Contains(w.Body.String(), "unknown code") {
+		t.Errorf("own code rejected: status %d %q", w.Code, w.Body)
+	}
+}
+
+// TestScanPostgres: el código impreso en la etiqueta vuelve al mismo equipo
+// por GET /scan/{code}. Necesita TEST_DATABASE_URL (ver db/rls_test.go).
+func TestScanPostgres(t *testing.T) {
+	e := newSessionEnv(t)
+	labels := &auth.LabelSigner{Secret: []byte("labels-secret")}
+	assets := &AssetsHandler{DB: e.db, LabelSigner: labels}
+	e.mux.Handle("/scan/", e.authn.Middleware(http.HandlerFunc(assets.Scan)))
+
+	var assetID string
+	err := e.db.QueryRow(e.sys, `
+		WITH c AS (
+			INSERT INTO customer (service_provider_id, name) VALUES ($1, 'Cliente') RETURNING id
+		), s AS (
+			INSERT INTO site (service_provider_id, customer_id, name) SELECT $1, id, 'Sitio' FROM c RETURNING id
+		)
+		INSERT INTO asset (service_provider_id, customer_id, site_id, tag_code)
+		SELECT $1, c.id, s.id, 'T-1' FROM c, s
+		RETURNING id
+	`, e.spid).Scan(&assetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := e.login(e.user("admin@labels.test", "admin"), "admin").Token
+
+	code, ok := labels.Code(e.spid, assetID)
+	if !ok {
+		t.Fatal("Code rejected the asset id")
+	}
+	w := e.do(http.MethodGet, "/scan/"+code, admin, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("scan: status %d: %s", w.Code, w.Body)
+	}
+	var out scanResult
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Asset.ID != assetID || out.SiteName != "Sitio" || out.CustomerName != "Cliente" {
+		t.Errorf("scan resolved to %+v", out)
+	}
+
+	// El mismo equipo firmado para otro provider no resuelve acá.
+	foreign, _ := labels.Code("00000000-0000-0000-0000-0000000000a2", assetID)
+	if w := e.do(http.MethodGet, "/scan/"+foreign, admin, ""); w.Code != http.StatusNotFound {
+		t.Errorf("foreign code: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,908 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type AssetsHandler struct {
+	DB          *db.DB
+	LabelSigner *auth.LabelSigner // nil => sin etiquetas ni /scan
+	FrontendURL string            // base del link que va en el QR
+
+	// Miniaturas de las fotos en la línea de tiempo y la hoja de vida
+	Storage   storage.Storage
+	Downloads *auth.DownloadSigner
+	PublicURL string
+}
+
+var (
+	assetTypes    = []string{"split", "mini_split", "package_unit", "vrf", "chiller", "other"}
+	assetStatuses = []string{"active", "out_of_service", "decommissioned"}
+
+	// assetTransitions: a qué estados se puede pasar desde cada uno.
+	// decommissioned es final (el equipo se retiró; queda por su historial).
+	assetTransitions = map[string][]string{
+		"active":         {"out_of_service", "decommissioned"},
+		"out_of_service": {"active", "decommissioned"},
+		"decommissioned": nil,
+	}
+)
+
+type assetItem struct {
+	ID              string    `json:"id"`
+	CustomerID      string    `json:"customer_id"`
+	SiteID          string    `json:"site_id"`
+	AreaID          *string   `json:"area_id,omitempty"`
+	Type            string    `json:"type"`
+	TagCode         string    `json:"tag_code"`
+	Name            *string   `json:"name,omitempty"`
+	Manufacturer    *string   `json:"manufacturer,omitempty"`
+	Model           *string   `json:"model,omitempty"`
+	SerialNumber    *string   `json:"serial_number,omitempty"`
+	CapacityBTU     *int      `json:"capacity_btu,omitempty"`
+	RefrigerantType *string   `json:"refrigerant_type,omitempty"`
+	InstallDate     *string   `json:"install_date,omitempty"` // YYYY-MM-DD
+	Status          string    `json:"status"`
+	Notes           *string   `json:"notes,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+const assetItemColumns = `
+	id, customer_id, site_id, area_id, type::text, tag_code, name,
+	manufacturer, model, serial_number, capacity_btu, refrigerant_type,
+	to_char(install_date, 'YYYY-MM-DD'), status::text, notes,
+	created_at, updated_at`
+
+func scanAssetItem(row pgx.Row, it *assetItem) error {
+	return row.Scan(
+		&it.ID, &it.CustomerID, &it.SiteID, &it.AreaID, &it.Type, &it.TagCode, &it.Name,
+		&it.Manufacturer, &it.Model, &it.SerialNumber, &it.CapacityBTU, &it.RefrigerantType,
+		&it.InstallDate, &it.Status, &it.Notes,
+		&it.CreatedAt, &it.UpdatedAt,
+	)
+}
+
+// assetScope: igual que customerScope pero con los permisos de equipos.
+func assetScope(r *http.Request) (own string, ok bool) {
+	claims := ClaimsFromContext(r.Context())
+	perms := PermissionsFromContext(r.Context())
+	switch {
+	case perms.Has(authz.AssetRead):
+		return "", true
+	case perms.Has(authz.AssetReadOwn) && claims.CustomerID != nil:
+		return *claims.CustomerID, true
+	}
+	return "", false
+}
+
+type assetRequest struct {
+	SiteID          *string `json:"site_id,omitempty"`
+	AreaID          *string `json:"area_id,omitempty"` // "" => sin área
+	Type            *string `json:"type,omitempty"`
+	TagCode         *string `json:"tag_code,omitempty"`
+	Name            *string `json:"name,omitempty"` // "" => se borra (igual el resto de opcionales)
+	Manufacturer    *string `json:"manufacturer,omitempty"`
+	Model           *string `json:"model,omitempty"`
+	SerialNumber    *string `json:"serial_number,omitempty"`
+	CapacityBTU     *int    `json:"capacity_btu,omitempty"` // 0 => se borra
+	RefrigerantType *string `json:"refrigerant_type,omitempty"`
+	InstallDate     *string `json:"install_date,omitempty"` // YYYY-MM-DD
+	Notes           *string `json:"notes,omitempty"`
+}
+
+// apply copia al item los campos presentes y valida el resultado. site/area se
+// validan aparte contra la DB (resolvePlacement).
+func (req assetRequest) apply(it *assetItem) error {
+	if req.SiteID != nil {
+		it.SiteID = strings.TrimSpace(*req.SiteID)
+	}
+	if req.AreaID != nil {
+		it.AreaID = trimmedOrNil(req.AreaID)
+	}
+	if req.Type != nil {
+		it.Type = strings.TrimSpace(*req.Type)
+	}
+	if req.TagCode != nil {
+		it.TagCode = strings.TrimSpace(*req.TagCode)
+	}
+	if req.Name != nil {
+		it.Name = trimmedOrNil(req.Name)
+	}
+	if req.Manufacturer != nil {
+		it.Manufacturer = trimmedOrNil(req.Manufacturer)
+	}
+	if req.Model != nil {
+		it.Model = trimmedOrNil(req.Model)
+	}
+	if req.SerialNumber != nil {
+		it.SerialNumber = trimmedOrNil(req.SerialNumber)
+	}
+	if req.CapacityBTU != nil {
+		it.CapacityBTU = req.CapacityBTU
+		if *req.CapacityBTU == 0 {
+			it.CapacityBTU = nil
+		}
+	}
+	if req.RefrigerantType != nil {
+		it.RefrigerantType = trimmedOrNil(req.RefrigerantType)
+		if it.RefrigerantType != nil {
+			rt := strings.ToUpper(*it.RefrigerantType) // R-410A, R-22...
+			it.RefrigerantType = &rt
+		}
+	}
+	if req.InstallDate != nil {
+		it.InstallDate = trimmedOrNil(req.InstallDate)
+	}
+	if req.Notes != nil {
+		it.Notes = trimmedOrNil(req.Notes)
+	}
+
+	if it.Type == "" {
+		it.Type = "other"
+	}
+	switch {
+	case it.SiteID == "":
+		return errors.New("site_id is required")
+	case !slices.Contains(assetTypes, it.Type):
+		return errors.New("invalid type")
+	case it.TagCode == "":
+		return errors.New("tag_code is required")
+	case len(it.TagCode) > 60:
+		return errors.New("tag_code too long (max 60)")
+	case it.Name != nil && len(*it.Name) > 120:
+		return errors.New("name too long (max 120)")
+	case it.Manufacturer != nil && len(*it.Manufacturer) > 80:
+		return errors.New("manufacturer too long (max 80)")
+	case it.Model != nil && len(*it.Model) > 80:
+		return errors.New("model too long (max 80)")
+	case it.SerialNumber != nil && len(*it.SerialNumber) > 80:
+		return errors.New("serial_number too long (max 80)")
+	case it.CapacityBTU != nil && *it.CapacityBTU < 0:
+		return errors.New("capacity_btu must be positive")
+	case it.RefrigerantType != nil && len(*it.RefrigerantType) > 20:
+		return errors.New("refrigerant_type too long (max 20)")
+	case it.Notes != nil && len(*it.Notes) > 500:
+		return errors.New("notes too long (max 500)")
+	}
+	if it.InstallDate != nil {
+		d, err := time.Parse("2006-01-02", *it.InstallDate)
+		if err != nil {
+			return errors.New("invalid install_date (YYYY-MM-DD)")
+		}
+		if d.After(time.Now()) {
+			return errors.New("install_date cannot be in the future")
+		}
+	}
+	return nil
+}
+
+// resolvePlacement valida que el sitio sea del provider y esté activo, y que
+// el área (si hay) sea de ese sitio. Devuelve el customer del sitio.
+func resolvePlacement(ctx context.Context, q dbtx, spid, siteID string, areaID *string) (customerID string, status int, err error) {
+	var siteActive bool
+	err = q.QueryRow(ctx, `
+		SELECT customer_id, is_active
+		FROM site
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, siteID, spid).Scan(&customerID, &siteActive)
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("invalid site_id for this provider")
+	}
+	if !siteActive {
+		return "", http.StatusConflict, errors.New("site is inactive")
+	}
+
+	if areaID != nil {
+		var ok bool
+		err = q.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM area WHERE id::text = $1 AND site_id::text = $2)
+		`, *areaID, siteID).Scan(&ok)
+		if err != nil {
+			return "", http.StatusInternalServerError, errors.New("could not check area")
+		}
+		if !ok {
+			return "", http.StatusBadRequest, errors.New("area_id does not belong to site_id")
+		}
+	}
+	return customerID, 0, nil
+}
+
+// insertAsset da de alta el equipo (ya validado y ubicado) y abre su historial
+// de estados. Va dentro de una transacción (API e importación).
+func insertAsset(ctx context.Context, q dbtx, spid, userID string, it *assetItem) error {
+	err := scanAssetItem(q.QueryRow(ctx, `
+		INSERT INTO asset (
+			service_provider_id, customer_id, site_id, area_id, type, tag_code, name,
+			manufacturer, model, serial_number, capacity_btu, refrigerant_type,
+			install_date, notes
+		) VALUES ($1, $2, $3, $4, $5::asset_type, $6, $7, $8, $9, $10, $11, $12, $13::date, $14)
+		RETURNING `+assetItemColumns,
+		spid, it.CustomerID, it.SiteID, it.AreaID, it.Type, it.TagCode, it.Name,
+		it.Manufacturer, it.Model, it.SerialNumber, it.CapacityBTU, it.RefrigerantType,
+		it.InstallDate, it.Notes,
+	), it)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(ctx, `
+		INSERT INTO asset_status_history (service_provider_id, asset_id, from_status, to_status, changed_by)
+		VALUES ($1, $2, NULL, $3::asset_status, $4)
+	`, spid, it.ID, it.Status, userID)
+	return err
+}
+
+// updateAsset guarda los datos del equipo; el estado se cambia solo por SetStatus.
+func updateAsset(ctx context.Context, q dbtx, spid string, it *assetItem) error {
+	return scanAssetItem(q.QueryRow(ctx, `
+		UPDATE asset
+		SET site_id = $3, area_id = $4, type = $5::asset_type, tag_code = $6, name = $7,
+		    manufacturer = $8, model = $9, serial_number = $10, capacity_btu = $11,
+		    refrigerant_type = $12, install_date = $13::date, notes = $14,
+		    updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+		RETURNING `+assetItemColumns,
+		it.ID, spid, it.SiteID, it.AreaID, it.Type, it.TagCode, it.Name,
+		it.Manufacturer, it.Model, it.SerialNumber, it.CapacityBTU,
+		it.RefrigerantType, it.InstallDate, it.Notes,
+	), it)
+}
+
+// isTagConflict: violación de uq_asset_customer_tag (tag repetido en el customer).
+func isTagConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "uq_asset_customer_tag"
+}
+
+// =========================
+// GET  /assets?customer_id=&site_id=&area_id=&type=&status=&refrigerant_type=&tag_code=&q=
+// POST /assets
+// =========================
+
+func (h *AssetsHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AssetsHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, ok := assetScope(r)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := []any{claims.ServiceProvider}
+	where := `WHERE service_provider_id = $1`
+	argn := 2
+
+	// client: solo los equipos de su customer (ignora customer_id)
+	customerID := own
+	if customerID == "" {
+		customerID = strings.TrimSpace(q.Get("customer_id"))
+	}
+	if customerID != "" {
+		where += " AND customer_id::text = $" + itoa(argn)
+		args = append(args, customerID)
+		argn++
+	}
+
+	for _, f := range []string{"site_id", "area_id"} {
+		if v := strings.TrimSpace(q.Get(f)); v != "" {
+			where += " AND " + f + "::text = $" + itoa(argn)
+			args = append(args, v)
+			argn++
+		}
+	}
+
+	if v := strings.TrimSpace(q.Get("type")); v != "" {
+		if !slices.Contains(assetTypes, v) {
+			http.Error(w, "invalid type", http.StatusBadRequest)
+			return
+		}
+		where += " AND type = $" + itoa(argn) + "::asset_type"
+		args = append(args, v)
+		argn++
+	}
+
+	if v := strings.TrimSpace(q.Get("status")); v != "" {
+		if !slices.Contains(assetStatuses, v) {
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+		where += " AND status = $" + itoa(argn) + "::asset_status"
+		args = append(args, v)
+		argn++
+	}
+
+	if v := strings.TrimSpace(q.Get("refrigerant_type")); v != "" {
+		where += " AND upper(refrigerant_type) = upper($" + itoa(argn) + ")"
+		args = append(args, v)
+		argn++
+	}
+
+	if v := strings.TrimSpace(q.Get("tag_code")); v != "" {
+		where += " AND tag_code = $" + itoa(argn)
+		args = append(args, v)
+		argn++
+	}
+
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		n := itoa(argn)
+		where += " AND (tag_code ILIKE $" + n + " OR name ILIKE $" + n +
+			" OR manufacturer ILIKE $" + n + " OR model ILIKE $" + n + " OR serial_number ILIKE $" + n + ")"
+		args = append(args, likePattern(search))
+		argn++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+assetItemColumns+`
+		FROM asset
+		`+where+`
+		ORDER BY tag_code ASC, id ASC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list assets", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]assetItem, 0, limit)
+	for rows.Next() {
+		var it assetItem
+		if err := scanAssetItem(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (h *AssetsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.AssetManage)
+	if claims == nil {
+		return
+	}
+
+	var req assetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	var it assetItem
+	if err := req.apply(&it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	customerID, status, err := resolvePlacement(ctx, tx, claims.ServiceProvider, it.SiteID, it.AreaID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	it.CustomerID = customerID
+	err = insertAsset(ctx, tx, claims.ServiceProvider, claims.UserID, &it)
+	if isTagConflict(err) {
+		http.Error(w, "tag_code already exists for this customer", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not create asset", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// GET /assets/labels?site_id= | ?ids=   (PDF, ver asset_labels.go)
+// GET /assets/by-tag/{tag_code}?customer_id=
+// GET/PATCH/DELETE /assets/{id}
+// POST /assets/{id}/status
+// GET  /assets/{id}/status-history
+// GET  /assets/{id}/history | history.pdf       (ver asset_history.go)
+// GET/POST /assets/{id}/readings
+// =========================
+
+func (h *AssetsHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "assets" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if parts[1] == "labels" && len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Labels(w, r)
+		return
+	}
+
+	if parts[1] == "by-tag" {
+		if len(parts) != 3 {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ByTag(w, r, strings.TrimSpace(parts[2]))
+		return
+	}
+
+	assetID := strings.TrimSpace(parts[1])
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.Get(w, r, assetID)
+		case http.MethodPatch:
+			h.Update(w, r, assetID)
+		case http.MethodDelete:
+			h.Delete(w, r, assetID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch parts[2] {
+	case "status":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.SetStatus(w, r, assetID)
+	case "status-history":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.StatusHistory(w, r, assetID)
+	case "history", "history.pdf":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if parts[2] == "history.pdf" {
+			h.HistoryPDF(w, r, assetID)
+			return
+		}
+		h.History(w, r, assetID)
+	case "readings":
+		h.Readings(w, r, assetID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// loadVisibleAsset trae el equipo si quien pregunta lo puede ver (client: solo
+// los de su customer). 404 en cualquier otro caso.
+func (h *AssetsHandler) loadVisibleAsset(ctx context.Context, r *http.Request, assetID string) (assetItem, int, error) {
+	claims := ClaimsFromContext(r.Context())
+	own, ok := assetScope(r)
+	if !ok {
+		return assetItem{}, http.StatusForbidden, errors.New("forbidden")
+	}
+
+	var it assetItem
+	err := scanAssetItem(h.DB.QueryRow(ctx, `
+		SELECT `+assetItemColumns+`
+		FROM asset
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, assetID, claims.ServiceProvider), &it)
+	if err != nil || (own != "" && it.CustomerID != own) {
+		return assetItem{}, http.StatusNotFound, errors.New("asset not found")
+	}
+	return it, 0, nil
+}
+
+func (h *AssetsHandler) Get(w http.ResponseWriter, r *http.Request, assetID string) {
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	it, status, err := h.loadVisibleAsset(ctx, r, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// ByTag busca un equipo por su tag_code (lo que está pegado en el equipo). El
+// tag es único por customer: si hay más de uno en el provider hay que pasar customer_id.
+func (h *AssetsHandler) ByTag(w http.ResponseWriter, r *http.Request, tag string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, ok := assetScope(r)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	customerID := own
+	if customerID == "" {
+		customerID = strings.TrimSpace(r.URL.Query().Get("customer_id"))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+assetItemColumns+`
+		FROM asset
+		WHERE service_provider_id = $1
+		  AND tag_code = $2
+		  AND ($3 = '' OR customer_id::text = $3)
+		LIMIT 2
+	`, claims.ServiceProvider, tag, customerID)
+	if err != nil {
+		http.Error(w, "could not look up asset", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var found []assetItem
+	for rows.Next() {
+		var it assetItem
+		if err := scanAssetItem(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		found = append(found, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	switch len(found) {
+	case 0:
+		http.Error(w, "asset not found", http.StatusNotFound)
+	case 1:
+		WriteJSON(w, http.StatusOK, found[0])
+	default:
+		http.Error(w, "tag_code is used by several customers; pass customer_id", http.StatusConflict)
+	}
+}
+
+func (h *AssetsHandler) Update(w http.ResponseWriter, r *http.Request, assetID string) {
+	claims := authorize(w, r, authz.AssetManage)
+	if claims == nil {
+		return
+	}
+
+	var req assetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var it assetItem
+	err = scanAssetItem(tx.QueryRow(ctx, `
+		SELECT `+assetItemColumns+`
+		FROM asset
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, assetID, claims.ServiceProvider), &it)
+	if err != nil {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if it.Status == "decommissioned" {
+		http.Error(w, "asset is decommissioned", http.StatusConflict)
+		return
+	}
+
+	prevSite, prevArea := it.SiteID, it.AreaID
+	if err := req.apply(&it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Moverlo de sitio/área: siempre dentro del mismo customer.
+	if it.SiteID != prevSite || (it.AreaID != nil && (prevArea == nil || *it.AreaID != *prevArea)) {
+		customerID, status, err := resolvePlacement(ctx, tx, claims.ServiceProvider, it.SiteID, it.AreaID)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if customerID != it.CustomerID {
+			http.Error(w, "site_id belongs to another customer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = updateAsset(ctx, tx, claims.ServiceProvider, &it)
+	if isTagConflict(err) {
+		http.Error(w, "tag_code already exists for this customer", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not update asset", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// Delete solo para equipos cargados por error (sin órdenes). Con historial,
+// la baja es POST /assets/{id}/status {"status": "decommissioned"}.
+func (h *AssetsHandler) Delete(w http.ResponseWriter, r *http.Request, assetID string) {
+	claims := authorize(w, r, authz.AssetManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	var inUse bool
+	err = tx.QueryRow(ctx, `
+		SELECT a.id, EXISTS (SELECT 1 FROM work_order wo WHERE wo.asset_id = a.id)
+		FROM asset a
+		WHERE a.id::text = $1 AND a.service_provider_id = $2
+		FOR UPDATE OF a
+	`, assetID, claims.ServiceProvider).Scan(&id, &inUse)
+	if err != nil {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if inUse {
+		http.Error(w, "asset has work orders; decommission it instead", http.StatusConflict)
+		return
+	}
+
+	// asset_status_history cae por ON DELETE CASCADE
+	if _, err := tx.Exec(ctx, `DELETE FROM asset WHERE id = $1`, id); err != nil {
+		http.Error(w, "could not delete asset", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// =========================
+// Ciclo de vida
+// =========================
+
+type setAssetStatusRequest struct {
+	Status string  `json:"status"`
+	Reason *string `json:"reason,omitempty"`
+}
+
+type assetStatusChange struct {
+	ID         string    `json:"id"`
+	FromStatus *string   `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	Reason     *string   `json:"reason,omitempty"`
+	ChangedBy  *string   `json:"changed_by,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+func (h *AssetsHandler) SetStatus(w http.ResponseWriter, r *http.Request, assetID string) {
+	claims := authorize(w, r, authz.AssetManage)
+	if claims == nil {
+		return
+	}
+
+	var req setAssetStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Status = strings.TrimSpace(req.Status)
+	req.Reason = trimmedOrNil(req.Reason)
+	if !slices.Contains(assetStatuses, req.Status) {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	if req.Reason != nil && len(*req.Reason) > 500 {
+		http.Error(w, "reason too long (max 500)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var current string
+	var openOrders int
+	err = tx.QueryRow(ctx, `
+		SELECT a.status::text,
+		       (SELECT count(*) FROM work_order wo
+		        WHERE wo.asset_id = a.id AND wo.status NOT IN ('completed', 'cancelled'))
+		FROM asset a
+		WHERE a.id::text = $1 AND a.service_provider_id = $2
+		FOR UPDATE OF a
+	`, assetID, claims.ServiceProvider).Scan(&current, &openOrders)
+	if err != nil {
+		http.Error(w, "asset not found", http.StatusNotFound)
+		return
+	}
+	if !slices.Contains(assetTransitions[current], req.Status) {
+		http.Error(w, "cannot change status from "+current+" to "+req.Status, http.StatusConflict)
+		return
+	}
+	if req.Status == "decommissioned" && openOrders > 0 {
+		http.Error(w, "asset has open work orders", http.StatusConflict)
+		return
+	}
+
+	var it assetItem
+	err = scanAssetItem(tx.QueryRow(ctx, `
+		UPDATE asset
+		SET status = $3::asset_status, updated_at = now()
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+assetItemColumns,
+		assetID, claims.ServiceProvider, req.Status,
+	), &it)
+	if err != nil {
+		http.Error(w, "could not update asset", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO asset_status_history (service_provider_id, asset_id, from_status, to_status, reason, changed_by)
+		VALUES ($1, $2, $3::asset_status, $4::asset_status, $5, $6)
+	`, claims.ServiceProvider, it.ID, current, req.Status, req.Reason, claims.UserID)
+	if err != nil {
+		http.Error(w, "could not record status", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+func (h *AssetsHandler) StatusHistory(w http.ResponseWriter, r *http.Request, assetID string) {
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	asset, status, err := h.loadVisibleAsset(ctx, r, assetID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT id, from_status::text, to_status::text, reason, changed_by, changed_at
+		FROM asset_status_history
+		WHERE asset_id = $1
+		ORDER BY changed_at DESC, id DESC
+	`, asset.ID)
+	if err != nil {
+		http.Error(w, "could not list status history", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]assetStatusChange, 0, 8)
+	for rows.Next() {
+		var c assetStatusChange
+		if err := rows.Scan(&c.ID, &c.FromStatus, &c.ToStatus, &c.Reason, &c.ChangedBy, &c.ChangedAt); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,914 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/imaging"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/phpdave11/gofpdf"
+)
+
+// =========================
+// Adjuntos de órdenes
+// GET/POST /work-orders/{id}/attachments        (POST: multipart, campo "file")
+// DELETE   /work-orders/{id}/attachments/{aid}
+// POST     /work-orders/{id}/uploads             (subida reanudable, ver abajo)
+// GET      /files/{token}                        (descarga por link firmado, pública)
+// =========================
+
+const (
+	maxUploadChunk  = 8 << 20 // por PATCH de una subida reanudable
+	uploadTTL       = 24 * time.Hour
+	multipartMemory = 8 << 20 // lo que pase de esto, ParseMultipartForm lo baja a disco
+)
+
+type attachmentItem struct {
+	ID          string    `json:"id"`
+	WorkOrderID string    `json:"work_order_id"`
+	FileType    string    `json:"file_type"` // photo|pdf|other
+	Filename    *string   `json:"filename,omitempty"`
+	ContentType *string   `json:"content_type,omitempty"`
+	SizeBytes   *int64    `json:"size_bytes,omitempty"`
+	UploadedBy  string    `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Fotos (jobs.PhotoProcessor): pending|processing|done|failed|unsupported
+	ProcessingStatus *string        `json:"processing_status,omitempty"`
+	Width            *int           `json:"width,omitempty"`
+	Height           *int           `json:"height,omitempty"`
+	DuplicateOf      *string        `json:"duplicate_of,omitempty"` // foto casi idéntica ya subida antes
+	TakenAt          *time.Time     `json:"taken_at,omitempty"`     // del EXIF; no se muestra a un client
+	Location         *photoLocation `json:"location,omitempty"`     // idem
+
+	// Links de descarga: firmados y de corta vida para los que están en el
+	// storage; los adjuntos viejos traen su URL tal cual.
+	DownloadURL       *string    `json:"download_url,omitempty"`
+	ThumbnailURL      *string    `json:"thumbnail_url,omitempty"` // fotos procesadas
+	WebURL            *string    `json:"web_url,omitempty"`       // idem, reducida para pantalla
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+
+	fileURL    *string
+	storageKey *string
+	thumbKey   *string
+	webKey     *string
+	lat, lng   *float64
+}
+
+type photoLocation struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+const attachmentColumns = `
+	id, work_order_id, file_type::text, filename, content_type, size_bytes,
+	uploaded_by, created_at, processing_status, width, height, duplicate_of,
+	taken_at, gps_lat, gps_lng, file_url, storage_key, thumb_key, web_key`
+
+func scanAttachment(row pgx.Row, it *attachmentItem) error {
+	return row.Scan(
+		&it.ID, &it.WorkOrderID, &it.FileType, &it.Filename, &it.ContentType, &it.SizeBytes,
+		&it.UploadedBy, &it.CreatedAt, &it.ProcessingStatus, &it.Width, &it.Height, &it.DuplicateOf,
+		&it.TakenAt, &it.lat, &it.lng, &it.fileURL, &it.storageKey, &it.thumbKey, &it.webKey,
+	)
+}
+
+// fileLink firma un link a /files/{token} (variant: "" original, thumb, web).
+// nil si no hay firmador.
+func fileLink(signer *auth.DownloadSigner, publicURL, spid, attachmentID, variant string) (*string, *time.Time) {
+	if signer == nil {
+		return nil, nil
+	}
+	token, exp := signer.Sign(spid, attachmentID, time.Now())
+	link := strings.TrimRight(publicURL, "/") + "/files/" + token
+	if variant != "" {
+		link += "?variant=" + variant
+	}
+	return &link, &exp
+}
+
+// withDownloadURL completa los links (sin firmador, solo los viejos). Un client
+// no ve de dónde ni cuándo se sacó la foto, ni baja una foto cuya metadata
+// todavía no se limpió.
+func (h *WorkOrdersHandler) withDownloadURL(spid string, it *attachmentItem, clientView bool) {
+	if it.lat != nil && it.lng != nil {
+		it.Location = &photoLocation{Lat: *it.lat, Lng: *it.lng}
+	}
+	if clientView {
+		it.TakenAt, it.Location = nil, nil
+	}
+	if it.storageKey == nil {
+		it.DownloadURL = it.fileURL
+		return
+	}
+	if clientView && it.ProcessingStatus != nil && *it.ProcessingStatus != "done" {
+		return
+	}
+	it.DownloadURL, it.DownloadExpiresAt = fileLink(h.Downloads, h.PublicURL, spid, it.ID, "")
+	if it.thumbKey != nil {
+		it.ThumbnailURL, _ = fileLink(h.Downloads, h.PublicURL, spid, it.ID, "thumb")
+	}
+	if it.webKey != nil {
+		it.WebURL, _ = fileLink(h.Downloads, h.PublicURL, spid, it.ID, "web")
+	}
+}
+
+// fileTypeFor mapea el tipo detectado del contenido a work_order_file_type.
+func fileTypeFor(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return "photo"
+	case contentType == "application/pdf":
+		return "pdf"
+	}
+	return "other"
+}
+
+// cleanFilename: solo el nombre (sin ruta), sin caracteres de control y acotado.
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	if r := []rune(name); len(r) > 200 {
+		name = string(r[:200])
+	}
+	return name
+}
+
+// canAttach: permiso y orden visible y no cancelada (404/403/409 según el caso).
+func (h *WorkOrdersHandler) canAttach(ctx context.Context, w http.ResponseWriter, r *http.Request, workOrderID string) (workOrderRef, bool) {
+	if h.Storage == nil {
+		http.Error(w, "attachments are not configured", http.StatusServiceUnavailable)
+		return workOrderRef{}, false
+	}
+	if authorize(w, r, authz.WorkOrderAttachmentWrite) == nil {
+		return workOrderRef{}, false
+	}
+	wo, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return workOrderRef{}, false
+	}
+	if wo.Status == "cancelled" {
+		http.Error(w, "work order is cancelled", http.StatusConflict)
+		return workOrderRef{}, false
+	}
+	return wo, true
+}
+
+// storedObject: archivo ya subido a su key definitiva, todavía sin fila.
+type storedObject struct {
+	id, key, contentType string
+	size                 int64
+}
+
+// errHEIF: HEIC/HEIF/AVIF no se aceptan (ver imaging.IsHEIF): se guardarían
+// con el GPS adentro y sin miniatura.
+var errHEIF = errors.New("HEIC/HEIF photos are not supported; upload them as JPEG")
+
+// putAttachmentObject detecta el tipo por el contenido (no por lo que declara
+// el cliente) y sube el objeto. No necesita ni abre transacción.
+func (h *WorkOrdersHandler) putAttachmentObject(ctx context.Context, spid, workOrderID string, body io.Reader, size int64) (storedObject, error) {
+	br := bufio.NewReaderSize(body, 512)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return storedObject{}, err
+	}
+	if imaging.IsHEIF(head) {
+		return storedObject{}, errHEIF
+	}
+	obj := storedObject{contentType: http.DetectContentType(head), size: size}
+
+	if err := h.DB.QueryRow(ctx, `SELECT gen_random_uuid()::text`).Scan(&obj.id); err != nil {
+		return storedObject{}, err
+	}
+	obj.key = spid + "/attachments/" + workOrderID + "/" + obj.id
+
+	if err := h.Storage.Put(ctx, obj.key, br, size, obj.contentType); err != nil {
+		return storedObject{}, err
+	}
+	return obj, nil
+}
+
+// insertAttachment crea la fila de un objeto ya subido.
+func insertAttachment(ctx context.Context, q dbtx, obj storedObject, spid, workOrderID, userID, filename string) (attachmentItem, error) {
+	var it attachmentItem
+	err := scanAttachment(q.QueryRow(ctx, `
+		INSERT INTO work_order_attachment (
+			id, service_provider_id, work_order_id, file_type, storage_key,
+			filename, content_type, size_bytes, uploaded_by, processing_status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CASE WHEN $4 = 'photo' THEN 'pending' END)
+		RETURNING `+attachmentColumns,
+		obj.id, spid, workOrderID, fileTypeFor(obj.contentType), obj.key,
+		filename, obj.contentType, obj.size, userID,
+	), &it)
+	return it, err
+}
+
+// dropObject borra un objeto que quedó sin fila (nadie lo va a encolar).
+func (h *WorkOrdersHandler) dropObject(ctx context.Context, key string) {
+	if err := h.Storage.Delete(context.WithoutCancel(ctx), key); err != nil {
+		log.Printf("[STORAGE] orphan %s: %v", key, err)
+	}
+}
+
+// storeAttachment sube el objeto y crea la fila.
+func (h *WorkOrdersHandler) storeAttachment(ctx context.Context, spid, workOrderID, userID, filename string, body io.Reader, size int64) (attachmentItem, error) {
+	obj, err := h.putAttachmentObject(ctx, spid, workOrderID, body, size)
+	if err != nil {
+		return attachmentItem{}, err
+	}
+	it, err := insertAttachment(ctx, h.DB, obj, spid, workOrderID, userID, filename)
+	if err != nil {
+		h.dropObject(ctx, obj.key)
+		return attachmentItem{}, err
+	}
+	return it, nil
+}
+
+// photoStored despierta al procesador de fotos (si no, la toma en su próxima vuelta).
+func (h *WorkOrdersHandler) photoStored(it attachmentItem) {
+	if h.Photos != nil && it.FileType == "photo" {
+		h.Photos.Wake()
+	}
+}
+
+func (h *WorkOrdersHandler) Attachments(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listAttachments(w, r, workOrderID)
+	case http.MethodPost:
+		h.uploadAttachment(w, r, workOrderID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WorkOrdersHandler) listAttachments(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	wo, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	customerID, _, _ := workOrderScope(r)
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM work_order_attachment
+		WHERE work_order_id = $1
+		ORDER BY created_at, id
+	`, wo.ID)
+	if err != nil {
+		http.Error(w, "could not list attachments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]attachmentItem, 0, 8)
+	for rows.Next() {
+		var it attachmentItem
+		if err := scanAttachment(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		h.withDownloadURL(claims.ServiceProvider, &it, customerID != "")
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// uploadAttachment: multipart/form-data con el archivo en el campo "file".
+// Para archivos grandes o conexiones malas, la subida reanudable.
+func (h *WorkOrdersHandler) uploadAttachment(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	wo, ok := h.canAttach(ctx, w, r, workOrderID)
+	if !ok {
+		return
+	}
+	claims := ClaimsFromContext(r.Context())
+
+	settings, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not load settings", http.StatusInternalServerError)
+		return
+	}
+	limit := settings.MaxUploadBytes()
+	tooLarge := fmt.Sprintf("file too large (max %d MB)", settings.MaxUploadMB)
+
+	// margen para los headers del multipart
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1<<20)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid multipart body", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	switch {
+	case header.Size == 0:
+		http.Error(w, "empty file", http.StatusBadRequest)
+		return
+	case header.Size > limit:
+		http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	it, err := h.storeAttachment(ctx, claims.ServiceProvider, wo.ID, claims.UserID, cleanFilename(header.Filename), file, header.Size)
+	if errors.Is(err, errHEIF) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		log.Printf("[STORAGE] upload work_order=%s: %v", wo.ID, err)
+		http.Error(w, "could not store file", http.StatusInternalServerError)
+		return
+	}
+	h.photoStored(it)
+	h.withDownloadURL(claims.ServiceProvider, &it, false)
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// deleteAttachment: quien gestiona órdenes, o quien lo subió. El objeto lo
+// borra jobs.StorageSweeper (el trigger lo encola).
+func (h *WorkOrdersHandler) DeleteAttachment(w http.ResponseWriter, r *http.Request, workOrderID, attachmentID string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	claims := authorize(w, r, authz.WorkOrderAttachmentWrite)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	wo, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var uploadedBy string
+	err = h.DB.QueryRow(ctx, `
+		SELECT uploaded_by FROM work_order_attachment
+		WHERE id::text = $1 AND work_order_id = $2
+	`, attachmentID, wo.ID).Scan(&uploadedBy)
+	if err != nil {
+		http.Error(w, "attachment not found", http.StatusNotFound)
+		return
+	}
+	if uploadedBy != claims.UserID && !PermissionsFromContext(r.Context()).Has(authz.WorkOrderUpdate) {
+		http.Error(w, "forbidden: only the uploader can delete an attachment", http.StatusForbidden)
+		return
+	}
+
+	if _, err := h.DB.Exec(ctx, `DELETE FROM work_order_attachment WHERE id::text = $1`, attachmentID); err != nil {
+		http.Error(w, "could not delete attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// =========================
+// Subida reanudable
+//
+// POST /work-orders/{id}/uploads {"filename", "size_bytes"} => {"id", ...}
+// PATCH /uploads/{id}  header Upload-Offset: n, body = siguiente parte (max 8 MB)
+// HEAD|GET /uploads/{id} => Upload-Offset (desde dónde seguir tras un corte)
+// DELETE /uploads/{id} => cancela
+//
+// Cada parte se guarda como objeto propio; con la última se arma el adjunto
+// (si eso falla, PATCH sin body con Upload-Offset = size_bytes lo reintenta).
+// Las subidas sin terminar vencen a las 24h (jobs.StorageSweeper).
+// =========================
+
+type createUploadRequest struct {
+	Filename  string `json:"filename"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+type uploadItem struct {
+	ID            string    `json:"id"`
+	WorkOrderID   string    `json:"work_order_id"`
+	Filename      string    `json:"filename"`
+	SizeBytes     int64     `json:"size_bytes"`
+	ReceivedBytes int64     `json:"received_bytes"`
+	ChunkSize     int64     `json:"chunk_size"` // máximo por PATCH
+	ExpiresAt     time.Time `json:"expires_at"`
+
+	partKeys []string // en orden; solo cuentan las partes confirmadas
+}
+
+const uploadColumns = `id, work_order_id, filename, size_bytes, received_bytes, expires_at, part_keys`
+
+func scanUpload(row pgx.Row, it *uploadItem) error {
+	it.ChunkSize = maxUploadChunk
+	return row.Scan(&it.ID, &it.WorkOrderID, &it.Filename, &it.SizeBytes, &it.ReceivedBytes, &it.ExpiresAt, &it.partKeys)
+}
+
+// uploadPartKey: cada intento de una parte va a su propia key, así un reintento
+// (o un PATCH duplicado) nunca pisa una parte ya confirmada.
+func uploadPartKey(spid, uploadID string, n int) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/uploads/%s/%06d-%s", spid, uploadID, n, hex.EncodeToString(b)), nil
+}
+
+func (h *WorkOrdersHandler) CreateUpload(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	wo, ok := h.canAttach(ctx, w, r, workOrderID)
+	if !ok {
+		return
+	}
+	claims := ClaimsFromContext(r.Context())
+
+	var req createUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not load settings", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case req.SizeBytes <= 0:
+		http.Error(w, "size_bytes is required", http.StatusBadRequest)
+		return
+	case req.SizeBytes > settings.MaxUploadBytes():
+		http.Error(w, fmt.Sprintf("file too large (max %d MB)", settings.MaxUploadMB), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var it uploadItem
+	err = scanUpload(h.DB.QueryRow(ctx, `
+		INSERT INTO attachment_upload (
+			service_provider_id, work_order_id, filename, size_bytes, created_by, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+uploadColumns,
+		claims.ServiceProvider, wo.ID, cleanFilename(req.Filename), req.SizeBytes,
+		claims.UserID, time.Now().Add(uploadTTL),
+	), &it)
+	if err != nil {
+		http.Error(w, "could not create upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/uploads/"+it.ID)
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// Upload atiende /uploads/{id}. Solo quien la creó sigue su subida.
+func (h *WorkOrdersHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) != 2 || parts[0] != "uploads" {
+		http.NotFound(w, r)
+		return
+	}
+	uploadID := strings.TrimSpace(parts[1])
+
+	claims := authorize(w, r, authz.WorkOrderAttachmentWrite)
+	if claims == nil {
+		return
+	}
+	if h.Storage == nil {
+		http.Error(w, "attachments are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		var it uploadItem
+		err := scanUpload(h.DB.QueryRow(ctx, `
+			SELECT `+uploadColumns+` FROM attachment_upload
+			WHERE id::text = $1 AND service_provider_id = $2 AND created_by = $3 AND expires_at > now()
+		`, uploadID, claims.ServiceProvider, claims.UserID), &it)
+		if err != nil {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(it.ReceivedBytes, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(it.SizeBytes, 10))
+		WriteJSON(w, http.StatusOK, it)
+	case http.MethodPatch:
+		h.appendUpload(w, r, uploadID)
+	case http.MethodDelete:
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		// las partes las encola el trigger
+		tag, err := h.DB.Exec(ctx, `
+			DELETE FROM attachment_upload
+			WHERE id::text = $1 AND service_provider_id = $2 AND created_by = $3
+		`, uploadID, claims.ServiceProvider, claims.UserID)
+		if err != nil {
+			http.Error(w, "could not cancel upload", http.StatusInternalServerError)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			http.Error(w, "upload not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// appendUpload guarda la siguiente parte. Upload-Offset tiene que coincidir con
+// lo recibido (409 si no: el cliente consulta HEAD y reintenta desde ahí).
+//
+// Mientras se habla con el storage no queda ninguna transacción (ni conexión)
+// tomada: se lee el estado, se sube la parte a una key propia y recién ahí se
+// avanza la subida, solo si sigue en el mismo offset. Si otro PATCH la avanzó
+// en el medio, esta parte se borra y se contesta 409.
+//
+// Con todo recibido se arma el adjunto, también fuera de transacción, y se
+// registra en una corta que cierra la subida. Si eso falla, un PATCH sin body
+// con Upload-Offset = size_bytes lo reintenta.
+func (h *WorkOrdersHandler) appendUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	claims := ClaimsFromContext(r.Context())
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "missing or invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+	chunk, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadChunk))
+	if err != nil {
+		http.Error(w, "chunk too large (max 8 MB)", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	var it uploadItem
+	err = scanUpload(h.DB.QueryRow(ctx, `
+		SELECT `+uploadColumns+` FROM attachment_upload
+		WHERE id::text = $1 AND service_provider_id = $2 AND created_by = $3 AND expires_at > now()
+	`, uploadID, claims.ServiceProvider, claims.UserID), &it)
+	if err != nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(it.ReceivedBytes, 10))
+	switch {
+	case offset != it.ReceivedBytes:
+		http.Error(w, "Upload-Offset does not match received bytes", http.StatusConflict)
+		return
+	case len(chunk) == 0 && it.ReceivedBytes < it.SizeBytes:
+		http.Error(w, "empty chunk", http.StatusBadRequest)
+		return
+	case it.ReceivedBytes+int64(len(chunk)) > it.SizeBytes:
+		http.Error(w, "chunk exceeds declared size_bytes", http.StatusBadRequest)
+		return
+	case it.ReceivedBytes == 0 && imaging.IsHEIF(chunk):
+		// mejor ahora que después de subir todo
+		http.Error(w, errHEIF.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if len(chunk) > 0 {
+		key, err := uploadPartKey(claims.ServiceProvider, it.ID, len(it.partKeys))
+		if err != nil {
+			http.Error(w, "could not store chunk", http.StatusInternalServerError)
+			return
+		}
+		if err := h.Storage.Put(ctx, key, bytes.NewReader(chunk), int64(len(chunk)), "application/octet-stream"); err != nil {
+			log.Printf("[STORAGE] upload part %s: %v", key, err)
+			http.Error(w, "could not store chunk", http.StatusInternalServerError)
+			return
+		}
+		err = scanUpload(h.DB.QueryRow(ctx, `
+			UPDATE attachment_upload
+			SET received_bytes = received_bytes + $3, parts = parts + 1,
+			    part_keys = array_append(part_keys, $4), updated_at = now()
+			WHERE id = $1 AND received_bytes = $2 AND expires_at > now()
+			RETURNING `+uploadColumns,
+			it.ID, it.ReceivedBytes, len(chunk), key,
+		), &it)
+		if err != nil {
+			h.dropObject(ctx, key)
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "upload changed while storing the chunk; check its offset and retry", http.StatusConflict)
+				return
+			}
+			http.Error(w, "could not update upload", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(it.ReceivedBytes, 10))
+		if it.ReceivedBytes < it.SizeBytes {
+			WriteJSON(w, http.StatusOK, it)
+			return
+		}
+	}
+
+	// Última parte: se arma el adjunto y se borra la subida (el trigger encola
+	// las partes). Si otro request la cerró antes, gana ese y este borra lo suyo.
+	body := &partsReader{ctx: ctx, store: h.Storage, keys: it.partKeys}
+	defer body.Close()
+
+	obj, err := h.putAttachmentObject(ctx, claims.ServiceProvider, it.WorkOrderID, body, it.SizeBytes)
+	if errors.Is(err, errHEIF) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		log.Printf("[STORAGE] assemble upload %s: %v", it.ID, err)
+		http.Error(w, "could not store file", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		h.dropObject(ctx, obj.key)
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM attachment_upload WHERE id = $1`, it.ID)
+	if err != nil || tag.RowsAffected() == 0 {
+		h.dropObject(ctx, obj.key)
+		if err != nil {
+			http.Error(w, "could not finish upload", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "upload already finished or cancelled", http.StatusConflict)
+		return
+	}
+	att, err := insertAttachment(ctx, tx, obj, claims.ServiceProvider, it.WorkOrderID, claims.UserID, it.Filename)
+	if err != nil {
+		h.dropObject(ctx, obj.key)
+		http.Error(w, "could not finish upload", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		// puede haber quedado commiteado: no se borra el objeto a ciegas
+		log.Printf("[STORAGE] commit upload %s (object %s): %v", it.ID, obj.key, err)
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+	h.photoStored(att)
+	h.withDownloadURL(claims.ServiceProvider, &att, false)
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(it.SizeBytes, 10))
+	WriteJSON(w, http.StatusCreated, att)
+}
+
+// partsReader concatena las partes de una subida abriéndolas de a una.
+type partsReader struct {
+	ctx   context.Context
+	store storage.Storage
+	keys  []string
+	cur   io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.cur == nil {
+			if len(p.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := p.store.Get(p.ctx, p.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			p.cur, p.keys = rc, p.keys[1:]
+		}
+		n, err := p.cur.Read(b)
+		if errors.Is(err, io.EOF) {
+			p.cur.Close()
+			p.cur = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.cur == nil {
+		return nil
+	}
+	return p.cur.Close()
+}
+
+// =========================
+// GET /files/{token}?variant=thumb|web
+// =========================
+
+// Download sirve el adjunto de un link firmado. Es público (el link es la
+// autorización), así que ata la conexión al tenant del token. Imágenes y PDF
+// se muestran inline; el resto baja como archivo para que el navegador no
+// interprete nada en nuestro origen. Con variant se sirve la miniatura o la
+// versión web de una foto (el original mientras no esté procesada).
+func (h *WorkOrdersHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Downloads == nil || h.Storage == nil {
+		http.Error(w, "attachments are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	parts := pathParts(r)
+	if len(parts) != 2 || parts[0] != "files" {
+		http.NotFound(w, r)
+		return
+	}
+	spid, attachmentID, ok := h.Downloads.Verify(parts[1], time.Now())
+	if !ok {
+		http.Error(w, "invalid or expired link", http.StatusForbidden)
+		return
+	}
+	variant := r.URL.Query().Get("variant")
+	if variant != "" && variant != "thumb" && variant != "web" {
+		http.Error(w, "invalid variant (thumb|web)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, release, err := h.DB.WithTenant(r.Context(), spid)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	var it attachmentItem
+	err = scanAttachment(h.DB.QueryRow(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM work_order_attachment
+		WHERE id::text = $1 AND service_provider_id = $2 AND storage_key IS NOT NULL
+	`, attachmentID, spid), &it)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	release() // no hace falta la conexión mientras se copia el archivo
+
+	key, contentType := *it.storageKey, "application/octet-stream"
+	if it.ContentType != nil {
+		contentType = *it.ContentType
+	}
+	// el tamaño guardado es el del original, y mientras se procesa puede cambiar
+	withLength := it.SizeBytes != nil && (it.ProcessingStatus == nil || *it.ProcessingStatus != "processing")
+	switch {
+	case variant == "thumb" && it.thumbKey != nil:
+		key, contentType, withLength = *it.thumbKey, "image/jpeg", false
+	case variant == "web" && it.webKey != nil:
+		key, contentType, withLength = *it.webKey, "image/jpeg", false
+	}
+
+	obj, err := h.Storage.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[STORAGE] get %s: %v", key, err)
+		http.Error(w, "could not read file", http.StatusBadGateway)
+		return
+	}
+	defer obj.Close()
+
+	disposition := "attachment"
+	if it.FileType == "photo" || it.FileType == "pdf" {
+		disposition = "inline"
+	}
+	filename := "file"
+	if it.Filename != nil {
+		filename = *it.Filename
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if withLength {
+		w.Header().Set("Content-Length", strconv.FormatInt(*it.SizeBytes, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		_, _ = io.Copy(w, obj)
+	}
+}
+
+// =========================
+// Miniaturas en los PDF (reporte mensual, hoja de vida): siempre la versión
+// chica, nunca el original.
+// =========================
+
+const maxThumbBytes = 1 << 20
+
+// loadThumbnails trae las miniaturas pedidas (key => bytes). Son decorativas:
+// la que falla se omite.
+func loadThumbnails(ctx context.Context, store storage.Storage, keys []string) map[string][]byte {
+	out := make(map[string][]byte, len(keys))
+	if store == nil {
+		return out
+	}
+	for _, k := range keys {
+		if _, ok := out[k]; ok {
+			continue
+		}
+		obj, err := store.Get(ctx, k)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(obj, maxThumbBytes))
+		obj.Close()
+		if err == nil {
+			out[k] = b
+		}
+	}
+	return out
+}
+
+// addThumbnail dibuja la miniatura con alto h (el ancho sale de la proporción)
+// y devuelve el ancho usado; 0 si no se pudo.
+func addThumbnail(pdf *gofpdf.Fpdf, key string, data []byte, x, y, h float64) float64 {
+	opts := gofpdf.ImageOptions{ImageType: "JPG"}
+	info := pdf.RegisterImageOptionsReader(key, opts, bytes.NewReader(data))
+	if !pdf.Ok() || info == nil {
+		pdf.ClearError()
+		return 0
+	}
+	w := h * info.Width() / info.Height()
+	pdf.ImageOptions(key, x, y, w, h, false, opts, 0, "")
+	return w
+}
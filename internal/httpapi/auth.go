@@ -8,24 +8,30 @@ import (
 	"time"
 
 	"github.com/alvgonz/hvac-saas-api/internal/auth"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	DB        *pgxpool.Pool
-	JWTSecret []byte
+	DB    *db.DB
+	Keys  *auth.KeySet
+	Guard *LoginGuard
 }
 
+// loginRequest: el provider se puede indicar por id, por slug o no indicarse
+// (se descubre a partir del email, ver Login).
 type loginRequest struct {
-	ServiceProviderID string `json:"service_provider_id"`
+	ServiceProviderID string `json:"service_provider_id,omitempty"`
+	ServiceProvider   string `json:"service_provider,omitempty"` // slug, ej. "frio-norte"
 	Email             string `json:"email"`
 	Password          string `json:"password"`
 }
 
 type loginResponse struct {
-	Token string `json:"token"`
-	User  struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         struct {
 		ID              string  `json:"id"`
 		ServiceProvider string  `json:"service_provider_id"`
 		CustomerID      *string `json:"customer_id,omitempty"`
@@ -35,6 +41,72 @@ type loginResponse struct {
 	} `json:"user"`
 }
 
+// maxTenantCandidates acota cuántos bcrypt hacemos en un login solo con email.
+const maxTenantCandidates = 10
+
+type tenantOption struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// tenantSelectionResponse (409): el email+password vale en más de un provider y
+// el cliente tiene que reintentar indicando cuál.
+type tenantSelectionResponse struct {
+	TenantSelectionRequired bool           `json:"tenant_selection_required"`
+	Providers               []tenantOption `json:"providers"`
+}
+
+type loginCandidate struct {
+	loginUser
+	Provider  tenantOption
+	IsActive  bool
+	Suspended bool // provider suspendido
+	Hash      string
+}
+
+// findLoginCandidates busca el usuario por email dentro del provider indicado
+// (id o slug) o, si no se indicó ninguno, en todos los providers.
+func findLoginCandidates(ctx context.Context, q dbtx, req loginRequest) ([]loginCandidate, error) {
+	where := `u.email = $1`
+	args := []any{req.Email}
+	switch {
+	case req.ServiceProviderID != "":
+		where += ` AND sp.id::text = $2`
+		args = append(args, req.ServiceProviderID)
+	case req.ServiceProvider != "":
+		where += ` AND sp.slug = $2`
+		args = append(args, req.ServiceProvider)
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT u.id, u.service_provider_id, u.customer_id, u.fullname, u.email, u.role,
+		       u.is_active, sp.suspended_at IS NOT NULL, u.password, sp.name, sp.slug
+		FROM "user" u
+		JOIN service_provider sp ON sp.id = u.service_provider_id
+		WHERE `+where+`
+		ORDER BY sp.name, sp.id
+		LIMIT `+itoa(maxTenantCandidates), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []loginCandidate
+	for rows.Next() {
+		var c loginCandidate
+		if err := rows.Scan(
+			&c.ID, &c.ServiceProvider, &c.CustomerID, &c.Fullname, &c.Email, &c.Role,
+			&c.IsActive, &c.Suspended, &c.Hash, &c.Provider.Name, &c.Provider.Slug,
+		); err != nil {
+			return nil, err
+		}
+		c.Provider.ID = c.ServiceProvider
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -49,68 +121,179 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 	req.ServiceProviderID = strings.TrimSpace(req.ServiceProviderID)
+	req.ServiceProvider = strings.ToLower(strings.TrimSpace(req.ServiceProvider))
 
-	if req.Email == "" || req.Password == "" || req.ServiceProviderID == "" {
+	if req.Email == "" || req.Password == "" {
 		http.Error(w, "missing fields", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	var (
-		userID     string
-		spid       string
-		customerID *string
-		fullname   string
-		email      string
-		role       string
-		isActive   bool
-		hash       string
-	)
-
-	err := h.DB.QueryRow(ctx, `
-		SELECT id, service_provider_id, customer_id, fullname, email, role, is_active, password
-		FROM "user"
-		WHERE service_provider_id = $1 AND email = $2
-	`, req.ServiceProviderID, req.Email).Scan(
-		&userID, &spid, &customerID, &fullname, &email, &role, &isActive, &hash,
-	)
+	ip := clientIP(r)
+	attempt := loginAttempt{ServiceProviderID: req.ServiceProviderID, Email: req.Email}
+
+	candidates, err := findLoginCandidates(ctx, h.DB, req)
 	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		http.Error(w, "db error", http.StatusInternalServerError)
 		return
 	}
-	if !isActive {
-		http.Error(w, "user inactive", http.StatusForbidden)
+	keys := accountKeys(req, candidates)
+
+	if wait := h.Guard.Allow(ctx, ip, keys...); wait > 0 {
+		attempt.Reason = "locked"
+		h.Guard.Record(ctx, r, attempt)
+		writeTooManyRequests(w, wait)
 		return
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+	// fail registra el intento fallido; si con este se activa el bloqueo respondemos 429.
+	fail := func(reason string, status int, msg string) {
+		attempt.Reason = reason
+		h.Guard.Record(ctx, r, attempt)
+		if wait := h.Guard.Failed(ctx, ip, keys...); wait > 0 {
+			writeTooManyRequests(w, wait)
+			return
+		}
+		http.Error(w, msg, status)
+	}
+
+	if len(candidates) == 0 {
+		fail("unknown_user", http.StatusUnauthorized, "invalid credentials")
 		return
 	}
+	if len(candidates) == 1 {
+		attempt.ServiceProviderID = candidates[0].ServiceProvider
+		attempt.UserID = &candidates[0].ID
+	}
+
+	// Solo mostramos providers en los que el password es correcto: así el
+	// descubrimiento no sirve para averiguar dónde está registrado un email.
+	var matched []loginCandidate
+	inactive, suspended := false, false
+	for _, c := range candidates {
+		if bcrypt.CompareHashAndPassword([]byte(c.Hash), []byte(req.Password)) != nil {
+			continue
+		}
+		if c.Suspended {
+			suspended = true
+			continue
+		}
+		if !c.IsActive {
+			inactive = true
+			continue
+		}
+		matched = append(matched, c)
+	}
+
+	switch {
+	case len(matched) == 0 && suspended:
+		fail("suspended", http.StatusForbidden, "service provider suspended")
+		return
+	case len(matched) == 0 && inactive:
+		fail("inactive", http.StatusForbidden, "user inactive")
+		return
+	case len(matched) == 0:
+		fail("bad_password", http.StatusUnauthorized, "invalid credentials")
+		return
+	case len(matched) > 1:
+		h.Guard.Succeeded(ctx, accountKeys(req, matched)...)
+		attempt.Success, attempt.Reason = true, "tenant_selection"
+		h.Guard.Record(ctx, r, attempt)
+
+		resp := tenantSelectionResponse{TenantSelectionRequired: true}
+		for _, c := range matched {
+			resp.Providers = append(resp.Providers, c.Provider)
+		}
+		WriteJSON(w, http.StatusConflict, resp)
+		return
+	}
+
+	u := matched[0].loginUser
+	h.Guard.Succeeded(ctx, accountKey(u.ServiceProvider, u.Email))
+
+	attempt.ServiceProviderID = u.ServiceProvider
+	attempt.UserID = &u.ID
+
+	// Ya se sabe el provider: MFA y la sesión nueva corren atados a él (RLS).
+	tctx, release, err := h.DB.WithTenant(ctx, u.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not bind tenant", http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	// Segundo factor: si aplica, en vez del JWT devolvemos un challenge de vida corta.
+	mfa, err := loadMFAStatus(tctx, h.DB, u)
+	if err != nil {
+		http.Error(w, "could not check mfa", http.StatusInternalServerError)
+		return
+	}
+	if mfa.Enabled || mfa.Required {
+		attempt.Success, attempt.Reason = true, "mfa_pending"
+		h.Guard.Record(ctx, r, attempt)
+
+		challenge, err := auth.SignMFAChallenge(h.Keys, auth.MFAChallenge{
+			UserID:          u.ID,
+			ServiceProvider: u.ServiceProvider,
+			Enroll:          !mfa.Enabled,
+		})
+		if err != nil {
+			http.Error(w, "could not sign token", http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, http.StatusOK, mfaChallengeResponse{
+			MFARequired:           mfa.Enabled,
+			MFAEnrollmentRequired: !mfa.Enabled,
+			MFAToken:              challenge,
+			ExpiresIn:             int(auth.MFAChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	attempt.Success, attempt.Reason = true, "ok"
+	h.Guard.Record(ctx, r, attempt)
+
+	writeLoginResponse(tctx, w, r, h.DB, h.Keys, u)
+}
+
+// loginUser es el usuario ya autenticado (password y, si aplica, MFA).
+type loginUser struct {
+	ID              string
+	ServiceProvider string
+	CustomerID      *string
+	Fullname        string
+	Email           string
+	Role            string
+}
 
+// writeLoginResponse abre la sesión y responde con los tokens. Es el final común
+// de Login y de la verificación MFA.
+func writeLoginResponse(ctx context.Context, w http.ResponseWriter, r *http.Request, q dbtx, keys *auth.KeySet, u loginUser) {
 	claims := auth.Claims{
-		UserID:          userID,
-		ServiceProvider: spid,
-		CustomerID:      customerID,
-		Role:            role,
+		UserID:          u.ID,
+		ServiceProvider: u.ServiceProvider,
+		CustomerID:      u.CustomerID,
+		Role:            u.Role,
 	}
 
-	token, err := auth.SignToken(h.JWTSecret, claims)
+	tokens, err := issueTokens(ctx, q, r, keys, claims)
 	if err != nil {
-		http.Error(w, "could not sign token", http.StatusInternalServerError)
+		http.Error(w, "could not create session", http.StatusInternalServerError)
 		return
 	}
 
 	var resp loginResponse
-	resp.Token = token
-	resp.User.ID = userID
-	resp.User.ServiceProvider = spid
-	resp.User.CustomerID = customerID
-	resp.User.Fullname = fullname
-	resp.User.Email = email
-	resp.User.Role = role
+	resp.Token = tokens.Token
+	resp.RefreshToken = tokens.RefreshToken
+	resp.ExpiresIn = tokens.ExpiresIn
+	resp.User.ID = u.ID
+	resp.User.ServiceProvider = u.ServiceProvider
+	resp.User.CustomerID = u.CustomerID
+	resp.User.Fullname = u.Fullname
+	resp.User.Email = u.Email
+	resp.User.Role = u.Role
 
 	WriteJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,313 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// =========================
+// Actores
+// =========================
+
+const (
+	testSPID     = "00000000-0000-0000-0000-0000000000a1"
+	testUserID   = "00000000-0000-0000-0000-0000000000b1"
+	testCustomer = "00000000-0000-0000-0000-0000000000c1"
+	testID       = "00000000-0000-0000-0000-0000000000d1"
+)
+
+type actor struct {
+	claims *auth.Claims
+	perms  authz.Set
+}
+
+// actors arma los mismos sets que Authenticator.Middleware: ForUser para
+// sesiones, ForScopes para API keys.
+func actors() map[string]actor {
+	customer := testCustomer
+	user := func(role string, cid *string, hasCustom bool, custom []string, operator bool) actor {
+		return actor{
+			claims: &auth.Claims{UserID: testUserID, ServiceProvider: testSPID, Role: role, CustomerID: cid, SessionID: "s"},
+			perms:  authz.ForUser(role, hasCustom, custom, operator),
+		}
+	}
+	key := func(scopes ...string) actor {
+		return actor{
+			claims: &auth.Claims{UserID: testUserID, ServiceProvider: testSPID, Role: auth.RoleIntegration, APIKeyID: "k", Scopes: scopes},
+			perms:  authz.ForScopes(scopes),
+		}
+	}
+	return map[string]actor{
+		"admin":      user("admin", nil, false, nil, false),
+		"dispatcher": user("dispatcher", nil, false, nil, false),
+		"technician": user("technician", nil, false, nil, false),
+		"client":     user("client", &customer, false, nil, false),
+		"operator":   user("admin", nil, false, nil, true),
+		// rol propio sobre admin que solo deja leer órdenes: reemplaza, no suma
+		"custom":    user("admin", nil, true, []string{string(authz.WorkOrderReadAll)}, false),
+		"key:read":  key(auth.ScopeWorkOrdersRead),
+		"key:write": key(auth.ScopeWorkOrdersWrite),
+	}
+}
+
+func withActor(r *http.Request, a actor) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsKey, a.claims)
+	ctx = context.WithValue(ctx, permsKey, a.perms)
+	return r.WithContext(ctx)
+}
+
+// unreachableDB: pool que nunca llega a conectar (puerto 1). Un handler que
+// deja pasar al actor falla recién al ir a la DB, con algo que no es 401/403.
+func unreachableDB(t *testing.T) *db.DB {
+	t.Helper()
+	cfg, err := pgxpool.ParseConfig("postgres://hvac@127.0.0.1:1/hvac?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return &db.DB{Pool: pool}
+}
+
+// =========================
+// Matriz endpoint × actor
+// =========================
+
+// Solo entran endpoints que deciden el permiso antes de tocar la DB; los que
+// resuelven el alcance con la fila cargada (ej. reenviar una invitación) no
+// se pueden probar sin Postgres.
+func TestEndpointAccessMatrix(t *testing.T) {
+	database := unreachableDB(t)
+	labels := &auth.LabelSigner{Secret: []byte("test")}
+	store := &storage.Local{Dir: t.TempDir()}
+
+	apiKeys := &APIKeysHandler{DB: database}
+	attempts := &LoginAttemptsHandler{DB: database}
+	mfa := &MFAHandler{DB: database}
+	settings := &SettingsHandler{DB: database}
+	roles := &RolesHandler{DB: database}
+	providers := &ProvidersHandler{DB: database}
+	users := &UsersHandler{DB: database}
+	invitations := &InvitationsHandler{DB: database}
+	customers := &CustomersHandler{DB: database}
+	sites := &SitesHandler{DB: database}
+	assets := &AssetsHandler{DB: database, LabelSigner: labels}
+	imports := &ImportsHandler{DB: database}
+	wo := &WorkOrdersHandler{DB: database, Storage: store}
+	reports := &ReportsHandler{DB: database}
+
+	everyone := []string{"admin", "dispatcher", "technician", "client", "operator", "custom", "key:read", "key:write"}
+	admins := []string{"admin", "operator"}
+	staff := []string{"admin", "dispatcher", "operator"}
+
+	cases := []struct {
+		handler      http.HandlerFunc
+		method, path string
+		body         string
+		allowed      []string
+	}{
+		{Permissions, "GET", "/permissions", "", everyone},
+
+		// Administración del provider
+		{apiKeys.Collection, "GET", "/api-keys", "", admins},
+		{apiKeys.Collection, "POST", "/api-keys", `{"name":"erp","scopes":["work_orders:read"]}`, admins},
+		{apiKeys.Item, "POST", "/api-keys/" + testID + "/revoke", "", admins},
+		{attempts.List, "GET", "/login-attempts", "", admins},
+		{mfa.Policy, "GET", "/mfa/policy", "", admins},
+		{mfa.Policy, "PUT", "/mfa/policy", `{"required_roles":["admin"]}`, admins},
+		{settings.Settings, "PATCH", "/settings", `{"language":"en"}`, admins},
+		{settings.Logo, "DELETE", "/settings/logo", "", admins},
+		{roles.Collection, "GET", "/roles", "", staff},
+		{roles.Collection, "POST", "/roles", `{"name":"x","base_role":"technician","permissions":[]}`, admins},
+		{roles.Item, "GET", "/roles/" + testID, "", admins},
+		{roles.Item, "DELETE", "/roles/" + testID, "", admins},
+
+		// Plataforma: solo el flag de operador, ni siquiera admin
+		{providers.Collection, "GET", "/platform/providers", "", []string{"operator"}},
+		{providers.Collection, "POST", "/platform/providers", `{}`, []string{"operator"}},
+		{providers.Item, "GET", "/platform/providers/" + testID, "", []string{"operator"}},
+		{providers.Item, "POST", "/platform/providers/" + testID + "/suspend", "", []string{"operator"}},
+
+		// Usuarios
+		{users.List, "GET", "/users", "", staff},
+		{users.Create, "POST", "/users", `{"fullname":"T","email":"t@example.com","role":"technician"}`, staff},
+		{users.Create, "POST", "/users", `{"fullname":"C","email":"c@example.com","role":"client","customer_id":"` + testCustomer + `"}`, admins},
+		{users.Item, "PATCH", "/users/" + testID, `{"fullname":"X"}`, staff},
+		{users.Item, "POST", "/users/" + testID + "/deactivate", "", staff},
+		{invitations.List, "GET", "/invitations", "", staff},
+
+		// Clientes, sitios y áreas
+		{customers.Collection, "GET", "/customers", "", []string{"admin", "dispatcher", "client", "operator"}},
+		{customers.Collection, "POST", "/customers", `{"name":"ACME"}`, staff},
+		{customers.Item, "PATCH", "/customers/" + testID, `{"name":"ACME"}`, staff},
+		{customers.Item, "POST", "/customers/" + testID + "/deactivate", "", staff},
+		{sites.Collection, "GET", "/sites", "", []string{"admin", "dispatcher", "technician", "client", "operator"}},
+		{sites.Collection, "POST", "/sites", `{"customer_id":"` + testCustomer + `","name":"Planta"}`, staff},
+		{sites.Item, "DELETE", "/sites/" + testID, "", staff},
+		{sites.Item, "POST", "/sites/" + testID + "/areas", `{"name":"Sala"}`, staff},
+		{sites.Area, "DELETE", "/areas/" + testID, "", staff},
+
+		// Equipos
+		{assets.Collection, "GET", "/assets", "", []string{"admin", "dispatcher", "technician", "client", "operator"}},
+		{assets.Collection, "POST", "/assets", `{"site_id":"` + testID + `","type":"split","tag_code":"T-1"}`, staff},
+		{assets.Item, "PATCH", "/assets/" + testID, `{"name":"X"}`, staff},
+		{assets.Item, "DELETE", "/assets/" + testID, "", staff},
+		{assets.Item, "POST", "/assets/" + testID + "/status", `{"status":"inactive"}`, staff},
+		{assets.Item, "POST", "/assets/" + testID + "/readings", `{"kind":"pressure","value":1,"unit":"psi"}`, []string{"admin", "dispatcher", "technician", "operator"}},
+		{assets.Item, "GET", "/assets/labels?site_id=" + testID, "", []string{"admin", "dispatcher", "technician", "operator"}},
+
+		// Importaciones
+		{imports.Collection, "GET", "/imports", "", staff},
+		{imports.Collection, "POST", "/imports?kind=assets", "tag_code\n", staff},
+
+		// Órdenes de trabajo
+		{wo.List, "GET", "/work-orders", "", []string{"admin", "dispatcher", "technician", "client", "operator", "custom", "key:read"}},
+		{wo.Create, "POST", "/work-orders", `{"customer_id":"` + testCustomer + `","site_id":"` + testID + `","type":"corrective","priority":"high","title":"x"}`, []string{"admin", "dispatcher", "operator", "key:write"}},
+		{wo.Item, "PATCH", "/work-orders/" + testID, `{"title":"x"}`, []string{"admin", "dispatcher", "operator", "key:write"}},
+		{wo.Item, "DELETE", "/work-orders/" + testID, "", []string{"admin", "dispatcher", "operator", "key:write"}},
+		{wo.Item, "POST", "/work-orders/" + testID + "/assign", `{"assigned_to":"` + testUserID + `"}`, []string{"admin", "dispatcher", "operator", "key:write"}},
+		{wo.Item, "POST", "/work-orders/" + testID + "/cancel", `{"reason":"duplicada"}`, []string{"admin", "dispatcher", "operator", "key:write"}},
+		{wo.Item, "POST", "/work-orders/" + testID + "/complete", `{}`, []string{"admin", "dispatcher", "technician", "operator", "key:write"}},
+		{wo.Item, "POST", "/work-orders/" + testID + "/comments", `{"comment":"hola"}`, []string{"admin", "dispatcher", "technician", "client", "operator"}},
+		{wo.Item, "POST", "/work-orders/" + testID + "/uploads", `{"filename":"a.jpg","size":1}`, []string{"admin", "dispatcher", "technician", "operator"}},
+
+		// Reportes
+		{reports.Monthly, "GET", "/reports/monthly?customer_id=" + testCustomer + "&month=2026-01", "", []string{"admin", "dispatcher", "client", "operator"}},
+	}
+
+	for _, tc := range cases {
+		for name, a := range actors() {
+			t.Run(tc.method+" "+tc.path+"/"+name, func(t *testing.T) {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)).WithContext(ctx)
+				if tc.body != "" && strings.HasPrefix(tc.body, "{") {
+					r.Header.Set("Content-Type", "application/json")
+				}
+				w := httptest.NewRecorder()
+				tc.handler(w, withActor(r, a))
+
+				code := w.Code
+				if slices.Contains(tc.allowed, name) {
+					if code == http.StatusUnauthorized || code == http.StatusForbidden {
+						t.Fatalf("allowed actor got %d: %s", code, w.Body.String())
+					}
+				} else if code != http.StatusForbidden {
+					t.Fatalf("denied actor got %d, want 403: %s", code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestEndpointsRequireClaims(t *testing.T) {
+	database := unreachableDB(t)
+	for path, h := range map[string]http.HandlerFunc{
+		"/permissions":     Permissions,
+		"/api-keys":        (&APIKeysHandler{DB: database}).Collection,
+		"/users":           (&UsersHandler{DB: database}).List,
+		"/work-orders":     (&WorkOrdersHandler{DB: database}).List,
+		"/reports/monthly": (&ReportsHandler{DB: database}).Monthly,
+	} {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without claims = %d, want 401", path, w.Code)
+		}
+	}
+}
+
+// =========================
+// Escalada al asignar roles propios
+// =========================
+
+// roleRow: fila falsa de provider_role (las columnas de roleItemColumns).
+type roleRow struct {
+	baseRole string
+	perms    []string
+	err      error
+}
+
+func (r roleRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != 8 {
+		return errors.New("roleRow: unexpected column count")
+	}
+	now := time.Now()
+	*dest[0].(*string) = testID
+	*dest[1].(*string) = "rol"
+	*dest[3].(*string) = r.baseRole
+	*dest[4].(*[]string) = r.perms
+	*dest[5].(*int) = 0
+	*dest[6].(**time.Time) = &now
+	*dest[7].(**time.Time) = &now
+	return nil
+}
+
+type roleQuerier struct{ row roleRow }
+
+func (q roleQuerier) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("unexpected Exec")
+}
+
+func (q roleQuerier) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected Query")
+}
+
+func (q roleQuerier) QueryRow(context.Context, string, ...any) pgx.Row { return q.row }
+
+func TestCheckAssignableRole(t *testing.T) {
+	p := func(ps ...authz.Permission) []string {
+		out := make([]string, len(ps))
+		for i, x := range ps {
+			out[i] = string(x)
+		}
+		return out
+	}
+	a := actors()
+
+	cases := []struct {
+		name     string
+		actor    authz.Set
+		row      roleRow
+		userRole string
+		want     int
+	}{
+		{"admin assigns any role", a["admin"].perms, roleRow{baseRole: "dispatcher", perms: p(authz.UserRead, authz.RoleManage)}, "dispatcher", 0},
+		{"dispatcher assigns a subset", a["dispatcher"].perms, roleRow{baseRole: "technician", perms: p(authz.WorkOrderReadAll, authz.WorkOrderComment)}, "technician", 0},
+		{"dispatcher cannot grant role.manage", a["dispatcher"].perms, roleRow{baseRole: "technician", perms: p(authz.WorkOrderComment, authz.RoleManage)}, "technician", http.StatusForbidden},
+		{"dispatcher cannot grant user.read.all", a["dispatcher"].perms, roleRow{baseRole: "dispatcher", perms: p(authz.UserReadAll)}, "dispatcher", http.StatusForbidden},
+		{"custom role actor limited to its own set", a["custom"].perms, roleRow{baseRole: "client", perms: p(authz.WorkOrderReadAll, authz.WorkOrderComment)}, "client", http.StatusForbidden},
+		{"platform perms in the row are dropped", a["dispatcher"].perms, roleRow{baseRole: "technician", perms: []string{string(authz.PlatformTenantManage)}}, "technician", 0},
+		{"empty role", a["technician"].perms, roleRow{baseRole: "technician"}, "technician", 0},
+		{"base role mismatch", a["admin"].perms, roleRow{baseRole: "client", perms: p(authz.WorkOrderComment)}, "technician", http.StatusBadRequest},
+		{"role of another provider", a["admin"].perms, roleRow{err: pgx.ErrNoRows}, "technician", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, err := checkAssignableRole(context.Background(), roleQuerier{tc.row}, tc.actor, testSPID, testID, tc.userRole)
+			if code != tc.want || (tc.want == 0) != (err == nil) {
+				t.Fatalf("checkAssignableRole = %d, %v; want %d", code, err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+type CustomersHandler struct {
+	DB *db.DB
+}
+
+type customerItem struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	ContactName  *string   `json:"contact_name,omitempty"`
+	ContactEmail *string   `json:"contact_email,omitempty"`
+	ContactPhone *string   `json:"contact_phone,omitempty"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const customerItemColumns = `
+	id, name, contact_name, contact_email, contact_phone,
+	is_active, created_at, updated_at`
+
+func scanCustomerItem(row pgx.Row, it *customerItem) error {
+	return row.Scan(
+		&it.ID, &it.Name, &it.ContactName, &it.ContactEmail, &it.ContactPhone,
+		&it.IsActive, &it.CreatedAt, &it.UpdatedAt,
+	)
+}
+
+// customerScope: "" si ve todos los customers del provider; si solo puede ver
+// el suyo (customer.read.own), su customer_id. ok=false => sin permiso.
+func customerScope(r *http.Request) (own string, ok bool) {
+	claims := ClaimsFromContext(r.Context())
+	perms := PermissionsFromContext(r.Context())
+	switch {
+	case perms.Has(authz.CustomerRead):
+		return "", true
+	case perms.Has(authz.CustomerReadOwn) && claims.CustomerID != nil:
+		return *claims.CustomerID, true
+	}
+	return "", false
+}
+
+// validateCustomer aplica los largos de la tabla customer.
+func validateCustomer(it customerItem) error {
+	switch {
+	case it.Name == "":
+		return errors.New("name is required")
+	case len(it.Name) > 120:
+		return errors.New("name too long (max 120)")
+	case it.ContactName != nil && len(*it.ContactName) > 80:
+		return errors.New("contact_name too long (max 80)")
+	case it.ContactEmail != nil && (len(*it.ContactEmail) > 120 || !strings.Contains(*it.ContactEmail, "@")):
+		return errors.New("invalid contact_email")
+	case it.ContactPhone != nil && len(*it.ContactPhone) > 20:
+		return errors.New("contact_phone too long (max 20)")
+	}
+	return nil
+}
+
+// insertCustomer / updateCustomer escriben un item ya validado (los usan la
+// API y la importación masiva).
+func insertCustomer(ctx context.Context, q dbtx, spid string, it *customerItem) error {
+	return scanCustomerItem(q.QueryRow(ctx, `
+		INSERT INTO customer (service_provider_id, name, contact_name, contact_email, contact_phone)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+customerItemColumns,
+		spid, it.Name, it.ContactName, it.ContactEmail, it.ContactPhone,
+	), it)
+}
+
+func updateCustomer(ctx context.Context, q dbtx, spid string, it *customerItem) error {
+	return scanCustomerItem(q.QueryRow(ctx, `
+		UPDATE customer
+		SET name = $3, contact_name = $4, contact_email = $5, contact_phone = $6,
+		    updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+		RETURNING `+customerItemColumns,
+		it.ID, spid, it.Name, it.ContactName, it.ContactEmail, it.ContactPhone,
+	), it)
+}
+
+// =========================
+// GET  /customers
+// POST /customers
+// =========================
+
+func (h *CustomersHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *CustomersHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, ok := customerScope(r)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	active, err := parseBool(q.Get("active"))
+	if err != nil {
+		http.Error(w, "invalid active", http.StatusBadRequest)
+		return
+	}
+
+	args := []any{claims.ServiceProvider}
+	where := `WHERE service_provider_id = $1`
+	argn := 2
+
+	// client: su propio customer y nada más
+	if own != "" {
+		where += " AND id = $" + itoa(argn)
+		args = append(args, own)
+		argn++
+	}
+
+	if active != nil {
+		where += " AND is_active = $" + itoa(argn)
+		args = append(args, *active)
+		argn++
+	}
+
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		n := itoa(argn)
+		where += " AND (name ILIKE $" + n + " OR contact_name ILIKE $" + n + " OR contact_email ILIKE $" + n + ")"
+		args = append(args, likePattern(search))
+		argn++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+customerItemColumns+`
+		FROM customer
+		`+where+`
+		ORDER BY name ASC, id ASC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list customers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]customerItem, 0, limit)
+	for rows.Next() {
+		var it customerItem
+		if err := scanCustomerItem(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+type customerRequest struct {
+	Name         *string `json:"name,omitempty"`
+	ContactName  *string `json:"contact_name,omitempty"`  // "" => se borra
+	ContactEmail *string `json:"contact_email,omitempty"` // "" => se borra
+	ContactPhone *string `json:"contact_phone,omitempty"` // "" => se borra
+}
+
+// apply copia al item los campos presentes en el request.
+func (req customerRequest) apply(it *customerItem) {
+	if req.Name != nil {
+		it.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.ContactName != nil {
+		it.ContactName = trimmedOrNil(req.ContactName)
+	}
+	if req.ContactEmail != nil {
+		it.ContactEmail = trimmedOrNil(req.ContactEmail)
+		if it.ContactEmail != nil {
+			e := strings.ToLower(*it.ContactEmail)
+			it.ContactEmail = &e
+		}
+	}
+	if req.ContactPhone != nil {
+		it.ContactPhone = trimmedOrNil(req.ContactPhone)
+	}
+}
+
+func (h *CustomersHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.CustomerManage)
+	if claims == nil {
+		return
+	}
+
+	var req customerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	var it customerItem
+	req.apply(&it)
+	if err := validateCustomer(it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := insertCustomer(ctx, h.DB, claims.ServiceProvider, &it); err != nil {
+		http.Error(w, "could not create customer", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// GET   /customers/{id}
+// PATCH /customers/{id}
+// POST  /customers/{id}/activate | /customers/{id}/deactivate
+// =========================
+
+func (h *CustomersHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "customers" {
+		http.NotFound(w, r)
+		return
+	}
+	customerID := strings.TrimSpace(parts[1])
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.Get(w, r, customerID)
+		case http.MethodPatch:
+			h.Update(w, r, customerID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch parts[2] {
+	case "activate":
+		h.setActive(w, r, customerID, true)
+	case "deactivate":
+		h.setActive(w, r, customerID, false)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *CustomersHandler) Get(w http.ResponseWriter, r *http.Request, customerID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, ok := customerScope(r)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	// 404 y no 403: a un client no le contamos qué otros customers existen
+	if own != "" && own != customerID {
+		http.Error(w, "customer not found", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var it customerItem
+	err := scanCustomerItem(h.DB.QueryRow(ctx, `
+		SELECT `+customerItemColumns+`
+		FROM customer
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, customerID, claims.ServiceProvider), &it)
+	if err != nil {
+		http.Error(w, "customer not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+func (h *CustomersHandler) Update(w http.ResponseWriter, r *http.Request, customerID string) {
+	claims := authorize(w, r, authz.CustomerManage)
+	if claims == nil {
+		return
+	}
+
+	var req customerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var it customerItem
+	err = scanCustomerItem(tx.QueryRow(ctx, `
+		SELECT `+customerItemColumns+`
+		FROM customer
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, customerID, claims.ServiceProvider), &it)
+	if err != nil {
+		http.Error(w, "customer not found", http.StatusNotFound)
+		return
+	}
+
+	req.apply(&it)
+	if err := validateCustomer(it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := updateCustomer(ctx, tx, claims.ServiceProvider, &it); err != nil {
+		http.Error(w, "could not update customer", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// setActive: un customer desactivado no admite órdenes nuevas (ver
+// WorkOrdersHandler.Create); lo existente (órdenes, reportes, usuarios) se conserva.
+func (h *CustomersHandler) setActive(w http.ResponseWriter, r *http.Request, customerID string, active bool) {
+	claims := authorize(w, r, authz.CustomerManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var it customerItem
+	err := scanCustomerItem(h.DB.QueryRow(ctx, `
+		UPDATE customer
+		SET is_active = $3, updated_at = now()
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+customerItemColumns,
+		customerID, claims.ServiceProvider, active,
+	), &it)
+	if err != nil {
+		http.Error(w, "customer not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
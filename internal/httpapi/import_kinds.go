@@ -0,0 +1,665 @@
+package httpapi
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/importer"
+)
+
+// Qué sabe importar cada tipo de archivo. Todas las filas se validan primero
+// (con las mismas reglas que la API); solo si no hay errores y apply=true se
+// escriben. Las referencias (customer, site, area) van por id o por nombre.
+
+type importRowError struct {
+	Row     int    `json:"row"` // fila de la planilla (1 = encabezado; 0 = el archivo entero)
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+type importOutcome struct {
+	Created int
+	Updated int
+	Errors  []importRowError
+}
+
+const maxImportErrors = 1000
+
+func (o *importOutcome) fail(row int, col, msg string) {
+	switch {
+	case len(o.Errors) < maxImportErrors:
+		o.Errors = append(o.Errors, importRowError{Row: row, Column: col, Message: msg})
+	case len(o.Errors) == maxImportErrors:
+		o.Errors = append(o.Errors, importRowError{Message: "too many errors; fix the ones above and retry"})
+	}
+}
+
+type importSpec struct {
+	Perm     authz.Permission
+	Required []string
+	Optional []string
+	run      func(ctx context.Context, q dbtx, spid, userID string, s *importer.Sheet, apply bool) (importOutcome, error)
+}
+
+var importKinds = map[string]importSpec{
+	"customers": {
+		Perm:     authz.CustomerManage,
+		Required: []string{"name"},
+		Optional: []string{"contact_name", "contact_email", "contact_phone"},
+		run:      importCustomers,
+	},
+	"sites": {
+		Perm:     authz.SiteManage,
+		Required: []string{"customer", "name"},
+		Optional: []string{"address", "latitude", "longitude", "access_instructions", "contact_name", "contact_phone"},
+		run:      importSites,
+	},
+	"areas": {
+		Perm:     authz.SiteManage,
+		Required: []string{"customer", "site", "name"},
+		run:      importAreas,
+	},
+	"assets": {
+		Perm:     authz.AssetManage,
+		Required: []string{"customer", "tag_code"},
+		Optional: []string{
+			"site", "area", "type", "name", "manufacturer", "model", "serial_number",
+			"capacity_btu", "refrigerant_type", "install_date", "notes",
+		},
+		run: importAssets,
+	},
+}
+
+// checkColumns: faltan obligatorias o sobran desconocidas (casi siempre un typo).
+func (spec importSpec) checkColumns(s *importer.Sheet) []importRowError {
+	var out []importRowError
+	for _, c := range spec.Required {
+		if !s.Has(c) {
+			out = append(out, importRowError{Row: 1, Column: c, Message: "missing column"})
+		}
+	}
+	for _, h := range s.Header {
+		if h != "" && !slices.Contains(spec.Required, h) && !slices.Contains(spec.Optional, h) {
+			out = append(out, importRowError{Row: 1, Column: h, Message: "unknown column"})
+		}
+	}
+	return out
+}
+
+// cell: nil si la planilla no trae la columna (=> no se toca), si no el valor
+// ("" borra el campo, igual que en un PATCH).
+func cell(s *importer.Sheet, r importer.Row, col string) *string {
+	if !s.Has(col) {
+		return nil
+	}
+	v := s.Get(r, col)
+	return &v
+}
+
+// nonEmptyCell: como cell, pero vacío también es "no se toca".
+func nonEmptyCell(s *importer.Sheet, r importer.Row, col string) *string {
+	if v := s.Get(r, col); v != "" {
+		return &v
+	}
+	return nil
+}
+
+func refKey(parent, name string) string {
+	return parent + "/" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// =========================
+// Referencias existentes del provider
+// =========================
+
+type importRefs struct {
+	customers       map[string]customerItem
+	customersByName map[string][]string // lower(name) => ids
+	sites           map[string]siteItem
+	sitesByName     map[string][]string // customer_id/lower(name) => ids
+	areas           map[string]areaItem
+	areasByName     map[string][]string // site_id/lower(name) => ids
+}
+
+func loadImportRefs(ctx context.Context, q dbtx, spid string, withSites, withAreas bool) (*importRefs, error) {
+	rf := &importRefs{
+		customers:       map[string]customerItem{},
+		customersByName: map[string][]string{},
+		sites:           map[string]siteItem{},
+		sitesByName:     map[string][]string{},
+		areas:           map[string]areaItem{},
+		areasByName:     map[string][]string{},
+	}
+
+	rows, err := q.Query(ctx, `SELECT `+customerItemColumns+` FROM customer WHERE service_provider_id = $1`, spid)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var it customerItem
+		if err := scanCustomerItem(rows, &it); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rf.addCustomer(it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if withSites {
+		rows, err := q.Query(ctx, `SELECT `+siteItemColumns+` FROM site WHERE service_provider_id = $1`, spid)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var it siteItem
+			if err := scanSiteItem(rows, &it); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			rf.addSite(it)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if withAreas {
+		rows, err := q.Query(ctx, `SELECT `+areaItemColumns+` FROM area WHERE service_provider_id = $1`, spid)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var it areaItem
+			if err := scanAreaItem(rows, &it); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			rf.addArea(it)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return rf, nil
+}
+
+func (rf *importRefs) addCustomer(it customerItem) {
+	rf.customers[it.ID] = it
+	k := strings.ToLower(it.Name)
+	rf.customersByName[k] = append(rf.customersByName[k], it.ID)
+}
+
+func (rf *importRefs) addSite(it siteItem) {
+	rf.sites[it.ID] = it
+	k := refKey(it.CustomerID, it.Name)
+	rf.sitesByName[k] = append(rf.sitesByName[k], it.ID)
+}
+
+func (rf *importRefs) addArea(it areaItem) {
+	rf.areas[it.ID] = it
+	k := refKey(it.SiteID, it.Name)
+	rf.areasByName[k] = append(rf.areasByName[k], it.ID)
+}
+
+// pick resuelve una referencia por id o por nombre; msg != "" si no se pudo.
+func pick(v string, byID func(string) bool, byName []string, what string) (id, msg string) {
+	if byID(v) {
+		return v, ""
+	}
+	switch len(byName) {
+	case 0:
+		return "", "unknown " + what
+	case 1:
+		return byName[0], ""
+	}
+	return "", what + " name is ambiguous; use its id"
+}
+
+func (rf *importRefs) customer(v string) (customerItem, string) {
+	id, msg := pick(v, func(id string) bool { _, ok := rf.customers[id]; return ok },
+		rf.customersByName[strings.ToLower(v)], "customer")
+	return rf.customers[id], msg
+}
+
+func (rf *importRefs) site(customerID, v string) (siteItem, string) {
+	id, msg := pick(v, func(id string) bool { s, ok := rf.sites[id]; return ok && s.CustomerID == customerID },
+		rf.sitesByName[refKey(customerID, v)], "site")
+	return rf.sites[id], msg
+}
+
+func (rf *importRefs) area(siteID, v string) (areaItem, string) {
+	id, msg := pick(v, func(id string) bool { a, ok := rf.areas[id]; return ok && a.SiteID == siteID },
+		rf.areasByName[refKey(siteID, v)], "area")
+	return rf.areas[id], msg
+}
+
+// =========================
+// customers: upsert por nombre
+// =========================
+
+func importCustomers(ctx context.Context, q dbtx, spid, _ string, s *importer.Sheet, apply bool) (importOutcome, error) {
+	var out importOutcome
+	rf, err := loadImportRefs(ctx, q, spid, false, false)
+	if err != nil {
+		return out, err
+	}
+
+	type pending struct {
+		line int
+		it   customerItem
+	}
+	var todo []pending
+	seen := map[string]int{}
+
+	for _, r := range s.Rows {
+		name := s.Get(r, "name")
+		key := strings.ToLower(name)
+		if prev, dup := seen[key]; dup && name != "" {
+			out.fail(r.Line, "name", "duplicate of row "+strconv.Itoa(prev))
+			continue
+		}
+		seen[key] = r.Line
+
+		var it customerItem
+		switch ids := rf.customersByName[key]; len(ids) {
+		case 0:
+		case 1:
+			it = rf.customers[ids[0]]
+		default:
+			out.fail(r.Line, "name", "several customers have this name")
+			continue
+		}
+
+		req := customerRequest{
+			Name:         &name,
+			ContactName:  cell(s, r, "contact_name"),
+			ContactEmail: cell(s, r, "contact_email"),
+			ContactPhone: cell(s, r, "contact_phone"),
+		}
+		req.apply(&it)
+		if err := validateCustomer(it); err != nil {
+			out.fail(r.Line, "", err.Error())
+			continue
+		}
+		todo = append(todo, pending{r.Line, it})
+	}
+
+	for _, p := range todo {
+		if p.it.ID == "" {
+			out.Created++
+		} else {
+			out.Updated++
+		}
+		if !apply || len(out.Errors) > 0 {
+			continue
+		}
+		if p.it.ID == "" {
+			err = insertCustomer(ctx, q, spid, &p.it)
+		} else {
+			err = updateCustomer(ctx, q, spid, &p.it)
+		}
+		if err != nil {
+			out.fail(p.line, "", "could not save row")
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// =========================
+// sites: upsert por (customer, nombre)
+// =========================
+
+func importSites(ctx context.Context, q dbtx, spid, _ string, s *importer.Sheet, apply bool) (importOutcome, error) {
+	var out importOutcome
+	rf, err := loadImportRefs(ctx, q, spid, true, false)
+	if err != nil {
+		return out, err
+	}
+
+	type pending struct {
+		line int
+		it   siteItem
+	}
+	var todo []pending
+	seen := map[string]int{}
+
+	for _, r := range s.Rows {
+		c, msg := rf.customer(s.Get(r, "customer"))
+		if msg != "" {
+			out.fail(r.Line, "customer", msg)
+			continue
+		}
+
+		name := s.Get(r, "name")
+		key := refKey(c.ID, name)
+		if prev, dup := seen[key]; dup && name != "" {
+			out.fail(r.Line, "name", "duplicate of row "+strconv.Itoa(prev))
+			continue
+		}
+		seen[key] = r.Line
+
+		var it siteItem
+		switch ids := rf.sitesByName[key]; len(ids) {
+		case 0:
+			if !c.IsActive {
+				out.fail(r.Line, "customer", "customer is inactive")
+				continue
+			}
+			it.CustomerID = c.ID
+		case 1:
+			it = rf.sites[ids[0]]
+		default:
+			out.fail(r.Line, "name", "several sites of this customer have this name")
+			continue
+		}
+
+		req := siteRequest{
+			Name:               &name,
+			Address:            cell(s, r, "address"),
+			AccessInstructions: cell(s, r, "access_instructions"),
+			ContactName:        cell(s, r, "contact_name"),
+			ContactPhone:       cell(s, r, "contact_phone"),
+		}
+		lat, lng := s.Get(r, "latitude"), s.Get(r, "longitude")
+		if lat == "" && lng == "" {
+			req.ClearLocation = s.Has("latitude") && s.Has("longitude")
+		} else {
+			bad := false
+			if req.Latitude, bad = parseCoordinate(lat); bad {
+				out.fail(r.Line, "latitude", "invalid number")
+				continue
+			}
+			if req.Longitude, bad = parseCoordinate(lng); bad {
+				out.fail(r.Line, "longitude", "invalid number")
+				continue
+			}
+		}
+
+		if err := req.apply(&it); err != nil {
+			out.fail(r.Line, "", err.Error())
+			continue
+		}
+		todo = append(todo, pending{r.Line, it})
+	}
+
+	for _, p := range todo {
+		if p.it.ID == "" {
+			out.Created++
+		} else {
+			out.Updated++
+		}
+		if !apply || len(out.Errors) > 0 {
+			continue
+		}
+		if p.it.ID == "" {
+			err = insertSite(ctx, q, spid, &p.it)
+		} else {
+			err = updateSite(ctx, q, spid, &p.it)
+		}
+		if err != nil {
+			out.fail(p.line, "", "could not save row")
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// parseCoordinate acepta coma decimal ("-34,6037"). bad=true si no es un número.
+func parseCoordinate(v string) (f *float64, bad bool) {
+	if v == "" {
+		return nil, false
+	}
+	n, err := strconv.ParseFloat(strings.Replace(v, ",", ".", 1), 64)
+	if err != nil {
+		return nil, true
+	}
+	n = math.Round(n*1e6) / 1e6 // numeric(9,6)
+	return &n, false
+}
+
+// =========================
+// areas: alta por (site, nombre); las existentes se dejan
+// =========================
+
+func importAreas(ctx context.Context, q dbtx, spid, _ string, s *importer.Sheet, apply bool) (importOutcome, error) {
+	var out importOutcome
+	rf, err := loadImportRefs(ctx, q, spid, true, true)
+	if err != nil {
+		return out, err
+	}
+
+	type pending struct {
+		line   int
+		siteID string
+		req    areaRequest
+	}
+	var todo []pending
+	seen := map[string]int{}
+
+	for _, r := range s.Rows {
+		c, msg := rf.customer(s.Get(r, "customer"))
+		if msg != "" {
+			out.fail(r.Line, "customer", msg)
+			continue
+		}
+		site, msg := rf.site(c.ID, s.Get(r, "site"))
+		if msg != "" {
+			out.fail(r.Line, "site", msg)
+			continue
+		}
+
+		req := areaRequest{Name: s.Get(r, "name")}
+		if err := req.validate(); err != nil {
+			out.fail(r.Line, "name", err.Error())
+			continue
+		}
+		key := refKey(site.ID, req.Name)
+		if prev, dup := seen[key]; dup {
+			out.fail(r.Line, "name", "duplicate of row "+strconv.Itoa(prev))
+			continue
+		}
+		seen[key] = r.Line
+
+		if len(rf.areasByName[key]) > 0 {
+			out.Updated++ // ya existe: no hay nada más que cargar
+			continue
+		}
+		todo = append(todo, pending{r.Line, site.ID, req})
+	}
+
+	for _, p := range todo {
+		out.Created++
+		if !apply || len(out.Errors) > 0 {
+			continue
+		}
+		_, err := q.Exec(ctx, `
+			INSERT INTO area (service_provider_id, site_id, name)
+			VALUES ($1, $2, $3)
+		`, spid, p.siteID, p.req.Name)
+		if err != nil {
+			out.fail(p.line, "", "could not save row")
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// =========================
+// assets: upsert por (customer, tag_code)
+// =========================
+
+func importAssets(ctx context.Context, q dbtx, spid, userID string, s *importer.Sheet, apply bool) (importOutcome, error) {
+	var out importOutcome
+	rf, err := loadImportRefs(ctx, q, spid, true, true)
+	if err != nil {
+		return out, err
+	}
+
+	existing := map[string]assetItem{} // customer_id/tag_code
+	rows, err := q.Query(ctx, `SELECT `+assetItemColumns+` FROM asset WHERE service_provider_id = $1`, spid)
+	if err != nil {
+		return out, err
+	}
+	for rows.Next() {
+		var it assetItem
+		if err := scanAssetItem(rows, &it); err != nil {
+			rows.Close()
+			return out, err
+		}
+		existing[it.CustomerID+"/"+it.TagCode] = it
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+
+	type pending struct {
+		line int
+		it   assetItem
+	}
+	var todo []pending
+	seen := map[string]int{}
+
+	for _, r := range s.Rows {
+		c, msg := rf.customer(s.Get(r, "customer"))
+		if msg != "" {
+			out.fail(r.Line, "customer", msg)
+			continue
+		}
+
+		tag := s.Get(r, "tag_code")
+		key := c.ID + "/" + tag
+		if prev, dup := seen[key]; dup && tag != "" {
+			out.fail(r.Line, "tag_code", "duplicate of row "+strconv.Itoa(prev))
+			continue
+		}
+		seen[key] = r.Line
+
+		it, isUpdate := existing[key]
+		if isUpdate && it.Status == "decommissioned" {
+			out.fail(r.Line, "tag_code", "asset is decommissioned")
+			continue
+		}
+		if !isUpdate {
+			it.CustomerID = c.ID
+		}
+
+		req := assetRequest{
+			TagCode:         &tag,
+			Type:            nonEmptyCell(s, r, "type"),
+			Name:            cell(s, r, "name"),
+			Manufacturer:    cell(s, r, "manufacturer"),
+			Model:           cell(s, r, "model"),
+			SerialNumber:    cell(s, r, "serial_number"),
+			RefrigerantType: cell(s, r, "refrigerant_type"),
+			Notes:           cell(s, r, "notes"),
+		}
+		if req.Type != nil {
+			t := strings.ToLower(*req.Type)
+			req.Type = &t
+		}
+
+		if v := cell(s, r, "capacity_btu"); v != nil {
+			n := 0
+			if *v != "" {
+				f, err := strconv.ParseFloat(*v, 64)
+				if err != nil || f != math.Trunc(f) || f <= 0 || f > math.MaxInt32 {
+					out.fail(r.Line, "capacity_btu", "must be a positive whole number")
+					continue
+				}
+				n = int(f)
+			}
+			req.CapacityBTU = &n
+		}
+
+		if v := cell(s, r, "install_date"); v != nil {
+			d := ""
+			if *v != "" {
+				t, err := importer.ParseDate(*v)
+				if err != nil {
+					out.fail(r.Line, "install_date", "invalid date (YYYY-MM-DD)")
+					continue
+				}
+				d = t.Format("2006-01-02")
+			}
+			req.InstallDate = &d
+		}
+
+		// Ubicación: site es obligatorio para equipos nuevos; para los existentes,
+		// vacío = se queda donde está.
+		siteID := it.SiteID
+		if v := s.Get(r, "site"); v != "" {
+			site, msg := rf.site(c.ID, v)
+			if msg != "" {
+				out.fail(r.Line, "site", msg)
+				continue
+			}
+			if site.ID != it.SiteID {
+				if !site.IsActive {
+					out.fail(r.Line, "site", "site is inactive")
+					continue
+				}
+				siteID = site.ID
+				req.SiteID = &site.ID
+				if !s.Has("area") {
+					empty := ""
+					req.AreaID = &empty // el área vieja es de otro sitio
+				}
+			}
+		} else if !isUpdate {
+			out.fail(r.Line, "site", "site is required for new assets")
+			continue
+		}
+
+		if v := cell(s, r, "area"); v != nil {
+			if *v == "" {
+				req.AreaID = v
+			} else {
+				area, msg := rf.area(siteID, *v)
+				if msg != "" {
+					out.fail(r.Line, "area", msg)
+					continue
+				}
+				req.AreaID = &area.ID
+			}
+		}
+
+		if err := req.apply(&it); err != nil {
+			out.fail(r.Line, "", err.Error())
+			continue
+		}
+		todo = append(todo, pending{r.Line, it})
+	}
+
+	for _, p := range todo {
+		if p.it.ID == "" {
+			out.Created++
+		} else {
+			out.Updated++
+		}
+		if !apply || len(out.Errors) > 0 {
+			continue
+		}
+		if p.it.ID == "" {
+			err = insertAsset(ctx, q, spid, userID, &p.it)
+		} else {
+			err = updateAsset(ctx, q, spid, &p.it)
+		}
+		if err != nil {
+			out.fail(p.line, "", "could not save row")
+			return out, nil
+		}
+	}
+	return out, nil
+}
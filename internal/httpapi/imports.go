@@ -0,0 +1,441 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/importer"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportsHandler: carga masiva de customers, sitios, áreas y equipos desde
+// CSV/XLSX. Subir el archivo lo valida (dry-run, no escribe nada); /commit lo
+// aplica en una sola transacción, revalidando contra lo que haya en ese momento.
+type ImportsHandler struct {
+	DB *db.DB
+}
+
+const maxImportBytes = 5 << 20
+
+type importJobItem struct {
+	ID          string           `json:"id"`
+	Kind        string           `json:"kind"`
+	Format      string           `json:"format"`
+	Filename    *string          `json:"filename,omitempty"`
+	Status      string           `json:"status"` // validated | invalid | committed
+	TotalRows   int              `json:"total_rows"`
+	CreatedRows int              `json:"created_rows"` // antes del commit: lo que se crearía
+	UpdatedRows int              `json:"updated_rows"` // antes del commit: lo que se actualizaría
+	ErrorCount  int              `json:"error_count"`
+	Errors      []importRowError `json:"errors,omitempty"` // solo en GET /imports/{id}
+	CreatedBy   string           `json:"created_by"`
+	CreatedAt   time.Time        `json:"created_at"`
+	CommittedBy *string          `json:"committed_by,omitempty"`
+	CommittedAt *time.Time       `json:"committed_at,omitempty"`
+}
+
+const importJobColumns = `
+	id, kind, format, filename, status,
+	total_rows, created_rows, updated_rows, jsonb_array_length(errors),
+	created_by, created_at, committed_by, committed_at`
+
+func scanImportJob(row pgx.Row, it *importJobItem) error {
+	return row.Scan(
+		&it.ID, &it.Kind, &it.Format, &it.Filename, &it.Status,
+		&it.TotalRows, &it.CreatedRows, &it.UpdatedRows, &it.ErrorCount,
+		&it.CreatedBy, &it.CreatedAt, &it.CommittedBy, &it.CommittedAt,
+	)
+}
+
+// importableKinds: los tipos que quien pregunta puede importar (y ver).
+func importableKinds(r *http.Request) []string {
+	perms := PermissionsFromContext(r.Context())
+	var out []string
+	for kind, spec := range importKinds {
+		if perms.Has(spec.Perm) {
+			out = append(out, kind)
+		}
+	}
+	return out
+}
+
+// validateImport corre las validaciones sobre el archivo; con apply=true
+// además escribe (q debe ser una transacción).
+func validateImport(ctx context.Context, q dbtx, spid, userID string, spec importSpec, s *importer.Sheet, apply bool) (importOutcome, error) {
+	if errs := spec.checkColumns(s); len(errs) > 0 {
+		return importOutcome{Errors: errs}, nil
+	}
+	out, err := spec.run(ctx, q, spid, userID, s, apply)
+	if out.Errors == nil {
+		out.Errors = []importRowError{} // jsonb NOT NULL: '[]', no null
+	}
+	return out, err
+}
+
+// =========================
+// GET  /imports?kind=&status=
+// POST /imports?kind=assets&filename=equipos.xlsx   (body: el archivo)
+// =========================
+
+func (h *ImportsHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ImportsHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	kinds := importableKinds(r)
+	if len(kinds) == 0 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	args := []any{claims.ServiceProvider, kinds}
+	where := `WHERE service_provider_id = $1 AND kind = ANY($2)`
+	argn := 3
+
+	if v := strings.TrimSpace(q.Get("kind")); v != "" {
+		where += " AND kind = $" + itoa(argn)
+		args = append(args, v)
+		argn++
+	}
+	if v := strings.TrimSpace(q.Get("status")); v != "" {
+		where += " AND status = $" + itoa(argn)
+		args = append(args, v)
+		argn++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+importJobColumns+`
+		FROM import_job
+		`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list imports", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]importJobItem, 0, limit)
+	for rows.Next() {
+		var it importJobItem
+		if err := scanImportJob(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (h *ImportsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	kind := strings.TrimSpace(q.Get("kind"))
+	spec, ok := importKinds[kind]
+	if !ok {
+		if ClaimsFromContext(r.Context()) == nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "invalid kind (customers|sites|areas|assets)", http.StatusBadRequest)
+		return
+	}
+	claims := authorize(w, r, spec.Perm)
+	if claims == nil {
+		return
+	}
+
+	name := q.Get("filename")
+	filename := trimmedOrNil(&name)
+	if filename != nil && len(*filename) > 255 {
+		http.Error(w, "filename too long (max 255)", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		http.Error(w, "file too large (max 5MB)", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	sheet, err := importer.Read(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	out, err := validateImport(ctx, h.DB, claims.ServiceProvider, claims.UserID, spec, sheet, false)
+	if err != nil {
+		http.Error(w, "could not validate import", http.StatusInternalServerError)
+		return
+	}
+
+	status := "validated"
+	if len(out.Errors) > 0 {
+		status = "invalid"
+	}
+
+	var it importJobItem
+	err = scanImportJob(h.DB.QueryRow(ctx, `
+		INSERT INTO import_job (
+			service_provider_id, kind, format, filename, file,
+			status, total_rows, created_rows, updated_rows, errors, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+importJobColumns,
+		claims.ServiceProvider, kind, sheet.Format, filename, data,
+		status, len(sheet.Rows), out.Created, out.Updated, out.Errors, claims.UserID,
+	), &it)
+	if err != nil {
+		http.Error(w, "could not save import", http.StatusInternalServerError)
+		return
+	}
+	it.Errors = out.Errors
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// GET  /imports/{id}
+// POST /imports/{id}/commit
+// GET  /imports/{id}/errors   (CSV)
+// =========================
+
+func (h *ImportsHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "imports" {
+		http.NotFound(w, r)
+		return
+	}
+	jobID := strings.TrimSpace(parts[1])
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Get(w, r, jobID)
+		return
+	}
+
+	switch parts[2] {
+	case "commit":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Commit(w, r, jobID)
+	case "errors":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ErrorReport(w, r, jobID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// loadJob trae el job con sus errores, si quien pregunta puede importar ese tipo.
+func (h *ImportsHandler) loadJob(ctx context.Context, r *http.Request, jobID string) (importJobItem, int, error) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		return importJobItem{}, http.StatusUnauthorized, errors.New("unauthorized")
+	}
+
+	var it importJobItem
+	var errs []importRowError
+	err := h.DB.QueryRow(ctx, `
+		SELECT `+importJobColumns+`, errors
+		FROM import_job
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, jobID, claims.ServiceProvider).Scan(
+		&it.ID, &it.Kind, &it.Format, &it.Filename, &it.Status,
+		&it.TotalRows, &it.CreatedRows, &it.UpdatedRows, &it.ErrorCount,
+		&it.CreatedBy, &it.CreatedAt, &it.CommittedBy, &it.CommittedAt,
+		&errs,
+	)
+	if err != nil {
+		return importJobItem{}, http.StatusNotFound, errors.New("import not found")
+	}
+	if !PermissionsFromContext(r.Context()).Has(importKinds[it.Kind].Perm) {
+		return importJobItem{}, http.StatusForbidden, errors.New("forbidden")
+	}
+	it.Errors = errs
+	return it, 0, nil
+}
+
+func (h *ImportsHandler) Get(w http.ResponseWriter, r *http.Request, jobID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	it, status, err := h.loadJob(ctx, r, jobID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// Commit aplica un import validado. Todo o nada: si al revalidar aparece algún
+// error (alguien cambió datos en el medio) no se escribe nada y el job queda invalid.
+func (h *ImportsHandler) Commit(w http.ResponseWriter, r *http.Request, jobID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var kind, status string
+	var data []byte
+	err = tx.QueryRow(ctx, `
+		SELECT kind, status, file
+		FROM import_job
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, jobID, claims.ServiceProvider).Scan(&kind, &status, &data)
+	if err != nil {
+		http.Error(w, "import not found", http.StatusNotFound)
+		return
+	}
+	spec := importKinds[kind]
+	if !PermissionsFromContext(r.Context()).Has(spec.Perm) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if status != "validated" {
+		http.Error(w, "import is "+status+"; only validated imports can be committed", http.StatusConflict)
+		return
+	}
+
+	sheet, err := importer.Read(data)
+	if err != nil {
+		http.Error(w, "could not read import file", http.StatusInternalServerError)
+		return
+	}
+
+	out, err := validateImport(ctx, tx, claims.ServiceProvider, claims.UserID, spec, sheet, true)
+	if err != nil {
+		http.Error(w, "could not apply import", http.StatusInternalServerError)
+		return
+	}
+
+	if len(out.Errors) > 0 {
+		// Se descarta lo escrito y se guardan los errores nuevos fuera de la tx.
+		_ = tx.Rollback(ctx)
+
+		var it importJobItem
+		err = scanImportJob(h.DB.QueryRow(ctx, `
+			UPDATE import_job
+			SET status = 'invalid', errors = $3, created_rows = $4, updated_rows = $5,
+			    validated_at = now()
+			WHERE id::text = $1 AND service_provider_id = $2
+			RETURNING `+importJobColumns,
+			jobID, claims.ServiceProvider, out.Errors, out.Created, out.Updated,
+		), &it)
+		if err != nil {
+			http.Error(w, "could not save import errors", http.StatusInternalServerError)
+			return
+		}
+		it.Errors = out.Errors
+		WriteJSON(w, http.StatusConflict, it)
+		return
+	}
+
+	var it importJobItem
+	err = scanImportJob(tx.QueryRow(ctx, `
+		UPDATE import_job
+		SET status = 'committed', created_rows = $3, updated_rows = $4,
+		    committed_by = $5, committed_at = now()
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+importJobColumns,
+		jobID, claims.ServiceProvider, out.Created, out.Updated, claims.UserID,
+	), &it)
+	if err != nil {
+		http.Error(w, "could not update import", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// ErrorReport baja los errores como CSV (fila, columna, mensaje) para
+// corregir la planilla original.
+func (h *ImportsHandler) ErrorReport(w http.ResponseWriter, r *http.Request, jobID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	it, status, err := h.loadJob(ctx, r, jobID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import_%s_errors.csv"`, it.ID))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"row", "column", "message"})
+	for _, e := range it.Errors {
+		_ = cw.Write([]string{strconv.Itoa(e.Row), e.Column, e.Message})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,377 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+)
+
+type InvitationsHandler struct {
+	DB          *db.DB
+	Mailer      mailer.Mailer
+	FrontendURL string
+}
+
+// createInvitation guarda una invitación nueva y devuelve el token en claro (solo para el email).
+// La vigencia es la de provider_settings.invite_ttl_hours.
+func createInvitation(ctx context.Context, q dbtx, spid, userID, createdBy string) (id, plain string, expiresAt time.Time, err error) {
+	settings, err := loadProviderSettings(ctx, q, spid)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	plain, tokenHash, err := newInviteToken()
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	expiresAt = time.Now().Add(settings.InviteTTL())
+
+	err = q.QueryRow(ctx, `
+		INSERT INTO user_invitation (
+			service_provider_id, user_id,
+			token_hash, expires_at,
+			created_by
+		) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`,
+		spid, userID,
+		tokenHash, expiresAt,
+		createdBy,
+	).Scan(&id)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return id, plain, expiresAt, nil
+}
+
+// sendInvite manda el email con el link a /set-password (el token nunca va al log).
+// Idioma y zona horaria del email: los del provider.
+func sendInvite(ctx context.Context, q dbtx, m mailer.Mailer, frontendURL, spid, email, fullname, plain string, expiresAt time.Time) error {
+	var providerName string
+	_ = q.QueryRow(ctx, `SELECT name FROM service_provider WHERE id = $1`, spid).Scan(&providerName)
+	settings, _ := loadProviderSettings(ctx, q, spid) // si falla, defaults
+
+	return sendMail(ctx, m, mailer.TemplateInvite, settings.Language, email, mailer.InviteData{
+		Fullname:     fullname,
+		ProviderName: providerName,
+		Link:         frontendLink(frontendURL, "/set-password", url.Values{"token": {plain}}),
+		ExpiresAt:    expiresAt.In(settings.Location()),
+	})
+}
+
+// exposeInviteToken: fuera de producción devolvemos el token para poder probar sin email.
+func exposeInviteToken(plain string) *string {
+	if strings.ToLower(os.Getenv("ENV")) != "production" {
+		return &plain
+	}
+	return nil
+}
+
+// =========================
+// GET /invitations
+// =========================
+
+type invitationItem struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Fullname  string     `json:"fullname"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Status    string     `json:"status"` // pending|expired|used|revoked
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	SweptAt   *time.Time `json:"swept_at,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const invitationStatusSQL = `
+	CASE
+	  WHEN i.used_at IS NOT NULL THEN 'used'
+	  WHEN i.revoked_at IS NOT NULL THEN 'revoked'
+	  WHEN i.expires_at <= now() THEN 'expired'
+	  ELSE 'pending'
+	END`
+
+func (h *InvitationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := authorize(w, r, authz.UserRead)
+	if claims == nil {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// status: pending|expired|used|revoked|all. Por defecto lo que requiere atención.
+	statuses := []string{"pending", "expired"}
+	switch s := strings.TrimSpace(q.Get("status")); s {
+	case "":
+	case "all":
+		statuses = nil
+	default:
+		statuses = nil
+		for _, st := range strings.Split(s, ",") {
+			st = strings.TrimSpace(st)
+			if st != "pending" && st != "expired" && st != "used" && st != "revoked" {
+				http.Error(w, "invalid status", http.StatusBadRequest)
+				return
+			}
+			statuses = append(statuses, st)
+		}
+	}
+
+	args := []any{claims.ServiceProvider}
+	where := `WHERE i.service_provider_id = $1`
+	argn := 2
+
+	if len(statuses) > 0 {
+		where += " AND (" + invitationStatusSQL + ") = ANY($" + itoa(argn) + ")"
+		args = append(args, statuses)
+		argn++
+	}
+
+	// solo invitaciones de roles que el actor gestiona (dispatcher: técnicos)
+	where += " AND u.role::text = ANY($" + itoa(argn) + ")"
+	args = append(args, PermissionsFromContext(r.Context()).ManageableRoles())
+	argn++
+	if role := strings.TrimSpace(q.Get("role")); role != "" {
+		where += " AND u.role::text = $" + itoa(argn)
+		args = append(args, role)
+		argn++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT
+		  i.id, i.user_id, u.fullname, u.email, u.role,
+		  `+invitationStatusSQL+`,
+		  i.expires_at, i.used_at, i.revoked_at, i.swept_at,
+		  i.created_by, i.created_at
+		FROM user_invitation i
+		JOIN "user" u ON u.id = i.user_id
+		`+where+`
+		ORDER BY i.created_at DESC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list invitations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]invitationItem, 0, limit)
+	for rows.Next() {
+		var it invitationItem
+		if err := rows.Scan(
+			&it.ID, &it.UserID, &it.Fullname, &it.Email, &it.Role,
+			&it.Status,
+			&it.ExpiresAt, &it.UsedAt, &it.RevokedAt, &it.SweptAt,
+			&it.CreatedBy, &it.CreatedAt,
+		); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// =========================
+// POST /invitations/{id}/resend
+// POST /invitations/{id}/revoke
+// =========================
+
+func (h *InvitationsHandler) Action(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := pathParts(r)
+	if len(parts) != 3 || parts[0] != "invitations" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch parts[2] {
+	case "resend":
+		h.resend(w, r, parts[1])
+	case "revoke":
+		h.revoke(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type invitationTarget struct {
+	UserID    string
+	Email     string
+	Fullname  string
+	Role      string
+	IsActive  bool
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	Activated bool // el usuario ya consumió alguna invitación
+}
+
+func (h *InvitationsHandler) loadTarget(ctx context.Context, q dbtx, spid, inviteID string) (invitationTarget, error) {
+	var t invitationTarget
+	err := q.QueryRow(ctx, `
+		SELECT u.id, u.email, u.fullname, u.role, u.is_active,
+		       i.used_at, i.revoked_at,
+		       EXISTS (
+		         SELECT 1 FROM user_invitation x
+		         WHERE x.user_id = u.id AND x.used_at IS NOT NULL
+		       )
+		FROM user_invitation i
+		JOIN "user" u ON u.id = i.user_id
+		WHERE i.id = $1 AND i.service_provider_id = $2
+	`, inviteID, spid).Scan(
+		&t.UserID, &t.Email, &t.Fullname, &t.Role, &t.IsActive,
+		&t.UsedAt, &t.RevokedAt,
+		&t.Activated,
+	)
+	return t, err
+}
+
+type resendInvitationResponse struct {
+	ID          string  `json:"id"`
+	UserID      string  `json:"user_id"`
+	InviteSent  bool    `json:"invite_sent"`
+	InviteToken *string `json:"invite_token,omitempty"`
+}
+
+func (h *InvitationsHandler) resend(w http.ResponseWriter, r *http.Request, inviteID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	t, err := h.loadTarget(ctx, h.DB, claims.ServiceProvider, inviteID)
+	if err != nil {
+		http.Error(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	if !PermissionsFromContext(r.Context()).CanManageRole(t.Role) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if t.Activated {
+		http.Error(w, "user already activated", http.StatusConflict)
+		return
+	}
+	if !t.IsActive {
+		http.Error(w, "user inactive", http.StatusConflict)
+		return
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// El token viejo deja de servir: solo vale el último enviado.
+	_, err = tx.Exec(ctx, `
+		UPDATE user_invitation
+		SET revoked_at = now(), revoked_by = $2
+		WHERE user_id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`, t.UserID, claims.UserID)
+	if err != nil {
+		http.Error(w, "could not revoke previous invitation", http.StatusInternalServerError)
+		return
+	}
+
+	newID, plain, expiresAt, err := createInvitation(ctx, tx, claims.ServiceProvider, t.UserID, claims.UserID)
+	if err != nil {
+		http.Error(w, "could not save invitation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	err = sendInvite(ctx, h.DB, h.Mailer, h.FrontendURL, claims.ServiceProvider, t.Email, t.Fullname, plain, expiresAt)
+	if err != nil {
+		log.Printf("[INVITE] could not resend invite user=%s: %v", t.UserID, err)
+	}
+
+	WriteJSON(w, http.StatusOK, resendInvitationResponse{
+		ID:          newID,
+		UserID:      t.UserID,
+		InviteSent:  err == nil,
+		InviteToken: exposeInviteToken(plain),
+	})
+}
+
+func (h *InvitationsHandler) revoke(w http.ResponseWriter, r *http.Request, inviteID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	t, err := h.loadTarget(ctx, h.DB, claims.ServiceProvider, inviteID)
+	if err != nil {
+		http.Error(w, "invitation not found", http.StatusNotFound)
+		return
+	}
+	if !PermissionsFromContext(r.Context()).CanManageRole(t.Role) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if t.UsedAt != nil {
+		http.Error(w, "invitation already used", http.StatusConflict)
+		return
+	}
+
+	if t.RevokedAt == nil {
+		_, err = h.DB.Exec(ctx, `
+			UPDATE user_invitation
+			SET revoked_at = now(), revoked_by = $3
+			WHERE id = $1 AND service_provider_id = $2 AND used_at IS NULL AND revoked_at IS NULL
+		`, inviteID, claims.ServiceProvider, claims.UserID)
+		if err != nil {
+			http.Error(w, "could not revoke invitation", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"id": inviteID, "status": "revoked"})
+}
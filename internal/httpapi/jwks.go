@@ -0,0 +1,24 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+)
+
+// JWKSHandler publica las claves públicas para que otros servicios verifiquen
+// nuestros access tokens sin tener el secreto de firma.
+type JWKSHandler struct {
+	Keys *auth.KeySet
+}
+
+// GET /.well-known/jwks.json
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Cache corto: una clave nueva se publica antes de activarse (ver LoadKeySet).
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	WriteJSON(w, http.StatusOK, h.Keys.JWKS())
+}
@@ -0,0 +1,300 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
+)
+
+// LoginGuard aplica el throttling de login/MFA (por cuenta y por IP) y deja
+// registro de cada intento en login_attempt.
+type LoginGuard struct {
+	DB      *db.DB
+	Account *throttle.Limiter
+	IP      *throttle.Limiter
+}
+
+type loginAttempt struct {
+	ServiceProviderID string
+	UserID            *string
+	Email             string
+	Success           bool
+	Reason            string // ok|mfa_pending|tenant_selection|bad_password|unknown_user|inactive|suspended|locked|mfa_failed
+}
+
+// accountKeys: un contador por cuenta, "acct:{spid}:{email}", para que los
+// fallos contra un provider no bloqueen la cuenta del mismo email en otro. Sin
+// provider el password se prueba contra todas las cuentas del email, así que el
+// intento cuenta para todas. Si no hay ninguna, la clave usa el id o slug
+// pedido: así un email inexistente se bloquea igual que uno real.
+func accountKeys(req loginRequest, candidates []loginCandidate) []string {
+	if len(candidates) == 0 {
+		provider := req.ServiceProviderID
+		if provider == "" {
+			provider = req.ServiceProvider
+		}
+		return []string{accountKey(provider, req.Email)}
+	}
+	keys := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		keys = append(keys, accountKey(c.ServiceProvider, c.Email))
+	}
+	return keys
+}
+
+func accountKey(spid, email string) string {
+	return "acct:" + spid + ":" + email
+}
+
+func mfaKey(userID string) string {
+	return "mfa:" + userID
+}
+
+// Allow devuelve cuánto hay que esperar si alguna de las claves o la IP están
+// bloqueadas. Si el store falla dejamos pasar: un problema de infraestructura no
+// debe dejar a todo el mundo afuera.
+func (g *LoginGuard) Allow(ctx context.Context, ip string, keys ...string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	var wait time.Duration
+	for _, key := range keys {
+		if d, err := g.Account.Check(ctx, key); err != nil {
+			log.Printf("[THROTTLE] check %s: %v", key, err)
+		} else if d > wait {
+			wait = d
+		}
+	}
+	if d, err := g.IP.Check(ctx, "ip:"+ip); err != nil {
+		log.Printf("[THROTTLE] check ip %s: %v", ip, err)
+	} else if d > wait {
+		wait = d
+	}
+	return wait
+}
+
+// Failed suma el fallo a cada clave y a la IP y devuelve el bloqueo resultante.
+func (g *LoginGuard) Failed(ctx context.Context, ip string, keys ...string) time.Duration {
+	if g == nil {
+		return 0
+	}
+	var wait time.Duration
+	for _, key := range keys {
+		if d, err := g.Account.Fail(ctx, key); err != nil {
+			log.Printf("[THROTTLE] fail %s: %v", key, err)
+		} else if d > wait {
+			wait = d
+		}
+	}
+	if d, err := g.IP.Fail(ctx, "ip:"+ip); err != nil {
+		log.Printf("[THROTTLE] fail ip %s: %v", ip, err)
+	} else if d > wait {
+		wait = d
+	}
+	return wait
+}
+
+// Succeeded limpia los contadores de las cuentas. El de la IP no: una IP que
+// prueba muchas cuentas sigue siendo sospechosa aunque acierte una.
+func (g *LoginGuard) Succeeded(ctx context.Context, keys ...string) {
+	if g == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := g.Account.Succeed(ctx, key); err != nil {
+			log.Printf("[THROTTLE] reset %s: %v", key, err)
+		}
+	}
+}
+
+// Record guarda el intento. Best-effort: si falla solo se loguea.
+func (g *LoginGuard) Record(ctx context.Context, r *http.Request, a loginAttempt) {
+	if g == nil {
+		return
+	}
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	email := a.Email
+	if len(email) > 100 {
+		email = email[:100]
+	}
+
+	// Corre como sistema: el intento puede no tener provider, o ser de uno
+	// distinto al que tenga fijado ctx.
+	ctx, release, err := g.DB.WithSystem(db.Detach(ctx))
+	if err != nil {
+		log.Printf("[LOGIN] could not record attempt email=%s: %v", email, err)
+		return
+	}
+	defer release()
+
+	// El provider solo se guarda si existe (el cliente puede mandar cualquier cosa).
+	_, err = g.DB.Exec(ctx, `
+		INSERT INTO login_attempt (
+			service_provider_id, user_id,
+			email, ip_address, user_agent,
+			success, reason
+		) VALUES (
+			(SELECT id FROM service_provider WHERE id::text = $1),
+			$2, $3, $4, $5, $6, $7
+		)
+	`, a.ServiceProviderID, a.UserID, email, clientIP(r), ua, a.Success, a.Reason)
+	if err != nil {
+		log.Printf("[LOGIN] could not record attempt email=%s: %v", email, err)
+	}
+}
+
+// PruneLoop limpia periódicamente los contadores viejos.
+func (g *LoginGuard) PruneLoop(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := g.Account.Prune(ctx); err != nil {
+				log.Printf("[THROTTLE] prune: %v", err)
+			}
+			if err := g.IP.Prune(ctx); err != nil {
+				log.Printf("[THROTTLE] prune: %v", err)
+			}
+		}
+	}
+}
+
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, "too many attempts, try again later", http.StatusTooManyRequests)
+}
+
+// =========================
+// GET /login-attempts (admin)
+// =========================
+
+type LoginAttemptsHandler struct {
+	DB *db.DB
+}
+
+type loginAttemptItem struct {
+	ID        string    `json:"id"`
+	UserID    *string   `json:"user_id,omitempty"`
+	Email     string    `json:"email"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent *string   `json:"user_agent,omitempty"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *LoginAttemptsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := authorize(w, r, authz.LoginAttemptRead)
+	if claims == nil {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	success, err := parseBool(q.Get("success"))
+	if err != nil {
+		http.Error(w, "invalid success", http.StatusBadRequest)
+		return
+	}
+
+	args := []any{claims.ServiceProvider}
+	where := `WHERE service_provider_id = $1`
+	argn := 2
+
+	if email := strings.ToLower(strings.TrimSpace(q.Get("email"))); email != "" {
+		where += " AND email = $" + itoa(argn)
+		args = append(args, email)
+		argn++
+	}
+	if ip := strings.TrimSpace(q.Get("ip")); ip != "" {
+		where += " AND ip_address = $" + itoa(argn)
+		args = append(args, ip)
+		argn++
+	}
+	if success != nil {
+		where += " AND success = $" + itoa(argn)
+		args = append(args, *success)
+		argn++
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// since: RFC3339 o una fecha (YYYY-MM-DD) en la zona del provider.
+	if since := strings.TrimSpace(q.Get("since")); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			settings, serr := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+			if serr != nil {
+				http.Error(w, "could not load settings", http.StatusInternalServerError)
+				return
+			}
+			t, err = parseLocalDate(since, settings.Location())
+		}
+		if err != nil {
+			http.Error(w, "invalid since, expected RFC3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		where += " AND created_at >= $" + itoa(argn)
+		args = append(args, t)
+		argn++
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT id, user_id, email, ip_address, user_agent, success, reason, created_at
+		FROM login_attempt
+		`+where+`
+		ORDER BY created_at DESC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list login attempts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]loginAttemptItem, 0, limit)
+	for rows.Next() {
+		var it loginAttemptItem
+		if err := rows.Scan(
+			&it.ID, &it.UserID, &it.Email, &it.IPAddress, &it.UserAgent,
+			&it.Success, &it.Reason, &it.CreatedAt,
+		); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
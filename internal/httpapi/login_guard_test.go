@@ -0,0 +1,111 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
+)
+
+func TestWriteTooManyRequests(t *testing.T) {
+	for _, c := range []struct {
+		wait time.Duration
+		want string
+	}{
+		{0, "1"},
+		{300 * time.Millisecond, "1"},
+		{1200 * time.Millisecond, "2"},
+		{10 * time.Minute, "600"},
+	} {
+		w := httptest.NewRecorder()
+		writeTooManyRequests(w, c.wait)
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("wait %v: status %d, want 429", c.wait, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != c.want {
+			t.Errorf("wait %v: Retry-After %q, want %q", c.wait, got, c.want)
+		}
+	}
+}
+
+func TestAccountKeys(t *testing.T) {
+	const otherSPID = "00000000-0000-0000-0000-0000000000b2"
+	candidate := func(spid string) loginCandidate {
+		return loginCandidate{loginUser: loginUser{ServiceProvider: spid, Email: "ana@example.com"}}
+	}
+	for _, c := range []struct {
+		name       string
+		req        loginRequest
+		candidates []loginCandidate
+		want       []string
+	}{
+		{"one provider", loginRequest{ServiceProvider: "frio-norte", Email: "ana@example.com"},
+			[]loginCandidate{candidate(testSPID)},
+			[]string{"acct:" + testSPID + ":ana@example.com"}},
+		{"email only, two accounts", loginRequest{Email: "ana@example.com"},
+			[]loginCandidate{candidate(testSPID), candidate(otherSPID)},
+			[]string{"acct:" + testSPID + ":ana@example.com", "acct:" + otherSPID + ":ana@example.com"}},
+		{"unknown by id", loginRequest{ServiceProviderID: otherSPID, Email: "nadie@example.com"}, nil,
+			[]string{"acct:" + otherSPID + ":nadie@example.com"}},
+		{"unknown by slug", loginRequest{ServiceProvider: "frio-norte", Email: "nadie@example.com"}, nil,
+			[]string{"acct:frio-norte:nadie@example.com"}},
+		{"unknown, no provider", loginRequest{Email: "nadie@example.com"}, nil,
+			[]string{"acct::nadie@example.com"}},
+	} {
+		if got := accountKeys(c.req, c.candidates); !slices.Equal(got, c.want) {
+			t.Errorf("%s: keys %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// Los fallos contra un provider no bloquean la cuenta del mismo email en otro;
+// un login sin provider mira (y castiga) todas.
+func TestLoginGuardPerAccount(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	g := &LoginGuard{
+		Account: &throttle.Limiter{Store: throttle.NewMemoryStore(), Policy: throttle.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}, Now: clock},
+		IP:      &throttle.Limiter{Store: throttle.NewMemoryStore(), Policy: throttle.Policy{FreeAttempts: 100, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}, Now: clock},
+	}
+	a := accountKey(testSPID, "ana@example.com")
+	b := accountKey("00000000-0000-0000-0000-0000000000b2", "ana@example.com")
+
+	for i := 0; i < 2; i++ {
+		if wait := g.Failed(ctx, "10.0.0.1", a); wait != 0 {
+			t.Fatalf("free failure %d: wait %v", i+1, wait)
+		}
+	}
+	if wait := g.Failed(ctx, "10.0.0.1", a); wait != time.Minute {
+		t.Fatalf("third failure: wait %v, want 1m", wait)
+	}
+	if wait := g.Allow(ctx, "10.0.0.2", b); wait != 0 {
+		t.Errorf("other provider locked for %v", wait)
+	}
+	if wait := g.Allow(ctx, "10.0.0.2", a, b); wait != time.Minute {
+		t.Errorf("email-only login: wait %v, want 1m", wait)
+	}
+
+	// Sin provider el fallo suma a las dos cuentas.
+	now = now.Add(2 * time.Minute)
+	g.Failed(ctx, "10.0.0.2", a, b)
+	if wait := g.Allow(ctx, "10.0.0.2", a); wait != 2*time.Minute {
+		t.Errorf("account a: wait %v, want 2m", wait)
+	}
+	if wait := g.Allow(ctx, "10.0.0.2", b); wait != 0 {
+		t.Errorf("account b after one failure: wait %v, want 0", wait)
+	}
+	g.Failed(ctx, "10.0.0.2", b)
+	if wait := g.Failed(ctx, "10.0.0.2", b); wait != time.Minute {
+		t.Errorf("account b after three failures: wait %v, want 1m", wait)
+	}
+
+	g.Succeeded(ctx, a, b)
+	if wait := g.Allow(ctx, "10.0.0.2", a, b); wait != 0 {
+		t.Errorf("after success: wait %v, want 0", wait)
+	}
+}
@@ -0,0 +1,592 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errMFAAlreadyEnabled = errors.New("mfa already enabled")
+	errMFANotPending     = errors.New("no pending mfa enrollment")
+	errInvalidMFACode    = errors.New("invalid code")
+)
+
+type MFAHandler struct {
+	DB     *db.DB
+	Keys   *auth.KeySet
+	Issuer string // aparece en la app autenticadora
+	Guard  *LoginGuard
+}
+
+type mfaChallengeResponse struct {
+	MFARequired           bool   `json:"mfa_required"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required"`
+	MFAToken              string `json:"mfa_token"`
+	ExpiresIn             int    `json:"expires_in"`
+}
+
+type mfaStatus struct {
+	Enabled  bool // el usuario tiene TOTP confirmado
+	Required bool // el provider lo exige para su rol
+}
+
+// mfaRequiredForRole: la política del provider aplica a quienes pueden crear
+// usuarios y ver todos los clientes.
+func mfaRequiredForRole(role string) bool {
+	return role == "admin" || role == "dispatcher"
+}
+
+func loadMFAStatus(ctx context.Context, q dbtx, u loginUser) (mfaStatus, error) {
+	var st mfaStatus
+	var providerRequires bool
+	err := q.QueryRow(ctx, `
+		SELECT
+		  EXISTS (SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL),
+		  sp.mfa_required
+		FROM service_provider sp
+		WHERE sp.id = $2
+	`, u.ID, u.ServiceProvider).Scan(&st.Enabled, &providerRequires)
+	if err != nil {
+		return st, err
+	}
+	st.Required = providerRequires && mfaRequiredForRole(u.Role)
+	return st, nil
+}
+
+func loadLoginUser(ctx context.Context, q dbtx, userID, spid string) (loginUser, error) {
+	var u loginUser
+	err := q.QueryRow(ctx, `
+		SELECT u.id, u.service_provider_id, u.customer_id, u.fullname, u.email, u.role
+		FROM "user" u
+		JOIN service_provider sp ON sp.id = u.service_provider_id
+		WHERE u.id = $1 AND u.service_provider_id = $2 AND u.is_active
+		  AND sp.suspended_at IS NULL
+	`, userID, spid).Scan(&u.ID, &u.ServiceProvider, &u.CustomerID, &u.Fullname, &u.Email, &u.Role)
+	return u, err
+}
+
+// startEnrollment genera un secreto nuevo (pendiente de confirmar). Si ya hay
+// MFA activo no lo pisa: para cambiar de teléfono primero se desactiva.
+func startEnrollment(ctx context.Context, q dbtx, userID, spid string) (string, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	tag, err := q.Exec(ctx, `
+		INSERT INTO user_mfa (user_id, service_provider_id, totp_secret)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET totp_secret = EXCLUDED.totp_secret,
+		    last_used_step = NULL,
+		    updated_at = now()
+		WHERE user_mfa.enabled_at IS NULL
+	`, userID, spid, secret)
+	if err != nil {
+		return "", err
+	}
+	if tag.RowsAffected() == 0 {
+		return "", errMFAAlreadyEnabled
+	}
+	return secret, nil
+}
+
+// confirmEnrollment valida el primer código, activa MFA y genera los recovery codes.
+// now es la hora contra la que se valida el código (time.Now() salvo en tests).
+func confirmEnrollment(ctx context.Context, q dbtx, userID, code string, now time.Time) ([]string, error) {
+	var secret string
+	err := q.QueryRow(ctx, `
+		SELECT totp_secret FROM user_mfa
+		WHERE user_id = $1 AND enabled_at IS NULL
+		FOR UPDATE
+	`, userID).Scan(&secret)
+	if err != nil {
+		return nil, errMFANotPending
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, now, auth.TOTPSkew)
+	if !ok {
+		return nil, errInvalidMFACode
+	}
+
+	_, err = q.Exec(ctx, `
+		UPDATE user_mfa
+		SET enabled_at = now(), last_used_step = $2, updated_at = now()
+		WHERE user_id = $1
+	`, userID, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaceRecoveryCodes(ctx, q, userID)
+}
+
+// verifySecondFactor acepta un código TOTP (una sola vez por paso) o un recovery code (una sola vez).
+func verifySecondFactor(ctx context.Context, q dbtx, userID, code, recoveryCode string, now time.Time) error {
+	if recoveryCode != "" {
+		var id string
+		err := q.QueryRow(ctx, `
+			UPDATE mfa_recovery_code
+			SET used_at = now()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			RETURNING id
+		`, userID, hashInviteToken(normalizeRecoveryCode(recoveryCode))).Scan(&id)
+		if err != nil {
+			return errInvalidMFACode
+		}
+		return nil
+	}
+
+	var secret string
+	err := q.QueryRow(ctx, `
+		SELECT totp_secret FROM user_mfa
+		WHERE user_id = $1 AND enabled_at IS NOT NULL
+	`, userID).Scan(&secret)
+	if err != nil {
+		return errInvalidMFACode
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, now, auth.TOTPSkew)
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	// Anti-replay: el mismo código (o uno anterior) no vale dos veces.
+	tag, err := q.Exec(ctx, `
+		UPDATE user_mfa
+		SET last_used_step = $2, updated_at = now()
+		WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2)
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes invalida los anteriores y devuelve los nuevos en claro (se muestran una vez).
+func replaceRecoveryCodes(ctx context.Context, q dbtx, userID string) ([]string, error) {
+	if _, err := q.Exec(ctx, `DELETE FROM mfa_recovery_code WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = q.Exec(ctx, `
+			INSERT INTO mfa_recovery_code (user_id, service_provider_id, code_hash)
+			SELECT id, service_provider_id, $2 FROM "user" WHERE id = $1
+		`, userID, hashInviteToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode: 10 caracteres sin ambigüedades (sin 0/o, 1/l/i), ej. "k7m2p-x9c4d".
+func newRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer("-", "", " ", "").Replace(s)
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidMFACode):
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+	case errors.Is(err, errMFAAlreadyEnabled):
+		http.Error(w, "mfa already enabled", http.StatusConflict)
+	case errors.Is(err, errMFANotPending):
+		http.Error(w, "no pending mfa enrollment", http.StatusConflict)
+	default:
+		http.Error(w, "mfa error", http.StatusInternalServerError)
+	}
+}
+
+// =========================
+// Públicos (con mfa_token):
+// POST /auth/mfa/verify
+// POST /auth/mfa/enroll
+// POST /auth/mfa/enroll/confirm
+// =========================
+
+type mfaTokenRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type mfaEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // para el QR
+}
+
+type mfaRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *MFAHandler) Auth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req mfaTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := auth.ParseMFAChallenge(h.Keys, strings.TrimSpace(req.MFAToken))
+	if err != nil {
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// El challenge está firmado: su provider es el del usuario (RLS).
+	ctx, release, err := h.DB.WithTenant(ctx, challenge.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not bind tenant", http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	u, err := loadLoginUser(ctx, h.DB, challenge.UserID, challenge.ServiceProvider)
+	if err != nil {
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	// El código son 6 dígitos: sin throttling se adivina en horas.
+	key, ip := mfaKey(u.ID), clientIP(r)
+	if wait := h.Guard.Allow(ctx, ip, key); wait > 0 {
+		writeTooManyRequests(w, wait)
+		return
+	}
+
+	switch strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "auth/mfa/") {
+	case "verify":
+		if challenge.Enroll {
+			http.Error(w, "mfa enrollment required", http.StatusBadRequest)
+			return
+		}
+		h.verify(ctx, w, r, u, req)
+	case "enroll":
+		if !challenge.Enroll {
+			http.Error(w, "mfa already enabled", http.StatusConflict)
+			return
+		}
+		h.enroll(ctx, w, u)
+	case "enroll/confirm":
+		if !challenge.Enroll {
+			http.Error(w, "mfa already enabled", http.StatusConflict)
+			return
+		}
+		h.confirmAndLogin(ctx, w, r, u, req.Code)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *MFAHandler) verify(ctx context.Context, w http.ResponseWriter, r *http.Request, u loginUser, req mfaTokenRequest) {
+	if strings.TrimSpace(req.Code) == "" && strings.TrimSpace(req.RecoveryCode) == "" {
+		http.Error(w, "code or recovery_code is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if err := verifySecondFactor(ctx, tx, u.ID, req.Code, req.RecoveryCode, time.Now()); err != nil {
+		h.mfaFailed(ctx, w, r, u, err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	h.mfaSucceeded(ctx, r, u)
+	writeLoginResponse(ctx, w, r, h.DB, h.Keys, u)
+}
+
+func (h *MFAHandler) enroll(ctx context.Context, w http.ResponseWriter, u loginUser) {
+	secret, err := startEnrollment(ctx, h.DB, u.ID, u.ServiceProvider)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	WriteJSON(w, http.StatusOK, mfaEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(h.Issuer, u.Email, secret),
+	})
+}
+
+// confirmAndLogin cierra el enrolamiento forzado: activa MFA y ya entrega la sesión.
+func (h *MFAHandler) confirmAndLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, u loginUser, code string) {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err := confirmEnrollment(ctx, tx, u.ID, code, time.Now())
+	if err != nil {
+		h.mfaFailed(ctx, w, r, u, err)
+		return
+	}
+
+	claims := auth.Claims{
+		UserID:          u.ID,
+		ServiceProvider: u.ServiceProvider,
+		CustomerID:      u.CustomerID,
+		Role:            u.Role,
+	}
+	tokens, err := issueTokens(ctx, tx, r, h.Keys, claims)
+	if err != nil {
+		http.Error(w, "could not create session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	h.mfaSucceeded(ctx, r, u)
+	WriteJSON(w, http.StatusOK, struct {
+		tokenPair
+		mfaRecoveryCodesResponse
+	}{tokens, mfaRecoveryCodesResponse{RecoveryCodes: codes}})
+}
+
+func (h *MFAHandler) mfaFailed(ctx context.Context, w http.ResponseWriter, r *http.Request, u loginUser, err error) {
+	if !errors.Is(err, errInvalidMFACode) {
+		writeMFAError(w, err)
+		return
+	}
+	h.Guard.Record(ctx, r, loginAttempt{
+		ServiceProviderID: u.ServiceProvider,
+		UserID:            &u.ID,
+		Email:             u.Email,
+		Reason:            "mfa_failed",
+	})
+	if wait := h.Guard.Failed(ctx, clientIP(r), mfaKey(u.ID)); wait > 0 {
+		writeTooManyRequests(w, wait)
+		return
+	}
+	writeMFAError(w, err)
+}
+
+func (h *MFAHandler) mfaSucceeded(ctx context.Context, r *http.Request, u loginUser) {
+	h.Guard.Succeeded(ctx, mfaKey(u.ID))
+	h.Guard.Record(ctx, r, loginAttempt{
+		ServiceProviderID: u.ServiceProvider,
+		UserID:            &u.ID,
+		Email:             u.Email,
+		Success:           true,
+		Reason:            "ok",
+	})
+}
+
+// =========================
+// Autenticados:
+// POST /me/mfa/enroll
+// POST /me/mfa/confirm
+// POST /me/mfa/recovery-codes
+// POST /me/mfa/disable
+// =========================
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (h *MFAHandler) Me(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// Una API key lleva el UserID de quien la creó: no puede tocar su MFA.
+	if claims.IsAPIKey() {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req mfaCodeRequest
+	_ = json.NewDecoder(r.Body).Decode(&req) // enroll no lleva body
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	u, err := loadLoginUser(ctx, h.DB, claims.UserID, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	action := strings.TrimPrefix(strings.Trim(r.URL.Path, "/"), "me/mfa/")
+	if action == "enroll" {
+		h.enroll(ctx, w, u)
+		return
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var resp any
+	switch action {
+	case "confirm":
+		codes, err := confirmEnrollment(ctx, tx, u.ID, req.Code, time.Now())
+		if err != nil {
+			writeMFAError(w, err)
+			return
+		}
+		resp = mfaRecoveryCodesResponse{RecoveryCodes: codes}
+
+	case "recovery-codes":
+		if err := verifySecondFactor(ctx, tx, u.ID, req.Code, "", time.Now()); err != nil {
+			writeMFAError(w, err)
+			return
+		}
+		codes, err := replaceRecoveryCodes(ctx, tx, u.ID)
+		if err != nil {
+			http.Error(w, "could not create recovery codes", http.StatusInternalServerError)
+			return
+		}
+		resp = mfaRecoveryCodesResponse{RecoveryCodes: codes}
+
+	case "disable":
+		st, err := loadMFAStatus(ctx, tx, u)
+		if err != nil {
+			http.Error(w, "could not check mfa", http.StatusInternalServerError)
+			return
+		}
+		if st.Required {
+			http.Error(w, "mfa is required by your organization", http.StatusForbidden)
+			return
+		}
+		if err := verifySecondFactor(ctx, tx, u.ID, req.Code, req.RecoveryCode, time.Now()); err != nil {
+			writeMFAError(w, err)
+			return
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_code WHERE user_id = $1`, u.ID); err != nil {
+			http.Error(w, "could not disable mfa", http.StatusInternalServerError)
+			return
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, u.ID); err != nil {
+			http.Error(w, "could not disable mfa", http.StatusInternalServerError)
+			return
+		}
+		resp = map[string]bool{"ok": true}
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// =========================
+// GET/PUT /mfa/policy (admin)
+// =========================
+
+type mfaPolicy struct {
+	Required bool `json:"required"` // exige MFA a admin y dispatcher
+}
+
+func (h *MFAHandler) Policy(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.MFAPolicyManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var p mfaPolicy
+	switch r.Method {
+	case http.MethodGet:
+		err := h.DB.QueryRow(ctx, `
+			SELECT mfa_required FROM service_provider WHERE id = $1
+		`, claims.ServiceProvider).Scan(&p.Required)
+		if err != nil {
+			http.Error(w, "provider not found", http.StatusNotFound)
+			return
+		}
+
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		_, err := h.DB.Exec(ctx, `
+			UPDATE service_provider
+			SET mfa_required = $2, updated_at = now()
+			WHERE id = $1
+		`, claims.ServiceProvider, p.Required)
+		if err != nil {
+			http.Error(w, "could not update policy", http.StatusInternalServerError)
+			return
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,306 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// mfaStore: user_mfa y mfa_recovery_code de un usuario, en memoria. Aplica las
+// mismas condiciones que las queries de mfa.go (enabled_at, last_used_step <
+// $2, used_at IS NULL) para que el anti-replay se decida igual que en Postgres.
+type mfaStore struct {
+	secret   string
+	enabled  bool
+	lastStep *int64
+	recovery map[string]bool // code_hash => usado
+}
+
+type rowFunc func(dest ...any) error
+
+func (f rowFunc) Scan(dest ...any) error { return f(dest...) }
+
+func (s *mfaStore) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "SELECT totp_secret FROM user_mfa"):
+		if s.secret == "" || s.enabled != strings.Contains(sql, "enabled_at IS NOT NULL") {
+			return rowFunc(func(...any) error { return pgx.ErrNoRows })
+		}
+		return rowFunc(func(dest ...any) error {
+			*dest[0].(*string) = s.secret
+			return nil
+		})
+	case strings.Contains(sql, "UPDATE mfa_recovery_code"):
+		hash := args[1].(string)
+		used, ok := s.recovery[hash]
+		if !ok || used {
+			return rowFunc(func(...any) error { return pgx.ErrNoRows })
+		}
+		s.recovery[hash] = true
+		return rowFunc(func(dest ...any) error {
+			*dest[0].(*string) = hash[:8]
+			return nil
+		})
+	}
+	return rowFunc(func(...any) error { return fmt.Errorf("unexpected query: %s", sql) })
+}
+
+func (s *mfaStore) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	switch {
+	case strings.Contains(sql, "SET enabled_at = now(), last_used_step = $2"):
+		step := args[1].(int64)
+		s.enabled, s.lastStep = true, &step
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	case strings.Contains(sql, "SET last_used_step = $2"):
+		step := args[1].(int64)
+		if !s.enabled || (s.lastStep != nil && *s.lastStep >= step) {
+			return pgconn.NewCommandTag("UPDATE 0"), nil
+		}
+		s.lastStep = &step
+		return pgconn.NewCommandTag("UPDATE 1"), nil
+	case strings.Contains(sql, "DELETE FROM mfa_recovery_code"):
+		n := len(s.recovery)
+		s.recovery = map[string]bool{}
+		return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", n)), nil
+	case strings.Contains(sql, "INSERT INTO mfa_recovery_code"):
+		s.recovery[args[1].(string)] = false
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	return pgconn.CommandTag{}, fmt.Errorf("unexpected exec: %s", sql)
+}
+
+func (s *mfaStore) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	return nil, fmt.Errorf("unexpected query: %s", sql)
+}
+
+// Hora fija: todos los códigos se calculan contra este reloj, no contra time.Now().
+var mfaNow = time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+
+// Secreto de los vectores del RFC 6238 (ver auth/totp_test.go).
+const rfcTestSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func codeAt(t *testing.T, at time.Time) string {
+	t.Helper()
+	code, err := auth.TOTPCode(rfcTestSecret, auth.TOTPStep(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func enrolledStore(t *testing.T) (*mfaStore, []string) {
+	t.Helper()
+	s := &mfaStore{secret: rfcTestSecret, recovery: map[string]bool{}}
+	codes, err := confirmEnrollment(context.Background(), s, "u1", codeAt(t, mfaNow), mfaNow)
+	if err != nil {
+		t.Fatalf("confirmEnrollment: %v", err)
+	}
+	return s, codes
+}
+
+func TestConfirmEnrollment(t *testing.T) {
+	ctx := context.Background()
+	s := &mfaStore{secret: rfcTestSecret, recovery: map[string]bool{}}
+
+	if _, err := confirmEnrollment(ctx, s, "u1", codeAt(t, mfaNow.Add(-2*time.Minute)), mfaNow); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("stale code = %v, want errInvalidMFACode", err)
+	}
+	if s.enabled {
+		t.Fatal("a wrong code enabled MFA")
+	}
+
+	codes, err := confirmEnrollment(ctx, s, "u1", codeAt(t, mfaNow), mfaNow)
+	if err != nil {
+		t.Fatalf("confirmEnrollment: %v", err)
+	}
+	if !s.enabled || s.lastStep == nil || *s.lastStep != auth.TOTPStep(mfaNow) {
+		t.Fatalf("after confirm: enabled=%v last_used_step=%v", s.enabled, s.lastStep)
+	}
+	seen := map[string]bool{}
+	for _, c := range codes {
+		seen[c] = true
+	}
+	if len(codes) != recoveryCodeCount || len(seen) != recoveryCodeCount || len(s.recovery) != recoveryCodeCount {
+		t.Fatalf("got %d codes (%d distinct), %d stored", len(codes), len(seen), len(s.recovery))
+	}
+
+	// El código que confirmó el alta ya quedó usado.
+	if err := verifySecondFactor(ctx, s, "u1", codeAt(t, mfaNow), "", mfaNow); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("enrollment code reused = %v, want errInvalidMFACode", err)
+	}
+	if _, err := confirmEnrollment(ctx, s, "u1", codeAt(t, mfaNow), mfaNow); !errors.Is(err, errMFANotPending) {
+		t.Fatalf("second confirm = %v, want errMFANotPending", err)
+	}
+}
+
+func TestVerifySecondFactorAntiReplay(t *testing.T) {
+	ctx := context.Background()
+	s, _ := enrolledStore(t)
+	next := mfaNow.Add(30 * time.Second)
+	later := mfaNow.Add(90 * time.Second)
+
+	steps := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{"same step again", codeAt(t, mfaNow), mfaNow, false},
+		{"previous step inside skew", codeAt(t, mfaNow.Add(-30*time.Second)), mfaNow, false},
+		{"next step", codeAt(t, next), next, true},
+		{"next step replayed", codeAt(t, next), next, false},
+		{"two steps ahead", codeAt(t, later.Add(60*time.Second)), later, false},
+		{"two steps behind", codeAt(t, later.Add(-60*time.Second)), later, false},
+		{"one step ahead", codeAt(t, later.Add(30*time.Second)), later, true},
+		{"current after using the one ahead", codeAt(t, later), later, false},
+		{"wrong code", "000000", later.Add(5 * time.Minute), false},
+		{"no code", "", later.Add(5 * time.Minute), false},
+	}
+	for _, st := range steps {
+		before := *s.lastStep
+		err := verifySecondFactor(ctx, s, "u1", st.code, "", st.at)
+		if st.ok != (err == nil) {
+			t.Fatalf("%s: err = %v, want ok=%v", st.name, err, st.ok)
+		}
+		if err != nil && !errors.Is(err, errInvalidMFACode) {
+			t.Fatalf("%s: err = %v, want errInvalidMFACode", st.name, err)
+		}
+		if err != nil && *s.lastStep != before {
+			t.Fatalf("%s: a rejected code moved last_used_step", st.name)
+		}
+	}
+	if want := auth.TOTPStep(later) + 1; *s.lastStep != want {
+		t.Fatalf("last_used_step = %d, want %d", *s.lastStep, want)
+	}
+}
+
+func TestVerifySecondFactorNotEnrolled(t *testing.T) {
+	s := &mfaStore{secret: rfcTestSecret, recovery: map[string]bool{}} // alta pendiente
+	if err := verifySecondFactor(context.Background(), s, "u1", codeAt(t, mfaNow), "", mfaNow); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("pending enrollment = %v, want errInvalidMFACode", err)
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	s, codes := enrolledStore(t)
+
+	// Se aceptan como los escribe la gente: mayúsculas, sin guion, con espacios.
+	if err := verifySecondFactor(ctx, s, "u1", "", " "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" ", mfaNow); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := verifySecondFactor(ctx, s, "u1", "", codes[0], mfaNow); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("second use = %v, want errInvalidMFACode", err)
+	}
+	if err := verifySecondFactor(ctx, s, "u1", "", codes[1], mfaNow); err != nil {
+		t.Fatalf("another code: %v", err)
+	}
+	if err := verifySecondFactor(ctx, s, "u1", "", "zzzzz-zzzzz", mfaNow); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("unknown code = %v, want errInvalidMFACode", err)
+	}
+	// Un recovery code no consume el paso TOTP.
+	if err := verifySecondFactor(ctx, s, "u1", codeAt(t, mfaNow.Add(30*time.Second)), "", mfaNow); err != nil {
+		t.Fatalf("totp after recovery codes: %v", err)
+	}
+
+	// Regenerarlos invalida todos los anteriores, usados o no.
+	fresh, err := replaceRecoveryCodes(ctx, s, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySecondFactor(ctx, s, "u1", "", codes[2], mfaNow); !errors.Is(err, errInvalidMFACode) {
+		t.Fatalf("old code after regenerate = %v, want errInvalidMFACode", err)
+	}
+	if err := verifySecondFactor(ctx, s, "u1", "", fresh[0], mfaNow); err != nil {
+		t.Fatalf("new code: %v", err)
+	}
+}
+
+// TestMFAPostgres repite el anti-replay y el uso único de los recovery codes
+// contra el SQL real de mfa.go. Necesita TEST_DATABASE_URL apuntando a una
+// base con las migraciones aplicadas; todo corre en una transacción que se
+// descarta al final.
+func TestMFAPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	database, err := db.New(dsn, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Pool.Close()
+
+	tx, err := database.Pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var spid, uid string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO service_provider (name, slug)
+		VALUES ('MFA test', 'mfa-test-' || substr(md5(random()::text), 1, 8))
+		RETURNING id
+	`).Scan(&spid)
+	if err == nil {
+		// user_mfa y mfa_recovery_code están bajo RLS: atamos la tx al provider.
+		_, err = tx.Exec(ctx, `SELECT set_config('app.service_provider_id', $1, true)`, spid)
+	}
+	if err == nil {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO "user" (service_provider_id, fullname, email, password, role)
+			VALUES ($1, 'MFA', 'mfa@example.com', 'x', 'admin')
+			RETURNING id
+		`, spid).Scan(&uid)
+	}
+	if err == nil {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO user_mfa (user_id, service_provider_id, totp_secret)
+			VALUES ($1, $2, $3)
+		`, uid, spid, rfcTestSecret)
+	}
+	if err != nil {
+		t.Fatalf("fixtures: %v", err)
+	}
+
+	codes, err := confirmEnrollment(ctx, tx, uid, codeAt(t, mfaNow), mfaNow)
+	if err != nil {
+		t.Fatalf("confirmEnrollment: %v", err)
+	}
+	next := mfaNow.Add(30 * time.Second)
+	checks := []struct {
+		name           string
+		code, recovery string
+		ok             bool
+	}{
+		{"enrollment code replayed", codeAt(t, mfaNow), "", false},
+		{"previous step", codeAt(t, mfaNow.Add(-30*time.Second)), "", false},
+		{"next step", codeAt(t, next), "", true},
+		{"next step replayed", codeAt(t, next), "", false},
+		{"recovery code", "", codes[0], true},
+		{"recovery code reused", "", codes[0], false},
+		{"other recovery code", "", strings.ToUpper(codes[1]), true},
+	}
+	for _, c := range checks {
+		err := verifySecondFactor(ctx, tx, uid, c.code, c.recovery, next)
+		if c.ok != (err == nil) {
+			t.Fatalf("%s: err = %v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+
+	var last int64
+	if err := tx.QueryRow(ctx, `SELECT last_used_step FROM user_mfa WHERE user_id = $1`, uid).Scan(&last); err != nil || last != auth.TOTPStep(next) {
+		t.Fatalf("last_used_step = %d (%v), want %d", last, err, auth.TOTPStep(next))
+	}
+}
@@ -2,36 +2,191 @@ package httpapi
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/jackc/pgx/v5"
 )
 
 type ctxKey string
 
-const claimsKey ctxKey = "claims"
+const (
+	claimsKey ctxKey = "claims"
+	permsKey  ctxKey = "perms"
+)
+
+// Authenticator valida el JWT y, además, confirma contra la DB que la sesión
+// siga viva: logout, usuario desactivado, jti revocado o provider suspendido
+// cortan el acceso en el acto.
+// También acepta "Authorization: ApiKey ..." para integraciones (ver api_keys.go).
+type Authenticator struct {
+	DB   *db.DB
+	Keys *auth.KeySet
+}
 
-func AuthMiddleware(secret []byte, next http.Handler) http.Handler {
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		h := r.Header.Get("Authorization")
-		if !strings.HasPrefix(h, "Bearer ") {
+
+		var claims *auth.Claims
+		var perms authz.Set
+		switch {
+		case strings.HasPrefix(h, "Bearer "):
+			token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+			c, err := auth.ParseToken(a.Keys, token)
+			if err != nil || c.SessionID == "" || c.ID == "" {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			p, err := a.sessionPermissions(r.Context(), c)
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "session revoked", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, errProviderSuspended) {
+				http.Error(w, "service provider suspended", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "could not verify session", http.StatusServiceUnavailable)
+				return
+			}
+			claims, perms = c, p
+
+		case strings.HasPrefix(h, "ApiKey "):
+			key := strings.TrimSpace(strings.TrimPrefix(h, "ApiKey "))
+			c, err := a.apiKeyClaims(r.Context(), key)
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "invalid api key", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, errProviderSuspended) {
+				http.Error(w, "service provider suspended", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "could not verify api key", http.StatusServiceUnavailable)
+				return
+			}
+			claims, perms = c, authz.ForScopes(c.Scopes)
+
+		default:
 			http.Error(w, "missing bearer token", http.StatusUnauthorized)
 			return
 		}
 
-		token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
-		claims, err := auth.ParseToken(secret, token)
+		// Desde acá todas las queries de la request ven solo filas de este
+		// provider (RLS), aunque el handler se olvide del WHERE. No se reserva
+		// una conexión: cada query o transacción toma una del pool y la suelta.
+		ctx, release, err := a.DB.WithTenant(r.Context(), claims.ServiceProvider)
 		if err != nil {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			http.Error(w, "could not bind tenant", http.StatusServiceUnavailable)
 			return
 		}
+		defer release()
 
-		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		ctx = context.WithValue(ctx, claimsKey, claims)
+		ctx = context.WithValue(ctx, permsKey, perms)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// errProviderSuspended: credenciales válidas pero el provider está suspendido.
+var errProviderSuspended = errors.New("service provider suspended")
+
+// apiKeyClaims busca la key por hash (como los tokens de invitación) y arma unos
+// claims con rol "integration". last_used_at se actualiza como mucho una vez por
+// minuto para no escribir en cada request. El provider sale de la key, así que
+// la búsqueda corre como sistema.
+func (a *Authenticator) apiKeyClaims(ctx context.Context, key string) (*auth.Claims, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ctx, release, err := a.DB.WithSystem(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	c := &auth.Claims{Role: auth.RoleIntegration}
+	var suspended bool
+	err = a.DB.QueryRow(ctx, `
+		WITH k AS (
+			SELECT id, service_provider_id, created_by, scopes, last_used_at
+			FROM api_key
+			WHERE key_hash = $1
+			  AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > now())
+		), touch AS (
+			UPDATE api_key
+			SET last_used_at = now()
+			WHERE id IN (
+				SELECT id FROM k
+				WHERE last_used_at IS NULL OR last_used_at < now() - interval '1 minute'
+			)
+		)
+		SELECT k.id, k.service_provider_id, k.created_by, k.scopes, sp.suspended_at IS NOT NULL
+		FROM k
+		JOIN service_provider sp ON sp.id = k.service_provider_id
+	`, hashInviteToken(key)).Scan(&c.APIKeyID, &c.ServiceProvider, &c.UserID, &c.Scopes, &suspended)
+	if err != nil {
+		return nil, err
+	}
+	if suspended {
+		return nil, errProviderSuspended
+	}
+	return c, nil
+}
+
+// sessionPermissions confirma que la sesión sigue viva (pgx.ErrNoRows si no) y
+// devuelve los permisos efectivos: los del rol propio si tiene uno asignado, si
+// no los del rol base, más los de plataforma si es operador. Se resuelven en
+// cada request, así un cambio de permisos aplica sin tener que reloguear.
+// Corre atado al provider del token: una sesión de otro provider no se ve.
+func (a *Authenticator) sessionPermissions(ctx context.Context, claims *auth.Claims) (authz.Set, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	ctx, release, err := a.DB.WithTenant(ctx, claims.ServiceProvider)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var hasCustom, operator, suspended bool
+	var custom []string
+	err = a.DB.QueryRow(ctx, `
+		SELECT
+		  u.custom_role_id IS NOT NULL,
+		  ARRAY(SELECT p.permission FROM provider_role_permission p WHERE p.role_id = u.custom_role_id),
+		  u.is_platform_operator,
+		  sp.suspended_at IS NOT NULL
+		FROM auth_session s
+		JOIN "user" u ON u.id = s.user_id
+		JOIN service_provider sp ON sp.id = u.service_provider_id
+		WHERE s.id = $1
+		  AND s.user_id = $2
+		  AND s.revoked_at IS NULL
+		  AND s.expires_at > now()
+		  AND u.is_active
+		  AND NOT EXISTS (SELECT 1 FROM revoked_access_token WHERE jti = $3)
+	`, claims.SessionID, claims.UserID, claims.ID).Scan(&hasCustom, &custom, &operator, &suspended)
+	if err != nil {
+		return nil, err
+	}
+	if suspended {
+		return nil, errProviderSuspended
+	}
+
+	return authz.ForUser(claims.Role, hasCustom, custom, operator), nil
+}
+
 func ClaimsFromContext(ctx context.Context) *auth.Claims {
 	v := ctx.Value(claimsKey)
 	if v == nil {
@@ -40,3 +195,27 @@ func ClaimsFromContext(ctx context.Context) *auth.Claims {
 	claims, _ := v.(*auth.Claims)
 	return claims
 }
+
+// PermissionsFromContext: permisos efectivos de la request (vacío si no hay).
+func PermissionsFromContext(ctx context.Context) authz.Set {
+	perms, _ := ctx.Value(permsKey).(authz.Set)
+	if perms == nil {
+		return authz.Set{}
+	}
+	return perms
+}
+
+// authorize es el chequeo estándar de los handlers: devuelve los claims si el
+// actor tiene el permiso; si no, responde 401/403 y devuelve nil.
+func authorize(w http.ResponseWriter, r *http.Request, perm authz.Permission) *auth.Claims {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	if !PermissionsFromContext(r.Context()).Has(perm) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil
+	}
+	return claims
+}
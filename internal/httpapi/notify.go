@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+)
+
+// sendMail renderiza la plantilla y la envía. Nunca logueamos el contenido:
+// invitaciones y resets llevan el token en el link.
+func sendMail(ctx context.Context, m mailer.Mailer, t mailer.Template, lang, to string, data any) error {
+	msg, err := mailer.Render(t, lang, to, data)
+	if err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
+
+// sendMailAsync es para notificaciones: el request no espera al SMTP y un fallo solo se loguea.
+func sendMailAsync(m mailer.Mailer, t mailer.Template, lang, to string, data any) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := sendMail(ctx, m, t, lang, to, data); err != nil {
+			log.Printf("[MAIL] %s to=%s failed: %v", t, to, err)
+		}
+	}()
+}
+
+// frontendLink arma {base}{path}?{params} (ej. https://app.tuapp.com/set-password?token=...).
+func frontendLink(base, path string, params url.Values) string {
+	link := strings.TrimRight(base, "/") + path
+	if len(params) > 0 {
+		link += "?" + params.Encode()
+	}
+	return link
+}
@@ -0,0 +1,63 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// pathParts parte "/users/{id}/activate" en ["users", "{id}", "activate"].
+func pathParts(r *http.Request) []string {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// parsePagination lee limit/offset del query string (default 50, máximo 200).
+func parsePagination(q url.Values) (limit, offset int, err error) {
+	limit = defaultPageSize
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+	if v := strings.TrimSpace(q.Get("offset")); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// likePattern escapa los comodines de LIKE y envuelve en %...% para búsquedas "contiene".
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+// parseBool acepta true/false/1/0; vacío => nil (sin filtro).
+func parseBool(s string) (*bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,326 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
+)
+
+// Un link de reset vive poco: si llega a otras manos, la ventana es corta.
+const passwordResetTTL = time.Hour
+
+// resetQueueSize acota los pedidos esperando a RunResets. Con la cola llena se
+// descartan (queda en el log): el cliente recibe la misma respuesta.
+const resetQueueSize = 100
+
+// =========================
+// POST /auth/forgot-password
+// =========================
+
+// forgotPasswordRequest: el provider se indica como en el login (id, slug o
+// ninguno: se busca el email en todos).
+type forgotPasswordRequest struct {
+	ServiceProviderID string `json:"service_provider_id,omitempty"`
+	ServiceProvider   string `json:"service_provider,omitempty"` // slug
+	Email             string `json:"email"`
+}
+
+// Respuesta fija: no debe dejar adivinar si el email existe.
+type forgotPasswordResponse struct {
+	OK bool `json:"ok"`
+}
+
+type resetJob struct {
+	ip  string
+	req loginRequest
+}
+
+func (h *PasswordHandler) queue() chan resetJob {
+	h.resetsOnce.Do(func() { h.resets = make(chan resetJob, resetQueueSize) })
+	return h.resets
+}
+
+func (h *PasswordHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	req.ServiceProviderID = strings.TrimSpace(req.ServiceProviderID)
+	req.ServiceProvider = strings.ToLower(strings.TrimSpace(req.ServiceProvider))
+
+	if req.Email == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+
+	// Cada pedido cuenta (acá no hay "fallos"). Por IP se responde 429; por
+	// email se descarta en silencio: nadie puede llenarle la casilla a otro y
+	// la respuesta no distingue un email de otro.
+	ip := clientIP(r)
+	if wait := countRequest(r.Context(), h.IPLimiter, "reset-ip:"+ip); wait > 0 {
+		writeTooManyRequests(w, wait)
+		return
+	}
+	if wait := countRequest(r.Context(), h.EmailLimiter, "reset:"+req.Email); wait > 0 {
+		log.Printf("[RESET] throttled email=%s", req.Email)
+		WriteJSON(w, http.StatusAccepted, forgotPasswordResponse{OK: true})
+		return
+	}
+
+	// Todo (buscar al usuario, guardar el token, mandar el mail) corre fuera de
+	// la request: si solo trabajáramos cuando el email existe, el tiempo de
+	// respuesta lo delataría. Los fallos se loguean; el cliente recibe lo mismo.
+	job := resetJob{ip: ip, req: loginRequest{
+		ServiceProviderID: req.ServiceProviderID,
+		ServiceProvider:   req.ServiceProvider,
+		Email:             req.Email,
+	}}
+	select {
+	case h.queue() <- job:
+	default:
+		log.Printf("[RESET] queue full, dropping request email=%s", req.Email)
+	}
+
+	WriteJSON(w, http.StatusAccepted, forgotPasswordResponse{OK: true})
+}
+
+// countRequest suma un pedido a key y devuelve cuánto falta si quedó
+// bloqueada. Sin limiter, o si el store falla, deja pasar (como LoginGuard).
+func countRequest(ctx context.Context, l *throttle.Limiter, key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	wait, err := l.Check(ctx, key)
+	if err == nil && wait == 0 {
+		wait, err = l.Fail(ctx, key)
+	}
+	if err != nil {
+		log.Printf("[THROTTLE] %s: %v", key, err)
+	}
+	return wait
+}
+
+// RunResets atiende los pedidos de ForgotPassword de a uno, hasta que ctx se
+// cancele. Sin él corriendo la cola se llena y los pedidos se descartan.
+func (h *PasswordHandler) RunResets(ctx context.Context) {
+	q := h.queue()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-q:
+			jctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := h.startPasswordReset(jctx, job.ip, job.req); err != nil {
+				log.Printf("[RESET] could not start password reset email=%s: %v", job.req.Email, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// startPasswordReset manda un link a cada cuenta activa con ese email en el
+// provider pedido (o en todos, si no se indicó): cada mail dice de qué
+// provider es.
+func (h *PasswordHandler) startPasswordReset(ctx context.Context, ip string, req loginRequest) error {
+	candidates, err := findLoginCandidates(ctx, h.DB, req)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range candidates {
+		// usuario inactivo o provider suspendido: no hay nada que hacer (ni que contar)
+		if !c.IsActive || c.Suspended {
+			continue
+		}
+		if err := h.sendPasswordReset(ctx, ip, c); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", c.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *PasswordHandler) sendPasswordReset(ctx context.Context, ip string, c loginCandidate) error {
+	spid := c.ServiceProvider
+	plain, tokenHash, err := newInviteToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(passwordResetTTL)
+
+	// Flujo público: nos atamos al provider del usuario (RLS).
+	ctx, release, err := h.DB.WithTenant(ctx, spid)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Solo vale el último link pedido
+	_, err = tx.Exec(ctx, `
+		UPDATE password_reset
+		SET used_at = now()
+		WHERE user_id = $1 AND used_at IS NULL
+	`, c.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO password_reset (
+			service_provider_id, user_id,
+			token_hash, expires_at,
+			requested_ip
+		) VALUES ($1, $2, $3, $4, $5)
+	`, spid, c.ID, tokenHash, expiresAt, ip)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	settings := defaultProviderSettings()
+	if s, err := loadProviderSettings(ctx, h.DB, spid); err == nil {
+		settings = s
+	}
+
+	return sendMail(ctx, h.Mailer, mailer.TemplatePasswordReset, settings.Language, c.Email, mailer.PasswordResetData{
+		Fullname:     c.Fullname,
+		ProviderName: c.Provider.Name,
+		Link:         frontendLink(h.FrontendURL, "/reset-password", url.Values{"token": {plain}}),
+		ExpiresAt:    expiresAt.In(settings.Location()),
+	})
+}
+
+// =========================
+// POST /auth/reset-password
+// =========================
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *PasswordHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	req.Password = strings.TrimSpace(req.Password)
+
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) < 6 {
+		http.Error(w, "password too short", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "could not hash password", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// El provider sale del token: corre como sistema y filtra por el token.
+	ctx, release, err := h.DB.WithSystem(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// FOR UPDATE: dos requests con el mismo token no pueden consumirlo a la vez
+	var resetID, userID string
+	err = tx.QueryRow(ctx, `
+		SELECT pr.id, pr.user_id
+		FROM password_reset pr
+		JOIN "user" u ON u.id = pr.user_id
+		WHERE pr.token_hash = $1
+		  AND pr.used_at IS NULL
+		  AND pr.expires_at > now()
+		  AND u.is_active
+		FOR UPDATE OF pr
+	`, hashInviteToken(req.Token)).Scan(&resetID, &userID)
+	if err != nil {
+		http.Error(w, "invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE "user"
+		SET password = $1, updated_at = now()
+		WHERE id = $2
+	`, string(hash), userID)
+	if err != nil {
+		http.Error(w, "could not set password", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_reset
+		SET used_at = now()
+		WHERE id = $1
+	`, resetID)
+	if err != nil {
+		http.Error(w, "could not mark reset used", http.StatusInternalServerError)
+		return
+	}
+
+	// Si alguien robó la password, sus sesiones mueren aquí.
+	if err := revokeUserSessions(ctx, tx, userID, "password_reset"); err != nil {
+		http.Error(w, "could not revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, setPasswordResponse{OK: true})
+}
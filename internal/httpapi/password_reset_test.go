@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
+)
+
+func forgotPassword(h *PasswordHandler, ip, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/auth/forgot-password", strings.NewReader(body))
+	r.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	h.ForgotPassword(w, r)
+	return w
+}
+
+// ForgotPassword no toca la DB: valida, cuenta el pedido y lo encola.
+func TestForgotPasswordQueuesByIDSlugOrEmail(t *testing.T) {
+	h := &PasswordHandler{}
+	for _, c := range []struct {
+		body string
+		want loginRequest
+	}{
+		{`{"service_provider_id":" ` + testSPID + ` ","email":" Ana@Example.com "}`, loginRequest{ServiceProviderID: testSPID, Email: "ana@example.com"}},
+		{`{"service_provider":" Frio-Norte ","email":"ana@example.com"}`, loginRequest{ServiceProvider: "frio-norte", Email: "ana@example.com"}},
+		{`{"email":"ana@example.com"}`, loginRequest{Email: "ana@example.com"}},
+	} {
+		if w := forgotPassword(h, "10.0.0.1", c.body); w.Code != http.StatusAccepted {
+			t.Fatalf("%s: status %d, want 202", c.body, w.Code)
+		}
+		select {
+		case job := <-h.queue():
+			if job.req != c.want || job.ip != "10.0.0.1" {
+				t.Errorf("%s: queued %+v from %s, want %+v", c.body, job.req, job.ip, c.want)
+			}
+		default:
+			t.Fatalf("%s: nothing queued", c.body)
+		}
+	}
+
+	if w := forgotPassword(h, "10.0.0.1", `{"service_provider":"frio-norte"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing email: status %d, want 400", w.Code)
+	}
+}
+
+// Por IP se corta con 429 y Retry-After; por email se responde igual que
+// siempre pero no se encola nada.
+func TestForgotPasswordThrottle(t *testing.T) {
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	store := throttle.NewMemoryStore()
+	policy := throttle.Policy{FreeAttempts: 2, BaseDelay: 10 * time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	h := &PasswordHandler{
+		IPLimiter:    &throttle.Limiter{Store: store, Policy: policy, Now: clock},
+		EmailLimiter: &throttle.Limiter{Store: store, Policy: policy, Now: clock},
+	}
+	drain := func() int {
+		n := 0
+		for {
+			select {
+			case <-h.queue():
+				n++
+			default:
+				return n
+			}
+		}
+	}
+
+	// Mismo email desde IPs distintas: los dos primeros se encolan, el resto no.
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		if w := forgotPassword(h, ip, `{"email":"ana@example.com"}`); w.Code != http.StatusAccepted {
+			t.Fatalf("email request %d: status %d, want 202", i+1, w.Code)
+		}
+	}
+	if n := drain(); n != 2 {
+		t.Errorf("queued %d resets for one email, want 2", n)
+	}
+
+	// Emails distintos desde la misma IP: al pasar el límite, 429.
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w = forgotPassword(h, "10.0.0.9", `{"email":"user`+itoa(i)+`@example.com"}`)
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "600" {
+		t.Fatalf("third request from one IP: status %d, Retry-After %q; want 429, 600", w.Code, w.Header().Get("Retry-After"))
+	}
+	drain()
+
+	// Cada pedido cuenta: terminado el bloqueo, uno más dentro de la ventana
+	// lo duplica. Pasada la ventana sin pedidos, el contador vuelve a cero.
+	now = now.Add(11 * time.Minute)
+	if w := forgotPassword(h, "10.0.0.9", `{"email":"otro@example.com"}`); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1200" {
+		t.Fatalf("after lock: status %d, Retry-After %q; want 429, 1200", w.Code, w.Header().Get("Retry-After"))
+	}
+	now = now.Add(time.Hour + time.Minute)
+	if w := forgotPassword(h, "10.0.0.9", `{"email":"otro@example.com"}`); w.Code != http.StatusAccepted {
+		t.Fatalf("after window: status %d, want 202", w.Code)
+	}
+	if n := drain(); n != 1 {
+		t.Errorf("after window: queued %d, want 1", n)
+	}
+}
+
+// Con la cola llena el pedido se descarta: la request no se bloquea.
+func TestForgotPasswordQueueFull(t *testing.T) {
+	h := &PasswordHandler{}
+	for i := 0; i < resetQueueSize; i++ {
+		h.queue() <- resetJob{}
+	}
+	done := make(chan int, 1)
+	go func() { done <- forgotPassword(h, "10.0.0.1", `{"email":"ana@example.com"}`).Code }()
+	select {
+	case code := <-done:
+		if code != http.StatusAccepted {
+			t.Fatalf("status %d, want 202", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ForgotPassword blocked on a full queue")
+	}
+}
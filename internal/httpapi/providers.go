@@ -0,0 +1,583 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
+	"github.com/jackc/pgx/v5"
+)
+
+// ProvidersHandler: alta de service providers (signup público u operador) y
+// administración de la plataforma (/platform/providers, solo operadores).
+type ProvidersHandler struct {
+	DB          *db.DB
+	Mailer      mailer.Mailer
+	FrontendURL string
+
+	// PublicSignup habilita POST /signup; si no, solo un operador puede dar de alta.
+	PublicSignup bool
+	// SignupLimiter cuenta altas por IP (cada signup suma, no solo los fallidos).
+	SignupLimiter *throttle.Limiter
+}
+
+type providerUsage struct {
+	Users          int `json:"users"`
+	ActiveUsers    int `json:"active_users"`
+	Customers      int `json:"customers"`
+	Assets         int `json:"assets"`
+	WorkOrders     int `json:"work_orders"`
+	OpenWorkOrders int `json:"open_work_orders"`
+}
+
+type providerItem struct {
+	ID              string        `json:"id"`
+	Name            string        `json:"name"`
+	Slug            string        `json:"slug"`
+	Status          string        `json:"status"` // active|suspended
+	SuspendedAt     *time.Time    `json:"suspended_at,omitempty"`
+	SuspendedReason *string       `json:"suspended_reason,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Usage           providerUsage `json:"usage"`
+}
+
+// Los conteos corren como sistema (WithSystem): RLS no filtra, filtramos a mano.
+const providerItemColumns = `
+	sp.id, sp.name, sp.slug,
+	CASE WHEN sp.suspended_at IS NULL THEN 'active' ELSE 'suspended' END,
+	sp.suspended_at, sp.suspended_reason, sp.created_at,
+	(SELECT count(*) FROM "user" u WHERE u.service_provider_id = sp.id),
+	(SELECT count(*) FROM "user" u WHERE u.service_provider_id = sp.id AND u.is_active),
+	(SELECT count(*) FROM customer c WHERE c.service_provider_id = sp.id),
+	(SELECT count(*) FROM asset a WHERE a.service_provider_id = sp.id),
+	(SELECT count(*) FROM work_order wo WHERE wo.service_provider_id = sp.id),
+	(SELECT count(*) FROM work_order wo WHERE wo.service_provider_id = sp.id
+	   AND wo.status NOT IN ('completed', 'cancelled'))`
+
+func scanProviderItem(row pgx.Row) (providerItem, error) {
+	var it providerItem
+	err := row.Scan(
+		&it.ID, &it.Name, &it.Slug, &it.Status,
+		&it.SuspendedAt, &it.SuspendedReason, &it.CreatedAt,
+		&it.Usage.Users, &it.Usage.ActiveUsers, &it.Usage.Customers,
+		&it.Usage.Assets, &it.Usage.WorkOrders, &it.Usage.OpenWorkOrders,
+	)
+	return it, err
+}
+
+// systemCtx: ctx sin RLS para un operador (su request tiene fijado su propio provider).
+func (h *ProvidersHandler) systemCtx(ctx context.Context) (context.Context, func(), error) {
+	return h.DB.WithSystem(db.Detach(ctx))
+}
+
+// =========================
+// Alta de provider + admin
+// =========================
+
+// slugRe es el mismo CHECK que service_provider.slug (migración 000008).
+var slugRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var slugAccents = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// slugify: "Frío Norte S.A." -> "frio-norte-s-a" (igual que el backfill de 000008).
+func slugify(name string) string {
+	s := slugAccents.Replace(strings.ToLower(name))
+
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	out := strings.Trim(b.String(), "-")
+	if len(out) > 50 {
+		out = strings.Trim(out[:50], "-")
+	}
+	if out == "" {
+		out = "provider"
+	}
+	return out
+}
+
+type signupRequest struct {
+	CompanyName   string `json:"company_name"`
+	Slug          string `json:"slug,omitempty"` // opcional: si no, se genera del nombre
+	AdminFullname string `json:"admin_fullname"`
+	AdminEmail    string `json:"admin_email"`
+}
+
+type signupResponse struct {
+	Provider    providerItem `json:"provider"`
+	AdminUserID string       `json:"admin_user_id"`
+	InviteSent  bool         `json:"invite_sent"`
+	InviteToken *string      `json:"invite_token,omitempty"`
+}
+
+var errSlugTaken = errors.New("slug already taken")
+
+func (req *signupRequest) normalize() error {
+	req.CompanyName = strings.TrimSpace(req.CompanyName)
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	req.AdminFullname = strings.TrimSpace(req.AdminFullname)
+	req.AdminEmail = strings.ToLower(strings.TrimSpace(req.AdminEmail))
+
+	switch {
+	case req.CompanyName == "" || req.AdminFullname == "" || req.AdminEmail == "":
+		return errors.New("company_name, admin_fullname and admin_email are required")
+	case len(req.CompanyName) > 100:
+		return errors.New("company_name too long (max 100)")
+	case len(req.AdminFullname) > 70:
+		return errors.New("admin_fullname too long (max 70)")
+	case len(req.AdminEmail) > 100 || !strings.Contains(req.AdminEmail, "@"):
+		return errors.New("invalid admin_email")
+	case req.Slug != "" && (len(req.Slug) > 63 || !slugRe.MatchString(req.Slug)):
+		return errors.New("invalid slug (lowercase letters, digits and dashes)")
+	}
+	return nil
+}
+
+// insertProvider crea el provider. Con slug explícito un duplicado es error;
+// con slug generado se reintenta con un sufijo al azar.
+func insertProvider(ctx context.Context, q dbtx, name, slug string) (string, error) {
+	explicit := slug != ""
+	if !explicit {
+		slug = slugify(name)
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		candidate := slug
+		if attempt > 0 {
+			b := make([]byte, 2)
+			if _, err := rand.Read(b); err != nil {
+				return "", err
+			}
+			candidate = slug + "-" + hex.EncodeToString(b)
+		}
+
+		var id string
+		err := q.QueryRow(ctx, `
+			INSERT INTO service_provider (name, slug)
+			VALUES ($1, $2)
+			ON CONFLICT (slug) DO NOTHING
+			RETURNING id
+		`, name, candidate).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return "", err
+		}
+		if explicit {
+			return "", errSlugTaken
+		}
+	}
+	return "", errSlugTaken
+}
+
+// createProvider da de alta provider + admin (con password placeholder) +
+// invitación, y manda el link de activación. Lo usan /signup y el operador.
+// El token solo vuelve en la respuesta si operator (y fuera de producción):
+// en /signup cualquiera podría activar una cuenta con un email ajeno.
+func (h *ProvidersHandler) createProvider(w http.ResponseWriter, r *http.Request, req signupRequest, operator bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Todavía no hay tenant: corre como sistema y cada query va por id.
+	ctx, release, err := h.systemCtx(ctx)
+	if err != nil {
+		http.Error(w, "db unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	spid, err := insertProvider(ctx, tx, req.CompanyName, req.Slug)
+	if errors.Is(err, errSlugTaken) {
+		http.Error(w, "slug already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not create provider", http.StatusInternalServerError)
+		return
+	}
+
+	var adminID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO "user" (service_provider_id, fullname, email, password, role, is_active)
+		VALUES ($1, $2, $3, $4, 'admin', true)
+		RETURNING id
+	`, spid, req.AdminFullname, req.AdminEmail, invitedPasswordPlaceholder).Scan(&adminID)
+	if err != nil {
+		http.Error(w, "could not create admin user", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO provider_settings (service_provider_id) VALUES ($1)`, spid)
+	if err != nil {
+		http.Error(w, "could not create provider settings", http.StatusInternalServerError)
+		return
+	}
+
+	// El admin se invita a sí mismo: no hay nadie más en el provider.
+	_, plain, expiresAt, err := createInvitation(ctx, tx, spid, adminID, adminID)
+	if err != nil {
+		http.Error(w, "could not save invitation", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	err = sendInvite(ctx, h.DB, h.Mailer, h.FrontendURL, spid, req.AdminEmail, req.AdminFullname, plain, expiresAt)
+	if err != nil {
+		log.Printf("[SIGNUP] could not send activation provider=%s user=%s: %v", spid, adminID, err)
+	}
+
+	it, scanErr := scanProviderItem(h.DB.QueryRow(ctx, `
+		SELECT `+providerItemColumns+` FROM service_provider sp WHERE sp.id = $1
+	`, spid))
+	if scanErr != nil {
+		http.Error(w, "could not load provider", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[SIGNUP] provider=%s slug=%s admin=%s", spid, it.Slug, adminID)
+	resp := signupResponse{
+		Provider:    it,
+		AdminUserID: adminID,
+		InviteSent:  err == nil,
+	}
+	if operator {
+		resp.InviteToken = exposeInviteToken(plain)
+	}
+	WriteJSON(w, http.StatusCreated, resp)
+}
+
+// =========================
+// POST /signup (público, si está habilitado)
+// =========================
+
+func (h *ProvidersHandler) Signup(w http.ResponseWriter, r *http.Request) {
+	if !h.PublicSignup {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req signupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := req.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Throttle por IP: cada alta cuenta (un bot no "falla", crea providers).
+	if h.SignupLimiter != nil {
+		key := "signup:" + clientIP(r)
+		wait, err := h.SignupLimiter.Check(r.Context(), key)
+		if err == nil && wait == 0 {
+			wait, err = h.SignupLimiter.Fail(r.Context(), key)
+		}
+		if err != nil {
+			log.Printf("[SIGNUP] throttle store error: %v", err)
+		}
+		if wait > 0 {
+			writeTooManyRequests(w, wait)
+			return
+		}
+	}
+
+	h.createProvider(w, r, req, false)
+}
+
+// =========================
+// GET  /platform/providers
+// POST /platform/providers
+// =========================
+
+func (h *ProvidersHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		if authorize(w, r, authz.PlatformTenantManage) == nil {
+			return
+		}
+		var req signupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if err := req.normalize(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.createProvider(w, r, req, true)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *ProvidersHandler) list(w http.ResponseWriter, r *http.Request) {
+	if authorize(w, r, authz.PlatformTenantRead) == nil {
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var args []any
+	where := `WHERE true`
+	switch strings.TrimSpace(q.Get("status")) {
+	case "":
+	case "active":
+		where += ` AND sp.suspended_at IS NULL`
+	case "suspended":
+		where += ` AND sp.suspended_at IS NOT NULL`
+	default:
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		args = append(args, likePattern(search))
+		where += ` AND (sp.name ILIKE $1 OR sp.slug ILIKE $1)`
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	ctx, release, err := h.systemCtx(ctx)
+	if err != nil {
+		http.Error(w, "db unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+providerItemColumns+`
+		FROM service_provider sp
+		`+where+`
+		ORDER BY sp.name ASC, sp.id ASC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list providers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]providerItem, 0, limit)
+	for rows.Next() {
+		it, err := scanProviderItem(rows)
+		if err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// =========================
+// GET  /platform/providers/{id}
+// POST /platform/providers/{id}/suspend | /platform/providers/{id}/reactivate
+// =========================
+
+type suspendProviderRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (h *ProvidersHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "platform" || parts[1] != "providers" {
+		http.NotFound(w, r)
+		return
+	}
+	spid := strings.TrimSpace(parts[2])
+
+	if len(parts) == 3 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.get(w, r, spid)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch parts[3] {
+	case "suspend":
+		h.suspend(w, r, spid)
+	case "reactivate":
+		h.reactivate(w, r, spid)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *ProvidersHandler) get(w http.ResponseWriter, r *http.Request, spid string) {
+	if authorize(w, r, authz.PlatformTenantRead) == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	ctx, release, err := h.systemCtx(ctx)
+	if err != nil {
+		http.Error(w, "db unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	it, err := scanProviderItem(h.DB.QueryRow(ctx, `
+		SELECT `+providerItemColumns+` FROM service_provider sp WHERE sp.id::text = $1
+	`, spid))
+	if err != nil {
+		http.Error(w, "provider not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// suspend bloquea todos los accesos del provider (ver Authenticator, Login y
+// Refresh). Las sesiones y API keys no se revocan: al reactivar vuelven a servir.
+func (h *ProvidersHandler) suspend(w http.ResponseWriter, r *http.Request, spid string) {
+	claims := authorize(w, r, authz.PlatformTenantManage)
+	if claims == nil {
+		return
+	}
+	if spid == claims.ServiceProvider {
+		http.Error(w, "cannot suspend your own provider", http.StatusConflict)
+		return
+	}
+
+	var req suspendProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 255 {
+		http.Error(w, "reason is required (max 255)", http.StatusBadRequest)
+		return
+	}
+
+	ok := h.setSuspended(w, r, spid, `
+		UPDATE service_provider
+		SET suspended_at = COALESCE(suspended_at, now()),
+		    suspended_reason = $2,
+		    suspended_by = $3,
+		    updated_at = now()
+		WHERE id::text = $1
+	`, spid, req.Reason, claims.UserID)
+	if ok {
+		log.Printf("[PLATFORM] provider=%s suspended by=%s", spid, claims.UserID)
+	}
+}
+
+func (h *ProvidersHandler) reactivate(w http.ResponseWriter, r *http.Request, spid string) {
+	claims := authorize(w, r, authz.PlatformTenantManage)
+	if claims == nil {
+		return
+	}
+
+	ok := h.setSuspended(w, r, spid, `
+		UPDATE service_provider
+		SET suspended_at = NULL,
+		    suspended_reason = NULL,
+		    suspended_by = NULL,
+		    updated_at = now()
+		WHERE id::text = $1
+	`, spid)
+	if ok {
+		log.Printf("[PLATFORM] provider=%s reactivated by=%s", spid, claims.UserID)
+	}
+}
+
+// setSuspended aplica el UPDATE y responde con el provider; false si respondió un error.
+func (h *ProvidersHandler) setSuspended(w http.ResponseWriter, r *http.Request, spid, update string, args ...any) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	ctx, release, err := h.systemCtx(ctx)
+	if err != nil {
+		http.Error(w, "db unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	defer release()
+
+	tag, err := h.DB.Exec(ctx, update, args...)
+	if err != nil {
+		http.Error(w, "could not update provider", http.StatusInternalServerError)
+		return false
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "provider not found", http.StatusNotFound)
+		return false
+	}
+
+	it, err := scanProviderItem(h.DB.QueryRow(ctx, `
+		SELECT `+providerItemColumns+` FROM service_provider sp WHERE sp.id::text = $1
+	`, spid))
+	if err != nil {
+		http.Error(w, "could not load provider", http.StatusInternalServerError)
+		return true
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+	return true
+}
@@ -1,20 +1,29 @@
 package httpapi
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
 	"github.com/phpdave11/gofpdf"
 )
 
 type ReportsHandler struct {
-	DB *pgxpool.Pool
+	DB      *db.DB
+	Storage storage.Storage // nil => sin fotos en el reporte
 }
 
+// maxReportPhotos: miniaturas por orden en el reporte mensual.
+const maxReportPhotos = 4
+
 type reportRow struct {
 	CompletedAt time.Time
 	WorkOrderID string
@@ -24,6 +33,18 @@ type reportRow struct {
 	Type        string
 	Priority    string
 	Title       string
+	Photos      []string // keys de las miniaturas
+}
+
+// monthRange devuelve [start, end) del mes YYYY-MM, de medianoche a
+// medianoche en loc. No son 30/31 × 24h: un mes con cambio de horario dura
+// una hora más o menos.
+func monthRange(month string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", month, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
 }
 
 func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
@@ -45,36 +66,46 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	monthStart, err := time.Parse("2006-01", monthStr)
-	if err != nil {
+	if _, _, err := monthRange(monthStr, time.UTC); err != nil {
 		http.Error(w, "invalid month format, expected YYYY-MM", http.StatusBadRequest)
 		return
 	}
-	start := monthStart
-	end := monthStart.AddDate(0, 1, 0)
 
-	// customer_id según rol
+	// customer_id según permisos
 	var customerID string
-	if claims.Role == "client" {
-		if claims.CustomerID == nil {
-			http.Error(w, "client has no customer_id", http.StatusForbidden)
-			return
-		}
-		customerID = *claims.CustomerID
-	} else if claims.Role == "admin" || claims.Role == "dispatcher" {
+	perms := PermissionsFromContext(r.Context())
+	if perms.Has(authz.ReportMonthlyRead) {
 		customerID = strings.TrimSpace(r.URL.Query().Get("customer_id"))
 		if customerID == "" {
 			http.Error(w, "customer_id is required for admin/dispatcher", http.StatusBadRequest)
 			return
 		}
+	} else if perms.Has(authz.ReportMonthlyReadOwn) {
+		if claims.CustomerID == nil {
+			http.Error(w, "client has no customer_id", http.StatusForbidden)
+			return
+		}
+		customerID = *claims.CustomerID
 	} else {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
 	defer cancel()
 
+	settings, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not load settings", http.StatusInternalServerError)
+		return
+	}
+	loc := settings.Location()
+	text := reportTextFor(settings.Language)
+
+	// El mes va de medianoche a medianoche en la zona del provider: una orden
+	// cerrada el 31 a las 22:00 en Bogotá es de ese mes aunque en UTC ya sea el 1.
+	start, end, _ := monthRange(monthStr, loc)
+
 	// Encabezados
 	var providerName, customerName string
 	err = h.DB.QueryRow(ctx, `
@@ -149,11 +180,17 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	thumbs, err := h.loadReportPhotos(ctx, items)
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+
 	// =========================
 	// Generar PDF
 	// =========================
 	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.SetTitle("Monthly Maintenance Report", false)
+	pdf.SetTitle(text.Title, true)
 
 	// Márgenes + salto de página manual
 	pdf.SetMargins(10, 12, 10)
@@ -164,7 +201,7 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 	pdf.AddUTF8Font("Body", "B", "internal/assets/fonts/AndaleMono.ttf")
 
 	// Footer + total pages (solo 1 vez)
-	addReportFooter(pdf)
+	addReportFooter(pdf, text)
 	pdf.AliasNbPages("")
 
 	pdf.AddPage()
@@ -172,27 +209,37 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 	// =========================
 	// Encabezado del reporte
 	// =========================
+	brand, hasBrand := parseHexColor(settings.PrimaryColor)
+	if settings.HasLogo {
+		addReportLogo(ctx, pdf, h.DB, claims.ServiceProvider)
+	}
+
 	pdf.SetFont("Body", "B", 16)
-	pdf.Cell(0, 10, "Monthly Maintenance Report")
+	if hasBrand {
+		pdf.SetTextColor(brand[0], brand[1], brand[2])
+	}
+	pdf.Cell(0, 10, text.Title)
+	pdf.SetTextColor(0, 0, 0)
 	pdf.Ln(8)
 
 	pdf.SetFont("Body", "", 11)
-	pdf.Cell(0, 7, fmt.Sprintf("Service Provider: %s", providerName))
+	pdf.Cell(0, 7, fmt.Sprintf("%s: %s", text.Provider, providerName))
 	pdf.Ln(6)
-	pdf.Cell(0, 7, fmt.Sprintf("Customer: %s", customerName))
+	pdf.Cell(0, 7, fmt.Sprintf("%s: %s", text.Customer, customerName))
 	pdf.Ln(6)
-	pdf.Cell(0, 7, fmt.Sprintf("Period: %s", monthStr))
+	pdf.Cell(0, 7, fmt.Sprintf("%s: %s (%s)", text.Period, monthStr, loc.String()))
 	pdf.Ln(8)
 
 	pdf.SetFont("Body", "B", 11)
-	pdf.Cell(0, 7, fmt.Sprintf("Completed Work Orders: %d", len(items)))
+	pdf.Cell(0, 7, fmt.Sprintf("%s: %d", text.Completed, len(items)))
 	pdf.Ln(10)
 
 	// =========================
 	// Tabla
 	// =========================
 	colW := []float64{22, 28, 30, 40, 70} // date, type, priority, asset, title
-	addTableHeader(pdf, colW)
+	tableHeader := func() { addTableHeader(pdf, colW, text, brand, hasBrand) }
+	tableHeader()
 
 	pdf.SetFont("Body", "", 9)
 
@@ -202,7 +249,7 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 	padBottom := 2.0
 
 	for _, it := range items {
-		dateStr := it.CompletedAt.Format("2006-01-02")
+		dateStr := it.CompletedAt.In(loc).Format(text.DateLayout)
 
 		assetStr := it.AssetTag
 		if it.AssetName != "" {
@@ -222,8 +269,20 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 
 		rowH := padTop + float64(maxLines)*lineH + padBottom
 
+		// fotos de la orden: una franja de miniaturas debajo de la fila
+		photos := make([]string, 0, len(it.Photos))
+		for _, k := range it.Photos {
+			if _, ok := thumbs[k]; ok {
+				photos = append(photos, k)
+			}
+		}
+		photosH := 0.0
+		if len(photos) > 0 {
+			photosH = photoStripH + 2*padTop
+		}
+
 		// ✅ si no cabe, agrega página y vuelve a imprimir header
-		ensureSpace(pdf, rowH, colW)
+		ensureSpace(pdf, rowH+photosH, tableHeader)
 
 		x0 := pdf.GetX()
 		y := pdf.GetY()
@@ -236,12 +295,12 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 
 		// Type
 		pdf.Rect(x, y, colW[1], rowH, "")
-		pdf.Text(x+padX, y+padTop+lineH, it.Type)
+		pdf.Text(x+padX, y+padTop+lineH, text.value(it.Type))
 		x += colW[1]
 
 		// Priority
 		pdf.Rect(x, y, colW[2], rowH, "")
-		pdf.Text(x+padX, y+padTop+lineH, it.Priority)
+		pdf.Text(x+padX, y+padTop+lineH, text.value(it.Priority))
 		x += colW[2]
 
 		// Asset (wrap)
@@ -259,6 +318,16 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 
 		// siguiente fila
 		pdf.SetXY(x0, y+rowH)
+
+		if len(photos) > 0 {
+			tableW := colW[0] + colW[1] + colW[2] + colW[3] + colW[4]
+			pdf.Rect(x0, y+rowH, tableW, photosH, "")
+			px := x0 + padX
+			for _, k := range photos {
+				px += addThumbnail(pdf, k, thumbs[k], px, y+rowH+padTop, photoStripH) + padX
+			}
+			pdf.SetXY(x0, y+rowH+photosH)
+		}
 	}
 
 	// Output
@@ -268,6 +337,56 @@ func (h *ReportsHandler) Monthly(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// photoStripH: alto de las miniaturas debajo de cada orden (mm).
+const photoStripH = 24.0
+
+// loadReportPhotos completa las fotos procesadas de cada orden (las primeras
+// maxReportPhotos) y trae sus miniaturas.
+func (h *ReportsHandler) loadReportPhotos(ctx context.Context, items []reportRow) (map[string][]byte, error) {
+	if h.Storage == nil || len(items) == 0 {
+		return map[string][]byte{}, nil
+	}
+	idx := make(map[string]int, len(items))
+	ids := make([]string, len(items))
+	for i, it := range items {
+		idx[it.WorkOrderID] = i
+		ids[i] = it.WorkOrderID
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT work_order_id::text, thumb_key
+		FROM (
+			SELECT f.work_order_id, f.thumb_key,
+			       row_number() OVER (PARTITION BY f.work_order_id ORDER BY f.created_at, f.id) AS n
+			FROM work_order_attachment f
+			WHERE f.work_order_id::text = ANY($1) AND f.thumb_key IS NOT NULL
+		) p
+		WHERE n <= $2
+		ORDER BY work_order_id, n
+	`, ids, maxReportPhotos)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0, len(items))
+	for rows.Next() {
+		var woID, key string
+		if err := rows.Scan(&woID, &key); err != nil {
+			return nil, err
+		}
+		if i, ok := idx[woID]; ok {
+			items[i].Photos = append(items[i].Photos, key)
+			keys = append(keys, key)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return loadThumbnails(ctx, h.Storage, keys), nil
+}
+
 func truncate(s string, max int) string {
 	s = strings.TrimSpace(s)
 	if max <= 0 || len(s) <= max {
@@ -352,31 +471,133 @@ func fitWithEllipsis(pdf *gofpdf.Fpdf, s string, w float64) string {
 	return ellipsis
 }
 
-func addReportFooter(pdf *gofpdf.Fpdf) {
+func addReportFooter(pdf *gofpdf.Fpdf, text reportText) {
 	pdf.SetFooterFunc(func() {
 		pdf.SetY(-12)
 		pdf.SetFont("Body", "", 8)
-		pdf.CellFormat(0, 10, fmt.Sprintf("Page %d/{nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+		pdf.CellFormat(0, 10, fmt.Sprintf("%s %d/{nb}", text.Page, pdf.PageNo()), "", 0, "C", false, 0, "")
 	})
 }
 
-func addTableHeader(pdf *gofpdf.Fpdf, colW []float64) {
+// addTableHeader: con color de marca, el header va relleno con ese color y texto blanco.
+func addTableHeader(pdf *gofpdf.Fpdf, colW []float64, text reportText, brand [3]int, hasBrand bool) {
 	pdf.SetFont("Body", "B", 9)
-	headers := []string{"Date", "Type", "Priority", "Asset", "Title"}
-	for i, h := range headers {
-		pdf.CellFormat(colW[i], 7, h, "1", 0, "LM", false, 0, "")
+	if hasBrand {
+		pdf.SetFillColor(brand[0], brand[1], brand[2])
+		pdf.SetTextColor(255, 255, 255)
+	}
+	for i, h := range text.Headers {
+		pdf.CellFormat(colW[i], 7, h, "1", 0, "LM", hasBrand, 0, "")
 	}
+	pdf.SetTextColor(0, 0, 0)
 	pdf.Ln(-1)
 	pdf.SetFont("Body", "", 9)
 }
 
-func ensureSpace(pdf *gofpdf.Fpdf, needed float64, colW []float64) {
+func ensureSpace(pdf *gofpdf.Fpdf, needed float64, header func()) {
 	_, pageH := pdf.GetPageSize()
 	_, _, _, bm := pdf.GetMargins()
 
 	// Si la fila no cabe, nueva página + header tabla
 	if pdf.GetY()+needed > pageH-bm {
 		pdf.AddPage()
-		addTableHeader(pdf, colW)
+		header()
+	}
+}
+
+// addReportLogo pone el logo del provider arriba a la derecha (30mm de ancho).
+// Es decorativo: si no se puede leer o no es una imagen válida, el reporte sale sin logo.
+func addReportLogo(ctx context.Context, pdf *gofpdf.Fpdf, q dbtx, spid string) {
+	logo, contentType, err := loadProviderLogo(ctx, q, spid)
+	if err != nil {
+		return
+	}
+
+	imageType := "PNG"
+	if contentType == "image/jpeg" {
+		imageType = "JPG"
+	}
+	opts := gofpdf.ImageOptions{ImageType: imageType}
+	pdf.RegisterImageOptionsReader("logo", opts, bytes.NewReader(logo))
+	if !pdf.Ok() {
+		pdf.ClearError()
+		return
+	}
+
+	pageW, _ := pdf.GetPageSize()
+	_, top, right, _ := pdf.GetMargins()
+	pdf.ImageOptions("logo", pageW-right-30, top, 30, 0, false, opts, 0, "")
+}
+
+// parseHexColor: "#rrggbb" => RGB. false si no hay color (o no es válido).
+func parseHexColor(c *string) ([3]int, bool) {
+	var rgb [3]int
+	if c == nil || len(*c) != 7 || (*c)[0] != '#' {
+		return rgb, false
+	}
+	for i := 0; i < 3; i++ {
+		v, err := strconv.ParseUint((*c)[1+2*i:3+2*i], 16, 8)
+		if err != nil {
+			return rgb, false
+		}
+		rgb[i] = int(v)
+	}
+	return rgb, true
+}
+
+// =========================
+// Textos del reporte por idioma (provider_settings.language)
+// =========================
+
+type reportText struct {
+	Title, Provider, Customer, Period, Completed, Page string
+	Headers                                            []string // date, type, priority, asset, title
+	DateLayout                                         string
+	Values                                             map[string]string // tipos y prioridades
+}
+
+func (t reportText) value(v string) string {
+	if s, ok := t.Values[v]; ok {
+		return s
+	}
+	return v
+}
+
+var reportTexts = map[string]reportText{
+	"en": {
+		Title:      "Monthly Maintenance Report",
+		Provider:   "Service Provider",
+		Customer:   "Customer",
+		Period:     "Period",
+		Completed:  "Completed Work Orders",
+		Page:       "Page",
+		Headers:    []string{"Date", "Type", "Priority", "Asset", "Title"},
+		DateLayout: "2006-01-02",
+	},
+	"es": {
+		Title:      "Reporte mensual de mantenimiento",
+		Provider:   "Proveedor",
+		Customer:   "Cliente",
+		Period:     "Período",
+		Completed:  "Órdenes completadas",
+		Page:       "Página",
+		Headers:    []string{"Fecha", "Tipo", "Prioridad", "Equipo", "Título"},
+		DateLayout: "02/01/2006",
+		Values: map[string]string{
+			"preventive": "preventivo",
+			"corrective": "correctivo",
+			"inspection": "inspección",
+			"low":        "baja",
+			"medium":     "media",
+			"high":       "alta",
+			"critical":   "crítica",
+		},
+	},
+}
+
+func reportTextFor(lang string) reportText {
+	if t, ok := reportTexts[mailer.NormalizeLang(lang)]; ok {
+		return t
 	}
+	return reportTexts["en"]
 }
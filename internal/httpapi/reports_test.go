@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // como en main: no depender del tzdata de la máquina
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// Una orden es del mes en que se completó según el reloj del provider, no UTC.
+func TestMonthRangeBoundaries(t *testing.T) {
+	bogota := mustLoad(t, "America/Bogota")
+	newYork := mustLoad(t, "America/New_York")
+	madrid := mustLoad(t, "Europe/Madrid")
+
+	for _, c := range []struct {
+		name        string
+		loc         *time.Location
+		completedAt time.Time
+		month       string // el mes que la incluye
+		day         string // la fecha que imprime el reporte
+	}{
+		// 22:00 del 31 en Bogotá son las 03:00 del 1 en UTC.
+		{"bogota end of month", bogota, time.Date(2025, 1, 31, 22, 0, 0, 0, bogota), "2025-01", "2025-01-31"},
+		{"bogota start of month", bogota, time.Date(2025, 2, 1, 0, 0, 0, 0, bogota), "2025-02", "2025-02-01"},
+		{"bogota new year", bogota, time.Date(2025, 1, 1, 4, 59, 0, 0, time.UTC), "2024-12", "2024-12-31"},
+		// Marzo en Nueva York arranca en EST y termina en EDT.
+		{"new york last minute of march", newYork, time.Date(2025, 3, 31, 23, 59, 0, 0, newYork), "2025-03", "2025-03-31"},
+		{"new york first of april", newYork, time.Date(2025, 4, 1, 0, 0, 0, 0, newYork), "2025-04", "2025-04-01"},
+		{"new york first of march", newYork, time.Date(2025, 3, 1, 4, 30, 0, 0, time.UTC), "2025-02", "2025-02-28"},
+		// Octubre en Madrid arranca en CEST y termina en CET.
+		{"madrid end of october", madrid, time.Date(2025, 10, 31, 23, 30, 0, 0, madrid), "2025-10", "2025-10-31"},
+		{"madrid first of november", madrid, time.Date(2025, 11, 1, 0, 0, 0, 0, madrid), "2025-11", "2025-11-01"},
+	} {
+		start, end, err := monthRange(c.month, c.loc)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if c.completedAt.Before(start) || !c.completedAt.Before(end) {
+			t.Errorf("%s: %s not in [%s, %s)", c.name, c.completedAt.UTC(), start.UTC(), end.UTC())
+		}
+		// ...y no en el mes vecino.
+		for _, other := range []time.Time{start.AddDate(0, -1, 0), end} {
+			ms, me, _ := monthRange(other.Format("2006-01"), c.loc)
+			if !c.completedAt.Before(ms) && c.completedAt.Before(me) {
+				t.Errorf("%s: also in %s", c.name, other.Format("2006-01"))
+			}
+		}
+		if got := c.completedAt.In(c.loc).Format("2006-01-02"); got != c.day {
+			t.Errorf("%s: printed as %s, want %s", c.name, got, c.day)
+		}
+	}
+}
+
+// Los meses con cambio de horario no duran días × 24h.
+func TestMonthRangeDST(t *testing.T) {
+	for _, c := range []struct {
+		zone, month string
+		want        time.Duration
+	}{
+		{"America/New_York", "2025-03", 31*24*time.Hour - time.Hour},
+		{"America/New_York", "2025-11", 30*24*time.Hour + time.Hour},
+		{"Europe/Madrid", "2025-10", 31*24*time.Hour + time.Hour},
+		{"America/Bogota", "2025-03", 31 * 24 * time.Hour},
+	} {
+		loc := mustLoad(t, c.zone)
+		start, end, err := monthRange(c.month, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := end.Sub(start); got != c.want {
+			t.Errorf("%s %s: %v long, want %v", c.zone, c.month, got, c.want)
+		}
+		if h, m, _ := start.In(loc).Clock(); h != 0 || m != 0 || start.In(loc).Day() != 1 {
+			t.Errorf("%s %s: starts at %s", c.zone, c.month, start.In(loc))
+		}
+	}
+
+	for _, bad := range []string{"", "2025-13", "2025-1", "2025-01-01"} {
+		if _, _, err := monthRange(bad, time.UTC); err == nil {
+			t.Errorf("monthRange(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type RolesHandler struct {
+	DB *db.DB
+}
+
+type roleItem struct {
+	ID          string             `json:"id"` // en los roles base es el nombre del rol
+	Name        string             `json:"name"`
+	Description *string            `json:"description,omitempty"`
+	BaseRole    string             `json:"base_role"`
+	Builtin     bool               `json:"builtin"`
+	Permissions []authz.Permission `json:"permissions"`
+	Users       *int               `json:"users,omitempty"` // usuarios asignados (solo roles propios)
+	CreatedAt   *time.Time         `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time         `json:"updated_at,omitempty"`
+}
+
+const roleItemColumns = `
+	r.id, r.name, r.description, r.base_role,
+	ARRAY(SELECT p.permission FROM provider_role_permission p WHERE p.role_id = r.id ORDER BY p.permission),
+	(SELECT count(*) FROM "user" u WHERE u.custom_role_id = r.id),
+	r.created_at, r.updated_at`
+
+func scanRoleItem(row pgx.Row) (roleItem, error) {
+	var it roleItem
+	var perms []string
+	it.Users = new(int)
+	err := row.Scan(
+		&it.ID, &it.Name, &it.Description, &it.BaseRole,
+		&perms, it.Users,
+		&it.CreatedAt, &it.UpdatedAt,
+	)
+	it.Permissions = authz.FromStrings(perms).List()
+	return it, err
+}
+
+// validBaseRole: los mismos roles que se pueden invitar (admin no).
+func validBaseRole(role string) bool {
+	return role == "dispatcher" || role == "technician" || role == "client"
+}
+
+// checkAssignableRole valida que el rol propio exista en el provider, extienda el
+// rol base del usuario y no dé más permisos de los que tiene quien lo asigna.
+func checkAssignableRole(ctx context.Context, q dbtx, actor authz.Set, spid, roleID, userRole string) (int, error) {
+	it, err := scanRoleItem(q.QueryRow(ctx, `
+		SELECT `+roleItemColumns+`
+		FROM provider_role r
+		WHERE r.id::text = $1 AND r.service_provider_id = $2
+	`, roleID, spid))
+	if err != nil {
+		return http.StatusBadRequest, errors.New("invalid custom_role_id for this provider")
+	}
+	if it.BaseRole != userRole {
+		return http.StatusBadRequest, errors.New("custom role base_role does not match user role")
+	}
+	if !actor.Covers(authz.NewSet(it.Permissions...)) {
+		return http.StatusForbidden, errors.New("cannot assign a role with permissions you do not have")
+	}
+	return 0, nil
+}
+
+// =========================
+// GET /permissions
+// =========================
+
+type permissionsResponse struct {
+	Permissions []authz.Permission `json:"permissions"` // catálogo completo
+	Granted     []authz.Permission `json:"granted"`     // los de quien pregunta
+}
+
+func Permissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, permissionsResponse{
+		Permissions: authz.All,
+		Granted:     PermissionsFromContext(r.Context()).List(),
+	})
+}
+
+// =========================
+// GET  /roles
+// POST /roles
+// =========================
+
+func (h *RolesHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *RolesHandler) list(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// quien asigna roles (user.update) también necesita verlos
+	if !PermissionsFromContext(r.Context()).HasAny(authz.RoleManage, authz.UserUpdate) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	out := make([]roleItem, 0, len(authz.BuiltinRoles))
+	for _, role := range authz.BuiltinRoles {
+		out = append(out, roleItem{
+			ID:          role,
+			Name:        role,
+			BaseRole:    role,
+			Builtin:     true,
+			Permissions: authz.ForRole(role).List(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+roleItemColumns+`
+		FROM provider_role r
+		WHERE r.service_provider_id = $1
+		ORDER BY r.name
+	`, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not list roles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		it, err := scanRoleItem(rows)
+		if err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+type roleRequest struct {
+	Name        *string            `json:"name,omitempty"`
+	Description *string            `json:"description,omitempty"`
+	BaseRole    string             `json:"base_role,omitempty"` // solo al crear
+	Permissions []authz.Permission `json:"permissions"`
+}
+
+// validatePermissions: todos existen y el actor los tiene (no hay escalada).
+func validatePermissions(actor authz.Set, perms []authz.Permission) (authz.Set, int, error) {
+	set := authz.Set{}
+	for _, p := range perms {
+		if !authz.Valid(p) {
+			return nil, http.StatusBadRequest, errors.New("invalid permission: " + string(p))
+		}
+		set[p] = struct{}{}
+	}
+	if !actor.Covers(set) {
+		return nil, http.StatusForbidden, errors.New("cannot grant permissions you do not have")
+	}
+	return set, 0, nil
+}
+
+func (h *RolesHandler) create(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.RoleManage)
+	if claims == nil {
+		return
+	}
+
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	name := ""
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	if name == "" || len(name) > 60 {
+		http.Error(w, "name is required (max 60)", http.StatusBadRequest)
+		return
+	}
+	req.BaseRole = strings.TrimSpace(req.BaseRole)
+	if !validBaseRole(req.BaseRole) {
+		http.Error(w, "invalid base_role", http.StatusBadRequest)
+		return
+	}
+	perms, status, err := validatePermissions(PermissionsFromContext(r.Context()), req.Permissions)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO provider_role (service_provider_id, name, description, base_role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, claims.ServiceProvider, name, trimmedOrNil(req.Description), req.BaseRole).Scan(&id)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "role name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "could not create role", http.StatusInternalServerError)
+		return
+	}
+
+	if err := setRolePermissions(ctx, tx, id, perms); err != nil {
+		http.Error(w, "could not save permissions", http.StatusInternalServerError)
+		return
+	}
+
+	it, err := h.load(ctx, tx, claims.ServiceProvider, id)
+	if err != nil {
+		http.Error(w, "could not load role", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// GET    /roles/{id}
+// PUT    /roles/{id}
+// DELETE /roles/{id}
+// =========================
+
+func (h *RolesHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) != 2 || parts[0] != "roles" {
+		http.NotFound(w, r)
+		return
+	}
+	roleID := strings.TrimSpace(parts[1])
+
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, roleID)
+	case http.MethodPut:
+		h.update(w, r, roleID)
+	case http.MethodDelete:
+		h.delete(w, r, roleID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *RolesHandler) load(ctx context.Context, q dbtx, spid, roleID string) (roleItem, error) {
+	return scanRoleItem(q.QueryRow(ctx, `
+		SELECT `+roleItemColumns+`
+		FROM provider_role r
+		WHERE r.id::text = $1 AND r.service_provider_id = $2
+	`, roleID, spid))
+}
+
+func (h *RolesHandler) get(w http.ResponseWriter, r *http.Request, roleID string) {
+	claims := authorize(w, r, authz.RoleManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	it, err := h.load(ctx, h.DB, claims.ServiceProvider, roleID)
+	if err != nil {
+		http.Error(w, "role not found", http.StatusNotFound)
+		return
+	}
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// update cambia nombre/descripción/permisos. El base_role no se toca: los
+// usuarios que lo tienen asignado dependen de él. Los permisos nuevos aplican
+// en la próxima request de cada usuario (se resuelven en el middleware).
+func (h *RolesHandler) update(w http.ResponseWriter, r *http.Request, roleID string) {
+	claims := authorize(w, r, authz.RoleManage)
+	if claims == nil {
+		return
+	}
+
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.BaseRole != "" {
+		http.Error(w, "base_role cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	actor := PermissionsFromContext(r.Context())
+	perms, status, err := validatePermissions(actor, req.Permissions)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	cur, err := h.load(ctx, tx, claims.ServiceProvider, roleID)
+	if err != nil {
+		http.Error(w, "role not found", http.StatusNotFound)
+		return
+	}
+	// Tampoco se puede quitar lo que uno no podría volver a dar.
+	if !actor.Covers(authz.NewSet(cur.Permissions...)) {
+		http.Error(w, "cannot edit a role with permissions you do not have", http.StatusForbidden)
+		return
+	}
+
+	name := cur.Name
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 60 {
+			http.Error(w, "name is required (max 60)", http.StatusBadRequest)
+			return
+		}
+	}
+	description := cur.Description
+	if req.Description != nil {
+		description = trimmedOrNil(req.Description)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE provider_role
+		SET name = $3, description = $4, updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+	`, cur.ID, claims.ServiceProvider, name, description)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "role name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "could not update role", http.StatusInternalServerError)
+		return
+	}
+
+	if err := setRolePermissions(ctx, tx, cur.ID, perms); err != nil {
+		http.Error(w, "could not save permissions", http.StatusInternalServerError)
+		return
+	}
+
+	it, err := h.load(ctx, tx, claims.ServiceProvider, cur.ID)
+	if err != nil {
+		http.Error(w, "could not load role", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+func (h *RolesHandler) delete(w http.ResponseWriter, r *http.Request, roleID string) {
+	claims := authorize(w, r, authz.RoleManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tag, err := h.DB.Exec(ctx, `
+		DELETE FROM provider_role
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, roleID, claims.ServiceProvider)
+	if err != nil {
+		// FK RESTRICT desde "user".custom_role_id
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			http.Error(w, "role is assigned to users", http.StatusConflict)
+			return
+		}
+		http.Error(w, "could not delete role", http.StatusInternalServerError)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		http.Error(w, "role not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setRolePermissions(ctx context.Context, q dbtx, roleID string, perms authz.Set) error {
+	if _, err := q.Exec(ctx, `DELETE FROM provider_role_permission WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+	list := make([]string, 0, len(perms))
+	for _, p := range perms.List() {
+		list = append(list, string(p))
+	}
+	_, err := q.Exec(ctx, `
+		INSERT INTO provider_role_permission (role_id, permission)
+		SELECT $1, unnest($2::text[])
+	`, roleID, list)
+	return err
+}
+
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,350 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Vida máxima de una sesión (login). Los refresh tokens rotan dentro de ella
+// pero no la extienden: pasado este plazo hay que volver a hacer login.
+const sessionTTL = 30 * 24 * time.Hour
+
+// dbtx es lo que comparten *db.DB, *pgxpool.Pool y pgx.Tx; así los helpers sirven
+// dentro y fuera de una transacción.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // segundos de vida del access token
+}
+
+// newRefreshToken usa el mismo esquema que las invitaciones: el token en claro
+// va al cliente y en DB solo queda el sha256.
+func newRefreshToken() (plain string, hash string, err error) {
+	return newInviteToken()
+}
+
+// createSession abre una sesión para el usuario y emite su primer refresh token.
+func createSession(ctx context.Context, q dbtx, r *http.Request, userID, spid string) (sessionID, refreshToken string, err error) {
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+
+	err = q.QueryRow(ctx, `
+		INSERT INTO auth_session (
+			service_provider_id, user_id,
+			user_agent, ip_address,
+			expires_at
+		) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, spid, userID, ua, clientIP(r), time.Now().Add(sessionTTL)).Scan(&sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	plain, hash, err := newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO refresh_token (session_id, token_hash)
+		VALUES ($1, $2)
+	`, sessionID, hash)
+	if err != nil {
+		return "", "", err
+	}
+
+	return sessionID, plain, nil
+}
+
+// issueTokens crea sesión + access token. Es el final común de cualquier login exitoso.
+func issueTokens(ctx context.Context, q dbtx, r *http.Request, keys *auth.KeySet, claims auth.Claims) (tokenPair, error) {
+	sessionID, refresh, err := createSession(ctx, q, r, claims.UserID, claims.ServiceProvider)
+	if err != nil {
+		return tokenPair{}, err
+	}
+	claims.SessionID = sessionID
+
+	token, err := auth.SignToken(keys, claims)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func revokeSession(ctx context.Context, q dbtx, sessionID, reason string) error {
+	_, err := q.Exec(ctx, `
+		UPDATE auth_session
+		SET revoked_at = now(), revoked_reason = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`, sessionID, reason)
+	return err
+}
+
+// revokeUserSessions cierra todas las sesiones abiertas del usuario
+// (cambio de password, cambio de rol, logout global...).
+func revokeUserSessions(ctx context.Context, q dbtx, userID, reason string) error {
+	_, err := q.Exec(ctx, `
+		UPDATE auth_session
+		SET revoked_at = now(), revoked_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID, reason)
+	return err
+}
+
+// TrustProxyHeaders: activar solo detrás de un proxy/balanceador propio que
+// agregue X-Forwarded-For; si no, cualquiera podría falsear su IP.
+var TrustProxyHeaders bool
+
+// clientIP devuelve la IP del cliente (sin puerto).
+func clientIP(r *http.Request) string {
+	if TrustProxyHeaders {
+		// La última entrada es la que agregó nuestro proxy; las anteriores las controla el cliente.
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// =========================
+// POST /auth/refresh
+// =========================
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	if req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// El provider sale del token: la búsqueda (y la rotación) corre como sistema.
+	ctx, release, err := h.DB.WithSystem(ctx)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	defer release()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		tokenID   string
+		usedAt    *time.Time
+		sessionID string
+		revokedAt *time.Time
+		expiresAt time.Time
+		claims    auth.Claims
+		isActive  bool
+		suspended bool
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT rt.id, rt.used_at,
+		       s.id, s.revoked_at, s.expires_at,
+		       u.id, u.service_provider_id, u.customer_id, u.role, u.is_active,
+		       sp.suspended_at IS NOT NULL
+		FROM refresh_token rt
+		JOIN auth_session s ON s.id = rt.session_id
+		JOIN "user" u ON u.id = s.user_id
+		JOIN service_provider sp ON sp.id = u.service_provider_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`, hashInviteToken(req.RefreshToken)).Scan(
+		&tokenID, &usedAt,
+		&sessionID, &revokedAt, &expiresAt,
+		&claims.UserID, &claims.ServiceProvider, &claims.CustomerID, &claims.Role, &isActive,
+		&suspended,
+	)
+	if err != nil {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Un refresh token ya rotado que vuelve a aparecer => alguien lo copió.
+	// No sabemos cuál de los dos es el legítimo, así que matamos la sesión entera.
+	if usedAt != nil {
+		if err := revokeSession(ctx, tx, sessionID, "refresh_reuse"); err == nil {
+			_ = tx.Commit(ctx)
+		}
+		log.Printf("[AUTH] refresh token reuse detected session=%s user=%s ip=%s",
+			sessionID, claims.UserID, clientIP(r))
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if revokedAt != nil || !expiresAt.After(time.Now()) || !isActive {
+		http.Error(w, "session expired or revoked", http.StatusUnauthorized)
+		return
+	}
+	// La sesión se conserva: si el provider se reactiva, sigue sirviendo.
+	if suspended {
+		http.Error(w, "service provider suspended", http.StatusForbidden)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_token SET used_at = now() WHERE id = $1`, tokenID)
+	if err != nil {
+		http.Error(w, "could not rotate refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	plain, hash, err := newRefreshToken()
+	if err != nil {
+		http.Error(w, "could not create refresh token", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_token (session_id, token_hash)
+		VALUES ($1, $2)
+	`, sessionID, hash)
+	if err != nil {
+		http.Error(w, "could not rotate refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE auth_session SET last_used_at = now() WHERE id = $1`, sessionID)
+	if err != nil {
+		http.Error(w, "could not update session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	// Rol y customer se leen de nuevo de la DB: si cambiaron, el nuevo token ya lo refleja.
+	claims.SessionID = sessionID
+	token, err := auth.SignToken(h.Keys, claims)
+	if err != nil {
+		http.Error(w, "could not sign token", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tokenPair{
+		Token:        token,
+		RefreshToken: plain,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	})
+}
+
+// =========================
+// POST /auth/logout
+// =========================
+
+type logoutRequest struct {
+	All bool `json:"all"` // true => cierra todas las sesiones del usuario
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if claims.IsAPIKey() {
+		http.Error(w, "api keys have no session", http.StatusBadRequest)
+		return
+	}
+
+	var req logoutRequest
+	_ = json.NewDecoder(r.Body).Decode(&req) // body opcional
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if req.All {
+		err = revokeUserSessions(ctx, tx, claims.UserID, "logout_all")
+	} else {
+		err = revokeSession(ctx, tx, claims.SessionID, "logout")
+	}
+	if err != nil {
+		http.Error(w, "could not revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	// El access token actual queda bloqueado por jti aunque le queden minutos de vida.
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO revoked_access_token (jti, user_id, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (jti) DO NOTHING
+		`, claims.ID, claims.UserID, claims.ExpiresAt.Time)
+		if err != nil {
+			http.Error(w, "could not revoke token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Limpieza oportunista: los jti expirados ya no hace falta recordarlos.
+	_, _ = tx.Exec(ctx, `DELETE FROM revoked_access_token WHERE expires_at < now()`)
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,280 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+)
+
+// sessionEnv: los handlers de sesión montados como en main.go, contra
+// Postgres real, con un provider propio que se borra al final. Otros tests
+// montan sus handlers en mux.
+type sessionEnv struct {
+	t     *testing.T
+	db    *db.DB
+	keys  *auth.KeySet
+	authn *Authenticator
+	mux   *http.ServeMux
+	sys   context.Context // como hvac_system, para sembrar y mirar la DB
+	spid  string
+}
+
+func newSessionEnv(t *testing.T) *sessionEnv {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	d, err := db.New(dsn, "hvac_app", "hvac_system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Pool.Close)
+
+	sys, release, err := d.WithSystem(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(release)
+
+	e := &sessionEnv{
+		t:    t,
+		db:   d,
+		keys: auth.NewHMACKeySet([]byte("sessions-test-secret"), "hvac-saas-api", "hvac-saas-api"),
+		sys:  sys,
+	}
+	err = d.QueryRow(sys, `
+		INSERT INTO service_provider (name, slug)
+		VALUES ('Sessions test', 'sessions-' || substr(md5(random()::text), 1, 8))
+		RETURNING id
+	`).Scan(&e.spid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// auth_session, refresh_token y revoked_access_token caen con el usuario.
+		for _, sql := range []string{
+			`DELETE FROM asset WHERE service_provider_id = $1`,
+			`DELETE FROM area WHERE service_provider_id = $1`,
+			`DELETE FROM site WHERE service_provider_id = $1`,
+			`DELETE FROM customer WHERE service_provider_id = $1`,
+			`DELETE FROM api_key WHERE service_provider_id = $1`,
+			`DELETE FROM "user" WHERE service_provider_id = $1`,
+			`DELETE FROM service_provider WHERE id = $1`,
+		} {
+			if _, err := d.Exec(sys, sql, e.spid); err != nil {
+				t.Errorf("cleanup: %v\n%s", err, sql)
+			}
+		}
+	})
+
+	e.authn = &Authenticator{DB: d, Keys: e.keys}
+	authn := e.authn
+	authHandler := &AuthHandler{DB: d, Keys: e.keys}
+	users := &UsersHandler{DB: d}
+	e.mux = http.NewServeMux()
+	e.mux.HandleFunc("/auth/refresh", authHandler.Refresh)
+	e.mux.Handle("/auth/logout", authn.Middleware(http.HandlerFunc(authHandler.Logout)))
+	e.mux.Handle("/users/", authn.Middleware(http.HandlerFunc(users.Item)))
+	// /ping solo dice si el access token sigue sirviendo.
+	e.mux.Handle("/ping", authn.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	return e
+}
+
+func (e *sessionEnv) user(email, role string) string {
+	var id string
+	err := e.db.QueryRow(e.sys, `
+		INSERT INTO "user" (service_provider_id, fullname, email, password, role)
+		VALUES ($1, $2, $2, 'x', $3)
+		RETURNING id
+	`, e.spid, email, role).Scan(&id)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return id
+}
+
+// login abre una sesión como lo hace Login después de validar el password.
+func (e *sessionEnv) login(userID, role string) tokenPair {
+	ctx, release, err := e.db.WithTenant(context.Background(), e.spid)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer release()
+	r := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	tokens, err := issueTokens(ctx, e.db, r, e.keys, auth.Claims{UserID: userID, ServiceProvider: e.spid, Role: role})
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return tokens
+}
+
+func (e *sessionEnv) do(method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	e.mux.ServeHTTP(w, r)
+	return w
+}
+
+// refresh devuelve el par nuevo (vacío si no fue 200) y el status.
+func (e *sessionEnv) refresh(refreshToken string) (tokenPair, int) {
+	w := e.do(http.MethodPost, "/auth/refresh", "", `{"refresh_token":"`+refreshToken+`"}`)
+	var out tokenPair
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+	return out, w.Code
+}
+
+func (e *sessionEnv) alive(token string) bool {
+	return e.do(http.MethodGet, "/ping", token, "").Code == http.StatusNoContent
+}
+
+// aliveAPIKey: como alive, pero autenticando con "ApiKey ...".
+func (e *sessionEnv) aliveAPIKey(key string) int {
+	r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	r.Header.Set("Authorization", "ApiKey "+key)
+	w := httptest.NewRecorder()
+	e.mux.ServeHTTP(w, r)
+	return w.Code
+}
+
+func (e *sessionEnv) revokedReason(token string) string {
+	c, err := auth.ParseToken(e.keys, token)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	var reason *string
+	if err := e.db.QueryRow(e.sys, `SELECT revoked_reason FROM auth_session WHERE id = $1`, c.SessionID).Scan(&reason); err != nil {
+		e.t.Fatal(err)
+	}
+	if reason == nil {
+		return ""
+	}
+	return *reason
+}
+
+// TestSessions recorre rotación, reuso, logout y desactivación contra el SQL
+// real de sessions.go y el trigger de desactivación. Necesita TEST_DATABASE_URL
+// (ver db/rls_test.go).
+func TestSessions(t *testing.T) {
+	e := newSessionEnv(t)
+	admin := e.user("admin@sessions.test", "admin")
+	tech := e.user("tech@sessions.test", "technician")
+
+	t.Run("rotation", func(t *testing.T) {
+		first := e.login(tech, "technician")
+		second, code := e.refresh(first.RefreshToken)
+		if code != http.StatusOK {
+			t.Fatalf("refresh: status %d", code)
+		}
+		if second.RefreshToken == first.RefreshToken || second.Token == "" {
+			t.Fatal("refresh did not rotate the tokens")
+		}
+		if !e.alive(second.Token) {
+			t.Error("new access token rejected")
+		}
+		if _, code := e.refresh(second.RefreshToken); code != http.StatusOK {
+			t.Errorf("refresh with the rotated token: status %d", code)
+		}
+	})
+
+	t.Run("reuse revokes the session", func(t *testing.T) {
+		first := e.login(tech, "technician")
+		second, code := e.refresh(first.RefreshToken)
+		if code != http.StatusOK {
+			t.Fatalf("refresh: status %d", code)
+		}
+		// Alguien repite el token ya rotado: ni el viejo ni el nuevo sirven más.
+		if _, code := e.refresh(first.RefreshToken); code != http.StatusUnauthorized {
+			t.Fatalf("replayed refresh token: status %d, want 401", code)
+		}
+		if _, code := e.refresh(second.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("current refresh token after reuse: status %d, want 401", code)
+		}
+		if e.alive(first.Token) || e.alive(second.Token) {
+			t.Error("access tokens of the session still accepted")
+		}
+		if got := e.revokedReason(second.Token); got != "refresh_reuse" {
+			t.Errorf("revoked_reason %q, want refresh_reuse", got)
+		}
+		// Otras sesiones del usuario no se tocan.
+		if other := e.login(tech, "technician"); !e.alive(other.Token) {
+			t.Error("a new session was rejected")
+		}
+	})
+
+	t.Run("logout revokes the jti", func(t *testing.T) {
+		tokens := e.login(tech, "technician")
+		other := e.login(tech, "technician")
+		if w := e.do(http.MethodPost, "/auth/logout", tokens.Token, ""); w.Code != http.StatusOK {
+			t.Fatalf("logout: status %d", w.Code)
+		}
+		if e.alive(tokens.Token) {
+			t.Error("access token accepted after logout")
+		}
+		if _, code := e.refresh(tokens.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("refresh after logout: status %d, want 401", code)
+		}
+
+		c, err := auth.ParseToken(e.keys, tokens.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		err = e.db.QueryRow(e.sys, `
+			SELECT count(*) FROM revoked_access_token
+			WHERE jti = $1 AND user_id = $2 AND expires_at = $3
+		`, c.ID, tech, c.ExpiresAt.Time).Scan(&n)
+		if err != nil || n != 1 {
+			t.Errorf("revoked jti rows = %d (%v), want 1", n, err)
+		}
+		if got := e.revokedReason(tokens.Token); got != "logout" {
+			t.Errorf("revoked_reason %q, want logout", got)
+		}
+		if !e.alive(other.Token) {
+			t.Error("logout closed another session")
+		}
+	})
+
+	t.Run("deactivation", func(t *testing.T) {
+		tokens := e.login(tech, "technician")
+		adminTokens := e.login(admin, "admin")
+		if w := e.do(http.MethodPost, "/users/"+tech+"/deactivate", adminTokens.Token, ""); w.Code != http.StatusOK {
+			t.Fatalf("deactivate: status %d: %s", w.Code, w.Body)
+		}
+		if e.alive(tokens.Token) {
+			t.Error("access token accepted after deactivation")
+		}
+		if _, code := e.refresh(tokens.RefreshToken); code != http.StatusUnauthorized {
+			t.Errorf("refresh after deactivation: status %d, want 401", code)
+		}
+		if got := e.revokedReason(tokens.Token); got != "user_deactivated" {
+			t.Errorf("revoked_reason %q, want user_deactivated", got)
+		}
+
+		// Reactivarlo no revive las sesiones viejas.
+		if w := e.do(http.MethodPost, "/users/"+tech+"/activate", adminTokens.Token, ""); w.Code != http.StatusOK {
+			t.Fatalf("activate: status %d: %s", w.Code, w.Body)
+		}
+		if e.alive(tokens.Token) {
+			t.Error("old access token accepted after reactivation")
+		}
+		if !e.alive(adminTokens.Token) {
+			t.Error("admin session closed")
+		}
+	})
+}
@@ -7,15 +7,27 @@ import (
 	"encoding/json"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/alvgonz/hvac-saas-api/internal/throttle"
 )
 
 type PasswordHandler struct {
-	DB *pgxpool.Pool
+	DB          *db.DB
+	Mailer      mailer.Mailer
+	FrontendURL string
+
+	// Límites de /auth/forgot-password (cada pedido cuenta, ver ForgotPassword).
+	IPLimiter    *throttle.Limiter
+	EmailLimiter *throttle.Limiter
+
+	resetsOnce sync.Once
+	resets     chan resetJob // ver RunResets
 }
 
 type setPasswordRequest struct {
@@ -61,13 +73,23 @@ func (h *PasswordHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
+	// Flujo público por token: aún no sabemos el provider, así que corre como
+	// sistema (sin RLS). Todas las queries van por token/user_id.
+	ctx, release, err := h.DB.WithSystem(ctx)
+	if err != nil {
+		http.Error(w, "db unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
 	// Buscamos invitación válida (no usada, no expirada)
 	var inviteID, userID string
-	err := h.DB.QueryRow(ctx, `
+	err = h.DB.QueryRow(ctx, `
 		SELECT id, user_id
 		FROM user_invitation
 		WHERE token_hash = $1
 		  AND used_at IS NULL
+		  AND revoked_at IS NULL
 		  AND expires_at > now()
 	`, tokenHash).Scan(&inviteID, &userID)
 	if err != nil {
@@ -0,0 +1,439 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/jackc/pgx/v5"
+)
+
+// Tamaño máximo del logo (mismo límite que el CHECK de provider_settings).
+const maxLogoBytes = 512 * 1024
+
+var (
+	workOrderPriorities = []string{"low", "medium", "high", "critical"}
+	workOrderTypes      = []string{"preventive", "corrective", "inspection"}
+
+	currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+	colorRe    = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+)
+
+type SettingsHandler struct {
+	DB *db.DB
+}
+
+type providerSettings struct {
+	Timezone                 string     `json:"timezone"` // IANA, ej. America/Bogota
+	Language                 string     `json:"language"` // es|en
+	Currency                 string     `json:"currency"` // ISO 4217
+	HasLogo                  bool       `json:"has_logo"` // GET /settings/logo
+	PrimaryColor             *string    `json:"primary_color,omitempty"`
+	SecondaryColor           *string    `json:"secondary_color,omitempty"`
+	DefaultWorkOrderPriority string     `json:"default_work_order_priority"`
+	DefaultWorkOrderType     string     `json:"default_work_order_type"`
+	InviteTTLHours           int        `json:"invite_ttl_hours"`
+	MaxUploadMB              int        `json:"max_upload_mb"` // por archivo adjunto
+	UpdatedAt                *time.Time `json:"updated_at,omitempty"`
+}
+
+// defaultProviderSettings: lo que ve un provider sin fila en provider_settings
+// (mismos defaults que la migración 000013).
+func defaultProviderSettings() providerSettings {
+	return providerSettings{
+		Timezone:                 "UTC",
+		Language:                 mailer.DefaultLang,
+		Currency:                 "USD",
+		DefaultWorkOrderPriority: "medium",
+		DefaultWorkOrderType:     "corrective",
+		InviteTTLHours:           48,
+		MaxUploadMB:              25,
+	}
+}
+
+// Location: zona horaria del provider (UTC si la guardada ya no existe en tzdata).
+func (s providerSettings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func (s providerSettings) InviteTTL() time.Duration {
+	return time.Duration(s.InviteTTLHours) * time.Hour
+}
+
+func (s providerSettings) MaxUploadBytes() int64 {
+	return int64(s.MaxUploadMB) << 20
+}
+
+const providerSettingsColumns = `
+	timezone, language, currency, logo IS NOT NULL,
+	primary_color, secondary_color,
+	default_work_order_priority, default_work_order_type,
+	invite_ttl_hours, max_upload_mb, updated_at`
+
+func scanProviderSettings(row pgx.Row) (providerSettings, error) {
+	var s providerSettings
+	err := row.Scan(
+		&s.Timezone, &s.Language, &s.Currency, &s.HasLogo,
+		&s.PrimaryColor, &s.SecondaryColor,
+		&s.DefaultWorkOrderPriority, &s.DefaultWorkOrderType,
+		&s.InviteTTLHours, &s.MaxUploadMB, &s.UpdatedAt,
+	)
+	return s, err
+}
+
+// loadProviderSettings devuelve la configuración del provider o los defaults si
+// todavía no tiene fila. Tabla con RLS: el ctx tiene que estar atado al tenant
+// (o ser de sistema).
+func loadProviderSettings(ctx context.Context, q dbtx, spid string) (providerSettings, error) {
+	s, err := scanProviderSettings(q.QueryRow(ctx, `
+		SELECT `+providerSettingsColumns+`
+		FROM provider_settings
+		WHERE service_provider_id = $1
+	`, spid))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return defaultProviderSettings(), nil
+	}
+	if err != nil {
+		return defaultProviderSettings(), err
+	}
+	return s, nil
+}
+
+// parseLocalDate: "2006-01-02" como medianoche en la zona del provider.
+func parseLocalDate(s string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", s, loc)
+}
+
+// =========================
+// GET   /settings
+// PATCH /settings
+// =========================
+
+type patchSettingsRequest struct {
+	Timezone                 *string `json:"timezone,omitempty"`
+	Language                 *string `json:"language,omitempty"`
+	Currency                 *string `json:"currency,omitempty"`
+	PrimaryColor             *string `json:"primary_color,omitempty"`   // "" => sin color
+	SecondaryColor           *string `json:"secondary_color,omitempty"` // "" => sin color
+	DefaultWorkOrderPriority *string `json:"default_work_order_priority,omitempty"`
+	DefaultWorkOrderType     *string `json:"default_work_order_type,omitempty"`
+	InviteTTLHours           *int    `json:"invite_ttl_hours,omitempty"`
+	MaxUploadMB              *int    `json:"max_upload_mb,omitempty"`
+}
+
+// apply valida y aplica los cambios sobre s.
+func (req patchSettingsRequest) apply(s *providerSettings) error {
+	if req.Timezone != nil {
+		tz := strings.TrimSpace(*req.Timezone)
+		// "" y "Local" los acepta LoadLocation pero no son zonas del provider.
+		if tz == "" || tz == "Local" {
+			return errors.New("invalid timezone")
+		}
+		if _, err := time.LoadLocation(tz); err != nil {
+			return errors.New("invalid timezone")
+		}
+		s.Timezone = tz
+	}
+	if req.Language != nil {
+		lang := strings.ToLower(strings.TrimSpace(*req.Language))
+		if mailer.NormalizeLang(lang) != lang {
+			return errors.New("unsupported language")
+		}
+		s.Language = lang
+	}
+	if req.Currency != nil {
+		cur := strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if !currencyRe.MatchString(cur) {
+			return errors.New("invalid currency, expected ISO 4217 code")
+		}
+		s.Currency = cur
+	}
+	for _, c := range []struct {
+		in  *string
+		out **string
+	}{
+		{req.PrimaryColor, &s.PrimaryColor},
+		{req.SecondaryColor, &s.SecondaryColor},
+	} {
+		if c.in == nil {
+			continue
+		}
+		color := strings.ToLower(strings.TrimSpace(*c.in))
+		if color == "" {
+			*c.out = nil
+			continue
+		}
+		if !colorRe.MatchString(color) {
+			return errors.New("invalid color, expected #rrggbb")
+		}
+		*c.out = &color
+	}
+	if req.DefaultWorkOrderPriority != nil {
+		p := strings.TrimSpace(*req.DefaultWorkOrderPriority)
+		if !slices.Contains(workOrderPriorities, p) {
+			return errors.New("invalid default_work_order_priority")
+		}
+		s.DefaultWorkOrderPriority = p
+	}
+	if req.DefaultWorkOrderType != nil {
+		t := strings.TrimSpace(*req.DefaultWorkOrderType)
+		if !slices.Contains(workOrderTypes, t) {
+			return errors.New("invalid default_work_order_type")
+		}
+		s.DefaultWorkOrderType = t
+	}
+	if req.InviteTTLHours != nil {
+		if *req.InviteTTLHours < 1 || *req.InviteTTLHours > 720 {
+			return errors.New("invite_ttl_hours must be between 1 and 720")
+		}
+		s.InviteTTLHours = *req.InviteTTLHours
+	}
+	if req.MaxUploadMB != nil {
+		if *req.MaxUploadMB < 1 || *req.MaxUploadMB > 100 {
+			return errors.New("max_upload_mb must be between 1 and 100")
+		}
+		s.MaxUploadMB = *req.MaxUploadMB
+	}
+	return nil
+}
+
+func (h *SettingsHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r)
+	case http.MethodPatch:
+		h.patch(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// get: cualquier usuario del provider (el frontend necesita zona, idioma y marca).
+func (h *SettingsHandler) get(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	s, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not load settings", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, s)
+}
+
+func (h *SettingsHandler) patch(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.SettingsManage)
+	if claims == nil {
+		return
+	}
+
+	var req patchSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// La fila puede no existir todavía (providers anteriores a la migración o sin tocar).
+	_, err = tx.Exec(ctx, `
+		INSERT INTO provider_settings (service_provider_id)
+		VALUES ($1)
+		ON CONFLICT (service_provider_id) DO NOTHING
+	`, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not update settings", http.StatusInternalServerError)
+		return
+	}
+
+	s, err := scanProviderSettings(tx.QueryRow(ctx, `
+		SELECT `+providerSettingsColumns+`
+		FROM provider_settings
+		WHERE service_provider_id = $1
+		FOR UPDATE
+	`, claims.ServiceProvider))
+	if err != nil {
+		http.Error(w, "could not load settings", http.StatusInternalServerError)
+		return
+	}
+
+	if err := req.apply(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, err = scanProviderSettings(tx.QueryRow(ctx, `
+		UPDATE provider_settings
+		SET timezone = $2, language = $3, currency = $4,
+		    primary_color = $5, secondary_color = $6,
+		    default_work_order_priority = $7, default_work_order_type = $8,
+		    invite_ttl_hours = $9, max_upload_mb = $11,
+		    updated_by = $10, updated_at = now()
+		WHERE service_provider_id = $1
+		RETURNING `+providerSettingsColumns,
+		claims.ServiceProvider, s.Timezone, s.Language, s.Currency,
+		s.PrimaryColor, s.SecondaryColor,
+		s.DefaultWorkOrderPriority, s.DefaultWorkOrderType,
+		s.InviteTTLHours, claims.UserID, s.MaxUploadMB,
+	))
+	if err != nil {
+		http.Error(w, "could not update settings", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, s)
+}
+
+// =========================
+// GET    /settings/logo
+// PUT    /settings/logo (body = imagen PNG o JPEG)
+// DELETE /settings/logo
+// =========================
+
+func (h *SettingsHandler) Logo(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.getLogo(w, r)
+	case http.MethodPut:
+		h.putLogo(w, r)
+	case http.MethodDelete:
+		h.deleteLogo(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func loadProviderLogo(ctx context.Context, q dbtx, spid string) (logo []byte, contentType string, err error) {
+	err = q.QueryRow(ctx, `
+		SELECT logo, logo_content_type
+		FROM provider_settings
+		WHERE service_provider_id = $1 AND logo IS NOT NULL
+	`, spid).Scan(&logo, &contentType)
+	return logo, contentType, err
+}
+
+func (h *SettingsHandler) getLogo(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	logo, contentType, err := loadProviderLogo(ctx, h.DB, claims.ServiceProvider)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "no logo", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not load logo", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(logo)
+}
+
+func (h *SettingsHandler) putLogo(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.SettingsManage)
+	if claims == nil {
+		return
+	}
+
+	logo, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogoBytes))
+	if err != nil {
+		http.Error(w, "logo too large (max 512KB)", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(logo) == 0 {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	// El Content-Type declarado no alcanza: lo detectamos del contenido.
+	// Solo PNG/JPEG, que es lo que sabe embeber el PDF.
+	contentType := http.DetectContentType(logo)
+	if contentType != "image/png" && contentType != "image/jpeg" {
+		http.Error(w, "logo must be a PNG or JPEG image", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err = h.DB.Exec(ctx, `
+		INSERT INTO provider_settings (service_provider_id, logo, logo_content_type, updated_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (service_provider_id) DO UPDATE
+		SET logo = EXCLUDED.logo,
+		    logo_content_type = EXCLUDED.logo_content_type,
+		    updated_by = EXCLUDED.updated_by,
+		    updated_at = now()
+	`, claims.ServiceProvider, logo, contentType, claims.UserID)
+	if err != nil {
+		http.Error(w, "could not save logo", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (h *SettingsHandler) deleteLogo(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.SettingsManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err := h.DB.Exec(ctx, `
+		UPDATE provider_settings
+		SET logo = NULL, logo_content_type = NULL,
+		    updated_by = $2, updated_at = now()
+		WHERE service_provider_id = $1
+	`, claims.ServiceProvider, claims.UserID)
+	if err != nil {
+		http.Error(w, "could not delete logo", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
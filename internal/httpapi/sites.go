@@ -0,0 +1,802 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+type SitesHandler struct {
+	DB *db.DB
+}
+
+// openingHours: día => franjas "HH:MM-HH:MM", ej. {"mon": ["08:00-12:00", "14:00-18:00"]}.
+type openingHours map[string][]string
+
+var (
+	weekDays = map[string]bool{"mon": true, "tue": true, "wed": true, "thu": true, "fri": true, "sat": true, "sun": true}
+	rangeRe  = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]-([01][0-9]|2[0-3]):[0-5][0-9]$`)
+)
+
+func (oh openingHours) validate() error {
+	for day, ranges := range oh {
+		if !weekDays[day] {
+			return errors.New("invalid opening_hours day: " + day)
+		}
+		for _, r := range ranges {
+			// "HH:MM" se compara bien como string
+			if !rangeRe.MatchString(r) || r[:5] >= r[6:] {
+				return errors.New("invalid opening_hours range: " + r)
+			}
+		}
+	}
+	return nil
+}
+
+type siteItem struct {
+	ID                 string       `json:"id"`
+	CustomerID         string       `json:"customer_id"`
+	Name               string       `json:"name"`
+	Address            *string      `json:"address,omitempty"`
+	Latitude           *float64     `json:"latitude,omitempty"`
+	Longitude          *float64     `json:"longitude,omitempty"`
+	AccessInstructions *string      `json:"access_instructions,omitempty"`
+	ContactName        *string      `json:"contact_name,omitempty"`
+	ContactPhone       *string      `json:"contact_phone,omitempty"`
+	OpeningHours       openingHours `json:"opening_hours,omitempty"`
+	IsActive           bool         `json:"is_active"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
+}
+
+const siteItemColumns = `
+	id, customer_id, name, address,
+	latitude::float8, longitude::float8,
+	access_instructions, contact_name, contact_phone, opening_hours,
+	is_active, created_at, updated_at`
+
+func scanSiteItem(row pgx.Row, it *siteItem) error {
+	return row.Scan(
+		&it.ID, &it.CustomerID, &it.Name, &it.Address,
+		&it.Latitude, &it.Longitude,
+		&it.AccessInstructions, &it.ContactName, &it.ContactPhone, &it.OpeningHours,
+		&it.IsActive, &it.CreatedAt, &it.UpdatedAt,
+	)
+}
+
+// siteScope: igual que customerScope pero con los permisos de sitios.
+func siteScope(r *http.Request) (own string, ok bool) {
+	claims := ClaimsFromContext(r.Context())
+	perms := PermissionsFromContext(r.Context())
+	switch {
+	case perms.Has(authz.SiteRead):
+		return "", true
+	case perms.Has(authz.SiteReadOwn) && claims.CustomerID != nil:
+		return *claims.CustomerID, true
+	}
+	return "", false
+}
+
+type siteRequest struct {
+	CustomerID         *string       `json:"customer_id,omitempty"` // solo al crear
+	Name               *string       `json:"name,omitempty"`
+	Address            *string       `json:"address,omitempty"` // "" => se borra
+	Latitude           *float64      `json:"latitude,omitempty"`
+	Longitude          *float64      `json:"longitude,omitempty"`
+	ClearLocation      bool          `json:"clear_location,omitempty"` // borra latitude/longitude
+	AccessInstructions *string       `json:"access_instructions,omitempty"`
+	ContactName        *string       `json:"contact_name,omitempty"`
+	ContactPhone       *string       `json:"contact_phone,omitempty"`
+	OpeningHours       *openingHours `json:"opening_hours,omitempty"` // {} => se borra
+}
+
+// apply copia al item los campos presentes y valida el resultado.
+func (req siteRequest) apply(it *siteItem) error {
+	if req.Name != nil {
+		it.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Address != nil {
+		it.Address = trimmedOrNil(req.Address)
+	}
+	if req.ClearLocation {
+		it.Latitude, it.Longitude = nil, nil
+	}
+	if req.Latitude != nil || req.Longitude != nil {
+		if req.Latitude == nil || req.Longitude == nil {
+			return errors.New("latitude and longitude go together")
+		}
+		it.Latitude, it.Longitude = req.Latitude, req.Longitude
+	}
+	if req.AccessInstructions != nil {
+		it.AccessInstructions = trimmedOrNil(req.AccessInstructions)
+	}
+	if req.ContactName != nil {
+		it.ContactName = trimmedOrNil(req.ContactName)
+	}
+	if req.ContactPhone != nil {
+		it.ContactPhone = trimmedOrNil(req.ContactPhone)
+	}
+	if req.OpeningHours != nil {
+		it.OpeningHours = *req.OpeningHours
+		if len(it.OpeningHours) == 0 {
+			it.OpeningHours = nil
+		}
+	}
+
+	switch {
+	case it.Name == "":
+		return errors.New("name is required")
+	case len(it.Name) > 120:
+		return errors.New("name too long (max 120)")
+	case it.Address != nil && len(*it.Address) > 200:
+		return errors.New("address too long (max 200)")
+	case it.Latitude != nil && (*it.Latitude < -90 || *it.Latitude > 90):
+		return errors.New("latitude must be between -90 and 90")
+	case it.Longitude != nil && (*it.Longitude < -180 || *it.Longitude > 180):
+		return errors.New("longitude must be between -180 and 180")
+	case it.AccessInstructions != nil && len(*it.AccessInstructions) > 1000:
+		return errors.New("access_instructions too long (max 1000)")
+	case it.ContactName != nil && len(*it.ContactName) > 80:
+		return errors.New("contact_name too long (max 80)")
+	case it.ContactPhone != nil && len(*it.ContactPhone) > 20:
+		return errors.New("contact_phone too long (max 20)")
+	}
+	return it.OpeningHours.validate()
+}
+
+// insertSite / updateSite escriben un item ya validado (API e importación).
+func insertSite(ctx context.Context, q dbtx, spid string, it *siteItem) error {
+	return scanSiteItem(q.QueryRow(ctx, `
+		INSERT INTO site (
+			service_provider_id, customer_id, name, address,
+			latitude, longitude,
+			access_instructions, contact_name, contact_phone, opening_hours
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+siteItemColumns,
+		spid, it.CustomerID, it.Name, it.Address,
+		it.Latitude, it.Longitude,
+		it.AccessInstructions, it.ContactName, it.ContactPhone, it.OpeningHours,
+	), it)
+}
+
+func updateSite(ctx context.Context, q dbtx, spid string, it *siteItem) error {
+	return scanSiteItem(q.QueryRow(ctx, `
+		UPDATE site
+		SET name = $3, address = $4,
+		    latitude = $5, longitude = $6,
+		    access_instructions = $7, contact_name = $8, contact_phone = $9,
+		    opening_hours = $10,
+		    updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+		RETURNING `+siteItemColumns,
+		it.ID, spid, it.Name, it.Address,
+		it.Latitude, it.Longitude,
+		it.AccessInstructions, it.ContactName, it.ContactPhone,
+		it.OpeningHours,
+	), it)
+}
+
+// =========================
+// GET  /sites?customer_id=&q=&active=
+// POST /sites
+// =========================
+
+func (h *SitesHandler) Collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *SitesHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	own, ok := siteScope(r)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	active, err := parseBool(q.Get("active"))
+	if err != nil {
+		http.Error(w, "invalid active", http.StatusBadRequest)
+		return
+	}
+
+	args := []any{claims.ServiceProvider}
+	where := `WHERE service_provider_id = $1`
+	argn := 2
+
+	// client: solo los sitios de su customer (ignora customer_id)
+	customerID := own
+	if customerID == "" {
+		customerID = strings.TrimSpace(q.Get("customer_id"))
+	}
+	if customerID != "" {
+		where += " AND customer_id::text = $" + itoa(argn)
+		args = append(args, customerID)
+		argn++
+	}
+
+	if active != nil {
+		where += " AND is_active = $" + itoa(argn)
+		args = append(args, *active)
+		argn++
+	}
+
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		n := itoa(argn)
+		where += " AND (name ILIKE $" + n + " OR address ILIKE $" + n + ")"
+		args = append(args, likePattern(search))
+		argn++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+siteItemColumns+`
+		FROM site
+		`+where+`
+		ORDER BY name ASC, id ASC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list sites", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]siteItem, 0, limit)
+	for rows.Next() {
+		var it siteItem
+		if err := scanSiteItem(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (h *SitesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	var req siteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.CustomerID == nil || strings.TrimSpace(*req.CustomerID) == "" {
+		http.Error(w, "customer_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var it siteItem
+	if err := req.apply(&it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	it.CustomerID = strings.TrimSpace(*req.CustomerID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var customerActive bool
+	err := h.DB.QueryRow(ctx, `
+		SELECT is_active FROM customer
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, it.CustomerID, claims.ServiceProvider).Scan(&customerActive)
+	if err != nil {
+		http.Error(w, "invalid customer_id for this provider", http.StatusBadRequest)
+		return
+	}
+	if !customerActive {
+		http.Error(w, "customer is inactive", http.StatusConflict)
+		return
+	}
+
+	if err := insertSite(ctx, h.DB, claims.ServiceProvider, &it); err != nil {
+		http.Error(w, "could not create site", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// GET/PATCH/DELETE /sites/{id}
+// POST /sites/{id}/activate | /sites/{id}/deactivate
+// GET/POST /sites/{id}/areas
+// =========================
+
+func (h *SitesHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "sites" {
+		http.NotFound(w, r)
+		return
+	}
+	siteID := strings.TrimSpace(parts[1])
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.Get(w, r, siteID)
+		case http.MethodPatch:
+			h.Update(w, r, siteID)
+		case http.MethodDelete:
+			h.Delete(w, r, siteID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch parts[2] {
+	case "areas":
+		switch r.Method {
+		case http.MethodGet:
+			h.listAreas(w, r, siteID)
+		case http.MethodPost:
+			h.createArea(w, r, siteID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "activate", "deactivate":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.setActive(w, r, siteID, parts[2] == "activate")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// loadVisibleSite trae el sitio si quien pregunta lo puede ver (client: solo
+// los de su customer). 404 en cualquier otro caso.
+func (h *SitesHandler) loadVisibleSite(ctx context.Context, r *http.Request, siteID string) (siteItem, int, error) {
+	claims := ClaimsFromContext(r.Context())
+	own, ok := siteScope(r)
+	if !ok {
+		return siteItem{}, http.StatusForbidden, errors.New("forbidden")
+	}
+
+	var it siteItem
+	err := scanSiteItem(h.DB.QueryRow(ctx, `
+		SELECT `+siteItemColumns+`
+		FROM site
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, siteID, claims.ServiceProvider), &it)
+	if err != nil || (own != "" && it.CustomerID != own) {
+		return siteItem{}, http.StatusNotFound, errors.New("site not found")
+	}
+	return it, 0, nil
+}
+
+func (h *SitesHandler) Get(w http.ResponseWriter, r *http.Request, siteID string) {
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	it, status, err := h.loadVisibleSite(ctx, r, siteID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+func (h *SitesHandler) Update(w http.ResponseWriter, r *http.Request, siteID string) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	var req siteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.CustomerID != nil {
+		http.Error(w, "customer_id cannot be changed", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var it siteItem
+	err = scanSiteItem(tx.QueryRow(ctx, `
+		SELECT `+siteItemColumns+`
+		FROM site
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, siteID, claims.ServiceProvider), &it)
+	if err != nil {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+
+	if err := req.apply(&it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := updateSite(ctx, tx, claims.ServiceProvider, &it); err != nil {
+		http.Error(w, "could not update site", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// setActive: desactivar deja el sitio (y su historial) pero no admite órdenes
+// nuevas. Con órdenes abiertas no se puede: primero hay que cerrarlas o cancelarlas.
+func (h *SitesHandler) setActive(w http.ResponseWriter, r *http.Request, siteID string, active bool) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var openOrders int
+	err = tx.QueryRow(ctx, `
+		SELECT (SELECT count(*) FROM work_order wo
+		        WHERE wo.site_id = s.id AND wo.status NOT IN ('completed', 'cancelled'))
+		FROM site s
+		WHERE s.id::text = $1 AND s.service_provider_id = $2
+		FOR UPDATE OF s
+	`, siteID, claims.ServiceProvider).Scan(&openOrders)
+	if err != nil {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+	if !active && openOrders > 0 {
+		http.Error(w, "site has open work orders", http.StatusConflict)
+		return
+	}
+
+	var it siteItem
+	err = scanSiteItem(tx.QueryRow(ctx, `
+		UPDATE site
+		SET is_active = $3, updated_at = now()
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+siteItemColumns,
+		siteID, claims.ServiceProvider, active,
+	), &it)
+	if err != nil {
+		http.Error(w, "could not update site", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// Delete borra el sitio y sus áreas solo si nunca se usó (sin equipos ni
+// órdenes). Si tiene historial, la alternativa es /deactivate.
+func (h *SitesHandler) Delete(w http.ResponseWriter, r *http.Request, siteID string) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id string
+	var inUse bool
+	err = tx.QueryRow(ctx, `
+		SELECT s.id,
+		       EXISTS (SELECT 1 FROM asset a WHERE a.site_id = s.id)
+		       OR EXISTS (SELECT 1 FROM work_order wo WHERE wo.site_id = s.id)
+		FROM site s
+		WHERE s.id::text = $1 AND s.service_provider_id = $2
+		FOR UPDATE OF s
+	`, siteID, claims.ServiceProvider).Scan(&id, &inUse)
+	if err != nil {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+	if inUse {
+		http.Error(w, "site has assets or work orders; deactivate it instead", http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM area WHERE site_id = $1`, id); err != nil {
+		http.Error(w, "could not delete site areas", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM site WHERE id = $1`, id); err != nil {
+		http.Error(w, "could not delete site", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// =========================
+// Áreas
+// =========================
+
+type areaItem struct {
+	ID        string    `json:"id"`
+	SiteID    string    `json:"site_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const areaItemColumns = `id, site_id, name, created_at, updated_at`
+
+func scanAreaItem(row pgx.Row, it *areaItem) error {
+	return row.Scan(&it.ID, &it.SiteID, &it.Name, &it.CreatedAt, &it.UpdatedAt)
+}
+
+type areaRequest struct {
+	Name string `json:"name"`
+}
+
+func (req *areaRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 120 {
+		return errors.New("name is required (max 120)")
+	}
+	return nil
+}
+
+// GET /sites/{id}/areas
+func (h *SitesHandler) listAreas(w http.ResponseWriter, r *http.Request, siteID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	site, status, err := h.loadVisibleSite(ctx, r, siteID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+areaItemColumns+`
+		FROM area
+		WHERE site_id = $1 AND service_provider_id = $2
+		ORDER BY name ASC, id ASC
+	`, site.ID, claims.ServiceProvider)
+	if err != nil {
+		http.Error(w, "could not list areas", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]areaItem, 0, 16)
+	for rows.Next() {
+		var it areaItem
+		if err := scanAreaItem(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// POST /sites/{id}/areas
+func (h *SitesHandler) createArea(w http.ResponseWriter, r *http.Request, siteID string) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	var req areaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// El INSERT ... SELECT falla cerrado: si el sitio no es de este provider no inserta nada.
+	var it areaItem
+	err := scanAreaItem(h.DB.QueryRow(ctx, `
+		INSERT INTO area (service_provider_id, site_id, name)
+		SELECT s.service_provider_id, s.id, $3
+		FROM site s
+		WHERE s.id::text = $1 AND s.service_provider_id = $2
+		RETURNING `+areaItemColumns,
+		siteID, claims.ServiceProvider, req.Name,
+	), &it)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "site not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "could not create area", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+// =========================
+// PATCH/DELETE /areas/{id}
+// =========================
+
+func (h *SitesHandler) Area(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) != 2 || parts[0] != "areas" {
+		http.NotFound(w, r)
+		return
+	}
+	areaID := strings.TrimSpace(parts[1])
+
+	switch r.Method {
+	case http.MethodPatch:
+		h.updateArea(w, r, areaID)
+	case http.MethodDelete:
+		h.deleteArea(w, r, areaID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *SitesHandler) updateArea(w http.ResponseWriter, r *http.Request, areaID string) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	var req areaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var it areaItem
+	err := scanAreaItem(h.DB.QueryRow(ctx, `
+		UPDATE area
+		SET name = $3, updated_at = now()
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+areaItemColumns,
+		areaID, claims.ServiceProvider, req.Name,
+	), &it)
+	if err != nil {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+func (h *SitesHandler) deleteArea(w http.ResponseWriter, r *http.Request, areaID string) {
+	claims := authorize(w, r, authz.SiteManage)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var deleted, inUse bool
+	err := h.DB.QueryRow(ctx, `
+		WITH target AS (
+			SELECT a.id,
+			       EXISTS (SELECT 1 FROM asset x WHERE x.area_id = a.id) AS in_use
+			FROM area a
+			WHERE a.id::text = $1 AND a.service_provider_id = $2
+		), del AS (
+			DELETE FROM area
+			WHERE id IN (SELECT id FROM target WHERE NOT in_use)
+			RETURNING id
+		)
+		SELECT EXISTS (SELECT 1 FROM del), COALESCE((SELECT in_use FROM target), false)
+	`, areaID, claims.ServiceProvider).Scan(&deleted, &inUse)
+	if err != nil {
+		http.Error(w, "could not delete area", http.StatusInternalServerError)
+		return
+	}
+	if inUse {
+		http.Error(w, "area has assets", http.StatusConflict)
+		return
+	}
+	if !deleted {
+		http.Error(w, "area not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
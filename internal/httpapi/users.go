@@ -3,32 +3,36 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
 )
 
+// invitedPasswordPlaceholder nunca es un hash bcrypt válido: el usuario no puede
+// hacer login hasta que defina su password con la invitación.
+const invitedPasswordPlaceholder = "!INVITED_USER_NO_PASSWORD!"
+
 type UsersHandler struct {
-	DB *pgxpool.Pool
-	// luego: Mailer, FrontendURL
+	DB          *db.DB
+	Mailer      mailer.Mailer
+	FrontendURL string
 }
 
 type createUserRequest struct {
-	CustomerID   *string `json:"customer_id,omitempty"` // requerido si role=client
-	Fullname     string  `json:"fullname"`
-	Email        string  `json:"email"`
-	PhoneNumber  *string `json:"phone_number,omitempty"`
-	Role         string  `json:"role"` // dispatcher|technician|client
+	CustomerID  *string `json:"customer_id,omitempty"` // requerido si role=client
+	Fullname    string  `json:"fullname"`
+	Email       string  `json:"email"`
+	PhoneNumber *string `json:"phone_number,omitempty"`
+	Role        string  `json:"role"` // dispatcher|technician|client
 }
 
 type createUserResponse struct {
-	ID         string `json:"id"`
-	InviteSent bool   `json:"invite_sent"`
+	ID          string  `json:"id"`
+	InviteSent  bool    `json:"invite_sent"`
 	InviteToken *string `json:"invite_token,omitempty"`
 }
 
@@ -44,10 +48,10 @@ func (h *UsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Permisos:
-	// admin: dispatcher/technician/client
-	// dispatcher: solo technician
-	if claims.Role != "admin" && claims.Role != "dispatcher" {
+	// Permisos: user.invite.<rol> (por defecto admin: dispatcher/technician/client;
+	// dispatcher: solo technician)
+	perms := PermissionsFromContext(r.Context())
+	if len(perms.ManageableRoles()) == 0 {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
@@ -77,8 +81,8 @@ func (h *UsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// reglas por rol
-	if claims.Role == "dispatcher" && req.Role != "technician" {
-		http.Error(w, "dispatcher can only create technician", http.StatusForbidden)
+	if !perms.CanManageRole(req.Role) {
+		http.Error(w, "not allowed to create "+req.Role+" users", http.StatusForbidden)
 		return
 	}
 	if req.Role == "client" {
@@ -108,7 +112,7 @@ func (h *UsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	// 1) Creamos usuario con password placeholder (NO usable)
 	// Nota: como password es NOT NULL, ponemos algo que nunca será válido para login
-	placeholder := "!INVITED_USER_NO_PASSWORD!"
+	placeholder := invitedPasswordPlaceholder
 
 	var userID string
 	err := h.DB.QueryRow(ctx, `
@@ -135,44 +139,21 @@ func (h *UsersHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2) Creamos invitación (token)
-	plain, tokenHash, err := newInviteToken()
-	if err != nil {
-		http.Error(w, "could not create invite token", http.StatusInternalServerError)
-		return
-	}
-
-	expiresAt := time.Now().Add(48 * time.Hour)
-
-	_, err = h.DB.Exec(ctx, `
-		INSERT INTO user_invitation (
-			service_provider_id, user_id,
-			token_hash, expires_at,
-			created_by
-		) VALUES ($1, $2, $3, $4, $5)
-	`,
-		claims.ServiceProvider, userID,
-		tokenHash, expiresAt,
-		claims.UserID,
-	)
+	_, plain, expiresAt, err := createInvitation(ctx, h.DB, claims.ServiceProvider, userID, claims.UserID)
 	if err != nil {
 		http.Error(w, "could not save invitation", http.StatusInternalServerError)
 		return
 	}
 
-	// 3) Enviar email (por ahora LOG)
-	// Luego lo cambias por tu frontend: https://tuapp.com/set-password?token=...
-	link := fmt.Sprintf("SET_PASSWORD_TOKEN=%s", plain)
-	log.Printf("[INVITE] user=%s email=%s role=%s expires=%s %s",
-		userID, req.Email, req.Role, expiresAt.Format(time.RFC3339), link)
-
-	var inviteToken *string
-	if strings.ToLower(os.Getenv("ENV")) != "production" {
-		inviteToken = &plain
+	// 3) Enviar email con el link al frontend (el token nunca va al log)
+	err = sendInvite(ctx, h.DB, h.Mailer, h.FrontendURL, claims.ServiceProvider, req.Email, req.Fullname, plain, expiresAt)
+	if err != nil {
+		log.Printf("[INVITE] could not send invite user=%s: %v", userID, err)
 	}
 
 	WriteJSON(w, http.StatusCreated, createUserResponse{
 		ID:          userID,
-		InviteSent:  true,
-		InviteToken: inviteToken,
+		InviteSent:  err == nil,
+		InviteToken: exposeInviteToken(plain),
 	})
-}
\ No newline at end of file
+}
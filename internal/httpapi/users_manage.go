@@ -0,0 +1,427 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/jackc/pgx/v5"
+)
+
+type userItem struct {
+	ID           string    `json:"id"`
+	CustomerID   *string   `json:"customer_id,omitempty"`
+	Fullname     string    `json:"fullname"`
+	Email        string    `json:"email"`
+	PhoneNumber  *string   `json:"phone_number,omitempty"`
+	Role         string    `json:"role"`
+	CustomRoleID *string   `json:"custom_role_id,omitempty"` // rol propio del provider (ver roles.go)
+	IsActive     bool      `json:"is_active"`
+	Activated    bool      `json:"activated"` // ya definió password
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const userItemColumns = `
+	id, customer_id, fullname, email, phone_number,
+	role, custom_role_id, is_active, password <> '` + invitedPasswordPlaceholder + `',
+	created_at, updated_at`
+
+func scanUserItem(row pgx.Row, it *userItem) error {
+	return row.Scan(
+		&it.ID, &it.CustomerID, &it.Fullname, &it.Email, &it.PhoneNumber,
+		&it.Role, &it.CustomRoleID, &it.IsActive, &it.Activated,
+		&it.CreatedAt, &it.UpdatedAt,
+	)
+}
+
+// Item despacha /users/{id} y /users/{id}/activate|deactivate.
+func (h *UsersHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "users" {
+		http.NotFound(w, r)
+		return
+	}
+	userID := strings.TrimSpace(parts[1])
+
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.Get(w, r, userID)
+		case http.MethodPatch:
+			h.Update(w, r, userID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch parts[2] {
+	case "activate":
+		h.setActive(w, r, userID, true)
+	case "deactivate":
+		h.setActive(w, r, userID, false)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// =========================
+// GET /users
+// =========================
+
+func (h *UsersHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims := authorize(w, r, authz.UserRead)
+	if claims == nil {
+		return
+	}
+	perms := PermissionsFromContext(r.Context())
+
+	q := r.URL.Query()
+	limit, offset, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	active, err := parseBool(q.Get("active"))
+	if err != nil {
+		http.Error(w, "invalid active", http.StatusBadRequest)
+		return
+	}
+
+	args := []any{claims.ServiceProvider}
+	where := `WHERE service_provider_id = $1`
+	argn := 2
+
+	// sin user.read.all, solo los roles que gestiona (mismas reglas que Create)
+	if !perms.Has(authz.UserReadAll) {
+		where += " AND role::text = ANY($" + itoa(argn) + ")"
+		args = append(args, perms.ManageableRoles())
+		argn++
+	}
+	if role := strings.TrimSpace(q.Get("role")); role != "" {
+		where += " AND role::text = $" + itoa(argn)
+		args = append(args, role)
+		argn++
+	}
+
+	if customerID := strings.TrimSpace(q.Get("customer_id")); customerID != "" {
+		where += " AND customer_id = $" + itoa(argn)
+		args = append(args, customerID)
+		argn++
+	}
+
+	if active != nil {
+		where += " AND is_active = $" + itoa(argn)
+		args = append(args, *active)
+		argn++
+	}
+
+	if search := strings.TrimSpace(q.Get("q")); search != "" {
+		where += " AND (fullname ILIKE $" + itoa(argn) + " OR email ILIKE $" + itoa(argn) + ")"
+		args = append(args, likePattern(search))
+		argn++
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+userItemColumns+`
+		FROM "user"
+		`+where+`
+		ORDER BY fullname ASC, id ASC
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, args...)
+	if err != nil {
+		http.Error(w, "could not list users", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]userItem, 0, limit)
+	for rows.Next() {
+		var it userItem
+		if err := scanUserItem(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// loadManagedUser trae al usuario del provider y verifica que el actor lo pueda gestionar
+// (forUpdate) o al menos ver (user.read.all). Devuelve el status HTTP a usar si no puede.
+func (h *UsersHandler) loadManagedUser(ctx context.Context, q dbtx, perms authz.Set, spid, userID string, forUpdate bool) (userItem, int, error) {
+	sql := `SELECT ` + userItemColumns + ` FROM "user" WHERE id = $1 AND service_provider_id = $2`
+	if forUpdate {
+		sql += ` FOR UPDATE`
+	}
+
+	var it userItem
+	if err := scanUserItem(q.QueryRow(ctx, sql, userID, spid), &it); err != nil {
+		return it, http.StatusNotFound, errors.New("user not found")
+	}
+	if !perms.CanManageRole(it.Role) && (forUpdate || !perms.Has(authz.UserReadAll)) {
+		return it, http.StatusForbidden, errors.New("forbidden")
+	}
+	return it, 0, nil
+}
+
+// =========================
+// GET /users/{id}
+// =========================
+
+func (h *UsersHandler) Get(w http.ResponseWriter, r *http.Request, userID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// cualquiera puede verse a sí mismo; al resto, según rol
+	if userID == claims.UserID && !claims.IsAPIKey() {
+		var it userItem
+		err := scanUserItem(h.DB.QueryRow(ctx, `
+			SELECT `+userItemColumns+` FROM "user" WHERE id = $1 AND service_provider_id = $2
+		`, userID, claims.ServiceProvider), &it)
+		if err != nil {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		WriteJSON(w, http.StatusOK, it)
+		return
+	}
+
+	perms := PermissionsFromContext(r.Context())
+	if !perms.HasAny(authz.UserRead, authz.UserReadAll) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	it, status, err := h.loadManagedUser(ctx, h.DB, perms, claims.ServiceProvider, userID, false)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// =========================
+// PATCH /users/{id}
+// =========================
+
+type updateUserRequest struct {
+	Fullname     *string `json:"fullname,omitempty"`
+	PhoneNumber  *string `json:"phone_number,omitempty"`
+	Role         *string `json:"role,omitempty"`           // dispatcher|technician|client
+	CustomRoleID *string `json:"custom_role_id,omitempty"` // "" => vuelve a los permisos del rol base
+	CustomerID   *string `json:"customer_id,omitempty"`    // requerido si role=client
+}
+
+func (h *UsersHandler) Update(w http.ResponseWriter, r *http.Request, userID string) {
+	claims := authorize(w, r, authz.UserUpdate)
+	if claims == nil {
+		return
+	}
+	perms := PermissionsFromContext(r.Context())
+
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	cur, status, err := h.loadManagedUser(ctx, tx, perms, claims.ServiceProvider, userID, true)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	next := cur
+	if req.Fullname != nil {
+		next.Fullname = strings.TrimSpace(*req.Fullname)
+		if next.Fullname == "" {
+			http.Error(w, "fullname cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.PhoneNumber != nil {
+		p := strings.TrimSpace(*req.PhoneNumber)
+		next.PhoneNumber = &p
+		if p == "" {
+			next.PhoneNumber = nil
+		}
+	}
+	if req.Role != nil {
+		next.Role = strings.TrimSpace(*req.Role)
+		if next.Role != "dispatcher" && next.Role != "technician" && next.Role != "client" {
+			http.Error(w, "invalid role", http.StatusBadRequest)
+			return
+		}
+		if !perms.CanManageRole(next.Role) {
+			http.Error(w, "forbidden role change", http.StatusForbidden)
+			return
+		}
+		// el rol propio extiende un rol base: si cambia el base, se pierde
+		if next.Role != cur.Role && req.CustomRoleID == nil {
+			next.CustomRoleID = nil
+		}
+	}
+	if req.CustomRoleID != nil {
+		next.CustomRoleID = nil
+		if id := strings.TrimSpace(*req.CustomRoleID); id != "" {
+			if status, err := checkAssignableRole(ctx, tx, perms, claims.ServiceProvider, id, next.Role); err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			next.CustomRoleID = &id
+		}
+	}
+	if req.CustomerID != nil {
+		c := strings.TrimSpace(*req.CustomerID)
+		next.CustomerID = &c
+	}
+
+	// customer_id solo tiene sentido para client
+	if next.Role == "client" {
+		if next.CustomerID == nil || *next.CustomerID == "" {
+			http.Error(w, "customer_id is required for client user", http.StatusBadRequest)
+			return
+		}
+		var ok bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS(
+				SELECT 1 FROM customer
+				WHERE id = $1 AND service_provider_id = $2
+			)
+		`, *next.CustomerID, claims.ServiceProvider).Scan(&ok)
+		if err != nil || !ok {
+			http.Error(w, "invalid customer_id for this provider", http.StatusBadRequest)
+			return
+		}
+	} else {
+		next.CustomerID = nil
+	}
+
+	err = scanUserItem(tx.QueryRow(ctx, `
+		UPDATE "user"
+		SET fullname = $3,
+		    phone_number = $4,
+		    role = $5,
+		    customer_id = $6,
+		    custom_role_id = $7,
+		    updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+		RETURNING `+userItemColumns+`
+	`, userID, claims.ServiceProvider, next.Fullname, next.PhoneNumber, next.Role, next.CustomerID, next.CustomRoleID), &next)
+	if err != nil {
+		http.Error(w, "could not update user", http.StatusInternalServerError)
+		return
+	}
+
+	// Rol y customer van dentro de auth.Claims: los tokens viejos ya no dicen la verdad.
+	if cur.Role != next.Role || !sameStringPtr(cur.CustomerID, next.CustomerID) {
+		if err := revokeUserSessions(ctx, tx, userID, "role_changed"); err != nil {
+			http.Error(w, "could not revoke sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, next)
+}
+
+// =========================
+// POST /users/{id}/activate
+// POST /users/{id}/deactivate
+// =========================
+
+func (h *UsersHandler) setActive(w http.ResponseWriter, r *http.Request, userID string, active bool) {
+	claims := authorize(w, r, authz.UserActivate)
+	if claims == nil {
+		return
+	}
+	if userID == claims.UserID {
+		http.Error(w, "cannot change your own status", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	if _, status, err := h.loadManagedUser(ctx, tx, PermissionsFromContext(r.Context()), claims.ServiceProvider, userID, true); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// Al desactivar, el trigger trg_user_deactivate_sessions revoca sus sesiones.
+	var it userItem
+	err = scanUserItem(tx.QueryRow(ctx, `
+		UPDATE "user"
+		SET is_active = $3, updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+		RETURNING `+userItemColumns+`
+	`, userID, claims.ServiceProvider, active), &it)
+	if err != nil {
+		http.Error(w, "could not update user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+func sameStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,390 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/jackc/pgx/v5"
+)
+
+// =========================
+// Comentarios de órdenes
+// GET/POST     /work-orders/{id}/comments
+// PATCH/DELETE /work-orders/{id}/comments/{commentId}
+// =========================
+
+const (
+	// commentEditWindow: el autor puede corregir o borrar su comentario durante
+	// este tiempo; después queda como está (salvo moderación con work_order.update).
+	commentEditWindow = 15 * time.Minute
+	maxCommentLen     = 2000
+	maxMentions       = 10
+)
+
+type workOrderComment struct {
+	ID          string     `json:"id"`
+	WorkOrderID string     `json:"work_order_id"`
+	AuthorID    string     `json:"author_id"`
+	AuthorName  string     `json:"author_name"`
+	Comment     string     `json:"comment"`
+	IsInternal  bool       `json:"is_internal"`
+	Mentions    []string   `json:"mentions"`
+	CreatedAt   time.Time  `json:"created_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+}
+
+const workOrderCommentColumns = `
+	c.id, c.work_order_id, c.author_id, u.fullname, c.comment, c.is_internal,
+	c.mentions::text[], c.created_at, c.edited_at`
+
+func scanWorkOrderComment(row pgx.Row, it *workOrderComment) error {
+	return row.Scan(
+		&it.ID, &it.WorkOrderID, &it.AuthorID, &it.AuthorName, &it.Comment, &it.IsInternal,
+		&it.Mentions, &it.CreatedAt, &it.EditedAt,
+	)
+}
+
+type createCommentRequest struct {
+	Comment    string   `json:"comment"`
+	IsInternal *bool    `json:"is_internal,omitempty"` // default: true si se puede, un client siempre false
+	Mentions   []string `json:"mentions,omitempty"`    // ids de usuarios a notificar
+}
+
+type updateCommentRequest struct {
+	Comment string `json:"comment"`
+}
+
+func (h *WorkOrdersHandler) Comments(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listComments(w, r, workOrderID)
+	case http.MethodPost:
+		h.createComment(w, r, workOrderID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WorkOrdersHandler) Comment(w http.ResponseWriter, r *http.Request, workOrderID, commentID string) {
+	switch r.Method {
+	case http.MethodPatch:
+		h.updateComment(w, r, workOrderID, commentID)
+	case http.MethodDelete:
+		h.deleteComment(w, r, workOrderID, commentID)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *WorkOrdersHandler) listComments(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	if ClaimsFromContext(r.Context()) == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit, offset, err := parsePagination(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	withInternal := PermissionsFromContext(r.Context()).Has(authz.WorkOrderCommentInternal)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	t, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT `+workOrderCommentColumns+`
+		FROM work_order_comment c
+		JOIN "user" u ON u.id = c.author_id
+		WHERE c.work_order_id = $1 AND (NOT c.is_internal OR $2)
+		ORDER BY c.created_at, c.id
+		LIMIT `+itoa(limit)+` OFFSET `+itoa(offset)+`
+	`, t.ID, withInternal)
+	if err != nil {
+		http.Error(w, "could not list comments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]workOrderComment, 0, limit)
+	for rows.Next() {
+		var it workOrderComment
+		if err := scanWorkOrderComment(rows, &it); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (h *WorkOrdersHandler) createComment(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	claims := authorize(w, r, authz.WorkOrderComment)
+	if claims == nil {
+		return
+	}
+	canInternal := PermissionsFromContext(r.Context()).Has(authz.WorkOrderCommentInternal)
+
+	var req createCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	isInternal := canInternal
+	if req.IsInternal != nil {
+		isInternal = *req.IsInternal
+	}
+
+	mentions := make([]string, 0, len(req.Mentions))
+	for _, id := range req.Mentions {
+		if id = strings.TrimSpace(id); id != "" && id != claims.UserID && !slices.Contains(mentions, id) {
+			mentions = append(mentions, id)
+		}
+	}
+
+	switch {
+	case req.Comment == "":
+		http.Error(w, "comment is required", http.StatusBadRequest)
+		return
+	case len(req.Comment) > maxCommentLen:
+		http.Error(w, "comment too long (max 2000)", http.StatusBadRequest)
+		return
+	case isInternal && !canInternal:
+		http.Error(w, "forbidden: cannot write internal comments", http.StatusForbidden)
+		return
+	case len(mentions) > maxMentions:
+		http.Error(w, "too many mentions (max 10)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	t, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	recipients, err := h.resolveMentions(ctx, claims.ServiceProvider, t, mentions, isInternal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var it workOrderComment
+	err = scanWorkOrderComment(h.DB.QueryRow(ctx, `
+		WITH c AS (
+			INSERT INTO work_order_comment (
+				service_provider_id, work_order_id, author_id, comment, is_internal, mentions
+			) VALUES ($1, $2, $3, $4, $5, $6::uuid[])
+			RETURNING *
+		)
+		SELECT `+workOrderCommentColumns+`
+		FROM c JOIN "user" u ON u.id = c.author_id
+	`, claims.ServiceProvider, t.ID, claims.UserID, req.Comment, isInternal, mentions), &it)
+	if err != nil {
+		http.Error(w, "could not create comment", http.StatusInternalServerError)
+		return
+	}
+
+	h.notifyMentions(ctx, claims.ServiceProvider, recipients, it, t)
+
+	WriteJSON(w, http.StatusCreated, it)
+}
+
+type mentionRecipient struct {
+	Email, Fullname string
+}
+
+// resolveMentions valida que cada mencionado sea un usuario activo del provider
+// que pueda leer el comentario: a un client solo se lo menciona en comentarios
+// visibles y de órdenes de su customer.
+func (h *WorkOrdersHandler) resolveMentions(ctx context.Context, spid string, t workOrderRef, ids []string, isInternal bool) ([]mentionRecipient, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rows, err := h.DB.Query(ctx, `
+		SELECT email, fullname
+		FROM "user"
+		WHERE id::text = ANY($1) AND service_provider_id = $2 AND is_active
+		  AND (role <> 'client' OR (NOT $3 AND customer_id = $4))
+	`, ids, spid, isInternal, t.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]mentionRecipient, 0, len(ids))
+	for rows.Next() {
+		var m mentionRecipient
+		if err := rows.Scan(&m.Email, &m.Fullname); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) != len(ids) {
+		return nil, errors.New("mentions: unknown user or user cannot see this comment")
+	}
+	return out, nil
+}
+
+// notifyMentions avisa por email a los mencionados. Best-effort, como la asignación.
+func (h *WorkOrdersHandler) notifyMentions(ctx context.Context, spid string, recipients []mentionRecipient, c workOrderComment, t workOrderRef) {
+	if len(recipients) == 0 {
+		return
+	}
+	settings, _ := loadProviderSettings(ctx, h.DB, spid) // si falla, defaults
+	excerpt := c.Comment
+	if r := []rune(excerpt); len(r) > 300 {
+		excerpt = string(r[:300]) + "…"
+	}
+	for _, m := range recipients {
+		sendMailAsync(h.Mailer, mailer.TemplateWorkOrderMention, settings.Language, m.Email, mailer.MentionData{
+			Fullname:   m.Fullname,
+			AuthorName: c.AuthorName,
+			Title:      t.Title,
+			Comment:    excerpt,
+			Link:       frontendLink(h.FrontendURL, "/work-orders/"+t.ID, nil),
+		})
+	}
+}
+
+// updateComment: solo el autor y dentro de la ventana de edición. Las menciones
+// y la visibilidad no cambian (ya se notificó a quien correspondía).
+func (h *WorkOrdersHandler) updateComment(w http.ResponseWriter, r *http.Request, workOrderID, commentID string) {
+	claims := authorize(w, r, authz.WorkOrderComment)
+	if claims == nil {
+		return
+	}
+
+	var req updateCommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Comment == "" {
+		http.Error(w, "comment is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Comment) > maxCommentLen {
+		http.Error(w, "comment too long (max 2000)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	t, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var authorID string
+	var createdAt time.Time
+	err = h.DB.QueryRow(ctx, `
+		SELECT author_id, created_at FROM work_order_comment
+		WHERE id::text = $1 AND work_order_id = $2
+	`, commentID, t.ID).Scan(&authorID, &createdAt)
+	if err != nil {
+		http.Error(w, "comment not found", http.StatusNotFound)
+		return
+	}
+	if authorID != claims.UserID {
+		http.Error(w, "forbidden: only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+	if time.Since(createdAt) > commentEditWindow {
+		http.Error(w, "edit window has expired", http.StatusConflict)
+		return
+	}
+
+	var it workOrderComment
+	err = scanWorkOrderComment(h.DB.QueryRow(ctx, `
+		WITH c AS (
+			UPDATE work_order_comment
+			SET comment = $2, edited_at = now()
+			WHERE id::text = $1
+			RETURNING *
+		)
+		SELECT `+workOrderCommentColumns+`
+		FROM c JOIN "user" u ON u.id = c.author_id
+	`, commentID, req.Comment), &it)
+	if err != nil {
+		http.Error(w, "could not update comment", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// deleteComment: el autor dentro de la ventana de edición, o quien gestiona
+// órdenes (work_order.update) en cualquier momento.
+func (h *WorkOrdersHandler) deleteComment(w http.ResponseWriter, r *http.Request, workOrderID, commentID string) {
+	claims := authorize(w, r, authz.WorkOrderComment)
+	if claims == nil {
+		return
+	}
+	perms := PermissionsFromContext(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	t, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var authorID string
+	var createdAt time.Time
+	var isInternal bool
+	err = h.DB.QueryRow(ctx, `
+		SELECT author_id, created_at, is_internal FROM work_order_comment
+		WHERE id::text = $1 AND work_order_id = $2
+	`, commentID, t.ID).Scan(&authorID, &createdAt, &isInternal)
+	if err != nil || (isInternal && !perms.Has(authz.WorkOrderCommentInternal)) {
+		http.Error(w, "comment not found", http.StatusNotFound)
+		return
+	}
+	if !perms.Has(authz.WorkOrderUpdate) {
+		if authorID != claims.UserID {
+			http.Error(w, "forbidden: only the author can delete a comment", http.StatusForbidden)
+			return
+		}
+		if time.Since(createdAt) > commentEditWindow {
+			http.Error(w, "edit window has expired", http.StatusConflict)
+			return
+		}
+	}
+
+	if _, err := h.DB.Exec(ctx, `DELETE FROM work_order_comment WHERE id::text = $1`, commentID); err != nil {
+		http.Error(w, "could not delete comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+)
+
+// =========================
+// Auditoría de órdenes (work_order_event)
+// GET /work-orders/{id}/events
+// =========================
+
+type fieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type workOrderEvent struct {
+	ID          string                 `json:"id"`
+	WorkOrderID string                 `json:"work_order_id"`
+	Action      string                 `json:"action"`
+	ActorID     *string                `json:"actor_id,omitempty"`
+	ActorName   *string                `json:"actor_name,omitempty"`
+	APIKeyID    *string                `json:"api_key_id,omitempty"`
+	OldStatus   *string                `json:"old_status,omitempty"`
+	NewStatus   *string                `json:"new_status,omitempty"`
+	Changes     map[string]fieldChange `json:"changes"`
+	Reason      *string                `json:"reason,omitempty"`
+	IPAddress   *string                `json:"ip_address,omitempty"` // solo con work_order.read.all
+	UserAgent   *string                `json:"user_agent,omitempty"` // idem
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// recordWorkOrderEvent agrega el evento al log. Va en la misma transacción que
+// el cambio: si no se puede auditar, el cambio no se hace.
+func recordWorkOrderEvent(ctx context.Context, q dbtx, r *http.Request, workOrderID, action, oldStatus, newStatus string, changes map[string]fieldChange, reason *string) error {
+	claims := ClaimsFromContext(r.Context())
+	if changes == nil {
+		changes = map[string]fieldChange{}
+	}
+	ua := r.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+
+	_, err := q.Exec(ctx, `
+		INSERT INTO work_order_event (
+			service_provider_id, work_order_id, action, actor_id, api_key_id,
+			old_status, new_status, changes, reason, ip_address, user_agent
+		) VALUES (
+			$1, $2, $3, $4, NULLIF($5, '')::uuid,
+			NULLIF($6, '')::work_order_status, NULLIF($7, '')::work_order_status, $8, $9, $10, NULLIF($11, '')
+		)
+	`, claims.ServiceProvider, workOrderID, action, claims.UserID, claims.APIKeyID,
+		oldStatus, newStatus, changes, reason, clientIP(r), ua)
+	return err
+}
+
+// diffWorkOrder: campos editables que cambiaron entre before y after.
+func diffWorkOrder(before, after workOrderDetail) map[string]fieldChange {
+	out := map[string]fieldChange{}
+	add := func(field string, from, to any) {
+		if !reflect.DeepEqual(from, to) {
+			out[field] = fieldChange{From: from, To: to}
+		}
+	}
+	add("type", before.Type, after.Type)
+	add("priority", before.Priority, after.Priority)
+	add("title", before.Title, after.Title)
+	add("description", strOrNil(before.Description), strOrNil(after.Description))
+	add("notes", strOrNil(before.Notes), strOrNil(after.Notes))
+	add("scheduled_at", timeOrNil(before.ScheduledAt), timeOrNil(after.ScheduledAt))
+	add("assigned_to", strOrNil(before.AssignedTo), strOrNil(after.AssignedTo))
+	return out
+}
+
+func strOrNil(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+func timeOrNil(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// internalFields: lo que un client no ve del log (las notas son del equipo técnico).
+var internalFields = []string{"notes"}
+
+// Events devuelve el log de la orden, del más viejo al más nuevo. Mismo
+// alcance que GET /work-orders/{id}. IP y user agent solo para quien ve todas
+// las órdenes; un client además no ve las notas internas.
+func (h *WorkOrdersHandler) Events(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	customerID, _, _ := workOrderScope(r)
+	clientView := customerID != ""
+	withOrigin := PermissionsFromContext(r.Context()).Has(authz.WorkOrderReadAll)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	wo, status, err := h.loadVisibleWorkOrder(ctx, r, workOrderID)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	rows, err := h.DB.Query(ctx, `
+		SELECT e.id, e.work_order_id, e.action, e.actor_id, u.fullname, e.api_key_id,
+		       e.old_status::text, e.new_status::text, e.changes, e.reason,
+		       e.ip_address, e.user_agent, e.created_at
+		FROM work_order_event e
+		LEFT JOIN "user" u ON u.id = e.actor_id
+		WHERE e.work_order_id = $1
+		ORDER BY e.created_at, e.id
+	`, wo.ID)
+	if err != nil {
+		http.Error(w, "could not list events", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := make([]workOrderEvent, 0, 16)
+	for rows.Next() {
+		var ev workOrderEvent
+		if err := rows.Scan(
+			&ev.ID, &ev.WorkOrderID, &ev.Action, &ev.ActorID, &ev.ActorName, &ev.APIKeyID,
+			&ev.OldStatus, &ev.NewStatus, &ev.Changes, &ev.Reason,
+			&ev.IPAddress, &ev.UserAgent, &ev.CreatedAt,
+		); err != nil {
+			http.Error(w, "scan error", http.StatusInternalServerError)
+			return
+		}
+		if !withOrigin {
+			ev.IPAddress, ev.UserAgent = nil, nil
+		}
+		if clientView {
+			ev.APIKeyID = nil
+			for _, f := range internalFields {
+				delete(ev.Changes, f)
+			}
+			// una edición que solo tocó notas internas no le dice nada al client
+			if ev.Action == "updated" && len(ev.Changes) == 0 {
+				continue
+			}
+		}
+		out = append(out, ev)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "rows error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, out)
+}
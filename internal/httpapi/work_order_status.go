@@ -0,0 +1,222 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+)
+
+// =========================
+// Máquina de estados de las órdenes
+//
+// open ─assign→ assigned ─start→ in_progress ─complete→ completed
+// in_progress ─pause→ assigned; assigned también se completa directo
+// open/assigned/in_progress ─cancel→ cancelled
+// completed/cancelled ─reopen→ assigned (u open si no tiene técnico)
+// =========================
+
+type workOrderTransition struct {
+	From []string
+	To   string // "" => lo decide la acción (reopen)
+	// Execution: acciones de quien ejecuta la orden (work_order.complete[.assigned]);
+	// el resto son de gestión (work_order.update).
+	Execution bool
+}
+
+var workOrderTransitions = map[string]workOrderTransition{
+	"assign":   {From: []string{"open", "assigned"}, To: "assigned"},
+	"start":    {From: []string{"assigned"}, To: "in_progress", Execution: true},
+	"pause":    {From: []string{"in_progress"}, To: "assigned", Execution: true},
+	"complete": {From: []string{"assigned", "in_progress"}, To: "completed", Execution: true},
+	"cancel":   {From: []string{"open", "assigned", "in_progress"}, To: "cancelled"},
+	"reopen":   {From: []string{"completed", "cancelled"}},
+}
+
+type workOrderTransitionRequest struct {
+	AssignedTo *string `json:"assigned_to,omitempty"` // assign
+	Reason     *string `json:"reason,omitempty"`      // cancel (obligatorio), reopen
+	Notes      *string `json:"notes,omitempty"`       // complete
+}
+
+// Transition ejecuta una acción de la máquina de estados. 409 si la orden no
+// está en un estado desde el que se pueda. Un technician solo inicia, pausa y
+// completa las que tiene asignadas (404 para el resto, como antes).
+func (h *WorkOrdersHandler) Transition(w http.ResponseWriter, r *http.Request, workOrderID, action string) {
+	t := workOrderTransitions[action]
+
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	assignedOnly, ok := transitionAccess(PermissionsFromContext(r.Context()), t)
+	if !ok {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	// body opcional salvo para assign y cancel
+	var req workOrderTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.AssignedTo = trimmedOrNil(req.AssignedTo)
+	req.Reason = trimmedOrNil(req.Reason)
+	switch {
+	case action == "assign" && req.AssignedTo == nil:
+		http.Error(w, "assigned_to is required", http.StatusBadRequest)
+		return
+	case action == "cancel" && req.Reason == nil:
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	case req.Reason != nil && len(*req.Reason) > 500:
+		http.Error(w, "reason too long (max 500)", http.StatusBadRequest)
+		return
+	case req.Notes != nil && len(*req.Notes) > 4000:
+		http.Error(w, "notes too long (max 4000)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var before workOrderDetail
+	err = scanWorkOrderDetail(tx.QueryRow(ctx, `
+		SELECT `+workOrderDetailColumns+`
+		FROM work_order
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, workOrderID, claims.ServiceProvider), &before)
+	if err != nil {
+		http.Error(w, "work order not found or not allowed", http.StatusNotFound)
+		return
+	}
+	to, status, err := transitionTarget(action, before.Status, before.AssignedTo, claims.UserID, assignedOnly)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	set := ""
+	args := []any{workOrderID, claims.ServiceProvider, to}
+	switch action {
+	case "assign":
+		if err := checkAssignee(ctx, tx, claims.ServiceProvider, *req.AssignedTo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		set = `assigned_to = $4, assigned_at = now(),`
+		args = append(args, *req.AssignedTo)
+	case "start":
+		// si se pausó, started_at queda en el primer inicio
+		set = `started_at = COALESCE(started_at, now()),`
+	case "complete":
+		set = `started_at = COALESCE(started_at, now()), completed_at = now(), notes = COALESCE($4, notes),`
+		args = append(args, req.Notes)
+	case "cancel":
+		set = `cancelled_at = now(), cancel_reason = $4,`
+		args = append(args, *req.Reason)
+	case "reopen":
+		set = `completed_at = NULL, cancelled_at = NULL, cancel_reason = NULL,`
+	}
+
+	var it workOrderDetail
+	err = scanWorkOrderDetail(tx.QueryRow(ctx, `
+		UPDATE work_order
+		SET status = $3::work_order_status, `+set+` updated_at = now()
+		WHERE id::text = $1 AND service_provider_id = $2
+		RETURNING `+workOrderDetailColumns,
+		args...,
+	), &it)
+	if err != nil {
+		http.Error(w, "could not update work order", http.StatusInternalServerError)
+		return
+	}
+
+	err = recordWorkOrderEvent(ctx, tx, r, it.ID, action, before.Status, it.Status, diffWorkOrder(before, it), req.Reason)
+	if err != nil {
+		http.Error(w, "could not record work order event", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	if action == "assign" {
+		h.notifyAssigned(ctx, claims.ServiceProvider, *req.AssignedTo, it.ID, it.Title, it.Priority, it.SiteID)
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// transitionAccess: las acciones de ejecución piden work_order.complete (o
+// .complete.assigned, y entonces solo sobre las propias: assignedOnly); las de
+// gestión, work_order.update.
+func transitionAccess(perms authz.Set, t workOrderTransition) (assignedOnly, ok bool) {
+	if !t.Execution {
+		return false, perms.Has(authz.WorkOrderUpdate)
+	}
+	if !perms.HasAny(authz.WorkOrderComplete, authz.WorkOrderCompleteAssigned) {
+		return false, false
+	}
+	return !perms.Has(authz.WorkOrderComplete), true
+}
+
+// transitionTarget decide el estado destino de action sobre una orden en
+// status. 404 si assignedOnly y la orden no es de userID (no revelamos que
+// existe), 409 si el estado no lo permite.
+func transitionTarget(action, status string, assignedTo *string, userID string, assignedOnly bool) (string, int, error) {
+	t, ok := workOrderTransitions[action]
+	if !ok {
+		return "", http.StatusNotFound, errors.New("unknown action")
+	}
+	if assignedOnly && (assignedTo == nil || *assignedTo != userID) {
+		return "", http.StatusNotFound, errors.New("work order not found or not allowed")
+	}
+	if !slices.Contains(t.From, status) {
+		return "", http.StatusConflict, errors.New("cannot " + action + " a work order in status " + status)
+	}
+	if action == "reopen" {
+		if assignedTo != nil {
+			return "assigned", 0, nil
+		}
+		return "open", 0, nil
+	}
+	return t.To, 0, nil
+}
+
+// checkAssignee: se asigna a un usuario activo del provider que no sea client.
+func checkAssignee(ctx context.Context, q dbtx, spid, userID string) error {
+	var role string
+	var active bool
+	err := q.QueryRow(ctx, `
+		SELECT role::text, is_active FROM "user"
+		WHERE id::text = $1 AND service_provider_id = $2
+	`, strings.TrimSpace(userID), spid).Scan(&role, &active)
+	switch {
+	case err != nil:
+		return errors.New("assigned_to: user not found")
+	case !active:
+		return errors.New("assigned_to: user is inactive")
+	case role == "client":
+		return errors.New("assigned_to: cannot assign to a client user")
+	}
+	return nil
+}
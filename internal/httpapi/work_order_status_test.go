@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+)
+
+var workOrderStatuses = []string{"open", "assigned", "in_progress", "completed", "cancelled"}
+
+// Las transiciones legales, escritas a mano (no derivadas del mapa) para que
+// un cambio en workOrderTransitions tenga que pasar por acá.
+var legalTransitions = map[string]map[string]string{
+	"assign":   {"open": "assigned", "assigned": "assigned"},
+	"start":    {"assigned": "in_progress"},
+	"pause":    {"in_progress": "assigned"},
+	"complete": {"assigned": "completed", "in_progress": "completed"},
+	"cancel":   {"open": "cancelled", "assigned": "cancelled", "in_progress": "cancelled"},
+	"reopen":   {"completed": "assigned", "cancelled": "assigned"}, // con técnico
+}
+
+func TestWorkOrderTransitions(t *testing.T) {
+	if len(workOrderTransitions) != len(legalTransitions) {
+		t.Fatalf("%d actions in workOrderTransitions, %d in the test", len(workOrderTransitions), len(legalTransitions))
+	}
+	tech := testUserID
+	for action, legal := range legalTransitions {
+		for _, status := range workOrderStatuses {
+			to, code, err := transitionTarget(action, status, &tech, tech, false)
+			want, ok := legal[status]
+			switch {
+			case ok && err != nil:
+				t.Errorf("%s from %s: %v (%d), want -> %s", action, status, err, code, want)
+			case ok && to != want:
+				t.Errorf("%s from %s: -> %s, want -> %s", action, status, to, want)
+			case !ok && code != http.StatusConflict:
+				t.Errorf("%s from %s: -> %q (%d), want 409", action, status, to, code)
+			}
+		}
+	}
+
+	// reopen sin técnico vuelve a open.
+	for _, status := range []string{"completed", "cancelled"} {
+		if to, _, err := transitionTarget("reopen", status, nil, tech, false); err != nil || to != "open" {
+			t.Errorf("reopen unassigned from %s: -> %s (%v), want open", status, to, err)
+		}
+	}
+}
+
+// Un technician solo ejecuta (start/pause/complete) y solo sobre las órdenes
+// que tiene asignadas; las ajenas dan 404, no 403, para no revelar que existen.
+func TestWorkOrderTransitionAccess(t *testing.T) {
+	technician := authz.ForUser("technician", false, nil, false)
+	dispatcher := authz.ForUser("dispatcher", false, nil, false)
+
+	for action, tr := range workOrderTransitions {
+		assignedOnly, ok := transitionAccess(technician, tr)
+		if ok != tr.Execution || (ok && !assignedOnly) {
+			t.Errorf("technician %s: ok=%v assignedOnly=%v, want ok=%v assignedOnly=true", action, ok, assignedOnly, tr.Execution)
+		}
+		if assignedOnly, ok := transitionAccess(dispatcher, tr); !ok || assignedOnly {
+			t.Errorf("dispatcher %s: ok=%v assignedOnly=%v, want ok, not assignedOnly", action, ok, assignedOnly)
+		}
+	}
+
+	mine, other := testUserID, "00000000-0000-0000-0000-0000000000b2"
+	for _, c := range []struct {
+		name         string
+		assignedTo   *string
+		assignedOnly bool
+		code         int
+	}{
+		{"own order", &mine, true, 0},
+		{"someone else's order", &other, true, http.StatusNotFound},
+		{"unassigned order", nil, true, http.StatusNotFound},
+		{"someone else's order, complete permission", &other, false, 0},
+	} {
+		_, code, err := transitionTarget("start", "assigned", c.assignedTo, mine, c.assignedOnly)
+		if code != c.code || (c.code == 0) != (err == nil) {
+			t.Errorf("%s: status %d (%v), want %d", c.name, code, err, c.code)
+		}
+	}
+
+	// El 404 va antes que el 409: un estado ilegal en una orden ajena no se revela.
+	if _, code, _ := transitionTarget("start", "completed", &other, mine, true); code != http.StatusNotFound {
+		t.Errorf("illegal transition on someone else's order: status %d, want 404", code)
+	}
+}
@@ -3,15 +3,30 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/alvgonz/hvac-saas-api/internal/auth"
+	"github.com/alvgonz/hvac-saas-api/internal/authz"
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/mailer"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+	"github.com/jackc/pgx/v5"
 )
 
 type WorkOrdersHandler struct {
-	DB *pgxpool.Pool
+	DB          *db.DB
+	Mailer      mailer.Mailer
+	FrontendURL string
+
+	// Adjuntos: sin Storage no hay subidas; sin Downloads no hay links de descarga.
+	Storage   storage.Storage
+	Downloads *auth.DownloadSigner
+	PublicURL string              // base pública del API para los links /files/{token}
+	Photos    interface{ Wake() } // jobs.PhotoProcessor; nil => solo por intervalo
 }
 
 // =========================
@@ -41,15 +56,9 @@ func (h *WorkOrdersHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims := ClaimsFromContext(r.Context())
+	// permisos (las integraciones necesitan el scope work_orders:write)
+	claims := authorize(w, r, authz.WorkOrderCreate)
 	if claims == nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// permisos
-	if claims.Role != "admin" && claims.Role != "dispatcher" {
-		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
@@ -71,64 +80,136 @@ func (h *WorkOrdersHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Type == "" {
-		req.Type = "corrective"
-	}
-	if req.Priority == "" {
-		req.Priority = "medium"
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	// Tipo y prioridad por defecto: los de la configuración del provider.
+	if req.Type == "" || req.Priority == "" {
+		settings, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+		if err != nil {
+			http.Error(w, "could not load settings", http.StatusInternalServerError)
+			return
+		}
+		if req.Type == "" {
+			req.Type = settings.DefaultWorkOrderType
+		}
+		if req.Priority == "" {
+			req.Priority = settings.DefaultWorkOrderPriority
+		}
+	}
+
 	// Validación fuerte: customer/site/asset deben existir y pertenecer al mismo service_provider (tenant)
-	var ok bool
+	var customerActive, siteActive bool
+	var assetStatus string
 	err := h.DB.QueryRow(ctx, `
-		SELECT EXISTS (
-		  SELECT 1
-		  FROM customer c
-		  JOIN site s ON s.id = $2 AND s.customer_id = c.id
-		  JOIN asset a ON a.id = $3 AND a.customer_id = c.id AND a.site_id = s.id
-		  WHERE c.id = $1 AND c.service_provider_id = $4
-		)
-	`, req.CustomerID, req.SiteID, req.AssetID, claims.ServiceProvider).Scan(&ok)
-	if err != nil || !ok {
+		SELECT c.is_active, s.is_active, a.status::text
+		FROM customer c
+		JOIN site s ON s.id = $2 AND s.customer_id = c.id
+		JOIN asset a ON a.id = $3 AND a.customer_id = c.id AND a.site_id = s.id
+		WHERE c.id = $1 AND c.service_provider_id = $4
+	`, req.CustomerID, req.SiteID, req.AssetID, claims.ServiceProvider).Scan(&customerActive, &siteActive, &assetStatus)
+	if err != nil {
 		http.Error(w, "invalid customer/site/asset for this provider", http.StatusBadRequest)
 		return
 	}
+	if !customerActive {
+		http.Error(w, "customer is inactive", http.StatusConflict)
+		return
+	}
+	if !siteActive {
+		http.Error(w, "site is inactive", http.StatusConflict)
+		return
+	}
+	// out_of_service sí: justamente es cuando más se piden correctivos
+	if assetStatus == "decommissioned" {
+		http.Error(w, "asset is decommissioned", http.StatusConflict)
+		return
+	}
 
-	var id string
-	err = h.DB.QueryRow(ctx, `
+	req.AssignedTo = trimmedOrNil(req.AssignedTo)
+	if req.AssignedTo != nil {
+		if err := checkAssignee(ctx, h.DB, claims.ServiceProvider, *req.AssignedTo); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var id, status string
+	err = tx.QueryRow(ctx, `
 		INSERT INTO work_order (
 		  service_provider_id,
 		  customer_id, site_id, asset_id,
 		  type, priority, status,
 		  title, description, notes,
-		  created_by, assigned_to
+		  created_by, assigned_to, assigned_at
 		) VALUES (
 		  $1,
 		  $2, $3, $4,
-		  $5, $6, 'open',
+		  $5, $6, CASE WHEN $11::uuid IS NOT NULL THEN 'assigned' ELSE 'open' END::work_order_status,
 		  $7, $8, $9,
-		  $10, $11
+		  $10, $11, CASE WHEN $11::uuid IS NOT NULL THEN now() END
 		)
-		RETURNING id
+		RETURNING id, status::text
 	`,
 		claims.ServiceProvider,
 		req.CustomerID, req.SiteID, req.AssetID,
 		req.Type, req.Priority,
 		req.Title, req.Description, req.Notes,
 		claims.UserID, req.AssignedTo,
-	).Scan(&id)
+	).Scan(&id, &status)
 
 	if err != nil {
 		http.Error(w, "could not create work order", http.StatusInternalServerError)
 		return
 	}
 
+	if err := recordWorkOrderEvent(ctx, tx, r, id, "created", "", status, nil, nil); err != nil {
+		http.Error(w, "could not record work order event", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	if req.AssignedTo != nil {
+		h.notifyAssigned(ctx, claims.ServiceProvider, *req.AssignedTo, id, req.Title, req.Priority, req.SiteID)
+	}
+
 	WriteJSON(w, http.StatusCreated, createWorkOrderResponse{ID: id})
 }
 
+// notifyAssigned avisa por email al técnico asignado. Es best-effort: la orden ya existe.
+func (h *WorkOrdersHandler) notifyAssigned(ctx context.Context, spid, userID, workOrderID, title, priority, siteID string) {
+	var email, fullname, siteName string
+	err := h.DB.QueryRow(ctx, `
+		SELECT u.email, u.fullname, COALESCE(s.name, '')
+		FROM "user" u
+		LEFT JOIN site s ON s.id = $3 AND s.service_provider_id = u.service_provider_id
+		WHERE u.id = $1 AND u.service_provider_id = $2 AND u.is_active
+	`, userID, spid, siteID).Scan(&email, &fullname, &siteName)
+	if err != nil {
+		return
+	}
+
+	settings, _ := loadProviderSettings(ctx, h.DB, spid) // si falla, defaults
+	sendMailAsync(h.Mailer, mailer.TemplateWorkOrderAssigned, settings.Language, email, mailer.WorkOrderData{
+		Fullname: fullname,
+		Title:    title,
+		Priority: priority,
+		SiteName: siteName,
+		Link:     frontendLink(h.FrontendURL, "/work-orders/"+workOrderID, nil),
+	})
+}
+
 // =========================
 // GET /work-orders
 // =========================
@@ -166,16 +247,26 @@ func (h *WorkOrdersHandler) List(w http.ResponseWriter, r *http.Request) {
 	limit := 50
 	offset := 0
 
-	// Reglas por rol:
-	// - admin/dispatcher: ven todo del provider (y pueden filtrar por customer_id)
-	// - technician: solo asignadas a él
-	// - client: solo su customer_id (del token)
-	if claims.Role == "client" {
+	// Alcance según permisos:
+	// - work_order.read.all (admin/dispatcher, API key con work_orders:read): todo
+	//   el provider (y pueden filtrar por customer_id)
+	// - work_order.read.customer (client): solo su customer_id (del token)
+	// - work_order.read.assigned (technician): solo asignadas a él
+	perms := PermissionsFromContext(r.Context())
+	assignedOnly := false
+	switch {
+	case perms.Has(authz.WorkOrderReadAll):
+	case perms.Has(authz.WorkOrderReadCustomer):
 		if claims.CustomerID == nil {
 			http.Error(w, "client has no customer_id", http.StatusForbidden)
 			return
 		}
 		customerID = *claims.CustomerID
+	case perms.Has(authz.WorkOrderReadAssigned):
+		assignedOnly = true
+	default:
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
@@ -186,7 +277,7 @@ func (h *WorkOrdersHandler) List(w http.ResponseWriter, r *http.Request) {
 	argn := 2
 
 	// customer filter (no aplica para technician; a technician le filtramos por assigned_to)
-	if customerID != "" && claims.Role != "technician" {
+	if customerID != "" && !assignedOnly {
 		where += " AND customer_id = $" + itoa(argn)
 		args = append(args, customerID)
 		argn++
@@ -198,12 +289,46 @@ func (h *WorkOrdersHandler) List(w http.ResponseWriter, r *http.Request) {
 		argn++
 	}
 
-	if claims.Role == "technician" {
+	if assignedOnly {
 		where += " AND assigned_to = $" + itoa(argn)
 		args = append(args, claims.UserID)
 		argn++
 	}
 
+	// from/to (YYYY-MM-DD, ambos inclusive) sobre created_at, en la zona del provider:
+	// "2025-03-01" es la medianoche de Bogotá, no la de UTC.
+	from := strings.TrimSpace(q.Get("from"))
+	to := strings.TrimSpace(q.Get("to"))
+	if from != "" || to != "" {
+		settings, err := loadProviderSettings(ctx, h.DB, claims.ServiceProvider)
+		if err != nil {
+			http.Error(w, "could not load settings", http.StatusInternalServerError)
+			return
+		}
+		loc := settings.Location()
+
+		if from != "" {
+			t, err := parseLocalDate(from, loc)
+			if err != nil {
+				http.Error(w, "invalid from, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			where += " AND created_at >= $" + itoa(argn)
+			args = append(args, t)
+			argn++
+		}
+		if to != "" {
+			t, err := parseLocalDate(to, loc)
+			if err != nil {
+				http.Error(w, "invalid to, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			where += " AND created_at < $" + itoa(argn)
+			args = append(args, t.AddDate(0, 0, 1))
+			argn++
+		}
+	}
+
 	rows, err := h.DB.Query(ctx, `
 		SELECT
 		  id, customer_id, site_id, asset_id,
@@ -259,26 +384,64 @@ func itoa(n int) string {
 	return sign + string(b[i:])
 }
 
-type completeWorkOrderRequest struct {
-	Notes *string `json:"notes,omitempty"`
+// =========================
+// GET/PATCH /work-orders/{id}
+// GET  /work-orders/{id}/events   (ver work_order_events.go)
+// GET/POST /work-orders/{id}/comments  |  PATCH/DELETE .../comments/{cid}  (ver work_order_comments.go)
+// POST /work-orders/{id}/{assign|start|pause|complete|cancel|reopen}
+// (PATCH /work-orders/{id}/complete sigue aceptándose)
+// =========================
+
+type workOrderDetail struct {
+	workOrderItem
+	Description  *string    `json:"description,omitempty"`
+	Notes        *string    `json:"notes,omitempty"`
+	ScheduledAt  *time.Time `json:"scheduled_at,omitempty"`
+	AssignedAt   *time.Time `json:"assigned_at,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CancelReason *string    `json:"cancel_reason,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
-func (h *WorkOrdersHandler) Complete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPatch {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+const workOrderDetailColumns = `
+	id, customer_id, site_id, asset_id,
+	type, priority, status, title,
+	assigned_to, created_by,
+	completed_at, created_at,
+	description, notes, scheduled_at, assigned_at, started_at,
+	cancelled_at, cancel_reason, updated_at`
+
+func scanWorkOrderDetail(row pgx.Row, it *workOrderDetail) error {
+	return row.Scan(
+		&it.ID, &it.CustomerID, &it.SiteID, &it.AssetID,
+		&it.Type, &it.Priority, &it.Status, &it.Title,
+		&it.AssignedTo, &it.CreatedBy,
+		&it.CompletedAt, &it.CreatedAt,
+		&it.Description, &it.Notes, &it.ScheduledAt, &it.AssignedAt, &it.StartedAt,
+		&it.CancelledAt, &it.CancelReason, &it.UpdatedAt,
+	)
+}
 
+// workOrderScope: mismo alcance que GET /work-orders. Devuelve el filtro a
+// aplicar (customer o técnico asignado; vacíos = todo el provider).
+func workOrderScope(r *http.Request) (customerID, assignedTo string, ok bool) {
 	claims := ClaimsFromContext(r.Context())
-	if claims == nil {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
+	perms := PermissionsFromContext(r.Context())
+	switch {
+	case perms.Has(authz.WorkOrderReadAll):
+		return "", "", true
+	case perms.Has(authz.WorkOrderReadCustomer) && claims.CustomerID != nil:
+		return *claims.CustomerID, "", true
+	case perms.Has(authz.WorkOrderReadAssigned):
+		return "", claims.UserID, true
 	}
+	return "", "", false
+}
 
-	// Esperamos path: /work-orders/{id}/complete
-	path := strings.Trim(r.URL.Path, "/")
-	parts := strings.Split(path, "/")
-	if len(parts) != 3 || parts[0] != "work-orders" || parts[2] != "complete" {
+func (h *WorkOrdersHandler) Item(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r)
+	if len(parts) < 2 || len(parts) > 4 || parts[0] != "work-orders" {
 		http.NotFound(w, r)
 		return
 	}
@@ -288,59 +451,307 @@ func (h *WorkOrdersHandler) Complete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if claims.Role == "client" {
+	if len(parts) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			h.Get(w, r, workOrderID)
+		case http.MethodPatch:
+			h.Update(w, r, workOrderID)
+		case http.MethodDelete:
+			h.Delete(w, r, workOrderID)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	action := parts[2]
+	if action == "comments" {
+		if len(parts) == 4 {
+			h.Comment(w, r, workOrderID, strings.TrimSpace(parts[3]))
+			return
+		}
+		h.Comments(w, r, workOrderID)
+		return
+	}
+	if action == "attachments" {
+		if len(parts) == 4 {
+			h.DeleteAttachment(w, r, workOrderID, strings.TrimSpace(parts[3]))
+			return
+		}
+		h.Attachments(w, r, workOrderID)
+		return
+	}
+	if len(parts) == 4 {
+		http.NotFound(w, r)
+		return
+	}
+	if action == "events" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Events(w, r, workOrderID)
+		return
+	}
+	if action == "uploads" {
+		h.CreateUpload(w, r, workOrderID)
+		return
+	}
+	if _, ok := workOrderTransitions[action]; !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// complete era PATCH antes de que existiera el resto de transiciones.
+	if r.Method != http.MethodPost && !(action == "complete" && r.Method == http.MethodPatch) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.Transition(w, r, workOrderID, action)
+}
+
+// workOrderRef: lo mínimo de una orden para colgarle comentarios o adjuntos.
+type workOrderRef struct {
+	ID, CustomerID, Title, Status string
+}
+
+// loadVisibleWorkOrder trae la orden si quien pregunta la puede ver (mismo
+// alcance que GET /work-orders). 404 si no.
+func (h *WorkOrdersHandler) loadVisibleWorkOrder(ctx context.Context, r *http.Request, workOrderID string) (workOrderRef, int, error) {
+	claims := ClaimsFromContext(r.Context())
+	customerID, assignedTo, ok := workOrderScope(r)
+	if !ok {
+		return workOrderRef{}, http.StatusForbidden, errors.New("forbidden")
+	}
+
+	var t workOrderRef
+	err := h.DB.QueryRow(ctx, `
+		SELECT id, customer_id, title, status::text FROM work_order
+		WHERE id::text = $1 AND service_provider_id = $2
+		  AND ($3 = '' OR customer_id::text = $3)
+		  AND ($4 = '' OR assigned_to::text = $4)
+	`, workOrderID, claims.ServiceProvider, customerID, assignedTo).Scan(&t.ID, &t.CustomerID, &t.Title, &t.Status)
+	if err != nil {
+		return workOrderRef{}, http.StatusNotFound, errors.New("work order not found")
+	}
+	return t, 0, nil
+}
+
+func (h *WorkOrdersHandler) Get(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	claims := ClaimsFromContext(r.Context())
+	if claims == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	customerID, assignedTo, ok := workOrderScope(r)
+	if !ok {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
 
-	var req completeWorkOrderRequest
-	_ = json.NewDecoder(r.Body).Decode(&req) // body opcional
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var it workOrderDetail
+	err := scanWorkOrderDetail(h.DB.QueryRow(ctx, `
+		SELECT `+workOrderDetailColumns+`
+		FROM work_order
+		WHERE id::text = $1 AND service_provider_id = $2
+		  AND ($3 = '' OR customer_id::text = $3)
+		  AND ($4 = '' OR assigned_to::text = $4)
+	`, workOrderID, claims.ServiceProvider, customerID, assignedTo), &it)
+	if err != nil {
+		http.Error(w, "work order not found", http.StatusNotFound)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+type updateWorkOrderRequest struct {
+	Type        *string `json:"type,omitempty"`
+	Priority    *string `json:"priority,omitempty"`
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`  // "" => se borra
+	Notes       *string `json:"notes,omitempty"`        // "" => se borra
+	ScheduledAt *string `json:"scheduled_at,omitempty"` // RFC3339; "" => se borra
+}
+
+func (req updateWorkOrderRequest) apply(it *workOrderDetail) error {
+	if req.Type != nil {
+		it.Type = strings.TrimSpace(*req.Type)
+		if !slices.Contains(workOrderTypes, it.Type) {
+			return errors.New("invalid type")
+		}
+	}
+	if req.Priority != nil {
+		it.Priority = strings.TrimSpace(*req.Priority)
+		if !slices.Contains(workOrderPriorities, it.Priority) {
+			return errors.New("invalid priority")
+		}
+	}
+	if req.Title != nil {
+		it.Title = strings.TrimSpace(*req.Title)
+		if it.Title == "" {
+			return errors.New("title is required")
+		}
+		if len(it.Title) > 140 {
+			return errors.New("title too long (max 140)")
+		}
+	}
+	if req.Description != nil {
+		it.Description = trimmedOrNil(req.Description)
+		if it.Description != nil && len(*it.Description) > 2000 {
+			return errors.New("description too long (max 2000)")
+		}
+	}
+	if req.Notes != nil {
+		it.Notes = trimmedOrNil(req.Notes)
+		if it.Notes != nil && len(*it.Notes) > 4000 {
+			return errors.New("notes too long (max 4000)")
+		}
+	}
+	if req.ScheduledAt != nil {
+		it.ScheduledAt = nil
+		if v := strings.TrimSpace(*req.ScheduledAt); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return errors.New("invalid scheduled_at, expected RFC3339")
+			}
+			it.ScheduledAt = &t
+		}
+	}
+	return nil
+}
+
+// Update edita los datos de la orden. El estado y el técnico no: eso va por
+// las transiciones (assign, start...).
+func (h *WorkOrdersHandler) Update(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	claims := authorize(w, r, authz.WorkOrderUpdate)
+	if claims == nil {
+		return
+	}
+
+	var req updateWorkOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Reglas:
-	// - admin/dispatcher: puede completar cualquier WO del provider
-	// - technician: solo si assigned_to = él
-	var tag string
-	var args []any
-
-	if claims.Role == "technician" {
-		tag = `
-			UPDATE work_order
-			SET status = 'completed',
-			    completed_at = now(),
-			    notes = COALESCE($3, notes),
-			    updated_at = now()
-			WHERE id = $1
-			  AND service_provider_id = $2
-			  AND assigned_to = $4
-			  AND status != 'cancelled'
-			RETURNING id
-		`
-		args = []any{workOrderID, claims.ServiceProvider, req.Notes, claims.UserID}
-	} else {
-		// admin/dispatcher
-		tag = `
-			UPDATE work_order
-			SET status = 'completed',
-			    completed_at = now(),
-			    notes = COALESCE($3, notes),
-			    updated_at = now()
-			WHERE id = $1
-			  AND service_provider_id = $2
-			  AND status != 'cancelled'
-			RETURNING id
-		`
-		args = []any{workOrderID, claims.ServiceProvider, req.Notes}
-	}
-
-	var id string
-	err := h.DB.QueryRow(ctx, tag, args...).Scan(&id)
+	tx, err := h.DB.Begin(ctx)
 	if err != nil {
-		http.Error(w, "work order not found or not allowed", http.StatusNotFound)
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var it workOrderDetail
+	err = scanWorkOrderDetail(tx.QueryRow(ctx, `
+		SELECT `+workOrderDetailColumns+`
+		FROM work_order
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, workOrderID, claims.ServiceProvider), &it)
+	if err != nil {
+		http.Error(w, "work order not found", http.StatusNotFound)
+		return
+	}
+	if it.Status == "completed" || it.Status == "cancelled" {
+		http.Error(w, "work order is "+it.Status+"; reopen it first", http.StatusConflict)
+		return
+	}
+
+	before := it
+	if err := req.apply(&it); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = scanWorkOrderDetail(tx.QueryRow(ctx, `
+		UPDATE work_order
+		SET type = $3, priority = $4, title = $5, description = $6, notes = $7,
+		    scheduled_at = $8, updated_at = now()
+		WHERE id = $1 AND service_provider_id = $2
+		RETURNING `+workOrderDetailColumns,
+		it.ID, claims.ServiceProvider,
+		it.Type, it.Priority, it.Title, it.Description, it.Notes, it.ScheduledAt,
+	), &it)
+	if err != nil {
+		http.Error(w, "could not update work order", http.StatusInternalServerError)
+		return
+	}
+
+	if changes := diffWorkOrder(before, it); len(changes) > 0 {
+		if err := recordWorkOrderEvent(ctx, tx, r, it.ID, "updated", "", "", changes, nil); err != nil {
+			http.Error(w, "could not record work order event", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, it)
+}
+
+// =========================
+// DELETE /work-orders/{id}
+// =========================
+
+// Delete borra la orden con sus comentarios, adjuntos y subidas (cascade). Los
+// objetos del storage los encolan los triggers y los borra jobs.StorageSweeper.
+// El log de auditoría se conserva, con un evento "deleted" al final. Una orden
+// completada es historia del equipo: no se borra.
+func (h *WorkOrdersHandler) Delete(w http.ResponseWriter, r *http.Request, workOrderID string) {
+	claims := authorize(w, r, authz.WorkOrderUpdate)
+	if claims == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		http.Error(w, "tx error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var it workOrderDetail
+	err = scanWorkOrderDetail(tx.QueryRow(ctx, `
+		SELECT `+workOrderDetailColumns+`
+		FROM work_order
+		WHERE id::text = $1 AND service_provider_id = $2
+		FOR UPDATE
+	`, workOrderID, claims.ServiceProvider), &it)
+	if err != nil {
+		http.Error(w, "work order not found", http.StatusNotFound)
+		return
+	}
+	if it.Status == "completed" {
+		http.Error(w, "cannot delete a completed work order", http.StatusConflict)
+		return
+	}
+
+	if err := recordWorkOrderEvent(ctx, tx, r, it.ID, "deleted", it.Status, "", nil, nil); err != nil {
+		http.Error(w, "could not record work order event", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM work_order WHERE id = $1 AND service_provider_id = $2`, it.ID, claims.ServiceProvider); err != nil {
+		http.Error(w, "could not delete work order", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		http.Error(w, "commit error", http.StatusInternalServerError)
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, map[string]string{"id": id, "status": "completed"})
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,214 @@
+// Package imaging procesa las fotos que suben los técnicos: lee y limpia la
+// metadata (EXIF), endereza según la orientación de la cámara, genera versiones
+// reducidas y calcula un hash perceptual para detectar fotos repetidas.
+// Solo usa la stdlib (JPEG, PNG y GIF).
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// Exif: lo que nos interesa de la metadata de la cámara.
+type Exif struct {
+	Orientation int // 1..8 (1 = normal); 0 si no viene
+
+	// Hora de captura tal como la guarda la cámara (hora local, sin zona) y el
+	// offset si la cámara lo informa (OffsetTimeOriginal, ej. "-05:00").
+	DateTime string
+	Offset   string
+
+	Lat, Lng *float64
+}
+
+// TakenAt interpreta DateTime con su offset o, si no trae, en loc.
+func (e Exif) TakenAt(loc *time.Location) *time.Time {
+	if e.DateTime == "" {
+		return nil
+	}
+	const layout = "2006:01:02 15:04:05"
+	var t time.Time
+	var err error
+	if e.Offset != "" {
+		t, err = time.Parse(layout+"-07:00", e.DateTime+e.Offset)
+	} else {
+		t, err = time.ParseInLocation(layout, e.DateTime, loc)
+	}
+	if err != nil || t.Year() < 1990 {
+		return nil
+	}
+	return &t
+}
+
+var errBadTIFF = errors.New("imaging: invalid exif data")
+
+const (
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatRef          = 0x0001
+	tagGPSLat             = 0x0002
+	tagGPSLngRef          = 0x0003
+	tagGPSLng             = 0x0004
+)
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// tiff lee un bloque EXIF (header TIFF + IFDs) con chequeo de límites: viene
+// del teléfono de alguien, no se confía en ningún offset.
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func newTIFF(b []byte) (*tiff, uint32, error) {
+	if len(b) < 8 {
+		return nil, 0, errBadTIFF
+	}
+	t := &tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, errBadTIFF
+	}
+	if t.order.Uint16(b[2:]) != 42 {
+		return nil, 0, errBadTIFF
+	}
+	return t, t.order.Uint32(b[4:]), nil
+}
+
+var tiffTypeSize = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (t *tiff) ifd(off uint32) (map[uint16]tiffEntry, error) {
+	if uint64(off)+2 > uint64(len(t.b)) {
+		return nil, errBadTIFF
+	}
+	n := uint32(t.order.Uint16(t.b[off:]))
+	if uint64(off)+2+uint64(n)*12 > uint64(len(t.b)) {
+		return nil, errBadTIFF
+	}
+	out := make(map[uint16]tiffEntry, n)
+	for i := uint32(0); i < n; i++ {
+		e := t.b[off+2+i*12:]
+		tag, typ, count := t.order.Uint16(e), t.order.Uint16(e[2:]), t.order.Uint32(e[4:])
+		size, ok := tiffTypeSize[typ]
+		if !ok || count > 1<<16 {
+			continue
+		}
+		total := size * count
+		var value []byte
+		if total <= 4 {
+			value = e[8 : 8+total]
+		} else {
+			p := t.order.Uint32(e[8:])
+			if uint64(p)+uint64(total) > uint64(len(t.b)) {
+				continue
+			}
+			value = t.b[p : p+total]
+		}
+		out[tag] = tiffEntry{typ: typ, count: count, value: value}
+	}
+	return out, nil
+}
+
+func (t *tiff) uint(e tiffEntry) (uint32, bool) {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value)), true
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+func (t *tiff) ascii(e tiffEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(e.value), "\x00"))
+}
+
+// degrees: GPS en grados/minutos/segundos (3 RATIONAL) => grados decimales.
+func (t *tiff) degrees(e tiffEntry) (float64, bool) {
+	if e.typ != 5 || e.count != 3 || len(e.value) < 24 {
+		return 0, false
+	}
+	var dms [3]float64
+	for i := range dms {
+		num, den := t.order.Uint32(e.value[i*8:]), t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		dms[i] = float64(num) / float64(den)
+	}
+	return dms[0] + dms[1]/60 + dms[2]/3600, true
+}
+
+// parseExif lee un bloque TIFF (el payload de APP1 sin "Exif\0\0", o el chunk eXIf de PNG).
+func parseExif(b []byte) (Exif, error) {
+	var out Exif
+	t, off, err := newTIFF(b)
+	if err != nil {
+		return out, err
+	}
+	ifd0, err := t.ifd(off)
+	if err != nil {
+		return out, err
+	}
+	if v, ok := t.uint(ifd0[tagOrientation]); ok && v >= 1 && v <= 8 {
+		out.Orientation = int(v)
+	}
+	out.DateTime = t.ascii(ifd0[tagDateTime])
+
+	if p, ok := t.uint(ifd0[tagExifIFD]); ok {
+		if exif, err := t.ifd(p); err == nil {
+			if dt := t.ascii(exif[tagDateTimeOriginal]); dt != "" {
+				out.DateTime = dt
+				out.Offset = t.ascii(exif[tagOffsetTimeOriginal])
+			}
+		}
+	}
+
+	if p, ok := t.uint(ifd0[tagGPSIFD]); ok {
+		if gps, err := t.ifd(p); err == nil {
+			lat, okLat := t.degrees(gps[tagGPSLat])
+			lng, okLng := t.degrees(gps[tagGPSLng])
+			// 0,0 es lo que graban algunos teléfonos sin señal
+			if okLat && okLng && (lat != 0 || lng != 0) && lat <= 90 && lng <= 180 {
+				if t.ascii(gps[tagGPSLatRef]) == "S" {
+					lat = -lat
+				}
+				if t.ascii(gps[tagGPSLngRef]) == "W" {
+					lng = -lng
+				}
+				lat, lng = math.Round(lat*1e7)/1e7, math.Round(lng*1e7)/1e7
+				out.Lat, out.Lng = &lat, &lng
+			}
+		}
+	}
+	return out, nil
+}
+
+// orientationExif arma un bloque EXIF mínimo con solo el tag Orientation: es lo
+// único que se deja en el original (sin él, la foto se vería girada).
+func orientationExif(orientation int) []byte {
+	b := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08" + // header TIFF, IFD0 en 8
+		"\x00\x01" + // 1 entrada
+		"\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00" + // Orientation SHORT x1
+		"\x00\x00\x00\x00") // sin IFD siguiente
+	binary.BigEndian.PutUint16(b[6+8+2+8:], uint16(orientation))
+	return b
+}
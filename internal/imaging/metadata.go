@@ -0,0 +1,154 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var errBadJPEG = errors.New("imaging: invalid jpeg")
+
+// stripJPEG devuelve el JPEG sin metadata y el EXIF que traía. Se va todo lo
+// que puede llevar datos del teléfono o del lugar: APP1 (EXIF, XMP), APP13
+// (IPTC), comentarios, el índice MPF y las imágenes extra pegadas después del
+// EOI (previews, mapas de profundidad, cada una con su propio EXIF). Quedan
+// los datos de imagen, el perfil de color (APP2 ICC) y, si hace falta, un EXIF
+// nuevo con solo la orientación.
+func stripJPEG(b []byte) ([]byte, Exif, error) {
+	var ex Exif
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return nil, ex, errBadJPEG
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(b[:2])
+
+	exifDone, orientationAt := false, -1
+	i := 2
+	for {
+		// marcador: uno o más 0xFF de relleno y el código
+		if i >= len(b) || b[i] != 0xFF {
+			return nil, ex, errBadJPEG
+		}
+		for i < len(b) && b[i] == 0xFF {
+			i++
+		}
+		if i >= len(b) {
+			return nil, ex, errBadJPEG
+		}
+		marker := b[i]
+		i++
+
+		switch {
+		case marker == 0xD9: // EOI: lo que siga se descarta
+			out.Write([]byte{0xFF, 0xD9})
+			if orientationAt >= 0 && ex.Orientation > 1 {
+				res := out.Bytes()
+				seg := segment(0xE1, orientationExif(ex.Orientation))
+				res = append(res[:orientationAt], append(seg, res[orientationAt:]...)...)
+				return res, ex, nil
+			}
+			return out.Bytes(), ex, nil
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01: // sin largo
+			out.Write([]byte{0xFF, marker})
+			continue
+		}
+
+		if i+2 > len(b) {
+			return nil, ex, errBadJPEG
+		}
+		n := int(binary.BigEndian.Uint16(b[i:]))
+		if n < 2 || i+n > len(b) {
+			return nil, ex, errBadJPEG
+		}
+		payload := b[i+2 : i+n]
+		seg := b[i-2 : i+n]
+		i += n
+
+		switch {
+		case marker == 0xE1:
+			if !exifDone && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				if parsed, err := parseExif(payload[6:]); err == nil {
+					ex = parsed
+				}
+				exifDone = true
+			}
+		case marker == 0xED, marker == 0xFE:
+		case marker == 0xE2 && bytes.HasPrefix(payload, []byte("MPF\x00")):
+		default:
+			out.Write(seg)
+			// el EXIF nuevo va después de APP0 (JFIF lo quiere primero)
+			if orientationAt < 0 && marker != 0xE0 {
+				orientationAt = out.Len() - len(seg)
+			}
+		}
+
+		if marker == 0xDA { // SOS: datos comprimidos hasta el próximo marcador real
+			start := i
+			for i+1 < len(b) {
+				if b[i] == 0xFF && b[i+1] != 0x00 && !(b[i+1] >= 0xD0 && b[i+1] <= 0xD7) {
+					break
+				}
+				i++
+			}
+			if i+1 >= len(b) {
+				return nil, ex, errBadJPEG
+			}
+			out.Write(b[start:i])
+		}
+	}
+}
+
+func segment(marker byte, payload []byte) []byte {
+	s := make([]byte, 4, 4+len(payload))
+	s[0], s[1] = 0xFF, marker
+	binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+var (
+	errBadPNG = errors.New("imaging: invalid png")
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// stripPNG saca el chunk eXIf y los de texto (tEXt, zTXt, iTXt: ahí va el XMP).
+// PNG no tiene orientación en la práctica: no se conserva nada.
+func stripPNG(b []byte) ([]byte, Exif, error) {
+	var ex Exif
+	if !bytes.HasPrefix(b, pngMagic) {
+		return nil, ex, errBadPNG
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(pngMagic)
+
+	for i := len(pngMagic); ; {
+		if i+8 > len(b) {
+			return nil, ex, errBadPNG
+		}
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		typ := string(b[i+4 : i+8])
+		if n < 0 || i+12+n > len(b) {
+			return nil, ex, errBadPNG
+		}
+		data := b[i+8 : i+8+n]
+		if crc32.ChecksumIEEE(b[i+4:i+8+n]) != binary.BigEndian.Uint32(b[i+8+n:]) {
+			return nil, ex, errBadPNG
+		}
+		chunk := b[i : i+12+n]
+		i += 12 + n
+
+		switch typ {
+		case "eXIf":
+			if parsed, err := parseExif(data); err == nil {
+				ex = parsed
+			}
+		case "tEXt", "zTXt", "iTXt":
+		default:
+			out.Write(chunk)
+		}
+		if typ == "IEND" {
+			ex.Orientation = 0
+			return out.Bytes(), ex, nil
+		}
+	}
+}
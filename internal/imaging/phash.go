@@ -0,0 +1,74 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// DuplicateMaxDistance: bits de diferencia de pHash hasta los que dos fotos se
+// consideran la misma (recomprimida, reducida, recortada apenas, otro brillo).
+const DuplicateMaxDistance = 6
+
+// pHash: hash perceptual de 64 bits (DCT). Fotos iguales o casi iguales
+// (recomprimidas, reducidas, con otro brillo) dan hashes a pocos bits de
+// distancia; fotos distintas, a ~32.
+func pHash(img *image.RGBA) uint64 {
+	const n = 32
+	small := resize(img, n, n)
+
+	var gray [n][n]float64
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			p := small.Pix[y*small.Stride+x*4:]
+			gray[y][x] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+		}
+	}
+
+	// DCT-II 2D, solo las 8x8 frecuencias más bajas
+	var cos [8][n]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < n; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * n))
+		}
+	}
+	var rows [n][8]float64 // DCT por filas
+	for y := 0; y < n; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < n; x++ {
+				s += gray[y][x] * cos[u][x]
+			}
+			rows[y][u] = s
+		}
+	}
+	coef := make([]float64, 0, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for y := 0; y < n; y++ {
+				s += rows[y][u] * cos[v][y]
+			}
+			coef = append(coef, s)
+		}
+	}
+
+	// la componente continua (brillo medio) no entra en la mediana
+	sorted := slices.Clone(coef[1:])
+	slices.Sort(sorted)
+	median := (sorted[31] + sorted[32]) / 2
+
+	var h uint64
+	for i, c := range coef {
+		if c > median {
+			h |= 1 << uint(i)
+		}
+	}
+	return h
+}
+
+// Distance: bits distintos entre dos hashes (0 = misma imagen).
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,98 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+	"time"
+)
+
+// scene dibuja una imagen con estructura (no ruido) a partir de f, que recibe
+// coordenadas normalizadas 0..1 y devuelve el gris.
+func scene(w, h int, f func(x, y float64) float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := max(0, min(255, f(float64(x)/float64(w), float64(y)/float64(h))))
+			img.SetRGBA(x, y, color.RGBA{uint8(v), uint8(v * 0.8), uint8(255 - v), 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEGAt(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func processedHash(t *testing.T, data []byte) uint64 {
+	t.Helper()
+	res, err := Process(data, "image/jpeg", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.PHash
+}
+
+// La misma foto recomprimida, reducida o con otro brillo queda a
+// DuplicateMaxDistance bits o menos; una foto distinta, bastante más lejos.
+func TestPHashDuplicates(t *testing.T) {
+	base := scene(480, 360, func(x, y float64) float64 {
+		// un equipo claro sobre fondo oscuro, con una franja en diagonal
+		v := 60 + 40*y
+		if x > 0.3 && x < 0.7 && y > 0.2 && y < 0.8 {
+			v = 200 - 30*math.Sin(8*y)
+		}
+		if math.Abs(x-y) < 0.05 {
+			v = 240
+		}
+		return v
+	})
+	original := processedHash(t, encodeJPEGAt(t, base, 92))
+
+	brighter := scene(480, 360, func(x, y float64) float64 {
+		r, _, _, _ := base.At(int(x*480), int(y*360)).RGBA()
+		return float64(r>>8) + 25
+	})
+	for name, data := range map[string][]byte{
+		"recompressed": encodeJPEGAt(t, base, 40),
+		"resized":      encodeJPEGAt(t, resize(base, 240, 180), 80),
+		"brighter":     encodeJPEGAt(t, brighter, 85),
+	} {
+		if d := Distance(original, processedHash(t, data)); d > DuplicateMaxDistance {
+			t.Errorf("%s copy: distance %d, want <= %d", name, d, DuplicateMaxDistance)
+		}
+	}
+
+	for name, img := range map[string]*image.RGBA{
+		"waves": scene(480, 360, func(x, y float64) float64 {
+			return 128 + 100*math.Sin(11*x+7*y)
+		}),
+		"gradient": scene(480, 360, func(x, y float64) float64 {
+			return 255 * (1 - x)
+		}),
+	} {
+		if d := Distance(original, processedHash(t, encodeJPEGAt(t, img, 92))); d <= DuplicateMaxDistance {
+			t.Errorf("unrelated %s image: distance %d, want > %d", name, d, DuplicateMaxDistance)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	if d := Distance(0, 0); d != 0 {
+		t.Errorf("Distance(0, 0) = %d", d)
+	}
+	if d := Distance(0b1011, 0b0110); d != 3 {
+		t.Errorf("Distance(1011, 0110) = %d, want 3", d)
+	}
+	if d := Distance(0, math.MaxUint64); d != 64 {
+		t.Errorf("Distance(0, max) = %d, want 64", d)
+	}
+}
@@ -0,0 +1,146 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"time"
+
+	_ "image/gif" // decoders registrados para image.Decode
+	_ "image/png"
+)
+
+const (
+	ThumbSize = 320  // lado mayor de la miniatura (listas, reportes, línea de tiempo)
+	WebSize   = 1600 // lado mayor de la versión para ver en pantalla
+
+	// maxPixels: arriba de esto no se decodifica (una imagen chica en bytes
+	// puede pedir GBs de memoria). 60 MP cubre cualquier teléfono.
+	maxPixels = 60_000_000
+)
+
+var (
+	ErrUnsupported = errors.New("imaging: unsupported image format")
+	ErrTooLarge    = errors.New("imaging: image dimensions too large")
+)
+
+// heifBrands: marcas ftyp de HEIF (HEIC de iPhone, AVIF).
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "mif1": true, "msf1": true,
+	"avif": true, "avis": true,
+}
+
+// IsHEIF dice si head (los primeros bytes del archivo) es HEIF. La stdlib no
+// lo decodifica ni http.DetectContentType lo reconoce (da
+// application/octet-stream), y su EXIF (con GPS) va dentro de la estructura de
+// cajas, que no sabemos limpiar: quien reciba fotos tiene que rechazarlo en
+// vez de guardarlo con la ubicación adentro.
+func IsHEIF(head []byte) bool {
+	if len(head) < 16 || string(head[4:8]) != "ftyp" {
+		return false
+	}
+	n := int(binary.BigEndian.Uint32(head))
+	if n < 16 || n > len(head) {
+		n = len(head)
+	}
+	// marca principal en 8..12, versión en 12..16 y después las compatibles
+	if heifBrands[string(head[8:12])] {
+		return true
+	}
+	for i := 16; i+4 <= n; i += 4 {
+		if heifBrands[string(head[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// Result de procesar una foto.
+type Result struct {
+	// Original sin metadata (nil si no había nada que sacar): reemplaza al subido.
+	Original []byte
+
+	Thumb, Web    []byte // JPEG, ya derechas y sin metadata
+	Width, Height int    // del original, ya derecho
+
+	TakenAt  *time.Time
+	Lat, Lng *float64
+	PHash    uint64
+}
+
+// Process limpia la metadata, endereza y genera las versiones de una foto.
+// contentType es el detectado del contenido (image/jpeg, image/png, image/gif).
+// La hora de captura sin zona se interpreta en loc (la del provider).
+func Process(data []byte, contentType string, loc *time.Location) (*Result, error) {
+	var (
+		stripped []byte
+		ex       Exif
+		err      error
+	)
+	switch contentType {
+	case "image/jpeg":
+		stripped, ex, err = stripJPEG(data)
+	case "image/png":
+		stripped, ex, err = stripPNG(data)
+	case "image/gif":
+		stripped = data // GIF no lleva EXIF
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{
+		TakenAt: ex.TakenAt(loc),
+		Lat:     ex.Lat,
+		Lng:     ex.Lng,
+	}
+	if !bytes.Equal(stripped, data) {
+		res.Original = stripped
+	}
+
+	// Se reduce antes de girar (girar 12 MP pixel a pixel es lo caro); el
+	// lado mayor es el mismo antes y después de girar.
+	src := toRGBA(img)
+	res.Width, res.Height = src.Rect.Dx(), src.Rect.Dy()
+	if ex.Orientation >= 5 {
+		res.Width, res.Height = res.Height, res.Width
+	}
+	w, h := fitSize(src.Rect.Dx(), src.Rect.Dy(), WebSize)
+	web := orient(resize(src, w, h), ex.Orientation)
+	w, h = fitSize(web.Rect.Dx(), web.Rect.Dy(), ThumbSize)
+	thumb := resize(web, w, h)
+	res.PHash = pHash(web)
+
+	if res.Web, err = encodeJPEG(web, 82); err != nil {
+		return nil, err
+	}
+	if res.Thumb, err = encodeJPEG(thumb, 75); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
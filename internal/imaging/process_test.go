@@ -0,0 +1,328 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// =========================
+// Fixtures
+// =========================
+
+// exifFixture arma un bloque TIFF big-endian como el de una cámara: IFD0 con
+// Orientation y los punteros, IFD Exif (DateTimeOriginal con offset -05:00) e
+// IFD GPS (4°36'N 74°5'W, Bogotá).
+func exifFixture(orientation int) []byte {
+	be := binary.BigEndian
+	b := make([]byte, 210)
+	copy(b, "MM\x00\x2a\x00\x00\x00\x08")
+	entry := func(at int, tag, typ uint16, count, value uint32) {
+		be.PutUint16(b[at:], tag)
+		be.PutUint16(b[at+2:], typ)
+		be.PutUint32(b[at+4:], count)
+		be.PutUint32(b[at+8:], value)
+	}
+	rational := func(at int, dms ...uint32) {
+		for i, v := range dms {
+			be.PutUint32(b[at+i*8:], v)
+			be.PutUint32(b[at+i*8+4:], 1)
+		}
+	}
+
+	be.PutUint16(b[8:], 3) // IFD0 en 8
+	entry(10, tagOrientation, 3, 1, uint32(orientation)<<16)
+	entry(22, tagExifIFD, 4, 1, 50)
+	entry(34, tagGPSIFD, 4, 1, 108)
+
+	be.PutUint16(b[50:], 2) // IFD Exif en 50
+	entry(52, tagDateTimeOriginal, 2, 20, 80)
+	entry(64, tagOffsetTimeOriginal, 2, 7, 100)
+	copy(b[80:], "2025:03:01 10:20:30\x00")
+	copy(b[100:], "-05:00\x00")
+
+	be.PutUint16(b[108:], 4) // IFD GPS en 108
+	entry(110, tagGPSLatRef, 2, 2, 'N'<<24)
+	entry(122, tagGPSLat, 5, 3, 162)
+	entry(134, tagGPSLngRef, 2, 2, 'W'<<24)
+	entry(146, tagGPSLng, 5, 3, 186)
+	rational(162, 4, 36, 0)
+	rational(186, 74, 5, 0)
+	return b
+}
+
+func exifSegment(orientation int) []byte {
+	return segment(0xE1, append([]byte("Exif\x00\x00"), exifFixture(orientation)...))
+}
+
+// quadrants: 64x32 con cada cuadrante de un color (así se nota cualquier giro
+// o espejo).
+var quadrantColors = [4]color.RGBA{
+	{255, 0, 0, 255},     // arriba izquierda
+	{0, 255, 0, 255},     // arriba derecha
+	{0, 0, 255, 255},     // abajo izquierda
+	{255, 255, 255, 255}, // abajo derecha
+}
+
+func quadrants() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetRGBA(x, y, quadrantColors[y/16*2+x/32])
+		}
+	}
+	return img
+}
+
+// encodeWith codifica img como JPEG y mete segments justo después del SOI.
+func encodeWith(t *testing.T, img image.Image, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	out := append([]byte{}, b[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, b[2:]...)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	c := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(c, uint32(len(data)))
+	copy(c[4:], typ)
+	c = append(c, data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+func checkBogota(t *testing.T, res *Result) {
+	t.Helper()
+	want := time.Date(2025, 3, 1, 15, 20, 30, 0, time.UTC)
+	if res.TakenAt == nil || !res.TakenAt.Equal(want) {
+		t.Errorf("TakenAt = %v, want %v", res.TakenAt, want)
+	}
+	if res.Lat == nil || res.Lng == nil || *res.Lat != 4.6 || *res.Lng != -74.0833333 {
+		t.Errorf("Lat, Lng = %v, %v; want 4.6, -74.0833333", res.Lat, res.Lng)
+	}
+}
+
+// =========================
+// Metadata
+// =========================
+
+// Del original sale todo lo que puede ubicar al técnico (EXIF con GPS, XMP,
+// IPTC, comentarios, índice MPF y las imágenes pegadas después del EOI), pero
+// hora y ubicación quedan en el Result para uso interno.
+func TestProcessStripsJPEGMetadata(t *testing.T) {
+	trailer := encodeWith(t, image.NewRGBA(image.Rect(0, 0, 8, 8)),
+		exifSegment(1),
+		segment(0xFE, []byte("trailer-secret")),
+	)
+	data := encodeWith(t, quadrants(),
+		exifSegment(6),
+		segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>exif:GPSLatitude=4,36N</x:xmpmeta>")),
+		segment(0xE2, []byte("MPF\x00MM\x00\x2a\x00\x00\x00\x08")),
+		segment(0xED, []byte("Photoshop 3.0\x00city=Bogota")),
+		segment(0xFE, []byte("comment-secret")),
+	)
+	data = append(data, trailer...)
+
+	res, err := Process(data, "image/jpeg", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBogota(t, res)
+	if res.Original == nil {
+		t.Fatal("Original = nil, want a stripped copy")
+	}
+	for _, leak := range []string{"ns.adobe.com/xap", "MPF\x00", "Photoshop", "comment-secret", "trailer-secret"} {
+		if bytes.Contains(res.Original, []byte(leak)) {
+			t.Errorf("stripped original still contains %q", leak)
+		}
+	}
+	if !bytes.HasSuffix(res.Original, []byte{0xFF, 0xD9}) {
+		t.Error("stripped original does not end at EOI")
+	}
+
+	// Del EXIF solo queda la orientación (sin ella la foto se vería girada).
+	_, ex, err := stripJPEG(res.Original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Orientation != 6 || ex.DateTime != "" || ex.Lat != nil || ex.Lng != nil {
+		t.Errorf("exif left in original = %+v, want only Orientation 6", ex)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(res.Original)); err != nil {
+		t.Errorf("stripped original does not decode: %v", err)
+	}
+}
+
+func TestProcessCleanJPEGKeepsOriginal(t *testing.T) {
+	res, err := Process(encodeWith(t, quadrants()), "image/jpeg", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Original != nil {
+		t.Error("Original != nil for a JPEG without metadata")
+	}
+	if res.TakenAt != nil || res.Lat != nil {
+		t.Errorf("TakenAt, Lat = %v, %v; want nil", res.TakenAt, res.Lat)
+	}
+}
+
+func TestProcessStripsPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, quadrants()); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	const afterIHDR = 8 + 25 // magic + IHDR
+	var data []byte
+	data = append(data, b[:afterIHDR]...)
+	data = append(data, pngChunk("eXIf", exifFixture(1))...)
+	data = append(data, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00png-secret"))...)
+	data = append(data, b[afterIHDR:]...)
+
+	res, err := Process(data, "image/png", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBogota(t, res)
+	if res.Original == nil {
+		t.Fatal("Original = nil, want a stripped copy")
+	}
+	for _, leak := range []string{"eXIf", "com.adobe.xmp", "png-secret"} {
+		if bytes.Contains(res.Original, []byte(leak)) {
+			t.Errorf("stripped png still contains %q", leak)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(res.Original)); err != nil {
+		t.Errorf("stripped png does not decode: %v", err)
+	}
+}
+
+// HEIF (fotos de iPhone) no se sabe limpiar: IsHEIF lo reconoce para que la
+// subida lo rechace, y Process no lo toma.
+func TestHEIF(t *testing.T) {
+	ftyp := func(major string, compatible ...string) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(16+4*len(compatible)))
+		b = append(b, "ftyp"+major+"\x00\x00\x00\x00"...)
+		for _, c := range compatible {
+			b = append(b, c...)
+		}
+		return append(b, "\x00\x00\x00\x08meta"...)
+	}
+	for _, c := range []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{"heic", ftyp("heic", "mif1", "heic"), true},
+		{"mif1", ftyp("mif1", "mif1", "heic"), true},
+		{"heif compatible only", ftyp("isom", "mif1"), true},
+		{"avif", ftyp("avif", "mif1", "miaf"), true},
+		{"mp4", ftyp("isom", "isom", "mp42"), false},
+		{"jpeg", encodeWith(t, quadrants()), false},
+		{"short", []byte("\x00\x00\x00\x10ftyphe"), false},
+	} {
+		if got := IsHEIF(c.head); got != c.want {
+			t.Errorf("IsHEIF(%s) = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	if _, err := Process(ftyp("heic", "mif1"), "image/heic", time.UTC); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Process(heic) = %v, want ErrUnsupported", err)
+	}
+}
+
+// =========================
+// Orientación
+// =========================
+
+// remap arma una imagen dw x dh tomando cada pixel de src en from(x, y).
+func remap(src *image.RGBA, dw, dh int, from func(x, y int) (int, int)) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := from(x, y)
+			dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// stored devuelve cómo guarda la cámara la imagen upright para cada
+// orientación EXIF: la inversa de la transformación que hay que aplicar al
+// mostrarla.
+func stored(upright *image.RGBA, orientation int) *image.RGBA {
+	w, h := upright.Rect.Dx(), upright.Rect.Dy()
+	switch orientation {
+	case 2: // se muestra con espejo horizontal
+		return remap(upright, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+	case 3: // girada 180°
+		return remap(upright, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+	case 4: // espejo vertical
+		return remap(upright, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+	case 5: // transpuesta
+		return remap(upright, h, w, func(x, y int) (int, int) { return y, x })
+	case 6: // se muestra girando 90° horario => guardada a 90° antihorario
+		return remap(upright, h, w, func(x, y int) (int, int) { return w - 1 - y, x })
+	case 7: // transversa
+		return remap(upright, h, w, func(x, y int) (int, int) { return w - 1 - y, h - 1 - x })
+	case 8: // se muestra girando 90° antihorario => guardada a 90° horario
+		return remap(upright, h, w, func(x, y int) (int, int) { return y, h - 1 - x })
+	}
+	return upright
+}
+
+func near(a, b color.RGBA) bool {
+	d := func(x, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return d(a.R, b.R) < 60 && d(a.G, b.G) < 60 && d(a.B, b.B) < 60
+}
+
+// Para cada orientación EXIF, miniatura y versión web salen derechas y las
+// dimensiones informadas son las de la foto ya derecha.
+func TestProcessOrientation(t *testing.T) {
+	upright := quadrants()
+	for o := 1; o <= 8; o++ {
+		res, err := Process(encodeWith(t, stored(upright, o), exifSegment(o)), "image/jpeg", time.UTC)
+		if err != nil {
+			t.Fatalf("orientation %d: %v", o, err)
+		}
+		if res.Width != 64 || res.Height != 32 {
+			t.Errorf("orientation %d: size %dx%d, want 64x32", o, res.Width, res.Height)
+		}
+		for name, data := range map[string][]byte{"thumb": res.Thumb, "web": res.Web} {
+			img, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("orientation %d %s: %v", o, name, err)
+			}
+			rgba := toRGBA(img)
+			if b := rgba.Rect; b.Dx() != 64 || b.Dy() != 32 {
+				t.Errorf("orientation %d %s: size %dx%d, want 64x32", o, name, b.Dx(), b.Dy())
+				continue
+			}
+			for q, want := range quadrantColors {
+				x, y := 16+q%2*32, 8+q/2*16
+				if got := rgba.RGBAAt(x, y); !near(got, want) {
+					t.Errorf("orientation %d %s: pixel (%d,%d) = %v, want ~%v", o, name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
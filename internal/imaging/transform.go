@@ -0,0 +1,101 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
+
+// fitSize: dimensiones para que el lado mayor sea limit (nunca agranda).
+func fitSize(w, h, limit int) (int, int) {
+	if w <= limit && h <= limit {
+		return w, h
+	}
+	if w >= h {
+		return limit, max(1, h*limit/w)
+	}
+	return max(1, w*limit/h), limit
+}
+
+// resize reduce con promedio de área (box filter): cada pixel destino es el
+// promedio del bloque de origen que cubre. Para achicar fotos alcanza y no
+// necesita nada fuera de la stdlib.
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if w == sw && h == sh {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0, y1 := dy*sh/h, (dy+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for dx := 0; dx < w; dx++ {
+			x0, x1 := dx*sw/w, (dx+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				p := src.Pix[y*src.Stride+x0*4 : y*src.Stride+x1*4]
+				for k := 0; k < len(p); k += 4 {
+					r += uint64(p[k])
+					g += uint64(p[k+1])
+					b += uint64(p[k+2])
+					a += uint64(p[k+3])
+					n++
+				}
+			}
+			o := dy*dst.Stride + dx*4
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] =
+				uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orient aplica la orientación EXIF (1..8) para que la imagen quede derecha.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // 5..8 rotan 90°: se invierten los lados
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var nx, ny int
+			switch orientation {
+			case 2: // espejo horizontal
+				nx, ny = w-1-x, y
+			case 3: // 180°
+				nx, ny = w-1-x, h-1-y
+			case 4: // espejo vertical
+				nx, ny = x, h-1-y
+			case 5: // transpuesta
+				nx, ny = y, x
+			case 6: // 90° horario
+				nx, ny = h-1-y, x
+			case 7: // transversa
+				nx, ny = h-1-y, w-1-x
+			case 8: // 90° antihorario
+				nx, ny = y, w-1-x
+			}
+			copy(dst.Pix[ny*dst.Stride+nx*4:ny*dst.Stride+nx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,52 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+func readCSV(data []byte) ([]Row, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if !utf8.Valid(data) {
+		return nil, errors.New("csv must be UTF-8")
+	}
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = sniffDelimiter(data)
+	cr.FieldsPerRecord = -1 // filas cortas: Sheet.Get devuelve "" para lo que falta
+	cr.LazyQuotes = true
+
+	var rows []Row
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, Row{Line: line, Cells: rec})
+		if len(rows) > MaxRows+1 {
+			return nil, ErrTooLarge
+		}
+	}
+	return rows, nil
+}
+
+// sniffDelimiter: Excel en español exporta con ";" (la coma es el separador decimal).
+func sniffDelimiter(data []byte) rune {
+	first := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		first = data[:i]
+	}
+	if bytes.Count(first, []byte(";")) > bytes.Count(first, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
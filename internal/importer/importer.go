@@ -0,0 +1,119 @@
+// Package importer lee planillas (CSV o XLSX) como una tabla de texto:
+// encabezados normalizados + filas. No sabe nada de customers ni equipos; la
+// validación y la carga las hace quien lo usa (httpapi).
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+
+	// MaxRows: más que esto se parte en varios archivos.
+	MaxRows = 5000
+)
+
+var (
+	ErrEmpty    = errors.New("file has no header row")
+	ErrTooLarge = errors.New("too many rows (max 5000)")
+)
+
+// Row es una fila de datos. Line es el número de fila en la planilla (1 = encabezado).
+type Row struct {
+	Line  int
+	Cells []string
+}
+
+type Sheet struct {
+	Format string
+	Header []string // en minúsculas, sin espacios alrededor
+	Rows   []Row
+
+	index map[string]int
+}
+
+// Has: la planilla trae esa columna.
+func (s *Sheet) Has(col string) bool {
+	_, ok := s.index[col]
+	return ok
+}
+
+// Get devuelve la celda de la columna (trim); "" si no existe.
+func (s *Sheet) Get(r Row, col string) string {
+	i, ok := s.index[col]
+	if !ok || i >= len(r.Cells) {
+		return ""
+	}
+	return strings.TrimSpace(r.Cells[i])
+}
+
+// DetectFormat mira el contenido: un XLSX es un zip ("PK\x03\x04"), lo demás se trata como CSV.
+func DetectFormat(data []byte) string {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return FormatXLSX
+	}
+	return FormatCSV
+}
+
+// Read parsea el archivo según su formato. La primera fila no vacía es el encabezado.
+func Read(data []byte) (*Sheet, error) {
+	format := DetectFormat(data)
+
+	var (
+		rows []Row
+		err  error
+	)
+	if format == FormatXLSX {
+		rows, err = readXLSX(data)
+	} else {
+		rows, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newSheet(format, rows)
+}
+
+func newSheet(format string, rows []Row) (*Sheet, error) {
+	// filas en blanco (comunes al final de una planilla) no cuentan
+	kept := rows[:0]
+	for _, r := range rows {
+		if !blank(r.Cells) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(kept)-1 > MaxRows {
+		return nil, ErrTooLarge
+	}
+
+	s := &Sheet{
+		Format: format,
+		Rows:   kept[1:],
+		index:  map[string]int{},
+	}
+	for i, h := range kept[0].Cells {
+		h = strings.ToLower(strings.TrimSpace(h))
+		s.Header = append(s.Header, h)
+		if _, dup := s.index[h]; h != "" && !dup {
+			s.index[h] = i
+		}
+	}
+	return s, nil
+}
+
+func blank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
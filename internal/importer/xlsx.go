@@ -0,0 +1,261 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lector mínimo de XLSX (Office Open XML): solo la primera hoja, valores de
+// celda como texto. Fórmulas => el último valor calculado que guardó Excel.
+
+// maxXMLPart: tope por archivo descomprimido (un zip chico puede inflarse mucho).
+const maxXMLPart = 64 << 20
+
+func readXLSX(data []byte) ([]Row, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("invalid xlsx file")
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, errors.New("xlsx: worksheet not found")
+	}
+	return readWorksheet(f, shared)
+}
+
+func openPart(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rc, maxXMLPart), rc}, nil
+}
+
+func decodePart(f *zip.File, v any) error {
+	rc, err := openPart(f)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// firstSheetPath sigue workbook.xml -> workbook.xml.rels hasta la primera hoja.
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	wbf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("xlsx: workbook not found")
+	}
+	var wb struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(wbf, &wb); err != nil {
+		return "", errors.New("xlsx: invalid workbook")
+	}
+	if len(wb.Sheets) == 0 {
+		return "", errors.New("xlsx: workbook has no sheets")
+	}
+
+	relf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback, nil
+	}
+	var rels struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(relf, &rels); err != nil {
+		return "", errors.New("xlsx: invalid workbook relationships")
+	}
+	for _, rel := range rels.Items {
+		if rel.ID != wb.Sheets[0].RID {
+			continue
+		}
+		// Target es relativo a xl/ ("worksheets/sheet1.xml") o absoluto ("/xl/worksheets/sheet1.xml")
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// richText: <si> y <is> pueden traer el texto directo (<t>) o en tramos con formato (<r><t>).
+type richText struct {
+	T    string   `xml:"t"`
+	Runs []string `xml:"r>t"`
+}
+
+func (rt richText) String() string {
+	if len(rt.Runs) == 0 {
+		return rt.T
+	}
+	return rt.T + strings.Join(rt.Runs, "")
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []richText `xml:"si"`
+	}
+	if err := decodePart(f, &sst); err != nil {
+		return nil, errors.New("xlsx: invalid shared strings")
+	}
+	out := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		out[i] = si.String()
+	}
+	return out, nil
+}
+
+type xlsxCell struct {
+	Ref    string   `xml:"r,attr"`
+	Type   string   `xml:"t,attr"`
+	Value  string   `xml:"v"`
+	Inline richText `xml:"is"`
+}
+
+func readWorksheet(f *zip.File, shared []string) ([]Row, error) {
+	rc, err := openPart(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// Decodificamos fila por fila para no cargar la hoja entera como árbol.
+	dec := xml.NewDecoder(rc)
+	var rows []Row
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.New("xlsx: invalid worksheet")
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "row" {
+			continue
+		}
+
+		var xr struct {
+			Num   int        `xml:"r,attr"`
+			Cells []xlsxCell `xml:"c"`
+		}
+		if err := dec.DecodeElement(&xr, &se); err != nil {
+			return nil, errors.New("xlsx: invalid row")
+		}
+		if xr.Num == 0 { // r es opcional: entonces va en orden
+			xr.Num = len(rows) + 1
+		}
+
+		row := Row{Line: xr.Num}
+		for i, c := range xr.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(row.Cells) <= col {
+				row.Cells = append(row.Cells, "")
+			}
+			if row.Cells[col], err = cellText(c, shared); err != nil {
+				return nil, err
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > MaxRows+1 {
+			return nil, ErrTooLarge
+		}
+	}
+	return rows, nil
+}
+
+func cellText(c xlsxCell, shared []string) (string, error) {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(shared) {
+			return "", errors.New("xlsx: invalid shared string reference " + c.Ref)
+		}
+		return shared[i], nil
+	case "inlineStr":
+		return c.Inline.String(), nil
+	case "b":
+		if c.Value == "1" {
+			return "true", nil
+		}
+		return "false", nil
+	}
+	// n (default), str, e: el valor tal cual
+	return c.Value, nil
+}
+
+// columnIndex: "A1" -> 0, "AB12" -> 27. Excel llega hasta XFD (16384); el
+// límite se chequea letra a letra para que una ref larga no desborde n.
+func columnIndex(ref string) (int, error) {
+	invalid := errors.New("xlsx: invalid cell reference " + ref)
+	n := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		n = n*26 + int(ref[i]-'A'+1)
+		if n > 16384 {
+			return 0, invalid
+		}
+	}
+	if i == 0 {
+		return 0, invalid
+	}
+	return n - 1, nil
+}
+
+// excelEpoch: Excel cuenta días desde 1899-12-30 (arrastrando el bug del 1900 bisiesto).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// ParseDate acepta YYYY-MM-DD, DD/MM/YYYY o un número de serie de Excel (las
+// celdas con formato fecha llegan así desde un XLSX).
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{"2006-01-02", "02/01/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial >= 1 && serial < 2958466 {
+		return excelEpoch.AddDate(0, 0, int(serial)), nil
+	}
+	return time.Time{}, errors.New("invalid date")
+}
@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+)
+
+// InvitationSweeper marca las invitaciones que llevan más de Grace vencidas
+// sin usarse y reporta (en el log) a los usuarios que nunca activaron su cuenta.
+type InvitationSweeper struct {
+	DB       *db.DB
+	Interval time.Duration
+	Grace    time.Duration
+}
+
+// Run corre un barrido al arrancar y luego cada Interval, hasta que ctx se cancele.
+func (s *InvitationSweeper) Run(ctx context.Context) {
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+
+	for {
+		if err := s.SweepOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[INVITES] sweep error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *InvitationSweeper) SweepOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	// Barre todos los providers: corre como sistema (sin filtro RLS).
+	ctx, release, err := s.DB.WithSystem(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Marcamos y en el mismo paso sacamos a quién pertenecían. Solo se reporta
+	// al usuario si no tiene otra invitación viva ni usada (o sea, quedó colgado).
+	rows, err := s.DB.Query(ctx, `
+		WITH swept AS (
+			UPDATE user_invitation
+			SET swept_at = now()
+			WHERE used_at IS NULL
+			  AND revoked_at IS NULL
+			  AND swept_at IS NULL
+			  AND expires_at < now() - make_interval(secs => $1)
+			RETURNING service_provider_id, user_id, expires_at
+		)
+		SELECT DISTINCT ON (sw.user_id)
+		       sp.name, u.id, u.email, u.role, sw.expires_at
+		FROM swept sw
+		JOIN service_provider sp ON sp.id = sw.service_provider_id
+		JOIN "user" u ON u.id = sw.user_id
+		WHERE u.is_active
+		  AND NOT EXISTS (
+		    SELECT 1 FROM user_invitation i
+		    WHERE i.user_id = u.id
+		      AND (i.used_at IS NOT NULL OR (i.revoked_at IS NULL AND i.expires_at > now()))
+		  )
+		ORDER BY sw.user_id, sw.expires_at DESC
+	`, s.Grace.Seconds())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var (
+			provider, userID, email, role string
+			expiresAt                     time.Time
+		)
+		if err := rows.Scan(&provider, &userID, &email, &role, &expiresAt); err != nil {
+			return err
+		}
+		log.Printf("[INVITES] never activated provider=%q user=%s email=%s role=%s invite_expired=%s",
+			provider, userID, email, role, expiresAt.Format(time.RFC3339))
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if n > 0 {
+		log.Printf("[INVITES] sweep done: %d users never activated", n)
+	}
+	return nil
+}
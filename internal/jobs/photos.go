@@ -0,0 +1,279 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/imaging"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+)
+
+const (
+	photoMaxAttempts = 3
+	// photoStaleAfter: una foto que quedó en processing más que esto (se cayó la
+	// instancia a mitad) vuelve a tomarse.
+	photoStaleAfter = 15 * time.Minute
+	maxPhotoBytes   = 110 << 20
+)
+
+// PhotoProcessor procesa las fotos subidas fuera de la request: reemplaza el
+// original por una copia sin metadata (guarda hora y ubicación en la fila,
+// para uso interno), genera miniatura y versión web derechas, registra
+// dimensiones y marca las repetidas (duplicate_of). Despierta cada Interval o
+// con Wake.
+type PhotoProcessor struct {
+	DB       *db.DB
+	Storage  storage.Storage
+	Interval time.Duration
+	Batch    int // 0 => 10 por vuelta
+
+	wake chan struct{}
+}
+
+func NewPhotoProcessor(database *db.DB, store storage.Storage, interval time.Duration) *PhotoProcessor {
+	return &PhotoProcessor{DB: database, Storage: store, Interval: interval, wake: make(chan struct{}, 1)}
+}
+
+// Wake avisa que hay fotos nuevas (no bloquea).
+func (p *PhotoProcessor) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run procesa lo pendiente al arrancar y luego cada Interval o con Wake, hasta que ctx se cancele.
+func (p *PhotoProcessor) Run(ctx context.Context) {
+	t := time.NewTicker(p.Interval)
+	defer t.Stop()
+
+	for {
+		for {
+			n, err := p.ProcessOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("[PHOTOS] process error: %v", err)
+			}
+			if err != nil || n < p.batch() {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-p.wake:
+		}
+	}
+}
+
+func (p *PhotoProcessor) batch() int {
+	if p.Batch <= 0 {
+		return 10
+	}
+	return p.Batch
+}
+
+type pendingPhoto struct {
+	id, storageKey, contentType, timezone string
+	attempts                              int
+}
+
+// ProcessOnce toma un lote de fotos pendientes y las procesa. Devuelve cuántas tomó.
+func (p *PhotoProcessor) ProcessOnce(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	// Todos los providers: corre como sistema (sin filtro RLS).
+	ctx, release, err := p.DB.WithSystem(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	batch := p.batch()
+	rows, err := p.DB.Query(ctx, `
+		UPDATE work_order_attachment f
+		SET processing_status = 'processing', processing_started_at = now(),
+		    processing_attempts = processing_attempts + 1
+		WHERE f.id IN (
+			SELECT id FROM work_order_attachment
+			WHERE processing_status = 'pending'
+			   OR (processing_status = 'processing' AND processing_started_at < now() - make_interval(secs => $2))
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING f.id, f.storage_key, COALESCE(f.content_type, ''),
+		          f.processing_attempts,
+		          COALESCE((SELECT ps.timezone FROM provider_settings ps
+		                    WHERE ps.service_provider_id = f.service_provider_id), 'UTC')
+	`, batch, photoStaleAfter.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	queue := make([]pendingPhoto, 0, batch)
+	for rows.Next() {
+		var ph pendingPhoto
+		if err := rows.Scan(&ph.id, &ph.storageKey, &ph.contentType, &ph.attempts, &ph.timezone); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		queue = append(queue, ph)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, ph := range queue {
+		if err := p.process(ctx, ph); err != nil {
+			if ctx.Err() != nil {
+				return len(queue), ctx.Err()
+			}
+			p.fail(ctx, ph, err)
+		}
+	}
+	return len(queue), nil
+}
+
+func (p *PhotoProcessor) process(ctx context.Context, ph pendingPhoto) error {
+	obj, err := p.Storage.Get(ctx, ph.storageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(obj, maxPhotoBytes))
+	obj.Close()
+	if err != nil {
+		return err
+	}
+
+	loc, err := time.LoadLocation(ph.timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	res, err := imaging.Process(data, ph.contentType, loc)
+	if errors.Is(err, imaging.ErrUnsupported) {
+		_, err = p.DB.Exec(ctx, `
+			UPDATE work_order_attachment
+			SET processing_status = 'unsupported', processed_at = now(), processing_error = NULL
+			WHERE id = $1
+		`, ph.id)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// La copia sin metadata va a otra key y la fila pasa a apuntarle recién al
+	// marcarla done: si algo falla antes, el reintento vuelve a leer el original
+	// (con su EXIF) y no una copia ya limpia de la que no sale ni hora ni GPS.
+	// La key es fija, así un reintento pisa la copia anterior en vez de dejarla.
+	cleanKey, size := ph.storageKey, int64(len(data))
+	if res.Original != nil {
+		cleanKey, size = ph.storageKey+".clean", int64(len(res.Original))
+		if err := p.Storage.Put(ctx, cleanKey, bytes.NewReader(res.Original), size, ph.contentType); err != nil {
+			return err
+		}
+	}
+	thumbKey, webKey := ph.storageKey+".thumb.jpg", ph.storageKey+".web.jpg"
+	if err := p.Storage.Put(ctx, thumbKey, bytes.NewReader(res.Thumb), int64(len(res.Thumb)), "image/jpeg"); err != nil {
+		return err
+	}
+	if err := p.Storage.Put(ctx, webKey, bytes.NewReader(res.Web), int64(len(res.Web)), "image/jpeg"); err != nil {
+		return err
+	}
+
+	tx, err := p.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE work_order_attachment
+		SET processing_status = 'done', processed_at = now(), processing_error = NULL,
+		    storage_key = $2, size_bytes = $3, thumb_key = $4, web_key = $5,
+		    width = $6, height = $7, taken_at = $8, gps_lat = $9, gps_lng = $10, phash = $11
+		WHERE id = $1 AND processing_status = 'processing' AND storage_key = $12
+	`, ph.id, cleanKey, size, thumbKey, webKey, res.Width, res.Height,
+		res.TakenAt, res.Lat, res.Lng, int64(res.PHash), ph.storageKey)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		// Si la fila sigue, otra vuelta la tomó por vencida y ya la terminó:
+		// las keys son las mismas y están en uso.
+		var exists bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM work_order_attachment WHERE id = $1)`, ph.id).Scan(&exists)
+		if err != nil || exists {
+			return err
+		}
+		// lo borraron mientras se procesaba: el trigger no conoció estas keys
+		orphans := []string{thumbKey, webKey}
+		if cleanKey != ph.storageKey {
+			orphans = append(orphans, cleanKey)
+		}
+		for _, k := range orphans {
+			if err := p.Storage.Delete(ctx, k); err != nil {
+				log.Printf("[PHOTOS] orphan %s: %v", k, err)
+			}
+		}
+		return nil
+	}
+	// el original con metadata lo borra jobs.StorageSweeper
+	if cleanKey != ph.storageKey {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO storage_deletion (service_provider_id, storage_key)
+			SELECT service_provider_id, $2 FROM work_order_attachment WHERE id = $1
+		`, ph.id, ph.storageKey)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// La foto más parecida ya subida en el provider, si está a pocos bits.
+	_, err = p.DB.Exec(ctx, `
+		UPDATE work_order_attachment me
+		SET duplicate_of = (
+			SELECT f.id FROM work_order_attachment f
+			WHERE f.service_provider_id = me.service_provider_id
+			  AND f.id <> me.id
+			  AND f.phash IS NOT NULL
+			  AND (f.created_at, f.id) < (me.created_at, me.id)
+			  AND bit_count((f.phash # me.phash)::bit(64)) <= $2
+			ORDER BY bit_count((f.phash # me.phash)::bit(64)), f.created_at
+			LIMIT 1
+		)
+		WHERE me.id = $1
+	`, ph.id, imaging.DuplicateMaxDistance)
+	return err
+}
+
+// fail deja la foto para reintentar o, después de photoMaxAttempts, como failed.
+func (p *PhotoProcessor) fail(ctx context.Context, ph pendingPhoto, cause error) {
+	status := "pending"
+	if ph.attempts >= photoMaxAttempts {
+		status = "failed"
+	}
+	msg := cause.Error()
+	if len(msg) > 500 {
+		msg = msg[:500]
+	}
+	log.Printf("[PHOTOS] attachment=%s attempt %d: %v", ph.id, ph.attempts, cause)
+	_, err := p.DB.Exec(ctx, `
+		UPDATE work_order_attachment
+		SET processing_status = $2, processing_error = $3
+		WHERE id = $1 AND processing_status = 'processing'
+	`, ph.id, status, msg)
+	if err != nil {
+		log.Printf("[PHOTOS] mark attachment=%s as %s: %v", ph.id, status, err)
+	}
+}
@@ -0,0 +1,329 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/imaging"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+)
+
+// memStorage: storage.Storage en memoria. beforePut, si no es nil, corre antes
+// de cada Put y si devuelve error el Put falla (así se corta el procesamiento
+// en el punto que haga falta).
+type memStorage struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	beforePut func(key string) error
+}
+
+func (m *memStorage) Put(_ context.Context, key string, r io.Reader, size int64, _ string) error {
+	if m.beforePut != nil {
+		if err := m.beforePut(key); err != nil {
+			return err
+		}
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) != size {
+		return fmt.Errorf("put %s: got %d bytes, want %d", key, len(b), size)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = b
+	return nil
+}
+
+func (m *memStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memStorage) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memStorage) object(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	return b, ok
+}
+
+// gpsJPEG: un JPEG chico con EXIF de cámara (DateTime 2025:03:01 10:20:30 y
+// GPS 4°36'N 74°5'W).
+func gpsJPEG(t *testing.T) []byte {
+	t.Helper()
+	be := binary.BigEndian
+	x := make([]byte, 160)
+	copy(x, "MM\x00\x2a\x00\x00\x00\x08")
+	entry := func(at int, tag, typ uint16, count, value uint32) {
+		be.PutUint16(x[at:], tag)
+		be.PutUint16(x[at+2:], typ)
+		be.PutUint32(x[at+4:], count)
+		be.PutUint32(x[at+8:], value)
+	}
+	be.PutUint16(x[8:], 2) // IFD0: DateTime y puntero al IFD GPS
+	entry(10, 0x0132, 2, 20, 38)
+	entry(22, 0x8825, 4, 1, 58)
+	copy(x[38:], "2025:03:01 10:20:30\x00")
+	be.PutUint16(x[58:], 4) // IFD GPS
+	entry(60, 0x0001, 2, 2, 'N'<<24)
+	entry(72, 0x0002, 5, 3, 112)
+	entry(84, 0x0003, 2, 2, 'W'<<24)
+	entry(96, 0x0004, 5, 3, 136)
+	for i, v := range []uint32{4, 36, 0, 74, 5, 0} {
+		be.PutUint32(x[112+i*8:], v)
+		be.PutUint32(x[112+i*8+4:], 1)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30)), nil); err != nil {
+		t.Fatal(err)
+	}
+	app1 := append([]byte("Exif\x00\x00"), x...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	be.PutUint16(seg[2:], uint16(len(app1)+2))
+	out := append([]byte{}, buf.Bytes()[:2]...)
+	out = append(out, seg...)
+	out = append(out, app1...)
+	return append(out, buf.Bytes()[2:]...)
+}
+
+type photoRow struct {
+	status, processingError, storageKey string
+	attempts                            int
+	takenAt                             *time.Time
+	lat                                 *float64
+}
+
+// TestPhotoProcessor corre el job contra Postgres real con el storage en
+// memoria. Necesita TEST_DATABASE_URL (ver db/rls_test.go) y una base sin otras
+// fotos pendientes: ProcessOnce toma las de todos los providers. Lo sembrado se
+// borra al final.
+func TestPhotoProcessor(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	d, err := db.New(dsn, "hvac_app", "hvac_system")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Pool.Close)
+
+	ctx, release, err := d.WithSystem(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(release)
+
+	var spid, userID, woID string
+	err = d.QueryRow(ctx, `
+		INSERT INTO service_provider (name, slug)
+		VALUES ('Photos test', 'photos-' || substr(md5(random()::text), 1, 8))
+		RETURNING id
+	`).Scan(&spid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, sql := range []string{
+			`DELETE FROM work_order WHERE service_provider_id = $1`,
+			`DELETE FROM storage_deletion WHERE service_provider_id = $1`,
+			`DELETE FROM asset WHERE service_provider_id = $1`,
+			`DELETE FROM area WHERE service_provider_id = $1`,
+			`DELETE FROM site WHERE service_provider_id = $1`,
+			`DELETE FROM customer WHERE service_provider_id = $1`,
+			`DELETE FROM "user" WHERE service_provider_id = $1`,
+			`DELETE FROM service_provider WHERE id = $1`,
+		} {
+			if _, err := d.Exec(ctx, sql, spid); err != nil {
+				t.Errorf("cleanup: %v\n%s", err, sql)
+			}
+		}
+	})
+	err = d.QueryRow(ctx, `
+		WITH u AS (
+			INSERT INTO "user" (service_provider_id, fullname, email, password, role)
+			VALUES ($1, 'Fotos', 'photos@example.com', 'x', 'admin') RETURNING id
+		), c AS (
+			INSERT INTO customer (service_provider_id, name) VALUES ($1, 'Cliente') RETURNING id
+		), s AS (
+			INSERT INTO site (service_provider_id, customer_id, name) SELECT $1, id, 'Sitio' FROM c RETURNING id
+		), a AS (
+			INSERT INTO area (service_provider_id, site_id, name) SELECT $1, id, 'Área' FROM s RETURNING id
+		), e AS (
+			INSERT INTO asset (service_provider_id, customer_id, site_id, area_id, tag_code)
+			SELECT $1, c.id, s.id, a.id, 'T-1' FROM c, s, a RETURNING id
+		), wo AS (
+			INSERT INTO work_order (service_provider_id, customer_id, site_id, asset_id, title, created_by)
+			SELECT $1, c.id, s.id, e.id, 'Orden', u.id FROM c, s, e, u RETURNING id
+		)
+		SELECT (SELECT id FROM u), (SELECT id FROM wo)
+	`, spid).Scan(&userID, &woID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memStorage{objects: map[string][]byte{}}
+	p := &PhotoProcessor{DB: d, Storage: store, Interval: time.Hour}
+	raw := gpsJPEG(t)
+
+	// addPhoto sube raw (si upload) y crea la fila pendiente.
+	addPhoto := func(upload bool) (id, key string) {
+		t.Helper()
+		err := d.QueryRow(ctx, `SELECT gen_random_uuid()::text`).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key = spid + "/attachments/" + woID + "/" + id
+		if upload {
+			store.objects[key] = raw
+		}
+		_, err = d.Exec(ctx, `
+			INSERT INTO work_order_attachment (
+				id, service_provider_id, work_order_id, file_type, storage_key,
+				filename, content_type, size_bytes, uploaded_by, processing_status
+			) VALUES ($1, $2, $3, 'photo', $4, 'foto.jpg', 'image/jpeg', $5, $6, 'pending')
+		`, id, spid, woID, key, len(raw), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id, key
+	}
+	load := func(id string) photoRow {
+		t.Helper()
+		var r photoRow
+		err := d.QueryRow(ctx, `
+			SELECT processing_status, processing_attempts, COALESCE(processing_error, ''),
+			       storage_key, taken_at, gps_lat
+			FROM work_order_attachment WHERE id = $1
+		`, id).Scan(&r.status, &r.attempts, &r.processingError, &r.storageKey, &r.takenAt, &r.lat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	queuedForDeletion := func(key string) bool {
+		t.Helper()
+		var n int
+		if err := d.QueryRow(ctx, `SELECT count(*) FROM storage_deletion WHERE storage_key = $1`, key).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n > 0
+	}
+	processOnce := func(want int) {
+		t.Helper()
+		n, err := p.ProcessOnce(context.Background())
+		if err != nil || n != want {
+			t.Fatalf("ProcessOnce = %d, %v; want %d photos", n, err, want)
+		}
+	}
+
+	// Falla entre subir la copia limpia y marcar done: el reintento tiene que
+	// volver a leer el original (con EXIF), no una copia sin hora ni GPS.
+	t.Run("retry keeps metadata", func(t *testing.T) {
+		id, key := addPhoto(true)
+		store.beforePut = func(k string) error {
+			if k == key+".thumb.jpg" {
+				return errors.New("storage down")
+			}
+			return nil
+		}
+		processOnce(1)
+		r := load(id)
+		if r.status != "pending" || r.attempts != 1 || r.processingError != "storage down" || r.storageKey != key {
+			t.Fatalf("after failure: %+v", r)
+		}
+		if b, _ := store.object(key); !bytes.Equal(b, raw) {
+			t.Fatal("original was overwritten before the row was marked done")
+		}
+
+		store.beforePut = nil
+		processOnce(1)
+		r = load(id)
+		wantTaken := time.Date(2025, 3, 1, 10, 20, 30, 0, time.UTC) // sin offset: zona del provider (UTC)
+		if r.status != "done" || r.attempts != 2 || r.storageKey != key+".clean" {
+			t.Fatalf("after retry: %+v", r)
+		}
+		if r.takenAt == nil || !r.takenAt.Equal(wantTaken) || r.lat == nil || *r.lat != 4.6 {
+			t.Fatalf("after retry: taken_at = %v, gps_lat = %v; metadata was lost", r.takenAt, r.lat)
+		}
+
+		clean, ok := store.object(key + ".clean")
+		if !ok {
+			t.Fatal("clean copy missing")
+		}
+		res, err := imaging.Process(clean, "image/jpeg", time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.TakenAt != nil || res.Lat != nil {
+			t.Errorf("clean copy still has metadata: taken_at = %v, lat = %v", res.TakenAt, res.Lat)
+		}
+		if !queuedForDeletion(key) {
+			t.Error("original with metadata was not queued for deletion")
+		}
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		id, _ := addPhoto(false) // el objeto no existe: Get falla siempre
+		for i := 1; i <= photoMaxAttempts; i++ {
+			processOnce(1)
+			want := "pending"
+			if i == photoMaxAttempts {
+				want = "failed"
+			}
+			if r := load(id); r.status != want || r.attempts != i || r.processingError == "" {
+				t.Fatalf("attempt %d: %+v, want status %s", i, r, want)
+			}
+		}
+		processOnce(0)
+	})
+
+	// Si borran el adjunto mientras se procesa, el trigger solo encola la key
+	// que conocía: miniatura, versión web y copia limpia las borra el job.
+	t.Run("deleted while processing", func(t *testing.T) {
+		id, key := addPhoto(true)
+		store.beforePut = func(k string) error {
+			if k == key+".web.jpg" {
+				_, err := d.Exec(ctx, `DELETE FROM work_order_attachment WHERE id = $1`, id)
+				return err
+			}
+			return nil
+		}
+		defer func() { store.beforePut = nil }()
+
+		processOnce(1)
+		for _, k := range []string{key + ".clean", key + ".thumb.jpg", key + ".web.jpg"} {
+			if _, ok := store.object(k); ok {
+				t.Errorf("orphan %s left in storage", k)
+			}
+		}
+		if !queuedForDeletion(key) {
+			t.Error("original was not queued for deletion by the trigger")
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/alvgonz/hvac-saas-api/internal/db"
+	"github.com/alvgonz/hvac-saas-api/internal/storage"
+)
+
+// StorageSweeper vence las subidas reanudables abandonadas y borra del storage
+// los objetos encolados en storage_deletion (adjuntos, partes, órdenes borradas).
+// Si el storage falla, el objeto queda en la cola y se reintenta en la próxima vuelta.
+type StorageSweeper struct {
+	DB       *db.DB
+	Storage  storage.Storage
+	Interval time.Duration
+	Batch    int // 0 => 500 por vuelta
+}
+
+// Run corre un barrido al arrancar y luego cada Interval, hasta que ctx se cancele.
+func (s *StorageSweeper) Run(ctx context.Context) {
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+
+	for {
+		if err := s.SweepOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[STORAGE] sweep error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *StorageSweeper) SweepOnce(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	// Barre todos los providers: corre como sistema (sin filtro RLS).
+	ctx, release, err := s.DB.WithSystem(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// las partes de las vencidas las encola el trigger
+	tag, err := s.DB.Exec(ctx, `DELETE FROM attachment_upload WHERE expires_at < now()`)
+	if err != nil {
+		return err
+	}
+	if n := tag.RowsAffected(); n > 0 {
+		log.Printf("[STORAGE] expired %d unfinished uploads", n)
+	}
+
+	batch := s.Batch
+	if batch <= 0 {
+		batch = 500
+	}
+	rows, err := s.DB.Query(ctx, `
+		SELECT id, storage_key FROM storage_deletion
+		ORDER BY attempts, created_at
+		LIMIT $1
+	`, batch)
+	if err != nil {
+		return err
+	}
+	type pending struct{ id, key string }
+	queue := make([]pending, 0, batch)
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.key); err != nil {
+			rows.Close()
+			return err
+		}
+		queue = append(queue, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	deleted, failed := 0, 0
+	for _, p := range queue {
+		if err := s.Storage.Delete(ctx, p.key); err != nil {
+			failed++
+			msg := err.Error()
+			if len(msg) > 500 {
+				msg = msg[:500]
+			}
+			if _, err := s.DB.Exec(ctx, `
+				UPDATE storage_deletion SET attempts = attempts + 1, last_error = $2 WHERE id = $1
+			`, p.id, msg); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := s.DB.Exec(ctx, `DELETE FROM storage_deletion WHERE id = $1`, p.id); err != nil {
+			return err
+		}
+		deleted++
+	}
+
+	if deleted > 0 || failed > 0 {
+		log.Printf("[STORAGE] sweep done: %d objects deleted, %d failed", deleted, failed)
+	}
+	return nil
+}
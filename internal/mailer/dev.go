@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DevMailer es para desarrollo: con Dir escribe cada mensaje como .eml
+// (se abre con cualquier cliente de correo); sin Dir imprime el texto en Out
+// con los tokens de los links tapados (Out suele terminar en los logs).
+type DevMailer struct {
+	From string
+	Dir  string
+	Out  io.Writer
+
+	mu sync.Mutex
+}
+
+func (m *DevMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+
+	if m.Dir != "" {
+		body, err := buildMIME(m.From, msg, now)
+		if err != nil {
+			return err
+		}
+		name := fmt.Sprintf("%s_%s.eml", now.Format("20060102T150405.000000000"), fileSafe(msg.To))
+		return os.WriteFile(filepath.Join(m.Dir, name), body, 0o600)
+	}
+
+	out := m.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(out, "----- MAIL %s -----\nFrom: %s\nTo: %s\nSubject: %s\n\n%s\n----- END MAIL -----\n",
+		now.Format(time.RFC3339), m.From, msg.To, msg.Subject, redactLinks(msg.Text))
+	return err
+}
+
+// secretParamRe: parámetros de query que llevan secretos (token, code, secret,
+// key, sig, o con prefijo: invite_token, api_key) en cualquier link del texto.
+var secretParamRe = regexp.MustCompile(`(?i)([?&](?:[\w.-]*_)?(?:token|code|secret|key|sig)=)[^&\s#"'<>()]+`)
+
+// redactLinks tapa el valor de los parámetros secretos de los links.
+func redactLinks(text string) string {
+	return secretParamRe.ReplaceAllString(text, "${1}REDACTED")
+}
+
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		case r == '@':
+			return '_'
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Message es un email ya renderizado (texto + HTML).
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer envía mensajes. Las implementaciones no deben loguear el cuerpo:
+// invitaciones y resets llevan tokens en el link.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromEnv arma el Mailer según MAIL_DRIVER (obligatorio: sin él no se sabe
+// adónde irían los links de activación):
+//   - smtp:   SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_IMPLICIT_TLS
+//   - file:   escribe .eml en MAIL_DIR (con los links completos)
+//   - stdout: imprime el texto con los tokens tapados (solo para desarrollo)
+//
+// Con ENV=production solo se acepta smtp. MAIL_FROM es el remitente en todos
+// los casos.
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "HVAC <no-reply@localhost>"
+	}
+
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER")))
+	if driver == "" {
+		return nil, fmt.Errorf("MAIL_DRIVER is required (smtp, file or stdout)")
+	}
+	if strings.ToLower(os.Getenv("ENV")) == "production" && driver != "smtp" {
+		return nil, fmt.Errorf("MAIL_DRIVER=%s is not allowed with ENV=production (use smtp)", driver)
+	}
+
+	switch driver {
+	case "stdout":
+		return &DevMailer{From: from, Out: os.Stdout}, nil
+
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("MAIL_DIR is required for MAIL_DRIVER=file")
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		return &DevMailer{From: from, Dir: dir}, nil
+
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for MAIL_DRIVER=smtp")
+		}
+		port := 587
+		if p := os.Getenv("SMTP_PORT"); p != "" {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_PORT: %w", err)
+			}
+			port = n
+		}
+		return &SMTPMailer{
+			Host:        host,
+			Port:        port,
+			Username:    os.Getenv("SMTP_USERNAME"),
+			Password:    os.Getenv("SMTP_PASSWORD"),
+			From:        from,
+			ImplicitTLS: os.Getenv("SMTP_IMPLICIT_TLS") == "true",
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+}
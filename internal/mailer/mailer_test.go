@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	cases := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+		want    string // tipo esperado
+	}{
+		{name: "driver required", env: map[string]string{}, wantErr: true},
+		{name: "stdout", env: map[string]string{"MAIL_DRIVER": "stdout"}, want: "*mailer.DevMailer"},
+		{name: "file without dir", env: map[string]string{"MAIL_DRIVER": "file"}, wantErr: true},
+		{name: "smtp without host", env: map[string]string{"MAIL_DRIVER": "smtp"}, wantErr: true},
+		{name: "smtp", env: map[string]string{"MAIL_DRIVER": "smtp", "SMTP_HOST": "mail.test"}, want: "*mailer.SMTPMailer"},
+		{name: "unknown", env: map[string]string{"MAIL_DRIVER": "pigeon"}, wantErr: true},
+		{name: "stdout in production", env: map[string]string{"MAIL_DRIVER": "stdout", "ENV": "production"}, wantErr: true},
+		{name: "file in production", env: map[string]string{"MAIL_DRIVER": "file", "MAIL_DIR": "x", "ENV": "Production"}, wantErr: true},
+		{name: "smtp in production", env: map[string]string{"MAIL_DRIVER": "smtp", "SMTP_HOST": "mail.test", "ENV": "production"}, want: "*mailer.SMTPMailer"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"MAIL_DRIVER", "MAIL_DIR", "SMTP_HOST", "SMTP_PORT", "ENV"} {
+				t.Setenv(k, "")
+			}
+			for k, v := range tc.env {
+				if k == "MAIL_DIR" {
+					v = filepath.Join(t.TempDir(), v)
+				}
+				t.Setenv(k, v)
+			}
+			m, err := FromEnv()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("FromEnv() = %T, want error", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromEnv: %v", err)
+			}
+			if got := typeName(m); got != tc.want {
+				t.Fatalf("FromEnv() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func typeName(m Mailer) string {
+	switch m.(type) {
+	case *DevMailer:
+		return "*mailer.DevMailer"
+	case *SMTPMailer:
+		return "*mailer.SMTPMailer"
+	}
+	return "?"
+}
+
+func TestDevMailerStdoutRedactsTokens(t *testing.T) {
+	var out bytes.Buffer
+	m := &DevMailer{From: "no-reply@hvac.test", Out: &out}
+
+	link := "https://app.test/set-password?token=s3cr3t-token"
+	msg, err := Render(TemplateInvite, "es", "ana@example.com", sampleData(TemplateInvite, link))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	if strings.Contains(got, "s3cr3t-token") {
+		t.Fatalf("stdout mail leaks the token:\n%s", got)
+	}
+	if !strings.Contains(got, "https://app.test/set-password?token=REDACTED") {
+		t.Fatalf("link missing from stdout mail:\n%s", got)
+	}
+	if !strings.Contains(got, msg.Subject) {
+		t.Fatalf("subject missing from stdout mail:\n%s", got)
+	}
+}
+
+func TestRedactLinks(t *testing.T) {
+	cases := map[string]string{
+		"ver https://app.test/wo/1 ahora":                    "ver https://app.test/wo/1 ahora",
+		"https://app.test/reset-password?token=abc":          "https://app.test/reset-password?token=REDACTED",
+		"(http://x.test/a?page=2&invite_token=abc&lang=es).": "(http://x.test/a?page=2&invite_token=REDACTED&lang=es).",
+		"https://x.test/r?Token=a.b-c_d#top":                 "https://x.test/r?Token=REDACTED#top",
+		"https://x.test/r?monkey=1&api_key=2":                "https://x.test/r?monkey=1&api_key=REDACTED",
+		"https://x.test/mfa?code=123456\nsiguiente línea":    "https://x.test/mfa?code=REDACTED\nsiguiente línea",
+		"sin links": "sin links",
+	}
+	for in, want := range cases {
+		if got := redactLinks(in); got != want {
+			t.Errorf("redactLinks(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestDevMailerFileKeepsFullMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := &DevMailer{From: "no-reply@hvac.test", Dir: dir}
+	msg := Message{To: "ana@example.com", Subject: "x", Text: "https://app.test/?token=abc\n", HTML: "<p>x</p>"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("eml files = %v (%v)", files, err)
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := parseMail(t, b).parts["text/plain"]; !strings.Contains(text, "https://app.test/?token=abc") {
+		t.Fatalf("file driver should keep the link usable: %q", text)
+	}
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPMailer envía por SMTP. Si el server ofrece STARTTLS se usa siempre;
+// ImplicitTLS es para el puerto 465. Sin Username no se autentica (útil para
+// relays internos o un server SMTP falso en los tests).
+type SMTPMailer struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	From        string
+	ImplicitTLS bool
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	from, err := envelopeAddr(m.From)
+	if err != nil {
+		return err
+	}
+	to, err := envelopeAddr(msg.To)
+	if err != nil {
+		return err
+	}
+	body, err := buildMIME(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	tlsCfg := &tls.Config{ServerName: m.Host}
+
+	var conn net.Conn
+	if m.ImplicitTLS {
+		d := tls.Dialer{Config: tlsCfg}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !m.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsCfg); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.Username != "" {
+		// PlainAuth se niega a mandar credenciales sin TLS (salvo localhost).
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(body); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,297 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received es lo que el server SMTP falso recibió en una sesión.
+type received struct {
+	from, to string
+	data     []byte
+}
+
+// fakeSMTP levanta un server SMTP mínimo (EHLO/MAIL/RCPT/DATA/QUIT, sin TLS ni
+// auth) en un puerto local. Cada mensaje aceptado sale por el canal.
+func fakeSMTP(t *testing.T) (host string, port int, msgs <-chan received) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	out := make(chan received, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, out)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, out
+}
+
+func serveSMTP(conn net.Conn, out chan<- received) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	tp := textproto.NewConn(conn)
+
+	var msg received
+	reply := func(s string) { _ = tp.PrintfLine("%s", s) }
+	reply("220 fake.local ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-fake.local")
+			reply("250 8BITMIME")
+		case "MAIL":
+			addr, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ") // sin BODY=8BITMIME
+			msg = received{from: addr}
+			reply("250 OK")
+		case "RCPT":
+			if msg.from == "" {
+				reply("503 need MAIL first")
+				continue
+			}
+			msg.to = strings.TrimPrefix(arg, "TO:")
+			reply("250 OK")
+		case "DATA":
+			if msg.to == "" {
+				reply("503 need RCPT first")
+				continue
+			}
+			reply("354 end with <CRLF>.<CRLF>")
+			if msg.data, err = tp.ReadDotBytes(); err != nil {
+				return
+			}
+			out <- msg
+			reply("250 queued")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func nextMessage(t *testing.T, msgs <-chan received) received {
+	t.Helper()
+	select {
+	case m := <-msgs:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake SMTP server got no message")
+	}
+	return received{}
+}
+
+// parsedMail: headers decodificados y las partes del multipart/alternative.
+type parsedMail struct {
+	header  mail.Header
+	subject string
+	parts   map[string]string // media type => cuerpo ya decodificado
+}
+
+func parseMail(t *testing.T, raw []byte) parsedMail {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("invalid RFC 5322 message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("subject: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q (%v), want multipart/alternative", m.Header.Get("Content-Type"), err)
+	}
+
+	out := parsedMail{header: m.Header, subject: subject, parts: map[string]string{}}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var order []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("multipart: %v", err)
+		}
+		pt, pp, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if err != nil || pp["charset"] != "utf-8" {
+			t.Fatalf("part Content-Type = %q", p.Header.Get("Content-Type"))
+		}
+		b, err := io.ReadAll(p) // quoted-printable ya decodificado por NextPart
+		if err != nil {
+			t.Fatalf("part %s: %v", pt, err)
+		}
+		out.parts[pt] = string(b)
+		order = append(order, pt)
+	}
+	// multipart/alternative: de la más simple a la más rica
+	if strings.Join(order, ",") != "text/plain,text/html" {
+		t.Fatalf("parts = %v, want text/plain then text/html", order)
+	}
+	return out
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	host, port, msgs := fakeSMTP(t)
+	m := &SMTPMailer{Host: host, Port: port, From: "HVAC Soporte <no-reply@hvac.test>"}
+
+	msg := Message{
+		To:      "Técnico Uno <tecnico@example.com>",
+		Subject: "Restablece tu contraseña",
+		Text:    "Hola,\n\nAbre https://app.test/reset-password?token=abc123 para continuar.\n" + strings.Repeat("línea larga ", 20) + "\n",
+		HTML:    `<p>Hola, <a href="https://app.test/reset-password?token=abc123">restablecer</a></p>`,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Send(ctx, msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := nextMessage(t, msgs)
+	if got.from != "<no-reply@hvac.test>" || got.to != "<tecnico@example.com>" {
+		t.Fatalf("envelope = %s -> %s", got.from, got.to)
+	}
+
+	pm := parseMail(t, got.data)
+	from, err := pm.header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Address != "no-reply@hvac.test" || from[0].Name != "HVAC Soporte" {
+		t.Fatalf("From = %v (%v)", from, err)
+	}
+	to, err := pm.header.AddressList("To")
+	if err != nil || len(to) != 1 || to[0].Address != "tecnico@example.com" || to[0].Name != "Técnico Uno" {
+		t.Fatalf("To = %v (%v)", to, err)
+	}
+	if pm.subject != msg.Subject {
+		t.Fatalf("Subject = %q, want %q", pm.subject, msg.Subject)
+	}
+	if pm.header.Get("MIME-Version") != "1.0" || pm.header.Get("Message-ID") == "" {
+		t.Fatalf("missing MIME-Version / Message-ID: %v", pm.header)
+	}
+	if _, err := pm.header.Date(); err != nil {
+		t.Fatalf("Date: %v", err)
+	}
+	if pm.parts["text/plain"] != msg.Text {
+		t.Fatalf("text part = %q, want %q", pm.parts["text/plain"], msg.Text)
+	}
+	if pm.parts["text/html"] != msg.HTML {
+		t.Fatalf("html part = %q, want %q", pm.parts["text/html"], msg.HTML)
+	}
+}
+
+func TestSMTPMailerRejectsBadAddress(t *testing.T) {
+	m := &SMTPMailer{Host: "127.0.0.1", Port: 1, From: "no-reply@hvac.test"}
+	if err := m.Send(context.Background(), Message{To: "not an address", Subject: "x", Text: "x"}); err == nil {
+		t.Fatal("Send to an invalid address: want error")
+	}
+}
+
+// sampleData: datos de ejemplo para cada plantilla, con el link que tiene que aparecer.
+func sampleData(tpl Template, link string) any {
+	expires := time.Date(2026, 3, 14, 15, 30, 0, 0, time.UTC)
+	switch tpl {
+	case TemplateInvite:
+		return InviteData{Fullname: "Ana Pérez", ProviderName: "Frío Total", Link: link, ExpiresAt: expires}
+	case TemplatePasswordReset:
+		return PasswordResetData{Fullname: "Ana Pérez", ProviderName: "Frío Norte", Link: link, ExpiresAt: expires}
+	case TemplateWorkOrderAssigned:
+		return WorkOrderData{Fullname: "Ana Pérez", Title: "Mantenimiento chiller", Priority: "high", SiteName: "Planta Norte", Link: link}
+	case TemplateWorkOrderMention:
+		return MentionData{Fullname: "Ana Pérez", AuthorName: "Luis", Title: "Mantenimiento chiller", Comment: "revisar <compresor> & filtros", Link: link}
+	}
+	return nil
+}
+
+var allTemplates = []Template{
+	TemplateInvite,
+	TemplatePasswordReset,
+	TemplateWorkOrderAssigned,
+	TemplateWorkOrderMention,
+}
+
+// Cada plantilla en cada idioma se renderiza y viaja completa por SMTP.
+func TestTemplatesOverSMTP(t *testing.T) {
+	host, port, msgs := fakeSMTP(t)
+	m := &SMTPMailer{Host: host, Port: port, From: "HVAC <no-reply@hvac.test>"}
+
+	for _, tpl := range allTemplates {
+		subjects := map[string]string{}
+		for _, lang := range []string{"es", "en"} {
+			t.Run(string(tpl)+"/"+lang, func(t *testing.T) {
+				link := "https://app.test/x?token=tok-" + string(tpl) + "-" + lang
+				msg, err := Render(tpl, lang, "ana@example.com", sampleData(tpl, link))
+				if err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+				if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+					t.Fatalf("Subject = %q", msg.Subject)
+				}
+				for _, body := range []string{msg.Text, msg.HTML} {
+					if strings.Contains(body, "<no value>") {
+						t.Fatalf("template references a missing field:\n%s", body)
+					}
+				}
+				if !strings.Contains(msg.Text, link) || !strings.Contains(msg.HTML, `href="`+link+`"`) {
+					t.Fatalf("link missing from text or html:\n%s\n%s", msg.Text, msg.HTML)
+				}
+				if tpl == TemplateWorkOrderMention && strings.Contains(msg.HTML, "<compresor>") {
+					t.Fatal("comment is not HTML-escaped")
+				}
+				subjects[lang] = msg.Subject
+
+				if err := m.Send(context.Background(), msg); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+				pm := parseMail(t, nextMessage(t, msgs).data)
+				if pm.subject != msg.Subject || pm.parts["text/plain"] != msg.Text || pm.parts["text/html"] != msg.HTML {
+					t.Fatal("delivered message differs from the rendered one")
+				}
+			})
+		}
+		if subjects["es"] != "" && subjects["es"] == subjects["en"] {
+			t.Errorf("%s: es and en subjects are the same (%q)", tpl, subjects["es"])
+		}
+	}
+}
+
+func TestRenderFallsBackToDefaultLang(t *testing.T) {
+	data := sampleData(TemplateInvite, "https://app.test/set-password?token=t")
+	want, err := Render(TemplateInvite, DefaultLang, "a@example.com", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lang := range []string{"", "fr", "ES-co"} {
+		got, err := Render(TemplateInvite, lang, "a@example.com", data)
+		if err != nil || got.Subject != want.Subject {
+			t.Errorf("Render(lang=%q) subject = %q (%v), want %q", lang, got.Subject, err, want.Subject)
+		}
+	}
+	if got := NormalizeLang("en_US"); got != "en" {
+		t.Errorf("NormalizeLang(en_US) = %q", got)
+	}
+}
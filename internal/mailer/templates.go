@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Template identifica un tipo de email. Cada uno tiene, por idioma, un
+// "<tpl>.<lang>.txt.tmpl" (bloques subject + text) y un "<tpl>.<lang>.html.tmpl".
+type Template string
+
+const (
+	TemplateInvite            Template = "invite"
+	TemplatePasswordReset     Template = "password_reset"
+	TemplateWorkOrderAssigned Template = "work_order_assigned"
+	TemplateWorkOrderMention  Template = "work_order_mention"
+)
+
+// DefaultLang se usa cuando el idioma pedido no tiene plantillas.
+const DefaultLang = "es"
+
+var supportedLangs = map[string]bool{"es": true, "en": true}
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.New("").ParseFS(templateFS, "templates/*.txt.tmpl"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("").ParseFS(templateFS, "templates/*.html.tmpl"))
+)
+
+type InviteData struct {
+	Fullname     string
+	ProviderName string
+	Link         string
+	ExpiresAt    time.Time
+}
+
+type PasswordResetData struct {
+	Fullname     string
+	ProviderName string // un mismo email puede tener cuenta en varios providers
+	Link         string
+	ExpiresAt    time.Time
+}
+
+type WorkOrderData struct {
+	Fullname string
+	Title    string
+	Priority string
+	SiteName string
+	Link     string
+}
+
+type MentionData struct {
+	Fullname   string
+	AuthorName string
+	Title      string
+	Comment    string
+	Link       string
+}
+
+// NormalizeLang reduce "es-CO" / "EN" a un idioma soportado.
+func NormalizeLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	if !supportedLangs[lang] {
+		return DefaultLang
+	}
+	return lang
+}
+
+// Render arma Subject/Text/HTML para el destinatario to.
+func Render(t Template, lang, to string, data any) (Message, error) {
+	name := fmt.Sprintf("%s.%s", t, NormalizeLang(lang))
+
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, name+".subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name+".text", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 habla el API de S3 (PutObject/GetObject/DeleteObject) firmando con
+// SigV4, sin SDK. Sirve para AWS y para compatibles (MinIO, R2, Spaces...):
+// con PathStyle la URL es {Endpoint}/{Bucket}/{key}, si no {bucket}.{host}/{key}.
+type S3 struct {
+	Endpoint  string // ej. https://s3.us-east-1.amazonaws.com, http://localhost:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	Client    *http.Client // nil => http.DefaultClient
+}
+
+// El cuerpo no se hashea (va por streaming): S3 y los compatibles lo aceptan
+// sobre HTTPS y en redes propias.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	if err := ValidKey(key); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid S3_ENDPOINT: %w", err)
+	}
+	// ValidKey deja solo caracteres que no se escapan: el path va tal cual.
+	if s.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	return u, nil
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+	s.sign(req, time.Now().UTC())
+
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return c.Do(req)
+}
+
+// sign agrega la firma SigV4 (host, x-amz-content-sha256, x-amz-date).
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + unsignedPayload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// s3Error resume la respuesta de error (el XML trae Code y Message).
+func s3Error(op string, resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("storage: s3 %s: %s: %s", op, resp.Status, strings.TrimSpace(string(b)))
+}
+
+// exactReader entrega exactamente size bytes de r. Si r trae de menos o de más
+// falla antes de entregar el último byte: el PUT se corta y S3 no llega a
+// guardar un objeto truncado.
+type exactReader struct {
+	r          io.Reader
+	size, left int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.left == 0 {
+		return 0, e.atEOF()
+	}
+	if int64(len(p)) > e.left {
+		p = p[:e.left]
+	}
+	n, err := e.r.Read(p)
+	e.left -= int64(n)
+	switch {
+	case err == io.EOF && e.left > 0:
+		return 0, fmt.Errorf("storage: expected %d bytes, got %d", e.size, e.size-e.left)
+	case err != nil && err != io.EOF:
+		return n, err
+	case e.left == 0:
+		if err := e.atEOF(); err != io.EOF {
+			return 0, err
+		}
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// atEOF: io.EOF si r ya no trae nada, error si trae bytes de más.
+func (e *exactReader) atEOF() error {
+	var one [1]byte
+	_, err := io.ReadFull(e.r, one[:])
+	switch err {
+	case io.EOF:
+		return io.EOF
+	case nil:
+		return fmt.Errorf("storage: expected %d bytes, got more", e.size)
+	}
+	return err
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	exact := &exactReader{r: r, size: size, left: size}
+	var body io.Reader = exact
+	if size == 0 {
+		// Con un Body que no es NoBody, net/http manda 0 bytes como chunked y S3
+		// lo rechaza (411): NoBody lleva "Content-Length: 0".
+		if err := exact.atEOF(); err != io.EOF {
+			return err
+		}
+		body = http.NoBody
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, body, size, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s3Error("put", resp)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		defer resp.Body.Close()
+		return nil, s3Error("get", resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", resp)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "us-east-1"
+	testBucket    = "hvac"
+)
+
+// fakeS3 es un stand-in tipo MinIO: verifica la firma SigV4 de cada request
+// (recalculada del lado servidor, con lo que llegó por la red) y guarda los
+// objetos en memoria.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := verifySigV4(r, testSecretKey, time.Now().UTC()); err != nil {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>"+err.Error()+"</Message></Error>", http.StatusForbidden)
+		return
+	}
+	prefix := "/" + testBucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			http.Error(w, "<Error><Code>MissingContentLength</Code></Error>", http.StatusLengthRequired)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(b)) != r.ContentLength {
+			http.Error(w, "<Error><Code>IncompleteBody</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = b
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		b, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		w.Write(b)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.objects[key]
+	return b, ok
+}
+
+func (f *fakeS3) contentType(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.types[key]
+}
+
+// verifySigV4 rearma el canonical request con los headers firmados que
+// declara la request y compara la firma.
+func verifySigV4(r *http.Request, secret string, now time.Time) error {
+	auth := r.Header.Get("Authorization")
+	const algo = "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(auth, algo) {
+		return errors.New("missing AWS4-HMAC-SHA256 authorization")
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, algo), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return fmt.Errorf("malformed authorization part %q", part)
+		}
+		fields[k] = v
+	}
+
+	cred := strings.Split(fields["Credential"], "/")
+	if len(cred) != 5 || cred[0] != testAccessKey || cred[2] != testRegion || cred[3] != "s3" || cred[4] != "aws4_request" {
+		return fmt.Errorf("bad credential %q", fields["Credential"])
+	}
+	day := cred[1]
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || !strings.HasPrefix(amzDate, day) {
+		return fmt.Errorf("bad x-amz-date %q", amzDate)
+	}
+	if d := now.Sub(signedAt); d > 15*time.Minute || d < -15*time.Minute {
+		return fmt.Errorf("request time too skewed: %s", d)
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	var headers strings.Builder
+	hasHost := false
+	for _, h := range signed {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v, hasHost = r.Host, true
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	if !hasHost {
+		return errors.New("host is not signed")
+	}
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		return errors.New("missing x-amz-content-sha256")
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		headers.String(),
+		fields["SignedHeaders"],
+		payload,
+	}, "\n")
+	scope := strings.Join(cred[1:], "/")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, testRegion)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	if want := hex.EncodeToString(hmacSHA256(key, toSign)); fields["Signature"] != want {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func testS3(endpoint string) *S3 {
+	return &S3{
+		Endpoint:  endpoint,
+		Bucket:    testBucket,
+		Region:    testRegion,
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+		PathStyle: true,
+	}
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	s := testS3(srv.URL)
+
+	key := "sp-1/attachments/photo.jpg"
+	data := bytes.Repeat([]byte("0123456789"), 10_000)
+	if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if b, ok := f.object(key); !ok || !bytes.Equal(b, data) {
+		t.Fatalf("stored object mismatch (ok=%v, %d bytes)", ok, len(b))
+	}
+	if ct := f.contentType(key); ct != "image/jpeg" {
+		t.Fatalf("stored content type = %q", ct)
+	}
+
+	if got := mustRead(t, s, key); !bytes.Equal(got, data) {
+		t.Fatalf("Get returned %d bytes, want %d", len(got), len(data))
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete missing = %v, want nil", err)
+	}
+}
+
+func TestS3EmptyObject(t *testing.T) {
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	s := testS3(srv.URL)
+
+	if err := s.Put(ctx, "sp/empty", strings.NewReader(""), 0, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if b, ok := f.object("sp/empty"); !ok || len(b) != 0 {
+		t.Fatalf("stored = %q, %v", b, ok)
+	}
+}
+
+func TestS3PutSizeMismatch(t *testing.T) {
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	s := testS3(srv.URL)
+
+	for name, r := range map[string]io.Reader{
+		"short": strings.NewReader("abc"),
+		"long":  strings.NewReader("abcdefgh"),
+		"empty": strings.NewReader(""),
+	} {
+		key := "sp/" + name
+		if err := s.Put(ctx, key, r, 5, ""); err == nil {
+			t.Errorf("Put %s reader: want error", name)
+		}
+		if b, ok := f.object(key); ok {
+			t.Errorf("Put %s reader stored %q", name, b)
+		}
+	}
+
+	if err := s.Put(ctx, "sp/extra", strings.NewReader("x"), 0, ""); err == nil {
+		t.Error("Put with size 0 and a non-empty reader: want error")
+	}
+}
+
+func TestS3BadCredentials(t *testing.T) {
+	ctx := context.Background()
+	f, srv := newFakeS3(t)
+	s := testS3(srv.URL)
+	s.SecretKey = "wrong"
+
+	if err := s.Put(ctx, "sp/x", strings.NewReader("x"), 1, ""); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Put with wrong secret = %v, want 403 error", err)
+	}
+	if _, ok := f.object("sp/x"); ok {
+		t.Fatal("object stored with a bad signature")
+	}
+	if _, err := s.Get(ctx, "sp/x"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get with wrong secret = %v, want 403 error", err)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	s := &S3{Endpoint: "https://s3.us-east-1.amazonaws.com/", Bucket: "b"}
+	u, err := s.objectURL("sp/a.jpg")
+	if err != nil || u.String() != "https://b.s3.us-east-1.amazonaws.com/sp/a.jpg" {
+		t.Fatalf("virtual-hosted URL = %v, %v", u, err)
+	}
+	s.PathStyle = true
+	u, err = s.objectURL("sp/a.jpg")
+	if err != nil || u.String() != "https://s3.us-east-1.amazonaws.com/b/sp/a.jpg" {
+		t.Fatalf("path-style URL = %v, %v", u, err)
+	}
+	if _, err := s.objectURL("../other-bucket/x"); err == nil {
+		t.Fatal("objectURL accepted a traversal key")
+	}
+}
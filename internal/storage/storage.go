@@ -0,0 +1,80 @@
+// Package storage guarda los archivos de las órdenes (fotos, PDFs) fuera de
+// Postgres: en disco local o en un bucket S3 compatible (AWS, MinIO, R2...).
+// La DB solo guarda la key; las descargas van por links firmados de la API.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage es el backend de objetos. Las keys las arma la API
+// ({provider}/attachments/{id}...) y solo usan [A-Za-z0-9/_.-].
+type Storage interface {
+	// Put guarda exactamente size bytes de r (si r trae otra cantidad, falla).
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get abre el objeto; ErrNotFound si no existe.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete borra el objeto; no es error que no exista.
+	Delete(ctx context.Context, key string) error
+}
+
+var keyRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+
+// ValidKey: sin "..", sin "/" al inicio y solo caracteres que no hay que escapar.
+func ValidKey(key string) error {
+	if len(key) > 300 || !keyRe.MatchString(key) {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "." || seg == ".." {
+			return fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// FromEnv arma el Storage según STORAGE_DRIVER:
+//   - local: archivos bajo STORAGE_DIR (default ./data/uploads)
+//   - s3:    S3_ENDPOINT, S3_BUCKET, S3_REGION (us-east-1), S3_ACCESS_KEY_ID,
+//     S3_SECRET_ACCESS_KEY, S3_PATH_STYLE (true; false => bucket.host)
+func FromEnv() (Storage, error) {
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_DRIVER")))
+	switch driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "./data/uploads"
+		}
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+		return &Local{Dir: dir}, nil
+
+	case "s3":
+		s := &S3{
+			Endpoint:  strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		}
+		if s.Region == "" {
+			s.Region = "us-east-1"
+		}
+		if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for STORAGE_DRIVER=s3")
+		}
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	valid := []string{
+		"a",
+		"sp-1/attachments/abc.jpg",
+		"sp-1/attachments/abc.jpg.thumb.jpg",
+		"sp_1/uploads/x/part-00001",
+		strings.Repeat("a", 300),
+	}
+	for _, k := range valid {
+		if err := ValidKey(k); err != nil {
+			t.Errorf("ValidKey(%q) = %v, want nil", k, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"/abs",
+		"trailing/",
+		"a//b",
+		".",
+		"..",
+		"../etc/passwd",
+		"a/../../b",
+		"a/./b",
+		"a/..",
+		`a\..\b`,
+		"a b",
+		"a%2F..",
+		"a?x=1",
+		"a#b",
+		"ñ",
+		"a\x00b",
+		strings.Repeat("a", 301),
+	}
+	for _, k := range invalid {
+		if err := ValidKey(k); err == nil {
+			t.Errorf("ValidKey(%q) = nil, want error", k)
+		}
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	l := &Local{Dir: t.TempDir()}
+	data := []byte("hello storage")
+
+	if err := l.Put(ctx, "sp/attachments/a.txt", bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got := mustRead(t, l, "sp/attachments/a.txt")
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get = %q, want %q", got, data)
+	}
+
+	// Put sobre la misma key reemplaza
+	if err := l.Put(ctx, "sp/attachments/a.txt", strings.NewReader("x"), 1, ""); err != nil {
+		t.Fatalf("Put replace: %v", err)
+	}
+	if got := mustRead(t, l, "sp/attachments/a.txt"); string(got) != "x" {
+		t.Fatalf("Get after replace = %q", got)
+	}
+
+	if err := l.Delete(ctx, "sp/attachments/a.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := l.Get(ctx, "sp/attachments/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := l.Delete(ctx, "sp/attachments/a.txt"); err != nil {
+		t.Fatalf("Delete missing = %v, want nil", err)
+	}
+}
+
+func TestLocalPutSizeMismatch(t *testing.T) {
+	ctx := context.Background()
+	l := &Local{Dir: t.TempDir()}
+
+	for name, r := range map[string]io.Reader{
+		"short": strings.NewReader("abc"),
+		"long":  strings.NewReader("abcdefgh"),
+	} {
+		if err := l.Put(ctx, "k/"+name, r, 5, ""); err == nil {
+			t.Errorf("Put %s reader: want error", name)
+		}
+		if _, err := l.Get(ctx, "k/"+name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after failed Put %s = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func TestLocalRejectsTraversal(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := filepath.Join(root, "uploads")
+	l := &Local{Dir: dir}
+
+	secret := filepath.Join(root, "secret")
+	if err := os.WriteFile(secret, []byte("do not touch"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"../secret", "a/../../secret", "/etc/passwd", `..\secret`} {
+		if err := l.Put(ctx, k, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q): want error", k)
+		}
+		if _, err := l.Get(ctx, k); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want invalid key error", k, err)
+		}
+		if err := l.Delete(ctx, k); err == nil {
+			t.Errorf("Delete(%q): want error", k)
+		}
+	}
+	if b, err := os.ReadFile(secret); err != nil || string(b) != "do not touch" {
+		t.Fatalf("file outside Dir changed: %q, %v", b, err)
+	}
+}
+
+func mustRead(t *testing.T, s Storage, key string) []byte {
+	t.Helper()
+	rc, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %q: %v", key, err)
+	}
+	return b
+}
@@ -0,0 +1,49 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore sirve para una sola instancia: cada réplica tendría su propio contador.
+type MemoryStore struct {
+	mu sync.Mutex
+	m  map[string]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{m: make(map[string]State)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[key], nil
+}
+
+func (s *MemoryStore) RecordFailure(_ context.Context, key string, now time.Time, p Policy) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := p.next(s.m[key], now)
+	s.m[key] = st
+	return st, nil
+}
+
+func (s *MemoryStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+	return nil
+}
+
+func (s *MemoryStore) Prune(_ context.Context, now time.Time, p Policy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, st := range s.m {
+		if now.Sub(st.LastFailureAt) > p.Window && !st.LockedUntil.After(now) {
+			delete(s.m, k)
+		}
+	}
+	return nil
+}
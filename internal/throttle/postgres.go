@@ -0,0 +1,102 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresStore comparte los contadores entre réplicas (tabla login_throttle).
+type PostgresStore struct {
+	DB *pgxpool.Pool
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (State, error) {
+	var st State
+	var locked *time.Time
+	err := s.DB.QueryRow(ctx, `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_throttle
+		WHERE key = $1
+	`, key).Scan(&st.Failures, &st.LastFailureAt, &locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+	if locked != nil {
+		st.LockedUntil = *locked
+	}
+	return st, nil
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, now time.Time, p Policy) (State, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return State{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Aseguramos la fila y la bloqueamos: dos réplicas no pueden pisarse el contador.
+	_, err = tx.Exec(ctx, `
+		INSERT INTO login_throttle (key, failures, last_failure_at)
+		VALUES ($1, 0, $2)
+		ON CONFLICT (key) DO NOTHING
+	`, key, now)
+	if err != nil {
+		return State{}, err
+	}
+
+	var st State
+	var locked *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_throttle
+		WHERE key = $1
+		FOR UPDATE
+	`, key).Scan(&st.Failures, &st.LastFailureAt, &locked)
+	if err != nil {
+		return State{}, err
+	}
+	if locked != nil {
+		st.LockedUntil = *locked
+	}
+	if st.Failures == 0 {
+		st.LastFailureAt = time.Time{}
+	}
+
+	st = p.next(st, now)
+
+	var lockedUntil *time.Time
+	if !st.LockedUntil.IsZero() {
+		lockedUntil = &st.LockedUntil
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE login_throttle
+		SET failures = $2, last_failure_at = $3, locked_until = $4
+		WHERE key = $1
+	`, key, st.Failures, st.LastFailureAt, lockedUntil)
+	if err != nil {
+		return State{}, err
+	}
+
+	return st, tx.Commit(ctx)
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.DB.Exec(ctx, `DELETE FROM login_throttle WHERE key = $1`, key)
+	return err
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, now time.Time, p Policy) error {
+	_, err := s.DB.Exec(ctx, `
+		DELETE FROM login_throttle
+		WHERE last_failure_at < $1
+		  AND (locked_until IS NULL OR locked_until < $2)
+	`, now.Add(-p.Window), now)
+	return err
+}
@@ -0,0 +1,114 @@
+// Package throttle limita intentos fallidos (login, MFA) con backoff exponencial
+// y bloqueo temporal. El estado vive en un Store: en memoria para una sola
+// instancia o en Postgres cuando hay varias réplicas detrás del balanceador.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// State es el contador de una clave (ej. "acct:{spid}:{email}" o "ip:1.2.3.4").
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	// RecordFailure suma un fallo (reiniciando el contador si pasó p.Window
+	// desde el anterior) y guarda el bloqueo que corresponda según p.
+	RecordFailure(ctx context.Context, key string, now time.Time, p Policy) (State, error)
+	Reset(ctx context.Context, key string) error
+	// Prune borra claves sin fallos recientes ni bloqueo vigente.
+	Prune(ctx context.Context, now time.Time, p Policy) error
+}
+
+// Policy define cuántos fallos se toleran y cómo crece el bloqueo.
+type Policy struct {
+	FreeAttempts int           // fallos sin castigo
+	BaseDelay    time.Duration // primer bloqueo al pasar FreeAttempts
+	MaxDelay     time.Duration // tope del backoff
+	Window       time.Duration // sin fallos durante Window => contador a cero
+}
+
+// LockFor: 0 hasta FreeAttempts; después BaseDelay, 2x, 4x... hasta MaxDelay.
+func (p Policy) LockFor(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := 1; i < over; i++ {
+		d *= 2
+		if d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// next calcula el estado tras un fallo nuevo (lo comparten los stores).
+func (p Policy) next(st State, now time.Time) State {
+	if st.LastFailureAt.IsZero() || now.Sub(st.LastFailureAt) > p.Window {
+		st.Failures = 0
+	}
+	st.Failures++
+	st.LastFailureAt = now
+	if lock := p.LockFor(st.Failures); lock > 0 {
+		st.LockedUntil = now.Add(lock)
+	}
+	return st
+}
+
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	Now    func() time.Time // para tests; nil => time.Now
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
+// Check devuelve cuánto falta para poder intentar de nuevo (0 = adelante).
+func (l *Limiter) Check(ctx context.Context, key string) (time.Duration, error) {
+	st, err := l.Store.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if wait := st.LockedUntil.Sub(l.now()); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail registra un fallo y devuelve el bloqueo resultante (0 si aún no aplica).
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+	st, err := l.Store.RecordFailure(ctx, key, now, l.Policy)
+	if err != nil {
+		return 0, err
+	}
+	if wait := st.LockedUntil.Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Succeed limpia el contador (login correcto).
+func (l *Limiter) Succeed(ctx context.Context, key string) error {
+	return l.Store.Reset(ctx, key)
+}
+
+// Prune limpia claves viejas del store.
+func (l *Limiter) Prune(ctx context.Context) error {
+	return l.Store.Prune(ctx, l.now(), l.Policy)
+}
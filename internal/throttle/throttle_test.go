@@ -0,0 +1,206 @@
+package throttle
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     10 * time.Minute,
+	Window:       time.Hour,
+}
+
+func TestLockFor(t *testing.T) {
+	for _, c := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0}, {1, 0}, {3, 0},
+		{4, time.Minute},
+		{5, 2 * time.Minute},
+		{6, 4 * time.Minute},
+		{7, 8 * time.Minute},
+		{8, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	} {
+		if got := testPolicy.LockFor(c.failures); got != c.want {
+			t.Errorf("LockFor(%d) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
+
+// step es una operación sobre el limiter después de adelantar el reloj.
+type step struct {
+	advance time.Duration
+	op      string // fail|check|succeed
+	key     string
+	want    time.Duration // espera devuelta por fail/check
+}
+
+var limiterCases = []struct {
+	name  string
+	steps []step
+}{
+	{"backoff", []step{
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", time.Minute},
+		{0, "fail", "a", 2 * time.Minute},
+		{0, "fail", "a", 4 * time.Minute},
+		{0, "fail", "a", 8 * time.Minute},
+		{0, "fail", "a", 10 * time.Minute},
+		{0, "fail", "a", 10 * time.Minute},
+		{0, "check", "a", 10 * time.Minute},
+		{0, "check", "b", 0},
+	}},
+	{"lock expires", []step{
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", time.Minute},
+		{40 * time.Second, "check", "a", 20 * time.Second},
+		{20 * time.Second, "check", "a", 0},
+		// dentro de la ventana el contador sigue: el próximo fallo bloquea más
+		{0, "fail", "a", 2 * time.Minute},
+	}},
+	{"window resets", []step{
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", time.Minute},
+		{time.Hour + time.Second, "check", "a", 0},
+		{0, "fail", "a", 0},
+	}},
+	{"success resets", []step{
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", time.Minute},
+		{0, "fail", "b", 0},
+		{0, "succeed", "a", 0},
+		{0, "check", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", 0},
+		{0, "fail", "a", time.Minute},
+	}},
+}
+
+// testStores: memoria siempre; Postgres si hay TEST_DATABASE_URL (una base con
+// las migraciones aplicadas). Los mismos casos corren contra los dos.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	stores := map[string]Store{"memory": NewMemoryStore()}
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Log("TEST_DATABASE_URL not set: skipping PostgresStore")
+		return stores
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	stores["postgres"] = &PostgresStore{DB: pool}
+	return stores
+}
+
+// uniqueKey evita chocar con claves de otra corrida en la misma base.
+func uniqueKey(t *testing.T, key string) string {
+	return "test:" + t.Name() + ":" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":" + key
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	for storeName, store := range testStores(t) {
+		for _, c := range limiterCases {
+			t.Run(storeName+"/"+c.name, func(t *testing.T) {
+				// Postgres guarda microsegundos: el reloj no lleva más precisión.
+				now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+				l := &Limiter{Store: store, Policy: testPolicy, Now: func() time.Time { return now }}
+				keys := map[string]string{}
+				key := func(k string) string {
+					if keys[k] == "" {
+						keys[k] = uniqueKey(t, k)
+						t.Cleanup(func() { store.Reset(ctx, keys[k]) })
+					}
+					return keys[k]
+				}
+
+				for i, s := range c.steps {
+					now = now.Add(s.advance)
+					var got time.Duration
+					var err error
+					switch s.op {
+					case "fail":
+						got, err = l.Fail(ctx, key(s.key))
+					case "check":
+						got, err = l.Check(ctx, key(s.key))
+					case "succeed":
+						err = l.Succeed(ctx, key(s.key))
+					}
+					if err != nil {
+						t.Fatalf("step %d (%s %s): %v", i, s.op, s.key, err)
+					}
+					if got != s.want {
+						t.Fatalf("step %d (%s %s): wait %v, want %v", i, s.op, s.key, got, s.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Prune borra lo viejo sin bloqueo vigente; lo reciente y lo bloqueado quedan.
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	for storeName, store := range testStores(t) {
+		t.Run(storeName, func(t *testing.T) {
+			now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+			long := testPolicy
+			long.BaseDelay, long.MaxDelay = time.Hour, 4*time.Hour
+			old := &Limiter{Store: store, Policy: testPolicy, Now: func() time.Time { return now }}
+			locked := &Limiter{Store: store, Policy: long, Now: func() time.Time { return now }}
+
+			stale, lockedKey, recent := uniqueKey(t, "stale"), uniqueKey(t, "locked"), uniqueKey(t, "recent")
+			for _, k := range []string{stale, lockedKey, recent} {
+				t.Cleanup(func() { store.Reset(ctx, k) })
+			}
+
+			if _, err := old.Fail(ctx, stale); err != nil {
+				t.Fatal(err)
+			}
+			// 3 libres y después 1h, 2h, 4h: queda bloqueada 4h
+			for i := 0; i < 6; i++ {
+				if _, err := locked.Fail(ctx, lockedKey); err != nil {
+					t.Fatal(err)
+				}
+			}
+			now = now.Add(2 * time.Hour)
+			if _, err := old.Fail(ctx, recent); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := old.Prune(ctx); err != nil {
+				t.Fatal(err)
+			}
+			for k, wantGone := range map[string]bool{stale: true, lockedKey: false, recent: false} {
+				st, err := store.Get(ctx, k)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if gone := st.Failures == 0; gone != wantGone {
+					t.Errorf("%s: failures %d after prune, want pruned=%v", k, st.Failures, wantGone)
+				}
+			}
+		})
+	}
+}